@@ -48,7 +48,9 @@ func All() []analysis.Analyzer {
 		&virtualservice.DestinationHostAnalyzer{},
 		&virtualservice.DestinationRuleAnalyzer{},
 		&virtualservice.GatewayAnalyzer{},
+		&virtualservice.ProtocolRouteAnalyzer{},
 		&virtualservice.RegexAnalyzer{},
+		&virtualservice.UDPRouteAnalyzer{},
 	}
 
 	analyzers = append(analyzers, schema.AllValidationAnalyzers()...)
@@ -274,6 +274,22 @@ var testGrid = []testCase{
 			{msg.ReferencedResourceNotFound, "VirtualService httpbin-bogus"},
 		},
 	},
+	{
+		name:       "virtualServiceProtocolRoutes",
+		inputFiles: []string{"testdata/virtualservice_protocolroutes.yaml"},
+		analyzer:   &virtualservice.ProtocolRouteAnalyzer{},
+		expected: []message{
+			{msg.VirtualServiceIgnoredRouteFields, "VirtualService users-retries.default"},
+		},
+	},
+	{
+		name:       "virtualServiceUDPRoutes",
+		inputFiles: []string{"testdata/virtualservice_udproutes.yaml"},
+		analyzer:   &virtualservice.UDPRouteAnalyzer{},
+		expected: []message{
+			{msg.VirtualServiceIgnoredUDPDestinations, "VirtualService dns-weighted.default"},
+		},
+	},
 	{
 		name:       "serviceMultipleDeployments",
 		inputFiles: []string{"testdata/deployment-multi-service.yaml"},
@@ -23,6 +23,7 @@ import (
 	"istio.io/istio/pkg/config/resource"
 	"istio.io/istio/pkg/config/schema/collection"
 	"istio.io/istio/pkg/config/schema/collections"
+	"istio.io/istio/pkg/config/validation"
 )
 
 // ValidationAnalyzer runs schema validation as an analyzer and reports any violations as messages
@@ -60,7 +61,8 @@ func (a *ValidationAnalyzer) Analyze(ctx analysis.Context) {
 		ns := r.Metadata.FullName.Namespace
 		name := r.Metadata.FullName.Name
 
-		err := a.s.Resource().ValidateProto(string(name), string(ns), r.Message)
+		err := multierror.Append(a.s.Resource().ValidateProto(string(name), string(ns), r.Message),
+			validation.ValidateAnnotations(a.s.Resource().Kind(), r.Metadata.Annotations, r.Message)).ErrorOrNil()
 		if err != nil {
 			if multiErr, ok := err.(*multierror.Error); ok {
 				for _, err := range multiErr.WrappedErrors() {
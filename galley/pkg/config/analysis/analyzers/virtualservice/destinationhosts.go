@@ -25,6 +25,7 @@ import (
 	"istio.io/istio/galley/pkg/config/analysis"
 	"istio.io/istio/galley/pkg/config/analysis/analyzers/util"
 	"istio.io/istio/galley/pkg/config/analysis/msg"
+	"istio.io/istio/pkg/config/kube"
 	"istio.io/istio/pkg/config/resource"
 	"istio.io/istio/pkg/config/schema/collection"
 	"istio.io/istio/pkg/config/schema/collections"
@@ -149,7 +150,7 @@ func initServiceEntryHostMap(ctx analysis.Context) map[util.ScopedFqdn]*v1alpha3
 			ports = append(ports, &v1alpha3.Port{
 				Number:   uint32(p.Port),
 				Name:     p.Name,
-				Protocol: string(p.Protocol),
+				Protocol: string(kube.ConvertProtocol(p.Port, p.Name, p.Protocol, p.AppProtocol)),
 			})
 		}
 		host := util.ConvertHostToFQDN(r.Metadata.FullName.Namespace, r.Metadata.FullName.Name.String())
@@ -0,0 +1,130 @@
+// Copyright 2020 Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package virtualservice
+
+import (
+	"fmt"
+	"strings"
+
+	"istio.io/api/networking/v1alpha3"
+
+	"istio.io/istio/galley/pkg/config/analysis"
+	"istio.io/istio/galley/pkg/config/analysis/analyzers/util"
+	"istio.io/istio/galley/pkg/config/analysis/msg"
+	"istio.io/istio/pilot/pkg/networking/core/v1alpha3/route"
+	"istio.io/istio/pkg/config/constants"
+	"istio.io/istio/pkg/config/protocol"
+	"istio.io/istio/pkg/config/resource"
+	"istio.io/istio/pkg/config/schema/collection"
+	"istio.io/istio/pkg/config/schema/collections"
+)
+
+// ProtocolRouteAnalyzer checks the HTTP routes of virtual services applied to the Thrift and Redis ports of
+// their hosts, which ignore the HTTP features the protocol proxies do not support.
+type ProtocolRouteAnalyzer struct{}
+
+var _ analysis.Analyzer = &ProtocolRouteAnalyzer{}
+
+// Metadata implements Analyzer
+func (a *ProtocolRouteAnalyzer) Metadata() analysis.Metadata {
+	return analysis.Metadata{
+		Name:        "virtualservice.ProtocolRouteAnalyzer",
+		Description: "Checks the HTTP routes applied to Thrift and Redis ports",
+		Inputs: collection.Names{
+			collections.IstioNetworkingV1Alpha3Serviceentries.Name(),
+			collections.IstioNetworkingV1Alpha3Virtualservices.Name(),
+			collections.K8SCoreV1Services.Name(),
+		},
+	}
+}
+
+// Analyze implements Analyzer
+func (a *ProtocolRouteAnalyzer) Analyze(ctx analysis.Context) {
+	serviceEntryHosts := initServiceEntryHostMap(ctx)
+
+	ctx.ForEach(collections.IstioNetworkingV1Alpha3Virtualservices.Name(), func(r *resource.Instance) bool {
+		a.analyzeVirtualService(r, ctx, serviceEntryHosts)
+		return true
+	})
+}
+
+func (a *ProtocolRouteAnalyzer) analyzeVirtualService(r *resource.Instance, ctx analysis.Context,
+	serviceEntryHosts map[util.ScopedFqdn]*v1alpha3.ServiceEntry) {
+
+	vs := r.Message.(*v1alpha3.VirtualService)
+
+	// The protocol routes are only built for sidecars.
+	if len(vs.GetGateways()) > 0 && !contains(vs.GetGateways(), constants.IstioMeshGateway) {
+		return
+	}
+
+	for _, h := range vs.GetHosts() {
+		s := getDestinationHost(r.Metadata.FullName.Namespace, h, serviceEntryHosts)
+		if s == nil {
+			continue
+		}
+		for _, p := range s.GetPorts() {
+			var ignoredFields func(*v1alpha3.HTTPRoute) []string
+			switch protocol.Parse(p.GetProtocol()) {
+			case protocol.Thrift:
+				ignoredFields = route.ThriftIgnoredFields
+			case protocol.Redis:
+				ignoredFields = route.RedisIgnoredFields
+			default:
+				continue
+			}
+			for i, http := range vs.GetHttp() {
+				if !appliesToPort(http, p.GetNumber()) {
+					continue
+				}
+				if fields := ignoredFields(http); len(fields) > 0 {
+					ctx.Report(collections.IstioNetworkingV1Alpha3Virtualservices.Name(),
+						msg.NewVirtualServiceIgnoredRouteFields(r, routeName(http, i), p.GetProtocol(), int(p.GetNumber()), h,
+							strings.Join(fields, ", ")))
+				}
+			}
+		}
+	}
+}
+
+// appliesToPort checks if an HTTP route applies to the port, which is the case if it has a match
+// without port, or for the port.
+func appliesToPort(http *v1alpha3.HTTPRoute, port uint32) bool {
+	if len(http.GetMatch()) == 0 {
+		return true
+	}
+	for _, m := range http.GetMatch() {
+		if m.GetPort() == 0 || m.GetPort() == port {
+			return true
+		}
+	}
+	return false
+}
+
+func routeName(http *v1alpha3.HTTPRoute, i int) string {
+	if http.GetName() != "" {
+		return fmt.Sprintf("%q", http.GetName())
+	}
+	return fmt.Sprintf("http[%d]", i)
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
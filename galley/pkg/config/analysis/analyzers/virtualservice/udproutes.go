@@ -0,0 +1,116 @@
+// Copyright 2020 Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package virtualservice
+
+import (
+	"fmt"
+	"strings"
+
+	"istio.io/api/networking/v1alpha3"
+
+	"istio.io/istio/galley/pkg/config/analysis"
+	"istio.io/istio/galley/pkg/config/analysis/analyzers/util"
+	"istio.io/istio/galley/pkg/config/analysis/msg"
+	"istio.io/istio/pkg/config/protocol"
+	"istio.io/istio/pkg/config/resource"
+	"istio.io/istio/pkg/config/schema/collection"
+	"istio.io/istio/pkg/config/schema/collections"
+)
+
+// UDPRouteAnalyzer checks the TCP routes of virtual services applied to the UDP servers of their gateways,
+// which only forward the datagrams to the default cluster of the first destination of the route.
+type UDPRouteAnalyzer struct{}
+
+var _ analysis.Analyzer = &UDPRouteAnalyzer{}
+
+// Metadata implements Analyzer
+func (a *UDPRouteAnalyzer) Metadata() analysis.Metadata {
+	return analysis.Metadata{
+		Name:        "virtualservice.UDPRouteAnalyzer",
+		Description: "Checks the TCP routes applied to UDP gateway servers",
+		Inputs: collection.Names{
+			collections.IstioNetworkingV1Alpha3Gateways.Name(),
+			collections.IstioNetworkingV1Alpha3Virtualservices.Name(),
+		},
+	}
+}
+
+// Analyze implements Analyzer
+func (a *UDPRouteAnalyzer) Analyze(ctx analysis.Context) {
+	ctx.ForEach(collections.IstioNetworkingV1Alpha3Virtualservices.Name(), func(r *resource.Instance) bool {
+		a.analyzeVirtualService(r, ctx)
+		return true
+	})
+}
+
+func (a *UDPRouteAnalyzer) analyzeVirtualService(r *resource.Instance, ctx analysis.Context) {
+	vs := r.Message.(*v1alpha3.VirtualService)
+
+	vsNs := r.Metadata.FullName.Namespace
+	for _, gwName := range vs.GetGateways() {
+		if gwName == util.MeshGateway {
+			continue
+		}
+		gw := ctx.Find(collections.IstioNetworkingV1Alpha3Gateways.Name(), resource.NewShortOrFullName(vsNs, gwName))
+		if gw == nil {
+			continue
+		}
+		for _, server := range gw.Message.(*v1alpha3.Gateway).GetServers() {
+			if protocol.Parse(server.GetPort().GetProtocol()) != protocol.UDP {
+				continue
+			}
+			port := server.GetPort().GetNumber()
+			for i, tcp := range vs.GetTcp() {
+				if !tcpAppliesToPort(tcp, port) {
+					continue
+				}
+				if ignored := udpIgnoredDestinations(tcp); len(ignored) > 0 {
+					ctx.Report(collections.IstioNetworkingV1Alpha3Virtualservices.Name(),
+						msg.NewVirtualServiceIgnoredUDPDestinations(r, fmt.Sprintf("tcp[%d]", i), int(port), gwName,
+							strings.Join(ignored, ", ")))
+				}
+			}
+		}
+	}
+}
+
+// tcpAppliesToPort checks if a TCP route applies to the port, which is the case if it has a match
+// without port, or for the port.
+func tcpAppliesToPort(tcp *v1alpha3.TCPRoute, port uint32) bool {
+	if len(tcp.GetMatch()) == 0 {
+		return true
+	}
+	for _, m := range tcp.GetMatch() {
+		if m.GetPort() == 0 || m.GetPort() == port {
+			return true
+		}
+	}
+	return false
+}
+
+// udpIgnoredDestinations returns the parts of the destinations of a TCP route that a UDP gateway server ignores.
+func udpIgnoredDestinations(tcp *v1alpha3.TCPRoute) []string {
+	var ignored []string
+	for i, route := range tcp.GetRoute() {
+		if i > 0 {
+			ignored = append(ignored, fmt.Sprintf("destination %s", route.GetDestination().GetHost()))
+			continue
+		}
+		if subset := route.GetDestination().GetSubset(); subset != "" {
+			ignored = append(ignored, fmt.Sprintf("subset %s", subset))
+		}
+	}
+	return ignored
+}
@@ -116,6 +116,14 @@ var (
 	// InvalidAnnotation defines a diag.MessageType for message "InvalidAnnotation".
 	// Description: An Istio annotation that is not valid
 	InvalidAnnotation = diag.NewMessageType(diag.Warning, "IST0125", "Invalid annotation %s: %s")
+
+	// VirtualServiceIgnoredRouteFields defines a diag.MessageType for message "VirtualServiceIgnoredRouteFields".
+	// Description: An HTTP route of a virtual service uses fields that have no equivalent for the protocol of the port it applies to.
+	VirtualServiceIgnoredRouteFields = diag.NewMessageType(diag.Warning, "IST0126", "The HTTP route %s is applied to the %s port %d of %s, which ignores: %s")
+
+	// VirtualServiceIgnoredUDPDestinations defines a diag.MessageType for message "VirtualServiceIgnoredUDPDestinations".
+	// Description: A TCP route of a virtual service applied to a UDP gateway server has destinations that are ignored.
+	VirtualServiceIgnoredUDPDestinations = diag.NewMessageType(diag.Warning, "IST0127", "The TCP route %s is applied to the UDP port %d of gateway %s, which ignores: %s")
 )
 
 // All returns a list of all known message types.
@@ -148,6 +156,8 @@ func All() []*diag.MessageType {
 		NamespaceMultipleInjectionLabels,
 		NamespaceInvalidInjectorRevision,
 		InvalidAnnotation,
+		VirtualServiceIgnoredRouteFields,
+		VirtualServiceIgnoredUDPDestinations,
 	}
 }
 
@@ -418,3 +428,28 @@ func NewInvalidAnnotation(r *resource.Instance, annotation string, problem strin
 		problem,
 	)
 }
+
+// NewVirtualServiceIgnoredRouteFields returns a new diag.Message based on VirtualServiceIgnoredRouteFields.
+func NewVirtualServiceIgnoredRouteFields(r *resource.Instance, route string, protocol string, port int, host string, fields string) diag.Message {
+	return diag.NewMessage(
+		VirtualServiceIgnoredRouteFields,
+		r,
+		route,
+		protocol,
+		port,
+		host,
+		fields,
+	)
+}
+
+// NewVirtualServiceIgnoredUDPDestinations returns a new diag.Message based on VirtualServiceIgnoredUDPDestinations.
+func NewVirtualServiceIgnoredUDPDestinations(r *resource.Instance, route string, port int, gateway string, ignored string) diag.Message {
+	return diag.NewMessage(
+		VirtualServiceIgnoredUDPDestinations,
+		r,
+		route,
+		port,
+		gateway,
+		ignored,
+	)
+}
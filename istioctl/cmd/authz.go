@@ -18,6 +18,7 @@ import (
 	"fmt"
 	"io/ioutil"
 	"os"
+	"strings"
 
 	"github.com/spf13/cobra"
 
@@ -25,6 +26,9 @@ import (
 	"istio.io/istio/istioctl/pkg/kubernetes"
 	"istio.io/istio/istioctl/pkg/util/configdump"
 	"istio.io/istio/istioctl/pkg/util/handlers"
+	"istio.io/istio/pilot/pkg/config/kube/crd"
+	"istio.io/istio/pilot/pkg/model"
+	"istio.io/istio/pkg/config/schema/collections"
 	"istio.io/pkg/log"
 )
 
@@ -39,7 +43,9 @@ var (
 		Short: "Check Envoy config dump for authorization configuration.",
 		Long: `Check reads the Envoy config dump and checks the filter configuration
 related to authorization. For example, it shows whether or not the Envoy is configured
-with authorization and the rules used in the authorization.
+with authorization and the rules used in the authorization. The shadow rules, built from
+the dry-run policies (istio.io/dry-run annotation), are shown next to the enforced rules,
+with the action they would take on the requests they match.
 
 The Envoy config dump could be provided either by pod name or from a config dump file
 (the whole output of http://localhost:15000/config_dump of an Envoy instance).
@@ -135,6 +141,129 @@ func getConfigDumpFromPod(podName, podNamespace string) (*configdump.Wrapper, er
 	return envoyConfig, nil
 }
 
+func simulateCmd() *cobra.Command {
+	var (
+		policyFiles    []string
+		workloadLabels map[string]string
+		headers        []string
+		claims         []string
+		expect         string
+		mesh           authz.Mesh
+		req            = &authz.Request{}
+	)
+	cmd := &cobra.Command{
+		Use:   "simulate",
+		Short: "Simulate the authorization of a request, without a cluster.",
+		Long: `Simulate evaluates a synthetic request to a workload against the AuthorizationPolicy and
+PeerAuthentication resources of the given files, without a cluster. The policies are converted to Envoy
+filters by the same code as in pilot, and the request is evaluated against the HTTP filters as Envoy
+would. It prints the decision, and the policy and rule matched by each authorization filter.
+
+The JWT of the request, described by its claims, is assumed to be valid. A request delegated to an
+external authorizer by a CUSTOM policy is assumed to be allowed by it, and is then evaluated against the
+other policies: the decision is CUSTOM if they allow the request, DENY otherwise.
+
+THIS COMMAND IS STILL UNDER ACTIVE DEVELOPMENT AND NOT READY FOR PRODUCTION USE.
+`,
+		Example: `  # Simulate a DELETE request from the sleep service account to the httpbin workload:
+  istioctl x authz simulate -f policies.yaml -n foo --labels app=httpbin --port 8000 \
+    --source-principal cluster.local/ns/foo/sa/sleep --method DELETE --path /status/200
+
+  # Verify that a request without a JWT is denied, in CI:
+  istioctl x authz simulate -f policies.yaml -n foo --labels app=httpbin --expect DENY`,
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if len(policyFiles) == 0 {
+				return fmt.Errorf("expecting policy files")
+			}
+			var configs []model.Config
+			for _, file := range policyFiles {
+				data, err := ioutil.ReadFile(file)
+				if err != nil {
+					return fmt.Errorf("failed to read %s: %v", file, err)
+				}
+				parsed, _, err := crd.ParseInputs(string(data))
+				if err != nil {
+					return fmt.Errorf("failed to parse %s: %v", file, err)
+				}
+				for _, config := range parsed {
+					switch config.Type {
+					case collections.IstioSecurityV1Beta1Authorizationpolicies.Resource().Kind(),
+						collections.IstioSecurityV1Beta1Peerauthentications.Resource().Kind():
+						configs = append(configs, config)
+					}
+				}
+			}
+
+			var err error
+			if req.Headers, err = parseKeyValues(headers); err != nil {
+				return fmt.Errorf("invalid header: %v", err)
+			}
+			req.Claims = map[string][]string{}
+			for _, claim := range claims {
+				kv, err := parseKeyValues([]string{claim})
+				if err != nil {
+					return fmt.Errorf("invalid claim: %v", err)
+				}
+				for k, v := range kv {
+					req.Claims[k] = append(req.Claims[k], strings.Split(v, ",")...)
+				}
+			}
+
+			ns := handlers.HandleNamespace(namespace, defaultNamespace)
+			result, err := authz.Simulate(configs, mesh, ns, workloadLabels, req)
+			if err != nil {
+				return err
+			}
+			result.Print(cmd.OutOrStdout())
+			if expect != "" && !strings.EqualFold(expect, result.Decision) {
+				return fmt.Errorf("expected decision %s, got %s", strings.ToUpper(expect), result.Decision)
+			}
+			return nil
+		},
+	}
+
+	flags := cmd.PersistentFlags()
+	flags.StringSliceVarP(&policyFiles, "file", "f", nil,
+		"The YAML files with the AuthorizationPolicy and PeerAuthentication resources")
+	flags.StringToStringVarP(&workloadLabels, "labels", "l", nil, "The labels of the workload")
+	flags.StringVar(&mesh.RootNamespace, "root-namespace", "istio-system", "The root namespace of the mesh")
+	flags.StringVar(&mesh.TrustDomain, "trust-domain", authz.DefaultTrustDomain, "The trust domain of the mesh")
+	flags.StringSliceVar(&mesh.TrustDomainAliases, "trust-domain-aliases", nil, "The aliases of the trust domain of the mesh")
+	flags.Uint32Var(&req.Port, "port", 80, "The port of the workload")
+	flags.StringVar(&req.SourcePrincipal, "source-principal", "",
+		"The identity of the client, e.g. cluster.local/ns/foo/sa/sleep. Empty for a plaintext request")
+	flags.StringVar(&req.SourceNamespace, "source-namespace", "",
+		"The namespace of the client. The source principal defaults to its default service account")
+	flags.StringVar(&req.SourceIP, "source-ip", "", "The IP address of the client")
+	flags.StringVar(&req.DestinationIP, "destination-ip", "", "The IP address of the workload")
+	flags.StringVar(&req.Host, "host", "", "The host of the request")
+	flags.StringVar(&req.Method, "method", "GET", "The method of the request")
+	flags.StringVar(&req.Path, "path", "/", "The path of the request")
+	flags.StringArrayVar(&headers, "header", nil, "A header of the request, in the <name>=<value> form")
+	flags.StringVar(&req.RequestPrincipal, "request-principal", "",
+		"The principal of the JWT of the request, <iss>/<sub> of the claims by default")
+	flags.StringArrayVar(&claims, "claim", nil,
+		"A claim of the JWT of the request, in the <name>=<value>[,<value>] form")
+	flags.StringToStringVar(&mesh.ExtAuthzProviders, "ext-authz-providers", nil,
+		"The external authorizers of the CUSTOM policies, in the <name>=<url> form of the extAuthzProviders of the mesh config")
+	flags.StringVar(&expect, "expect", "", "Fail if the decision is not this one: ALLOW, DENY or CUSTOM")
+	return cmd
+}
+
+// parseKeyValues parses a list of <key>=<value>.
+func parseKeyValues(values []string) (map[string]string, error) {
+	out := map[string]string{}
+	for _, v := range values {
+		kv := strings.SplitN(v, "=", 2)
+		if len(kv) != 2 || kv[0] == "" {
+			return nil, fmt.Errorf("expected <name>=<value>, got %q", v)
+		}
+		out[kv[0]] = kv[1]
+	}
+	return out, nil
+}
+
 // AuthZ groups commands used for inspecting and interacting the authorization policy.
 // Note: this is still under active development and is not ready for real use.
 func AuthZ() *cobra.Command {
@@ -143,13 +272,18 @@ func AuthZ() *cobra.Command {
 		Short: "Inspect and interact with authorization policies",
 		Long: `Commands to inspect and interact with the authorization policies
   check - check Envoy config dump for authorization configuration
+  simulate - simulate the authorization of a request, without a cluster
 `,
 		Example: `  # Check Envoy authorization configuration for pod httpbin-88ddbcfdd-nt5jb:
   istioctl x authz check httpbin-88ddbcfdd-nt5jb
+
+  # Simulate a request to the httpbin workload against the policies of policies.yaml:
+  istioctl x authz simulate -f policies.yaml -n foo --labels app=httpbin --source-namespace bar
 `,
 	}
 
 	cmd.AddCommand(checkCmd)
+	cmd.AddCommand(simulateCmd())
 	return cmd
 }
 
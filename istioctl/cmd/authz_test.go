@@ -51,6 +51,11 @@ func TestAuthZCheck(t *testing.T) {
 			in:     "testdata/authz/productpage_config_dump.json",
 			golden: "testdata/authz/productpage.golden",
 		},
+		{
+			name:   "dry-run policies",
+			in:     "testdata/authz/httpbin_dry-run_config_dump.json",
+			golden: "testdata/authz/httpbin_dry-run.golden",
+		},
 	}
 
 	for _, c := range testCases {
@@ -58,3 +63,75 @@ func TestAuthZCheck(t *testing.T) {
 		runCommandWantOutput(command, c.golden, t)
 	}
 }
+
+func TestAuthZSimulate(t *testing.T) {
+	base := "experimental authz simulate -f testdata/authz/simulate-policies.yaml -n foo -l app=httpbin " +
+		"--ext-authz-providers opa=grpc://opa.istio-system.svc.cluster.local:9191 "
+	testCases := []struct {
+		name   string
+		args   string
+		golden string
+	}{
+		{
+			name:   "allowed",
+			args:   "--source-namespace foo --path /headers",
+			golden: "testdata/authz/simulate-allowed.golden",
+		},
+		{
+			name:   "denied",
+			args:   "--source-principal cluster.local/ns/foo/sa/sleep --method DELETE --expect deny",
+			golden: "testdata/authz/simulate-denied.golden",
+		},
+		{
+			name:   "plaintext",
+			args:   "--expect DENY",
+			golden: "testdata/authz/simulate-plaintext.golden",
+		},
+		{
+			name:   "claims",
+			args:   "--source-principal cluster.local/ns/bar/sa/admin --path /admin/users --claim groups=dev,admin",
+			golden: "testdata/authz/simulate-claims.golden",
+		},
+		{
+			name:   "principal",
+			args:   "--source-principal cluster.local/ns/bar/sa/sleep --path /sleep/headers --expect ALLOW",
+			golden: "testdata/authz/simulate-principal.golden",
+		},
+		{
+			name:   "principal-denied",
+			args:   "--source-principal cluster.local/ns/bar/sa/attacker --path /sleep/headers --expect DENY",
+			golden: "testdata/authz/simulate-principal-denied.golden",
+		},
+		{
+			name: "trust-domain",
+			args: "--trust-domain td1 --trust-domain-aliases cluster.local " +
+				"--source-principal td1/ns/bar/sa/sleep --path /sleep/headers --expect ALLOW",
+			golden: "testdata/authz/simulate-trust-domain.golden",
+		},
+		{
+			name:   "trust-domain-denied",
+			args:   "--trust-domain td1 --source-principal other-td/ns/bar/sa/sleep --path /sleep/headers --expect DENY",
+			golden: "testdata/authz/simulate-trust-domain-denied.golden",
+		},
+		{
+			name:   "custom",
+			args:   "--source-namespace foo --path /ext/check --expect CUSTOM",
+			golden: "testdata/authz/simulate-custom.golden",
+		},
+		{
+			name:   "custom-denied",
+			args:   "--source-namespace bar --path /ext/check --expect DENY",
+			golden: "testdata/authz/simulate-custom-denied.golden",
+		},
+	}
+
+	for _, c := range testCases {
+		t.Run(c.name, func(t *testing.T) {
+			runCommandWantOutput(base+c.args, c.golden, t)
+		})
+	}
+
+	if _, err := runCommand(base+"--source-namespace bar --expect ALLOW", t); err == nil {
+		t.Error("expected an error for an unexpected decision")
+	}
+}
@@ -23,6 +23,7 @@ import (
 	"strings"
 
 	envoy_api "github.com/envoyproxy/go-control-plane/envoy/api/v2"
+	envoy_api_cluster "github.com/envoyproxy/go-control-plane/envoy/api/v2/cluster"
 	envoy_api_core "github.com/envoyproxy/go-control-plane/envoy/api/v2/core"
 	envoy_api_route "github.com/envoyproxy/go-control-plane/envoy/api/v2/route"
 	rbac_http_filter "github.com/envoyproxy/go-control-plane/envoy/config/filter/http/rbac/v2"
@@ -677,18 +678,27 @@ func getIstioVirtualServiceNameForSvc(cd *configdump.Wrapper, svc v1.Service, po
 
 // getIstioVirtualServicePathForSvcFromRoute returns something like "/apis/networking/v1alpha3/namespaces/default/virtual-service/reviews"
 func getIstioVirtualServicePathForSvcFromRoute(cd *configdump.Wrapper, svc v1.Service, port int32) (string, error) {
+	route, err := getRouteForSvc(cd, svc, port)
+	if err != nil || route == nil {
+		return "", err
+	}
+	return getIstioConfig(route.Metadata)
+}
+
+// getRouteForSvc returns the first route to the service port, or nil if there is none
+func getRouteForSvc(cd *configdump.Wrapper, svc v1.Service, port int32) (*envoy_api_route.Route, error) {
 	sPort := strconv.Itoa(int(port))
 
 	// Routes know their destination Service name, namespace, and port, and the DR that configures them
 	rcd, err := cd.GetDynamicRouteDump(false)
 	if err != nil {
-		return "", err
+		return nil, err
 	}
 	for _, rcd := range rcd.DynamicRouteConfigs {
 		routeTyped := &envoy_api.RouteConfiguration{}
 		err = ptypes.UnmarshalAny(rcd.RouteConfig, routeTyped)
 		if err != nil {
-			return "", err
+			return nil, err
 		}
 		if routeTyped.Name != sPort && !strings.HasPrefix(routeTyped.Name, "http.") {
 			continue
@@ -697,12 +707,12 @@ func getIstioVirtualServicePathForSvcFromRoute(cd *configdump.Wrapper, svc v1.Se
 		for _, vh := range routeTyped.VirtualHosts {
 			for _, route := range vh.Routes {
 				if routeDestinationMatchesSvc(route, svc, vh, port) {
-					return getIstioConfig(route.Metadata)
+					return route, nil
 				}
 			}
 		}
 	}
-	return "", nil
+	return nil, nil
 }
 
 func mixerConfigMatches(ns string, name string, mixer *structpb.Struct, tmixer *any.Any) bool {
@@ -831,6 +841,21 @@ func getIstioDestinationRuleNameForSvc(cd *configdump.Wrapper, svc v1.Service, p
 
 // getIstioDestinationRulePathForSvc returns something like "/apis/networking/v1alpha3/namespaces/default/destination-rule/reviews"
 func getIstioDestinationRulePathForSvc(cd *configdump.Wrapper, svc v1.Service, port int32) (string, error) {
+	cluster, err := getOutboundClusterForSvc(cd, svc, port)
+	if err != nil || cluster == nil {
+		return "", err
+	}
+	metadata := cluster.Metadata
+	if metadata != nil {
+		istioConfig := asMyProtoValue(metadata.FilterMetadata["istio"]).
+			keyAsString("config")
+		return istioConfig, nil
+	}
+	return "", nil
+}
+
+// getOutboundClusterForSvc returns the outbound cluster of the service port, or nil if there is none
+func getOutboundClusterForSvc(cd *configdump.Wrapper, svc v1.Service, port int32) (*envoy_api.Cluster, error) {
 
 	svcHost := extendFQDN(fmt.Sprintf("%s.%s", svc.ObjectMeta.Name, svc.ObjectMeta.Namespace))
 	filter := istio_envoy_configdump.ClusterFilter{
@@ -843,26 +868,80 @@ func getIstioDestinationRulePathForSvc(cd *configdump.Wrapper, svc v1.Service, p
 
 	dump, err := cd.GetClusterConfigDump()
 	if err != nil {
-		return "", err
+		return nil, err
 	}
 
 	for _, dac := range dump.DynamicActiveClusters {
 		clusterTyped := &envoy_api.Cluster{}
 		err = ptypes.UnmarshalAny(dac.Cluster, clusterTyped)
 		if err != nil {
-			return "", err
+			return nil, err
 		}
 		if filter.Verify(clusterTyped) {
-			metadata := clusterTyped.Metadata
-			if metadata != nil {
-				istioConfig := asMyProtoValue(metadata.FilterMetadata["istio"]).
-					keyAsString("config")
-				return istioConfig, nil
+			return clusterTyped, nil
+		}
+	}
+
+	return nil, nil
+}
+
+// getRetryFactsForSvc describes the effective retry policy of the route to the service port, and the retry
+// budget of its cluster.
+func getRetryFactsForSvc(cd *configdump.Wrapper, svc v1.Service, port int32) []string {
+	facts := []string{}
+
+	route, err := getRouteForSvc(cd, svc, port)
+	if err == nil && route.GetRoute() != nil {
+		policy, hedge := route.GetRoute().RetryPolicy, route.GetRoute().HedgePolicy
+		if policy == nil {
+			facts = append(facts, "Retries disabled")
+		} else {
+			facts = append(facts, "Retry policy: "+renderRetryPolicy(policy, hedge))
+		}
+	}
+
+	cluster, err := getOutboundClusterForSvc(cd, svc, port)
+	if err == nil && cluster != nil {
+		for _, threshold := range cluster.CircuitBreakers.GetThresholds() {
+			if budget := threshold.RetryBudget; budget != nil {
+				facts = append(facts, "Retry budget: "+renderRetryBudget(budget))
 			}
 		}
 	}
 
-	return "", nil
+	return facts
+}
+
+func renderRetryPolicy(policy *envoy_api_route.RetryPolicy, hedge *envoy_api_route.HedgePolicy) string {
+	retryOn := []string{}
+	if policy.RetryOn != "" {
+		retryOn = append(retryOn, policy.RetryOn)
+	}
+	for _, code := range policy.RetriableStatusCodes {
+		retryOn = append(retryOn, strconv.Itoa(int(code)))
+	}
+
+	out := fmt.Sprintf("%d attempts on %s", policy.NumRetries.GetValue(), strings.Join(retryOn, ","))
+	if policy.PerTryTimeout != nil {
+		if d, err := ptypes.Duration(policy.PerTryTimeout); err == nil {
+			out += fmt.Sprintf(", per try timeout %v", d)
+		}
+	}
+	if policy.RetryPriority != nil {
+		out += ", retried in remote localities"
+	}
+	if hedge.GetHedgeOnPerTryTimeout() {
+		out += ", hedged on per try timeout"
+	}
+	return out
+}
+
+func renderRetryBudget(budget *envoy_api_cluster.CircuitBreakers_Thresholds_RetryBudget) string {
+	out := fmt.Sprintf("%g%% of active requests", budget.BudgetPercent.GetValue())
+	if budget.MinRetryConcurrency != nil {
+		out += fmt.Sprintf(", at least %d concurrent retries", budget.MinRetryConcurrency.GetValue())
+	}
+	return out
 }
 
 // TODO simplify this by showing for each matching Destination the negation of the previous HttpMatchRequest
@@ -1296,6 +1375,14 @@ func describePodServices(writer io.Writer, kubeClient istioctl_kubernetes.ExecCl
 				}
 			}
 
+			for _, fact := range getRetryFactsForSvc(&cd, svc, port.Port) {
+				if len(svc.Spec.Ports) > 1 {
+					// If there is more than one port, prefix each fact by the port it applies to
+					fmt.Fprintf(writer, "%d ", port.Port)
+				}
+				fmt.Fprintf(writer, "%s\n", fact)
+			}
+
 			policies, _ := getIstioRBACPolicies(&cd, port.Port)
 			if len(policies) > 0 {
 				if len(svc.Spec.Ports) > 1 {
@@ -19,6 +19,13 @@ import (
 	"fmt"
 	"strings"
 	"testing"
+	"time"
+
+	envoy_api_cluster "github.com/envoyproxy/go-control-plane/envoy/api/v2/cluster"
+	envoy_api_route "github.com/envoyproxy/go-control-plane/envoy/api/v2/route"
+	envoy_type "github.com/envoyproxy/go-control-plane/envoy/type"
+	"github.com/golang/protobuf/ptypes"
+	"github.com/golang/protobuf/ptypes/wrappers"
 
 	coreV1 "k8s.io/api/core/v1"
 	metaV1 "k8s.io/apimachinery/pkg/apis/meta/v1"
@@ -592,6 +599,7 @@ Service: ratings
 DestinationRule: ratings for "ratings"
    Matching subsets: v1
    Traffic Policy TLS Mode: ISTIO_MUTUAL
+Retry policy: 2 attempts on connect-failure,refused-stream,unavailable,cancelled,resource-exhausted,retriable-status-codes,503
 RBAC policies: ratings-reader
 `,
 		},
@@ -607,6 +615,7 @@ Service: productpage
    Port:  9080/auto-detect targets pod port 9080
 DestinationRule: productpage for "productpage"
    No Traffic Policy
+Retry policy: 2 attempts on connect-failure,refused-stream,unavailable,cancelled,resource-exhausted,retriable-status-codes,503
 
 
 Exposed on Ingress Gateway http://10.1.2.3
@@ -627,6 +636,7 @@ Service: ratings
 DestinationRule: ratings for "ratings"
    Matching subsets: v1
    Traffic Policy TLS Mode: ISTIO_MUTUAL
+Retry policy: 2 attempts on connect-failure,refused-stream,unavailable,cancelled,resource-exhausted,retriable-status-codes,503
 RBAC policies: ratings-reader
 `,
 		},
@@ -645,6 +655,7 @@ RBAC policies: ratings-reader
 DestinationRule: ratings.bookinfo for "ratings"
    Matching subsets: v1
    Traffic Policy TLS Mode: ISTIO_MUTUAL
+Retry policy: 2 attempts on connect-failure,refused-stream,unavailable,cancelled,resource-exhausted,retriable-status-codes,503
 RBAC policies: ratings-reader
 `,
 		},
@@ -660,6 +671,7 @@ Service: productpage
    Port:  9080/auto-detect targets pod port 9080
 DestinationRule: productpage for "productpage"
    No Traffic Policy
+Retry policy: 2 attempts on connect-failure,refused-stream,unavailable,cancelled,resource-exhausted,retriable-status-codes,503
 
 
 Exposed on Ingress Gateway http://10.1.2.3:7080
@@ -754,6 +766,7 @@ Service: productpage
    Port:  9080/auto-detect targets pod port 9080
 DestinationRule: productpage for "productpage"
    No Traffic Policy
+Retry policy: 2 attempts on connect-failure,refused-stream,unavailable,cancelled,resource-exhausted,retriable-status-codes,503
 
 
 Exposed on Ingress Gateway http://10.1.2.3
@@ -771,6 +784,7 @@ VirtualService: bookinfo
    Port:  9080/auto-detect targets pod port 9080
 DestinationRule: productpage for "productpage"
    No Traffic Policy
+Retry policy: 2 attempts on connect-failure,refused-stream,unavailable,cancelled,resource-exhausted,retriable-status-codes,503
 
 
 Exposed on Ingress Gateway http://10.1.2.3
@@ -795,3 +809,30 @@ func mockInterfaceFactoryGenerator(k8sConfigs []runtime.Object) func(kubeconfig
 
 	return outFactory
 }
+
+func TestRenderRetryPolicy(t *testing.T) {
+	policy := &envoy_api_route.RetryPolicy{
+		RetryOn:              "gateway-error,retriable-status-codes",
+		NumRetries:           &wrappers.UInt32Value{Value: 3},
+		PerTryTimeout:        ptypes.DurationProto(2 * time.Second),
+		RetriableStatusCodes: []uint32{503},
+	}
+	want := "3 attempts on gateway-error,retriable-status-codes,503, per try timeout 2s"
+	if got := renderRetryPolicy(policy, nil); got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+
+	hedge := &envoy_api_route.HedgePolicy{HedgeOnPerTryTimeout: true}
+	if got := renderRetryPolicy(policy, hedge); got != want+", hedged on per try timeout" {
+		t.Errorf("got %q, want the hedge policy", got)
+	}
+
+	budget := &envoy_api_cluster.CircuitBreakers_Thresholds_RetryBudget{
+		BudgetPercent:       &envoy_type.Percent{Value: 12.5},
+		MinRetryConcurrency: &wrappers.UInt32Value{Value: 3},
+	}
+	want = "12.5% of active requests, at least 3 concurrent retries"
+	if got := renderRetryBudget(budget); got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
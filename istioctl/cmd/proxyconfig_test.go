@@ -161,15 +161,15 @@ default           Cert Chain     ACTIVE      true           17232678821166591831
 		{ // endpoint valid
 			execClientConfig: endpointConfig,
 			args:             strings.Split("proxy-config endpoint details-v1-5b7f94f9bc-wp5tb --port=15014", " "),
-			expectedOutput: `ENDPOINT              STATUS        OUTLIER CHECK     CLUSTER
-172.17.0.14:15014     UNHEALTHY     OK                outbound|15014||istio-policy.istio-system.svc.cluster.local
+			expectedOutput: `ENDPOINT              STATUS        OUTLIER CHECK     PRIORITY     CLUSTER
+172.17.0.14:15014     UNHEALTHY     OK                0            outbound|15014||istio-policy.istio-system.svc.cluster.local
 `,
 		},
 		{ // endpoint status filter
 			execClientConfig: endpointConfig,
 			args:             strings.Split("proxy-config endpoint details-v1-5b7f94f9bc-wp5tb --status=unhealthy", " "),
-			expectedOutput: `ENDPOINT              STATUS        OUTLIER CHECK     CLUSTER
-172.17.0.14:15014     UNHEALTHY     OK                outbound|15014||istio-policy.istio-system.svc.cluster.local
+			expectedOutput: `ENDPOINT              STATUS        OUTLIER CHECK     PRIORITY     CLUSTER
+172.17.0.14:15014     UNHEALTHY     OK                0            outbound|15014||istio-policy.istio-system.svc.cluster.local
 `,
 		},
 		{ // bootstrap no args
@@ -245,8 +245,8 @@ default           Cert Chain     ACTIVE      true           17232678821166591831
 		},
 		{ // endpoint using --file
 			args: strings.Split("proxy-config endpoint --file ../pkg/writer/envoy/clusters/testdata/clusters.json --port=15014", " "),
-			expectedOutput: `ENDPOINT              STATUS        OUTLIER CHECK     CLUSTER
-172.17.0.14:15014     UNHEALTHY     OK                outbound|15014||istio-policy.istio-system.svc.cluster.local
+			expectedOutput: `ENDPOINT              STATUS        OUTLIER CHECK     PRIORITY     CLUSTER
+172.17.0.14:15014     UNHEALTHY     OK                0            outbound|15014||istio-policy.istio-system.svc.cluster.local
 `,
 		},
 	}
@@ -17,6 +17,7 @@ package authz
 import (
 	"fmt"
 	"io"
+	"sort"
 	"strings"
 	"text/tabwriter"
 
@@ -29,6 +30,7 @@ import (
 	rbac_http_filter "github.com/envoyproxy/go-control-plane/envoy/config/filter/http/rbac/v2"
 	hcm_filter "github.com/envoyproxy/go-control-plane/envoy/config/filter/network/http_connection_manager/v2"
 	rbac_tcp_filter "github.com/envoyproxy/go-control-plane/envoy/config/filter/network/rbac/v2"
+	rbac_config "github.com/envoyproxy/go-control-plane/envoy/config/rbac/v2"
 	"github.com/envoyproxy/go-control-plane/pkg/conversion"
 	"github.com/golang/protobuf/proto"
 	"github.com/golang/protobuf/ptypes"
@@ -48,8 +50,8 @@ type filterChain struct {
 
 	authN    *authn_filter.FilterConfig
 	envoyJWT *envoy_jwt.JwtAuthentication
-	rbacHTTP *rbac_http_filter.RBAC
-	rbacTCP  *rbac_tcp_filter.RBAC
+	rbacHTTP []*rbac_http_filter.RBAC
+	rbacTCP  []*rbac_tcp_filter.RBAC
 
 	routeHTTP string
 }
@@ -141,7 +143,7 @@ func ParseListener(listener *v2.Listener) *ParsedListener {
 							if err := getHTTPFilterConfig(httpFilter, rbacHTTP); err != nil {
 								log.Errorf("found RBAC HTTP filter but failed to parse: %s", err)
 							} else {
-								parsedFC.rbacHTTP = rbacHTTP
+								parsedFC.rbacHTTP = append(parsedFC.rbacHTTP, rbacHTTP)
 							}
 						}
 					}
@@ -157,7 +159,7 @@ func ParseListener(listener *v2.Listener) *ParsedListener {
 				if err := getFilterConfig(filter, rbacTCP); err != nil {
 					log.Errorf("found RBAC network filter but failed to parse: %s", err)
 				} else {
-					parsedFC.rbacTCP = rbacTCP
+					parsedFC.rbacTCP = append(parsedFC.rbacTCP, rbacTCP)
 				}
 			}
 		}
@@ -212,28 +214,28 @@ func (l *ParsedListener) print(w io.Writer, printAll bool) {
 		}
 		mTLS := fmt.Sprintf("%s (%s)", mTLSEnabled, mTLSMode)
 
+		var rules, shadowRules []*rbac_config.RBAC
+		for _, rbac := range fc.rbacHTTP {
+			rules = append(rules, rbac.GetRules())
+			shadowRules = append(shadowRules, rbac.GetShadowRules())
+		}
+		for _, rbac := range fc.rbacTCP {
+			rules = append(rules, rbac.GetRules())
+			shadowRules = append(shadowRules, rbac.GetShadowRules())
+		}
 		rbacPolicy := "no (none)"
-		if fc.rbacHTTP != nil || fc.rbacTCP != nil {
-			rbacPolicy = "yes (none)"
-			rules := make([]string, 0)
-			for p := range fc.rbacHTTP.GetRules().GetPolicies() {
-				rules = append(rules, p)
-			}
-			for p := range fc.rbacTCP.GetRules().GetPolicies() {
-				rules = append(rules, p)
-			}
-			if len(rules) != 0 {
-				rbacPolicy = fmt.Sprintf("yes (%d: %s)", len(rules), strings.Join(rules, ", "))
-			}
+		if len(fc.rbacHTTP) != 0 || len(fc.rbacTCP) != 0 {
+			rbacPolicy = "yes " + printRules(rules, false)
 		}
+		shadowPolicy := printRules(shadowRules, true)
 
 		var err error
 		if printAll {
-			_, err = fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\t%s\n",
-				listenerName, fc.routeHTTP, sni, alpn, cert, mTLS, rbacPolicy)
+			_, err = fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\t%s\t%s\n",
+				listenerName, fc.routeHTTP, sni, alpn, cert, mTLS, rbacPolicy, shadowPolicy)
 		} else {
-			_, err = fmt.Fprintf(w, "%s\t%s\t%s\t%s\n",
-				listenerName, cert, mTLS, rbacPolicy)
+			_, err = fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\n",
+				listenerName, cert, mTLS, rbacPolicy, shadowPolicy)
 		}
 		if err != nil {
 			log.Errorf("failed to print output: %s", err)
@@ -242,11 +244,30 @@ func (l *ParsedListener) print(w io.Writer, printAll bool) {
 	}
 }
 
+// printRules returns the number and the names of the policies of the RBAC rules, sorted. With withAction,
+// each policy is followed by the action taken on the requests it matches, which is the result of shadow rules.
+func printRules(rules []*rbac_config.RBAC, withAction bool) string {
+	var names []string
+	for _, r := range rules {
+		for name := range r.GetPolicies() {
+			if withAction {
+				name = fmt.Sprintf("%s[%s]", name, r.GetAction())
+			}
+			names = append(names, name)
+		}
+	}
+	if len(names) == 0 {
+		return "(none)"
+	}
+	sort.Strings(names)
+	return fmt.Sprintf("(%d: %s)", len(names), strings.Join(names, ", "))
+}
+
 func PrintParsedListeners(writer io.Writer, parsedListeners []*ParsedListener, printAll bool) {
 	w := new(tabwriter.Writer).Init(writer, 0, 8, 5, ' ', 0)
-	col := "LISTENER[FilterChain]\tHTTP ROUTE\tSNI\tALPN\tCERTIFICATE\tmTLS (MODE)\tAuthZ (RULES)"
+	col := "LISTENER[FilterChain]\tHTTP ROUTE\tSNI\tALPN\tCERTIFICATE\tmTLS (MODE)\tAuthZ (RULES)\tAuthZ SHADOW (RULES)"
 	if !printAll {
-		col = "LISTENER[FilterChain]\tCERTIFICATE\tmTLS (MODE)\tAuthZ (RULES)"
+		col = "LISTENER[FilterChain]\tCERTIFICATE\tmTLS (MODE)\tAuthZ (RULES)\tAuthZ SHADOW (RULES)"
 	}
 
 	if _, err := fmt.Fprintln(w, col); err != nil {
@@ -0,0 +1,300 @@
+// Copyright 2020 Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package authz
+
+import (
+	"net"
+	"regexp"
+	"sort"
+	"strings"
+
+	core "github.com/envoyproxy/go-control-plane/envoy/api/v2/core"
+	route "github.com/envoyproxy/go-control-plane/envoy/api/v2/route"
+	rbac_config "github.com/envoyproxy/go-control-plane/envoy/config/rbac/v2"
+	envoy_matcher "github.com/envoyproxy/go-control-plane/envoy/type/matcher"
+
+	"istio.io/pkg/log"
+)
+
+// simulatedRequest is the view of a request that the Envoy RBAC filter matches.
+type simulatedRequest struct {
+	// principal is the peer identity, e.g. cluster.local/ns/foo/sa/sleep. It is empty without mutual TLS.
+	principal       string
+	sourceIP        net.IP
+	destinationIP   net.IP
+	destinationPort uint32
+	// headers are the request headers by lower-case name, including the :authority, :method and :path
+	// pseudo headers.
+	headers map[string]string
+	// metadata is the dynamic metadata of the filters, by filter name and key. The values are either strings
+	// or maps of lists of strings.
+	metadata map[string]map[string]interface{}
+}
+
+// evaluateRBAC returns whether the RBAC rules allow the request, and the policy matching the request, if
+// any. Like Envoy, the policies are matched in the order of their names.
+func evaluateRBAC(rules *rbac_config.RBAC, req *simulatedRequest) (bool, string) {
+	names := make([]string, 0, len(rules.GetPolicies()))
+	for name := range rules.GetPolicies() {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	matched := ""
+	for _, name := range names {
+		if matchPolicy(rules.Policies[name], req) {
+			matched = name
+			break
+		}
+	}
+	if rules.GetAction() == rbac_config.RBAC_DENY {
+		return matched == "", matched
+	}
+	return matched != "", matched
+}
+
+func matchPolicy(policy *rbac_config.Policy, req *simulatedRequest) bool {
+	permitted := false
+	for _, p := range policy.GetPermissions() {
+		if matchPermission(p, req) {
+			permitted = true
+			break
+		}
+	}
+	if !permitted {
+		return false
+	}
+	for _, p := range policy.GetPrincipals() {
+		if matchPrincipal(p, req) {
+			return true
+		}
+	}
+	return false
+}
+
+func matchPermission(p *rbac_config.Permission, req *simulatedRequest) bool {
+	switch r := p.GetRule().(type) {
+	case *rbac_config.Permission_Any:
+		return r.Any
+	case *rbac_config.Permission_AndRules:
+		for _, rule := range r.AndRules.GetRules() {
+			if !matchPermission(rule, req) {
+				return false
+			}
+		}
+		return true
+	case *rbac_config.Permission_OrRules:
+		for _, rule := range r.OrRules.GetRules() {
+			if matchPermission(rule, req) {
+				return true
+			}
+		}
+		return false
+	case *rbac_config.Permission_NotRule:
+		return !matchPermission(r.NotRule, req)
+	case *rbac_config.Permission_Header:
+		return matchHeader(r.Header, req.headers)
+	case *rbac_config.Permission_UrlPath:
+		return matchString(r.UrlPath.GetPath(), urlPath(req.headers[":path"]))
+	case *rbac_config.Permission_DestinationIp:
+		return matchCidr(r.DestinationIp, req.destinationIP)
+	case *rbac_config.Permission_DestinationPort:
+		return r.DestinationPort == req.destinationPort
+	case *rbac_config.Permission_Metadata:
+		return matchMetadata(r.Metadata, req.metadata)
+	case *rbac_config.Permission_RequestedServerName:
+		// The simulated requests have no SNI.
+		return matchString(r.RequestedServerName, "")
+	default:
+		log.Warnf("unsupported RBAC permission %v, assuming it does not match", p)
+		return false
+	}
+}
+
+func matchPrincipal(p *rbac_config.Principal, req *simulatedRequest) bool {
+	switch id := p.GetIdentifier().(type) {
+	case *rbac_config.Principal_Any:
+		return id.Any
+	case *rbac_config.Principal_AndIds:
+		for _, i := range id.AndIds.GetIds() {
+			if !matchPrincipal(i, req) {
+				return false
+			}
+		}
+		return true
+	case *rbac_config.Principal_OrIds:
+		for _, i := range id.OrIds.GetIds() {
+			if matchPrincipal(i, req) {
+				return true
+			}
+		}
+		return false
+	case *rbac_config.Principal_NotId:
+		return !matchPrincipal(id.NotId, req)
+	case *rbac_config.Principal_Authenticated_:
+		if req.principal == "" {
+			return false
+		}
+		if id.Authenticated.GetPrincipalName() == nil {
+			return true
+		}
+		return matchString(id.Authenticated.GetPrincipalName(), "spiffe://"+req.principal)
+	case *rbac_config.Principal_SourceIp:
+		return matchCidr(id.SourceIp, req.sourceIP)
+	case *rbac_config.Principal_Header:
+		return matchHeader(id.Header, req.headers)
+	case *rbac_config.Principal_UrlPath:
+		return matchString(id.UrlPath.GetPath(), urlPath(req.headers[":path"]))
+	case *rbac_config.Principal_Metadata:
+		return matchMetadata(id.Metadata, req.metadata)
+	default:
+		log.Warnf("unsupported RBAC principal %v, assuming it does not match", p)
+		return false
+	}
+}
+
+// urlPath returns the path of the :path header, without the query and the fragment.
+func urlPath(path string) string {
+	if i := strings.IndexAny(path, "?#"); i >= 0 {
+		return path[:i]
+	}
+	return path
+}
+
+func matchCidr(cidr *core.CidrRange, ip net.IP) bool {
+	if ip == nil {
+		return false
+	}
+	prefix := net.ParseIP(cidr.GetAddressPrefix())
+	if prefix == nil {
+		return false
+	}
+	bits := 8 * net.IPv6len
+	if prefix.To4() != nil {
+		prefix, bits = prefix.To4(), 8*net.IPv4len
+		ip = ip.To4()
+		if ip == nil {
+			return false
+		}
+	}
+	network := net.IPNet{IP: prefix, Mask: net.CIDRMask(int(cidr.GetPrefixLen().GetValue()), bits)}
+	return network.Contains(ip)
+}
+
+func matchHeader(h *route.HeaderMatcher, headers map[string]string) bool {
+	value, found := headers[strings.ToLower(h.GetName())]
+	if !found {
+		return h.GetInvertMatch() && h.GetPresentMatch()
+	}
+	match := false
+	switch m := h.GetHeaderMatchSpecifier().(type) {
+	case *route.HeaderMatcher_ExactMatch:
+		match = value == m.ExactMatch
+	case *route.HeaderMatcher_PrefixMatch:
+		match = strings.HasPrefix(value, m.PrefixMatch)
+	case *route.HeaderMatcher_SuffixMatch:
+		match = strings.HasSuffix(value, m.SuffixMatch)
+	case *route.HeaderMatcher_SafeRegexMatch:
+		match = matchRegex(m.SafeRegexMatch.GetRegex(), value)
+	case *route.HeaderMatcher_PresentMatch:
+		match = m.PresentMatch
+	case nil:
+		match = true
+	default:
+		log.Warnf("unsupported header matcher %v, assuming it does not match", h)
+	}
+	return match != h.GetInvertMatch()
+}
+
+func matchString(m *envoy_matcher.StringMatcher, value string) bool {
+	if m.GetIgnoreCase() {
+		value = strings.ToLower(value)
+	}
+	lower := func(s string) string {
+		if m.GetIgnoreCase() {
+			return strings.ToLower(s)
+		}
+		return s
+	}
+	switch p := m.GetMatchPattern().(type) {
+	case *envoy_matcher.StringMatcher_Exact:
+		return value == lower(p.Exact)
+	case *envoy_matcher.StringMatcher_Prefix:
+		return strings.HasPrefix(value, lower(p.Prefix))
+	case *envoy_matcher.StringMatcher_Suffix:
+		return strings.HasSuffix(value, lower(p.Suffix))
+	case *envoy_matcher.StringMatcher_SafeRegex:
+		return matchRegex(p.SafeRegex.GetRegex(), value)
+	default:
+		log.Warnf("unsupported string matcher %v, assuming it does not match", m)
+		return false
+	}
+}
+
+// matchRegex returns whether the regex matches the whole value, like the Envoy regex matchers.
+func matchRegex(regex, value string) bool {
+	re, err := regexp.Compile("^(?:" + regex + ")$")
+	if err != nil {
+		log.Warnf("invalid regex %q: %v", regex, err)
+		return false
+	}
+	return re.MatchString(value)
+}
+
+func matchMetadata(m *envoy_matcher.MetadataMatcher, metadata map[string]map[string]interface{}) bool {
+	var value interface{}
+	if fields, f := metadata[m.GetFilter()]; f {
+		value = fields
+	}
+	for _, segment := range m.GetPath() {
+		switch v := value.(type) {
+		case map[string]interface{}:
+			value = v[segment.GetKey()]
+		case map[string][]string:
+			if list, f := v[segment.GetKey()]; f {
+				value = list
+			} else {
+				value = nil
+			}
+		default:
+			value = nil
+		}
+	}
+	return matchValue(m.GetValue(), value)
+}
+
+func matchValue(m *envoy_matcher.ValueMatcher, value interface{}) bool {
+	switch p := m.GetMatchPattern().(type) {
+	case *envoy_matcher.ValueMatcher_PresentMatch:
+		return (value != nil) == p.PresentMatch
+	case *envoy_matcher.ValueMatcher_StringMatch:
+		s, ok := value.(string)
+		return ok && matchString(p.StringMatch, s)
+	case *envoy_matcher.ValueMatcher_ListMatch:
+		list, ok := value.([]string)
+		if !ok {
+			return false
+		}
+		for _, v := range list {
+			if matchValue(p.ListMatch.GetOneOf(), v) {
+				return true
+			}
+		}
+		return false
+	default:
+		log.Warnf("unsupported metadata value matcher %v, assuming it does not match", m)
+		return false
+	}
+}
@@ -0,0 +1,343 @@
+// Copyright 2020 Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package authz
+
+import (
+	"fmt"
+	"io"
+	"net"
+	"strings"
+	"text/tabwriter"
+
+	extauthz_http_filter "github.com/envoyproxy/go-control-plane/envoy/config/filter/http/ext_authz/v2"
+	rbac_http_filter "github.com/envoyproxy/go-control-plane/envoy/config/filter/http/rbac/v2"
+	"github.com/envoyproxy/go-control-plane/pkg/wellknown"
+
+	meshconfig "istio.io/api/mesh/v1alpha1"
+
+	"istio.io/istio/pilot/pkg/config/memory"
+	"istio.io/istio/pilot/pkg/model"
+	"istio.io/istio/pilot/pkg/security/authn/v1beta1"
+	"istio.io/istio/pilot/pkg/security/authz/builder"
+	authz_model "istio.io/istio/pilot/pkg/security/authz/model"
+	authn_model "istio.io/istio/pilot/pkg/security/model"
+	"istio.io/istio/pilot/pkg/security/trustdomain"
+	"istio.io/istio/pkg/config/labels"
+	"istio.io/istio/pkg/config/mesh"
+	"istio.io/istio/pkg/config/schema/collections"
+)
+
+// Decisions of a simulated request.
+const (
+	DecisionAllow = "ALLOW"
+	DecisionDeny  = "DENY"
+	// DecisionCustom is the decision on a request delegated to an external authorizer.
+	DecisionCustom = "CUSTOM"
+)
+
+// DefaultTrustDomain is the trust domain of the simulated mesh if none is set.
+const DefaultTrustDomain = "cluster.local"
+
+// Mesh is the mesh wide configuration of a simulation.
+type Mesh struct {
+	RootNamespace string
+	// TrustDomain is the trust domain of the mesh, DefaultTrustDomain if empty.
+	TrustDomain        string
+	TrustDomainAliases []string
+	// ExtAuthzProviders declares the external authorizers of the CUSTOM policies, like the extAuthzProviders
+	// extension of the mesh config. They are assumed to allow the requests.
+	ExtAuthzProviders map[string]string
+}
+
+// Request is a synthetic request to a workload, simulated by Simulate.
+type Request struct {
+	// SourcePrincipal is the identity of the client, e.g. cluster.local/ns/foo/sa/sleep. If empty, it is
+	// the default service account of SourceNamespace, or the request is a plaintext request.
+	SourcePrincipal string
+	SourceNamespace string
+	SourceIP        string
+	DestinationIP   string
+	// Port is the port of the workload.
+	Port   uint32
+	Host   string
+	Method string
+	Path   string
+	// Headers are the other request headers.
+	Headers map[string]string
+	// RequestPrincipal is the principal of the JWT of the request, <iss>/<sub> by default.
+	RequestPrincipal string
+	// Claims are the claims of the JWT of the request, which is assumed to be valid.
+	Claims map[string][]string
+}
+
+// SimulationStep is the result of an authorization filter on a simulated request.
+type SimulationStep struct {
+	Filter string
+	// Rules is "enforced" or "shadow".
+	Rules  string
+	Action string
+	Result string
+	Policy string
+}
+
+// SimulationResult is the decision on a simulated request.
+type SimulationResult struct {
+	Decision      string
+	Reason        string
+	MutualTLSMode model.MutualTLSMode
+	Steps         []SimulationStep
+	Notes         []string
+}
+
+// Simulate evaluates the request to the workload with the given labels in the namespace, against the
+// filters that pilot builds from the AuthorizationPolicy and PeerAuthentication configs in the given mesh.
+// Only the HTTP filters are simulated.
+func Simulate(configs []model.Config, m Mesh, namespace string, workloadLabels map[string]string,
+	req *Request) (*SimulationResult, error) {
+	rootNamespace := m.RootNamespace
+	trustDomain := m.TrustDomain
+	if trustDomain == "" {
+		trustDomain = DefaultTrustDomain
+	}
+	store := model.MakeIstioStore(memory.Make(collections.Pilot))
+	for _, config := range configs {
+		if config.Namespace == "" {
+			config.Namespace = namespace
+		}
+		if _, err := store.Create(config); err != nil {
+			return nil, fmt.Errorf("failed to add %s %s/%s: %v", config.Type, config.Namespace, config.Name, err)
+		}
+	}
+	env := &model.Environment{
+		IstioConfigStore: store,
+		Watcher: mesh.NewFixedWatcher(&meshconfig.MeshConfig{
+			RootNamespace:      rootNamespace,
+			TrustDomain:        trustDomain,
+			TrustDomainAliases: m.TrustDomainAliases,
+		}),
+	}
+	workload := labels.Collection{workloadLabels}
+
+	authnPolicies, err := model.GetAuthenticationPolicies(env)
+	if err != nil {
+		return nil, err
+	}
+	authzPolicies, err := model.GetAuthorizationPolicies(env)
+	if err != nil {
+		return nil, err
+	}
+
+	result := &SimulationResult{}
+	simulated, err := buildSimulatedRequest(req, trustDomain, result)
+	if err != nil {
+		return nil, err
+	}
+
+	applier := v1beta1.NewPolicyApplier(rootNamespace,
+		authnPolicies.GetJwtPoliciesForWorkload(namespace, workload),
+		authnPolicies.GetPeerAuthenticationsForWorkload(namespace, workload))
+	result.MutualTLSMode = applier.GetMutualTLSModeForPort(req.Port)
+	switch result.MutualTLSMode {
+	case model.MTLSStrict:
+		if simulated.principal == "" {
+			result.Decision, result.Reason = DecisionDeny, "plaintext request rejected by STRICT mutual TLS"
+			return result, nil
+		}
+	case model.MTLSDisable:
+		if simulated.principal != "" {
+			result.Notes = append(result.Notes, "mutual TLS is disabled, the source principal is ignored")
+			simulated.principal = ""
+		}
+	}
+	if simulated.principal != "" {
+		simulated.metadata[authn_model.AuthnFilterName]["source.principal"] = simulated.principal
+	}
+
+	// The principals of the policies are matched in the trust domain of the mesh and its aliases, like in pilot.
+	tdBundle := trustdomain.NewBundle(trustDomain, m.TrustDomainAliases)
+	b := builder.New(tdBundle, workload, namespace, authzPolicies, true, m.ExtAuthzProviders)
+	if b == nil {
+		result.Decision, result.Reason = DecisionAllow, "no authorization policy applies to the workload"
+		return result, nil
+	}
+	if err := evaluateHTTPFilters(b, simulated, result); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// buildSimulatedRequest returns the view of the request matched by the RBAC filters.
+func buildSimulatedRequest(req *Request, trustDomain string, result *SimulationResult) (*simulatedRequest, error) {
+	principal := req.SourcePrincipal
+	if req.SourceNamespace != "" {
+		if principal == "" {
+			principal = fmt.Sprintf("%s/ns/%s/sa/default", trustDomain, req.SourceNamespace)
+			result.Notes = append(result.Notes, "using the source principal "+principal)
+		} else if !strings.Contains(principal, "/ns/"+req.SourceNamespace+"/") {
+			return nil, fmt.Errorf("source principal %s is not in the source namespace %s", principal, req.SourceNamespace)
+		}
+	}
+
+	simulated := &simulatedRequest{
+		principal:       principal,
+		destinationPort: req.Port,
+		headers:         map[string]string{},
+		metadata:        map[string]map[string]interface{}{authn_model.AuthnFilterName: {}},
+	}
+	for name, ip := range map[string]string{"source": req.SourceIP, "destination": req.DestinationIP} {
+		if ip == "" {
+			continue
+		}
+		parsed := net.ParseIP(ip)
+		if parsed == nil {
+			return nil, fmt.Errorf("invalid %s IP %q", name, ip)
+		}
+		if name == "source" {
+			simulated.sourceIP = parsed
+		} else {
+			simulated.destinationIP = parsed
+		}
+	}
+
+	for k, v := range req.Headers {
+		simulated.headers[strings.ToLower(k)] = v
+	}
+	simulated.headers[":authority"] = req.Host
+	simulated.headers[":method"] = req.Method
+	simulated.headers[":path"] = req.Path
+
+	authn := simulated.metadata[authn_model.AuthnFilterName]
+	requestPrincipal := req.RequestPrincipal
+	if requestPrincipal == "" && len(req.Claims["iss"]) > 0 && len(req.Claims["sub"]) > 0 {
+		requestPrincipal = req.Claims["iss"][0] + "/" + req.Claims["sub"][0]
+	}
+	if requestPrincipal != "" {
+		authn["request.auth.principal"] = requestPrincipal
+	}
+	if aud := req.Claims["aud"]; len(aud) > 0 {
+		authn["request.auth.audiences"] = aud[0]
+	}
+	if azp := req.Claims["azp"]; len(azp) > 0 {
+		authn["request.auth.presenter"] = azp[0]
+	}
+	if len(req.Claims) > 0 {
+		authn["request.auth.claims"] = req.Claims
+	}
+	return simulated, nil
+}
+
+// evaluateHTTPFilters evaluates the request against the authorization HTTP filters, in order, like Envoy.
+// The requests delegated to an external authorizer are assumed to be allowed by it, and are then evaluated
+// against the next filters.
+func evaluateHTTPFilters(b *builder.Builder, req *simulatedRequest, result *SimulationResult) error {
+	// The reason of the delegation of the request to an external authorizer, if any.
+	delegated := ""
+	for _, filter := range b.BuildHTTP() {
+		switch filter.Name {
+		case authz_model.RBACHTTPFilterName:
+			config := &rbac_http_filter.RBAC{}
+			if err := getHTTPFilterConfig(filter, config); err != nil {
+				return fmt.Errorf("failed to parse RBAC filter: %v", err)
+			}
+			// The policy matched by the shadow rules, read by the next filter.
+			shadowPolicy := ""
+			if config.ShadowRules != nil {
+				allowed, policy := evaluateRBAC(config.ShadowRules, req)
+				result.Steps = append(result.Steps, newSimulationStep(filter.Name, "shadow",
+					config.ShadowRules.GetAction().String(), allowed, policy))
+				shadowPolicy = policy
+			}
+			if config.Rules != nil {
+				allowed, policy := evaluateRBAC(config.Rules, req)
+				result.Steps = append(result.Steps, newSimulationStep(filter.Name, "enforced",
+					config.Rules.GetAction().String(), allowed, policy))
+				if !allowed {
+					result.Decision = DecisionDeny
+					if policy != "" {
+						result.Reason = "denied by " + policy
+					} else {
+						result.Reason = "no ALLOW policy matched"
+					}
+					if delegated != "" {
+						result.Reason = delegated + ", then " + result.Reason
+					}
+					return nil
+				}
+			}
+			// Like Envoy, the matched policy of the previous shadow rules is kept if none matches.
+			if shadowPolicy != "" {
+				req.metadata[authz_model.RBACHTTPFilterName] = map[string]interface{}{
+					"shadow_effective_policy_id": shadowPolicy,
+				}
+			}
+		case wellknown.HTTPExternalAuthorization:
+			config := &extauthz_http_filter.ExtAuthz{}
+			if err := getHTTPFilterConfig(filter, config); err != nil {
+				return fmt.Errorf("failed to parse ext_authz filter: %v", err)
+			}
+			authorizer := config.GetGrpcService().GetEnvoyGrpc().GetClusterName()
+			if authorizer == "" {
+				authorizer = config.GetHttpService().GetServerUri().GetCluster()
+			}
+			policy, _ := req.metadata[authz_model.RBACHTTPFilterName]["shadow_effective_policy_id"].(string)
+			if policy != "" {
+				result.Steps = append(result.Steps, SimulationStep{
+					Filter: filter.Name, Rules: "enforced", Action: authorizer, Result: "delegated", Policy: policy})
+				delegated = fmt.Sprintf("delegated to the external authorizer %s by %s", authorizer, policy)
+				// Set by the external authorizer when it allows the request, read by the next filter.
+				req.headers[builder.ExtAuthzAllowedHeader] = "true"
+				continue
+			}
+			result.Steps = append(result.Steps, SimulationStep{
+				Filter: filter.Name, Rules: "enforced", Action: authorizer, Result: "allowed"})
+		}
+	}
+	result.Decision, result.Reason = DecisionAllow, "allowed by the authorization policies"
+	if delegated != "" {
+		result.Decision, result.Reason = DecisionCustom, delegated+", then allowed by the authorization policies"
+	}
+	return nil
+}
+
+func newSimulationStep(filter, rules, action string, allowed bool, policy string) SimulationStep {
+	step := SimulationStep{Filter: filter, Rules: rules, Action: action, Result: "denied", Policy: policy}
+	if allowed {
+		step.Result = "allowed"
+	}
+	return step
+}
+
+// Print prints the decision and the result of each authorization filter.
+func (r *SimulationResult) Print(writer io.Writer) {
+	_, _ = fmt.Fprintf(writer, "DECISION: %s (%s)\n", r.Decision, r.Reason)
+	_, _ = fmt.Fprintf(writer, "mTLS: %s\n", r.MutualTLSMode)
+	for _, note := range r.Notes {
+		_, _ = fmt.Fprintf(writer, "NOTE: %s\n", note)
+	}
+	if len(r.Steps) == 0 {
+		return
+	}
+
+	w := new(tabwriter.Writer).Init(writer, 0, 8, 5, ' ', 0)
+	_, _ = fmt.Fprintln(w, "FILTER\tRULES\tACTION\tRESULT\tPOLICY")
+	for _, s := range r.Steps {
+		policy := s.Policy
+		if policy == "" {
+			policy = "none"
+		}
+		_, _ = fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\n", s.Filter, s.Rules, s.Action, s.Result, policy)
+	}
+	_ = w.Flush()
+}
@@ -39,6 +39,7 @@ import (
 	"istio.io/istio/pkg/config/schema/collection"
 	"istio.io/istio/pkg/config/schema/collections"
 	"istio.io/istio/pkg/config/schema/resource"
+	"istio.io/istio/pkg/config/validation"
 	"istio.io/istio/pkg/util/gogoprotomarshal"
 
 	operator_istio "istio.io/istio/operator/pkg/apis/istio"
@@ -110,7 +111,10 @@ func (v *validator) validateResource(istioNamespace string, un *unstructured.Uns
 		if err = checkFields(un); err != nil {
 			return err
 		}
-		return schema.Resource().ValidateProto(obj.Name, obj.Namespace, obj.Spec)
+		if err = schema.Resource().ValidateProto(obj.Name, obj.Namespace, obj.Spec); err != nil {
+			return err
+		}
+		return validation.ValidateAnnotations(schema.Resource().Kind(), obj.Annotations, obj.Spec)
 	}
 
 	if v.mixerValidator != nil && un.GetAPIVersion() == mixerAPIVersion {
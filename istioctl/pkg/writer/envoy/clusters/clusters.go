@@ -51,6 +51,7 @@ type EndpointCluster struct {
 	cluster            string
 	status             core.HealthStatus
 	failedOutlierCheck bool
+	priority           uint32
 }
 
 // Prime loads the clusters output into the writer ready for printing
@@ -88,6 +89,11 @@ func retrieveFailedOutlierCheck(l *adminapi.HostStatus) bool {
 	return l.HealthStatus.GetFailedOutlierCheck()
 }
 
+// retrieveEndpointPriority returns the priority of the endpoint, which is its locality failover tier
+func retrieveEndpointPriority(l *adminapi.HostStatus) uint32 {
+	return l.GetPriority()
+}
+
 // Verify returns true if the passed host matches the filter fields
 func (e *EndpointFilter) Verify(host *adminapi.HostStatus, cluster string) bool {
 	if e.Address == "" && e.Port == 0 && e.Cluster == "" && e.Status == "" {
@@ -125,13 +131,14 @@ func (c *ConfigWriter) PrintEndpointsSummary(filter EndpointFilter) error {
 				port := retrieveEndpointPort(host)
 				status := retrieveEndpointStatus(host)
 				outlierCheck := retrieveFailedOutlierCheck(host)
-				clusterEndpoint = append(clusterEndpoint, EndpointCluster{addr, int(port), cluster.Name, status, outlierCheck})
+				priority := retrieveEndpointPriority(host)
+				clusterEndpoint = append(clusterEndpoint, EndpointCluster{addr, int(port), cluster.Name, status, outlierCheck, priority})
 			}
 		}
 	}
 
 	clusterEndpoint = retrieveSortedEndpointClusterSlice(clusterEndpoint)
-	fmt.Fprintln(w, "ENDPOINT\tSTATUS\tOUTLIER CHECK\tCLUSTER")
+	fmt.Fprintln(w, "ENDPOINT\tSTATUS\tOUTLIER CHECK\tPRIORITY\tCLUSTER")
 	for _, ce := range clusterEndpoint {
 		var endpoint string
 		if ce.port != 0 {
@@ -139,7 +146,8 @@ func (c *ConfigWriter) PrintEndpointsSummary(filter EndpointFilter) error {
 		} else {
 			endpoint = ce.address
 		}
-		fmt.Fprintf(w, "%v\t%v\t%v\t%v\n", endpoint, core.HealthStatus_name[int32(ce.status)], printFailedOutlierCheck(ce.failedOutlierCheck), ce.cluster)
+		fmt.Fprintf(w, "%v\t%v\t%v\t%v\t%v\n", endpoint, core.HealthStatus_name[int32(ce.status)],
+			printFailedOutlierCheck(ce.failedOutlierCheck), ce.priority, ce.cluster)
 	}
 
 	return w.Flush()
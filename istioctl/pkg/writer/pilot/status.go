@@ -87,10 +87,10 @@ func (s *StatusWriter) setupStatusPrint(statuses map[string][]byte) (*tabwriter.
 }
 
 func statusPrintln(w io.Writer, status *writerStatus) error {
-	clusterSynced := xdsStatus(status.ClusterSent, status.ClusterAcked)
-	listenerSynced := xdsStatus(status.ListenerSent, status.ListenerAcked)
-	routeSynced := xdsStatus(status.RouteSent, status.RouteAcked)
-	endpointSynced := xdsStatus(status.EndpointSent, status.EndpointAcked)
+	clusterSynced := xdsStatus(status.ClusterSent, status.ClusterAcked, status.ClusterNacked)
+	listenerSynced := xdsStatus(status.ListenerSent, status.ListenerAcked, status.ListenerNacked)
+	routeSynced := xdsStatus(status.RouteSent, status.RouteAcked, status.RouteNacked)
+	endpointSynced := xdsStatus(status.EndpointSent, status.EndpointAcked, status.EndpointNacked)
 	version := status.IstioVersion
 	if version == "" {
 		// If we can't find an Istio version (talking to a 1.1 pilot), fallback to the proxy version
@@ -103,13 +103,17 @@ func statusPrintln(w io.Writer, status *writerStatus) error {
 	return nil
 }
 
-func xdsStatus(sent, acked string) string {
+func xdsStatus(sent, acked, nacked string) string {
 	if sent == "" {
 		return "NOT SENT"
 	}
 	if sent == acked {
 		return "SYNCED"
 	}
+	// The proxy rejected the latest config, details are available from Pilot's /debug/nackz
+	if sent == nacked {
+		return "NACKED"
+	}
 	// acked will be empty string when there is never Acknowledged
 	if acked == "" {
 		return "STALE (Never Acknowledged)"
@@ -119,6 +119,14 @@ func TestStatusWriter_PrintSingle(t *testing.T) {
 			filterPod: "proxy2",
 			want:      "testdata/singleStatus.txt",
 		},
+		{
+			name: "prints rejected config",
+			input: map[string][]v2.SyncStatus{
+				"pilot2": statusInputNacked(),
+			},
+			filterPod: "proxy2",
+			want:      "testdata/singleStatusNacked.txt",
+		},
 		{
 			name: "fallback to proxy version",
 			input: map[string][]v2.SyncStatus{
@@ -195,6 +203,24 @@ func statusInput2() []v2.SyncStatus {
 	}
 }
 
+func statusInputNacked() []v2.SyncStatus {
+	return []v2.SyncStatus{
+		{
+			ProxyID:        "proxy2",
+			IstioVersion:   "1.1",
+			ClusterSent:    preDefinedNonce,
+			ClusterAcked:   newNonce(),
+			ListenerSent:   preDefinedNonce,
+			ListenerAcked:  newNonce(),
+			ListenerNacked: preDefinedNonce,
+			EndpointSent:   preDefinedNonce,
+			EndpointAcked:  preDefinedNonce,
+			RouteSent:      preDefinedNonce,
+			RouteAcked:     preDefinedNonce,
+		},
+	}
+}
+
 func statusInput3() []v2.SyncStatus {
 	return []v2.SyncStatus{
 		{
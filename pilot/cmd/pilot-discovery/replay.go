@@ -0,0 +1,110 @@
+// Copyright 2020 Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"strings"
+
+	"github.com/golang/protobuf/jsonpb"
+	"github.com/spf13/cobra"
+
+	"istio.io/istio/pilot/pkg/bootstrap"
+	v2 "istio.io/istio/pilot/pkg/proxy/envoy/v2"
+)
+
+var (
+	replayTypes = map[string]string{
+		"cds": v2.ClusterType,
+		"lds": v2.ListenerType,
+		"rds": v2.RouteType,
+		"eds": v2.EndpointType,
+	}
+
+	replayArgs = struct {
+		snapshot string
+		proxy    string
+		types    []string
+		plugins  []string
+	}{}
+
+	replayCmd = &cobra.Command{
+		Use:   "replay --snapshot <file> --proxy <proxy ID>",
+		Short: "Regenerates the xDS configuration of a proxy from a push snapshot",
+		Long: "Loads a snapshot exported by the /debug/push_snapshot endpoint and prints the discovery " +
+			"responses Pilot pushes to the proxy, without connecting to a cluster.",
+		Args: cobra.ExactArgs(0),
+		RunE: func(c *cobra.Command, args []string) error {
+			b, err := ioutil.ReadFile(replayArgs.snapshot)
+			if err != nil {
+				return err
+			}
+			snap := &v2.PushSnapshot{}
+			if err := json.Unmarshal(b, snap); err != nil {
+				return fmt.Errorf("failed to parse snapshot %s: %v", replayArgs.snapshot, err)
+			}
+			proxy := snap.Proxy(replayArgs.proxy)
+			if proxy == nil {
+				ids := make([]string, 0, len(snap.Proxies))
+				for _, p := range snap.Proxies {
+					ids = append(ids, p.ID)
+				}
+				return fmt.Errorf("proxy %q not found in snapshot, available: %s", replayArgs.proxy, strings.Join(ids, ", "))
+			}
+			typeURLs := make([]string, 0, len(replayArgs.types))
+			for _, t := range replayArgs.types {
+				typeURL, f := replayTypes[strings.ToLower(t)]
+				if !f {
+					return fmt.Errorf("unknown type %q, expected one of cds, lds, rds, eds", t)
+				}
+				typeURLs = append(typeURLs, typeURL)
+			}
+
+			s, err := v2.NewReplayServer(snap, replayArgs.plugins)
+			if err != nil {
+				return err
+			}
+			responses, err := s.Replay(snap, proxy, typeURLs)
+			if err != nil {
+				return err
+			}
+			jsonm := &jsonpb.Marshaler{Indent: "  "}
+			for _, res := range responses {
+				if err := jsonm.Marshal(c.OutOrStdout(), res); err != nil {
+					return err
+				}
+				_, _ = fmt.Fprintln(c.OutOrStdout())
+			}
+			return nil
+		},
+	}
+)
+
+func init() {
+	replayCmd.PersistentFlags().StringVar(&replayArgs.snapshot, "snapshot", "",
+		"File holding the snapshot, as exported by /debug/push_snapshot")
+	replayCmd.PersistentFlags().StringVar(&replayArgs.proxy, "proxy", "",
+		"ID of the proxy to generate the configuration for, for example productpage-v1-12345.default")
+	replayCmd.PersistentFlags().StringSliceVar(&replayArgs.types, "type", []string{"cds", "lds", "rds", "eds"},
+		"Comma separated list of the types to generate, in order")
+	replayCmd.PersistentFlags().StringSliceVar(&replayArgs.plugins, "plugins", bootstrap.DefaultPlugins,
+		"comma separated list of networking plugins to enable, as configured for the discovery service")
+	_ = replayCmd.MarkPersistentFlagRequired("snapshot")
+	_ = replayCmd.MarkPersistentFlagRequired("proxy")
+
+	rootCmd.AddCommand(replayCmd)
+}
@@ -92,6 +92,7 @@ func (s *Server) initConfigController(args *PilotArgs) error {
 		s.ConfigStores = append(s.ConfigStores, configController)
 		if features.EnableServiceApis {
 			s.ConfigStores = append(s.ConfigStores, gateway.NewController(s.kubeClient, configController))
+			s.initGatewayStatusController(args, configController)
 		}
 		if features.EnableAnalysis {
 			if err := s.initInprocessAnalysisController(args); err != nil {
@@ -354,6 +355,22 @@ func (s *Server) initStatusController(args *PilotArgs) {
 	s.EnvoyXdsServer.StatusReporter = s.statusReporter
 }
 
+// initGatewayStatusController writes the status of the Kubernetes gateway API resources from the leader.
+func (s *Server) initGatewayStatusController(args *PilotArgs, store model.ConfigStoreCache) {
+	// The controller is created before the store runs, to register its event handlers.
+	c := gateway.NewStatusController(store)
+	c.QPS = float32(features.StatusQPS)
+	c.Burst = features.StatusBurst
+	s.addTerminatingStartFunc(func(stop <-chan struct{}) error {
+		leaderelection.
+			NewLeaderElection(args.Namespace, args.PodName, leaderelection.GatewayStatusController, s.kubeClient).
+			AddRunFunction(func(stop <-chan struct{}) {
+				c.Start(s.kubeConfig, stop)
+			}).Run(stop)
+		return nil
+	})
+}
+
 func (s *Server) mcpController(
 	opts *mcp.Options,
 	conn *grpc.ClientConn,
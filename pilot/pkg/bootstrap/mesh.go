@@ -64,7 +64,7 @@ func (s *Server) initMeshConfiguration(args *PilotArgs, fileWatcher filewatcher.
 	}
 
 	// Config file either wasn't specified or failed to load - use a default mesh.
-	meshConfig, err := getMeshConfig(s.kubeClient, kubecontroller.IstioNamespace, kubecontroller.IstioConfigMap)
+	meshConfig, extensions, err := getMeshConfig(s.kubeClient, kubecontroller.IstioNamespace, kubecontroller.IstioConfigMap)
 	if err != nil {
 		log.Warnf("failed to read the default mesh configuration: %v, from the %s config map in the %s namespace",
 			err, kubecontroller.IstioConfigMap, kubecontroller.IstioNamespace)
@@ -76,7 +76,7 @@ func (s *Server) initMeshConfiguration(args *PilotArgs, fileWatcher filewatcher.
 		meshConfig.MixerCheckServer = args.Mesh.MixerAddress
 		meshConfig.MixerReportServer = args.Mesh.MixerAddress
 	}
-	s.environment.Watcher = mesh.NewFixedWatcher(meshConfig)
+	s.environment.Watcher = mesh.NewFixedWatcherWithExtensions(meshConfig, extensions)
 	return nil
 }
 
@@ -99,35 +99,39 @@ func (s *Server) initMeshNetworks(args *PilotArgs, fileWatcher filewatcher.FileW
 	}
 }
 
-// getMeshConfig fetches the ProxyMesh configuration from Kubernetes ConfigMap.
+// getMeshConfig fetches the ProxyMesh configuration and its extensions from Kubernetes ConfigMap.
 // Deprecated - does not watch !
-func getMeshConfig(kube kubernetes.Interface, namespace, name string) (*meshconfig.MeshConfig, error) {
+func getMeshConfig(kube kubernetes.Interface, namespace, name string) (*meshconfig.MeshConfig, *mesh.MeshExtensions, error) {
 	if kube == nil {
 		defaultMesh := mesh.DefaultMeshConfig()
-		return &defaultMesh, nil
+		return &defaultMesh, &mesh.MeshExtensions{}, nil
 	}
 
 	cfg, err := kube.CoreV1().ConfigMaps(namespace).Get(context.TODO(), name, metav1.GetOptions{})
 	if err != nil {
 		if errors.IsNotFound(err) {
 			defaultMesh := mesh.DefaultMeshConfig()
-			return &defaultMesh, nil
+			return &defaultMesh, &mesh.MeshExtensions{}, nil
 		}
-		return nil, err
+		return nil, nil, err
 	}
 
 	// values in the data are strings, while proto might use a different data type.
 	// therefore, we have to get a value by a key
 	cfgYaml, exists := cfg.Data[configMapKey]
 	if !exists {
-		return nil, fmt.Errorf("missing configuration map key %q", configMapKey)
+		return nil, nil, fmt.Errorf("missing configuration map key %q", configMapKey)
 	}
 
 	meshConfig, err := mesh.ApplyMeshConfigDefaults(cfgYaml)
 	if err != nil {
-		return nil, fmt.Errorf("failed reading mesh config: %v. YAML:\n%s", err, cfgYaml)
+		return nil, nil, fmt.Errorf("failed reading mesh config: %v. YAML:\n%s", err, cfgYaml)
+	}
+	extensions, err := mesh.ParseMeshExtensions(cfgYaml)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed reading mesh config extensions: %v. YAML:\n%s", err, cfgYaml)
 	}
 
 	log.Warn("Loading default mesh config from K8S, no reload support.")
-	return meshConfig, nil
+	return meshConfig, extensions, nil
 }
@@ -65,43 +65,51 @@ func (c controller) List(typ resource.GroupVersionKind, namespace string) ([]mod
 		return nil, errUnsupportedOp
 	}
 
-	gatewayClass, err := c.cache.List(collections.K8SServiceApisV1Alpha1Gatewayclasses.Resource().GroupVersionKind(), namespace)
+	input, err := listResources(c.cache, namespace)
+	if err != nil {
+		return nil, err
+	}
+	output := convertResources(input)
+
+	switch typ {
+	case gatewayType.GroupVersionKind():
+		return output.Gateway, nil
+	case vsType.GroupVersionKind():
+		return output.VirtualService, nil
+	}
+	return nil, errUnsupportedOp
+}
+
+// listResources lists the Kubernetes gateway API resources of the namespace from the store.
+func listResources(store model.ConfigStore, namespace string) (*KubernetesResources, error) {
+	gatewayClass, err := store.List(collections.K8SServiceApisV1Alpha1Gatewayclasses.Resource().GroupVersionKind(), namespace)
 	if err != nil {
 		return nil, fmt.Errorf("failed to list type GatewayClass: %v", err)
 	}
-	gateway, err := c.cache.List(collections.K8SServiceApisV1Alpha1Gateways.Resource().GroupVersionKind(), namespace)
+	gateway, err := store.List(collections.K8SServiceApisV1Alpha1Gateways.Resource().GroupVersionKind(), namespace)
 	if err != nil {
 		return nil, fmt.Errorf("failed to list type Gateway: %v", err)
 	}
-	httpRoute, err := c.cache.List(collections.K8SServiceApisV1Alpha1Httproutes.Resource().GroupVersionKind(), namespace)
+	httpRoute, err := store.List(collections.K8SServiceApisV1Alpha1Httproutes.Resource().GroupVersionKind(), namespace)
 	if err != nil {
 		return nil, fmt.Errorf("failed to list type HTTPRoute: %v", err)
 	}
-	tcpRoute, err := c.cache.List(collections.K8SServiceApisV1Alpha1Tcproutes.Resource().GroupVersionKind(), namespace)
+	tcpRoute, err := store.List(collections.K8SServiceApisV1Alpha1Tcproutes.Resource().GroupVersionKind(), namespace)
 	if err != nil {
 		return nil, fmt.Errorf("failed to list type TcpRoute: %v", err)
 	}
-	trafficSplit, err := c.cache.List(collections.K8SServiceApisV1Alpha1Trafficsplits.Resource().GroupVersionKind(), namespace)
+	trafficSplit, err := store.List(collections.K8SServiceApisV1Alpha1Trafficsplits.Resource().GroupVersionKind(), namespace)
 	if err != nil {
 		return nil, fmt.Errorf("failed to list type TrafficSplit: %v", err)
 	}
 
-	input := &KubernetesResources{
+	return &KubernetesResources{
 		GatewayClass: gatewayClass,
 		Gateway:      gateway,
 		HTTPRoute:    httpRoute,
 		TCPRoute:     tcpRoute,
 		TrafficSplit: trafficSplit,
-	}
-	output := convertResources(input)
-
-	switch typ {
-	case gatewayType.GroupVersionKind():
-		return output.Gateway, nil
-	case vsType.GroupVersionKind():
-		return output.VirtualService, nil
-	}
-	return nil, errUnsupportedOp
+	}, nil
 }
 
 var (
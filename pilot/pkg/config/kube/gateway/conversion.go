@@ -34,6 +34,12 @@ const (
 	ControllerName = "istio.io/gateway-controller"
 )
 
+// HeaderType constants missing from the service-apis API, which only defines HeaderTypeExact.
+const (
+	headerTypePrefix            = "Prefix"
+	headerTypeRegularExpression = "RegularExpression"
+)
+
 type KubernetesResources struct {
 	GatewayClass []model.Config
 	Gateway      []model.Config
@@ -42,27 +48,63 @@ type KubernetesResources struct {
 	TrafficSplit []model.Config
 }
 
-func (r *KubernetesResources) LookupReference(ref k8s.LocalObjectReference, ns string) (model.Config, bool) {
+// LookupReference returns the resource referenced from the namespace ns. It returns an error if the
+// resource does not exist or its kind is not supported.
+func (r *KubernetesResources) LookupReference(ref k8s.LocalObjectReference, ns string) (model.Config, error) {
+	var cfgs []model.Config
 	switch ref.Resource {
 	case "HTTPRoute":
-		c := findByName(ref.Name, ns, r.HTTPRoute)
-		if c != nil {
-			return *c, true
-		}
+		cfgs = r.HTTPRoute
 	case "TcpRoute":
-		c := findByName(ref.Name, ns, r.TCPRoute)
-		if c != nil {
-			return *c, true
-		}
+		cfgs = r.TCPRoute
+	case "TrafficSplit":
+		cfgs = r.TrafficSplit
 	default:
-		panic("kind not supported: " + ref.String())
+		return model.Config{}, fmt.Errorf("unsupported kind of %s %s/%s", ref.Resource, ns, ref.Name)
+	}
+	c := findByName(ref.Name, ns, cfgs)
+	if c == nil {
+		return model.Config{}, fmt.Errorf("%s %s/%s not found", ref.Resource, ns, ref.Name)
 	}
-	return model.Config{}, false
+	return *c, nil
+}
+
+// ConfigErrorReason is the reason of a ConfigError.
+type ConfigErrorReason = string
+
+const (
+	// InvalidRefs indicates a reference to a resource that does not exist or has an unsupported kind.
+	InvalidRefs ConfigErrorReason = "InvalidRefs"
+	// InvalidConfiguration indicates a field whose value cannot be converted.
+	InvalidConfiguration ConfigErrorReason = "InvalidConfiguration"
+	// UnsupportedFeature indicates a resource or a field that the controller does not convert.
+	UnsupportedFeature ConfigErrorReason = "UnsupportedFeature"
+)
+
+// ConfigError is an error converting a Kubernetes resource, to be reported on its status.
+type ConfigError struct {
+	Reason  ConfigErrorReason
+	Message string
+}
+
+func (e ConfigError) Error() string {
+	return e.Reason + ": " + e.Message
 }
 
 type IstioResources struct {
 	Gateway        []model.Config
 	VirtualService []model.Config
+	// Errors are the errors converting each Kubernetes resource. The parts of a resource that cannot be
+	// converted are ignored.
+	Errors map[model.ConfigKey][]ConfigError
+}
+
+// reportError records an error converting the Kubernetes resource obj.
+func (r *IstioResources) reportError(obj model.Config, reason ConfigErrorReason, format string, args ...interface{}) {
+	err := ConfigError{Reason: reason, Message: fmt.Sprintf(format, args...)}
+	log.Debugf("error converting %s %s/%s: %v", obj.Type, obj.Namespace, obj.Name, err)
+	key := model.ConfigKey{Kind: obj.GroupVersionKind(), Name: obj.Name, Namespace: obj.Namespace}
+	r.Errors[key] = append(r.Errors[key], err)
 }
 
 var _ = k8s.HTTPRoute{}
@@ -78,23 +120,24 @@ func findByName(name, namespace string, cfgs []model.Config) *model.Config {
 }
 
 func convertResources(r *KubernetesResources) IstioResources {
-	result := IstioResources{}
-	gw, routeMap := convertGateway(r)
-	vs := convertVirtualService(r, routeMap)
+	result := IstioResources{Errors: map[model.ConfigKey][]ConfigError{}}
+	gw, routeMap := convertGateway(r, &result)
+	vs := convertVirtualService(r, routeMap, &result)
 	result.Gateway = gw
 	result.VirtualService = vs
 	return result
 }
 
-func convertVirtualService(r *KubernetesResources, routeMap map[*k8s.HTTPRouteSpec][]string) []model.Config {
+func convertVirtualService(r *KubernetesResources, routeMap map[*k8s.HTTPRouteSpec][]string, out *IstioResources) []model.Config {
 	result := []model.Config{}
-	// TODO implement this once the API does. For now just iterate to make sure types work
+	// TcpRoute and TrafficSplit are placeholders in v1alpha1, without any field to convert.
 	for _, obj := range r.TrafficSplit {
 		_ = obj.Spec.(*k8s.TrafficSplitSpec)
+		out.reportError(obj, UnsupportedFeature, "TrafficSplit defines no backends")
 	}
-	// TODO implement this once the API does. For now just iterate to make sure types work
 	for _, obj := range r.TCPRoute {
 		_ = obj.Spec.(*k8s.TcpRouteSpec)
+		out.reportError(obj, UnsupportedFeature, "TcpRoute defines no rules")
 	}
 	for _, obj := range r.HTTPRoute {
 		route := obj.Spec.(*k8s.HTTPRouteSpec)
@@ -110,7 +153,7 @@ func convertVirtualService(r *KubernetesResources, routeMap map[*k8s.HTTPRouteSp
 		for _, h := range route.Hosts {
 			// TODO does flattening here work?
 			hosts = append(hosts, h.Hostname)
-			for _, r := range h.Rules {
+			for _, rule := range h.Rules {
 				vs := &istio.HTTPRoute{
 					Match:            nil,
 					Route:            nil,
@@ -124,18 +167,33 @@ func convertVirtualService(r *KubernetesResources, routeMap map[*k8s.HTTPRouteSp
 					CorsPolicy:       nil,
 					//Headers:               nil,
 				}
-				if r.Match != nil {
+				if rule.Match != nil {
+					uri, err := createURIMatch(rule.Match)
+					if err != nil {
+						out.reportError(obj, InvalidConfiguration, "host %q: %v", h.Hostname, err)
+						continue
+					}
+					headers, err := createHeadersMatch(rule.Match)
+					if err != nil {
+						out.reportError(obj, InvalidConfiguration, "host %q: %v", h.Hostname, err)
+						continue
+					}
 					vs.Match = []*istio.HTTPMatchRequest{{
-						Uri:     createURIMatch(r.Match),
-						Headers: createHeadersMatch(r.Match),
+						Uri:     uri,
+						Headers: headers,
 					}}
 				}
-				if r.Filter != nil {
-					vs.Headers = createHeadersFilter(r.Filter.Headers)
+				if rule.Filter != nil {
+					vs.Headers = createHeadersFilter(rule.Filter.Headers)
 				}
 				// TODO this should be required? in the spec
-				if r.Action != nil {
-					vs.Route = createRoute(r.Action, obj.Namespace)
+				if rule.Action != nil {
+					destinations, err := createRoute(rule.Action, obj.Namespace, r)
+					if err != nil {
+						out.reportError(obj, err.Reason, "host %q: %s", h.Hostname, err.Message)
+						continue
+					}
+					vs.Route = destinations
 				}
 				httproutes = append(httproutes, vs)
 			}
@@ -160,21 +218,31 @@ func convertVirtualService(r *KubernetesResources, routeMap map[*k8s.HTTPRouteSp
 	return result
 }
 
-// TODO support traffic split
-func createRoute(action *k8s.HTTPRouteAction, ns string) []*istio.HTTPRouteDestination {
+func createRoute(action *k8s.HTTPRouteAction, ns string, r *KubernetesResources) ([]*istio.HTTPRouteDestination, *ConfigError) {
 	if action == nil || action.ForwardTo == nil {
-		return nil
+		return nil, nil
+	}
+
+	switch action.ForwardTo.Resource {
+	case "Service":
+	case "TrafficSplit":
+		if _, err := r.LookupReference(*action.ForwardTo, ns); err != nil {
+			return nil, &ConfigError{Reason: InvalidRefs, Message: "forwardTo: " + err.Error()}
+		}
+		return nil, &ConfigError{Reason: UnsupportedFeature,
+			Message: fmt.Sprintf("forwarding to TrafficSplit %s/%s is not supported", ns, action.ForwardTo.Name)}
+	default:
+		return nil, &ConfigError{Reason: InvalidRefs,
+			Message: fmt.Sprintf("unsupported kind of forwardTo %s %s/%s", action.ForwardTo.Resource, ns, action.ForwardTo.Name)}
 	}
 
-	// TODO this is really bad. What types does object point to?
 	return []*istio.HTTPRouteDestination{{
 		Destination: &istio.Destination{
 			// TODO cluster.local hardcode
 			// TODO is this the right format?
 			Host: fmt.Sprintf("%s.%s.svc.cluster.local", action.ForwardTo.Name, ns),
 		},
-	}}
-
+	}}, nil
 }
 
 func createHeadersFilter(filter *k8s.HTTPHeaderFilter) *istio.Headers {
@@ -189,51 +257,46 @@ func createHeadersFilter(filter *k8s.HTTPHeaderFilter) *istio.Headers {
 	}
 }
 
-func createHeadersMatch(match *k8s.HTTPRouteMatch) map[string]*istio.StringMatch {
+func createHeadersMatch(match *k8s.HTTPRouteMatch) (map[string]*istio.StringMatch, error) {
 	res := map[string]*istio.StringMatch{}
 	for k, v := range match.Header {
-		// TODO use well known types
-		if match.HeaderType == nil || *match.HeaderType == "Exact" {
+		if match.HeaderType == nil || *match.HeaderType == k8s.HeaderTypeExact {
 			res[k] = &istio.StringMatch{
 				MatchType: &istio.StringMatch_Exact{Exact: v},
 			}
-		} else if match.PathType == "Prefix" {
+		} else if *match.HeaderType == headerTypePrefix {
 			res[k] = &istio.StringMatch{
 				MatchType: &istio.StringMatch_Prefix{Prefix: v},
 			}
-		} else if match.PathType == "RegularExpression" {
+		} else if *match.HeaderType == headerTypeRegularExpression {
 			res[k] = &istio.StringMatch{
 				MatchType: &istio.StringMatch_Regex{Regex: v},
 			}
 		} else {
-			// TODO do not panic
-			panic("unknown type")
+			return nil, fmt.Errorf("unsupported headerType %q", *match.HeaderType)
 		}
 	}
-	return res
+	return res, nil
 }
 
-func createURIMatch(match *k8s.HTTPRouteMatch) *istio.StringMatch {
+func createURIMatch(match *k8s.HTTPRouteMatch) (*istio.StringMatch, error) {
 	if match.Path == nil {
-		return nil
+		return nil, nil
 	}
-	// TODO use well known types
-	if match.PathType == "" || match.PathType == "Exact" {
+	if match.PathType == "" || match.PathType == k8s.PathTypeExact {
 		return &istio.StringMatch{
 			MatchType: &istio.StringMatch_Exact{Exact: *match.Path},
-		}
-	} else if match.PathType == "Prefix" {
+		}, nil
+	} else if match.PathType == k8s.PathTypePrefix {
 		return &istio.StringMatch{
 			MatchType: &istio.StringMatch_Prefix{Prefix: *match.Path},
-		}
-	} else if match.PathType == "RegularExpression" {
+		}, nil
+	} else if match.PathType == k8s.PathTypeRegularExpression {
 		return &istio.StringMatch{
 			MatchType: &istio.StringMatch_Regex{Regex: *match.Path},
-		}
-	} else {
-		// TODO do not panic
-		panic("unknown type")
+		}, nil
 	}
+	return nil, fmt.Errorf("unsupported pathType %q", match.PathType)
 }
 
 // getGatewayClass finds all gateway class that are owned by Istio
@@ -250,7 +313,7 @@ func getGatewayClasses(r *KubernetesResources) map[string]struct{} {
 	return classes
 }
 
-func convertGateway(r *KubernetesResources) ([]model.Config, map[*k8s.HTTPRouteSpec][]string) {
+func convertGateway(r *KubernetesResources, out *IstioResources) ([]model.Config, map[*k8s.HTTPRouteSpec][]string) {
 	result := []model.Config{}
 	routeToGateway := map[*k8s.HTTPRouteSpec][]string{}
 	classes := getGatewayClasses(r)
@@ -265,14 +328,12 @@ func convertGateway(r *KubernetesResources) ([]model.Config, map[*k8s.HTTPRouteS
 		for _, l := range kgw.Listeners {
 			if l.Port == nil {
 				// TODO this is optional in spec
-				// TODO propagate errors to status
-				log.Warnf("invalid listener, port is nil: %v", l)
+				out.reportError(obj, UnsupportedFeature, "listener %q has no port", l.Name)
 				continue
 			}
 			if l.Protocol == nil {
 				// TODO this is optional in spec
-				// TODO propagate errors to status
-				log.Warnf("invalid listener, protocol is nil: %v", l)
+				out.reportError(obj, UnsupportedFeature, "listener %q has no protocol", l.Name)
 				continue
 			}
 			server := &istio.Server{
@@ -292,10 +353,9 @@ func convertGateway(r *KubernetesResources) ([]model.Config, map[*k8s.HTTPRouteS
 			servers = append(servers, server)
 		}
 		for _, route := range kgw.Routes {
-			r, f := r.LookupReference(route, obj.Namespace)
-			if !f {
-				// TODO propagate errors to status
-				log.Warnf("route %v/%v not found", route.Resource, route.Name)
+			r, err := r.LookupReference(route, obj.Namespace)
+			if err != nil {
+				out.reportError(obj, InvalidRefs, "route: %v", err)
 				continue
 			}
 			switch r.Type {
@@ -303,9 +363,9 @@ func convertGateway(r *KubernetesResources) ([]model.Config, map[*k8s.HTTPRouteS
 				http := r.Spec.(*k8s.HTTPRouteSpec)
 				routeToGateway[http] = append(routeToGateway[http], name)
 			case collections.K8SServiceApisV1Alpha1Tcproutes.Resource().Kind():
-				// TODO implement this once the spec is defined
+				// The TcpRoute itself is reported as unsupported.
 			default:
-				log.Warnf("unsupported typed %v", r.Type)
+				out.reportError(obj, InvalidRefs, "unsupported kind of route %s %s/%s", route.Resource, obj.Namespace, route.Name)
 				continue
 			}
 		}
@@ -21,6 +21,9 @@ import (
 
 	"github.com/d4l3k/messagediff"
 	"github.com/ghodss/yaml"
+	k8s "sigs.k8s.io/service-apis/api/v1alpha1"
+
+	istio "istio.io/api/networking/v1alpha3"
 
 	"istio.io/istio/pkg/config/schema/collections"
 
@@ -30,13 +33,45 @@ import (
 )
 
 func TestConvertResources(t *testing.T) {
-	cases := []string{"simple", "mismatch"}
+	cases := []struct {
+		name   string
+		errors map[string][]ConfigErrorReason
+	}{
+		{
+			name:   "simple",
+			errors: map[string][]ConfigErrorReason{"tcp": {UnsupportedFeature}},
+		},
+		{
+			name: "mismatch",
+		},
+		{
+			name: "invalid",
+			errors: map[string][]ConfigErrorReason{
+				"gateway": {UnsupportedFeature, InvalidRefs, InvalidRefs},
+				"http":    {InvalidConfiguration, UnsupportedFeature},
+				"split":   {UnsupportedFeature},
+			},
+		},
+	}
 	for _, tt := range cases {
-		t.Run(tt, func(t *testing.T) {
-			input := readConfig(t, fmt.Sprintf("testdata/%s.yaml", tt))
+		t.Run(tt.name, func(t *testing.T) {
+			input := readConfig(t, fmt.Sprintf("testdata/%s.yaml", tt.name))
 			output := convertResources(splitInput(input))
 
-			goldenFile := fmt.Sprintf("testdata/%s.yaml.golden", tt)
+			errors := map[string][]ConfigErrorReason{}
+			for key, errs := range output.Errors {
+				for _, err := range errs {
+					errors[key.Name] = append(errors[key.Name], err.Reason)
+				}
+			}
+			if len(errors) != 0 || len(tt.errors) != 0 {
+				if diff, eq := messagediff.PrettyDiff(tt.errors, errors); !eq {
+					t.Errorf("unexpected errors %v:\n%s", output.Errors, diff)
+				}
+			}
+			output.Errors = nil
+
+			goldenFile := fmt.Sprintf("testdata/%s.yaml.golden", tt.name)
 			if util.Refresh() {
 				res := append(output.Gateway, output.VirtualService...)
 				if err := ioutil.WriteFile(goldenFile, marshalYaml(t, res), 0644); err != nil {
@@ -52,6 +87,59 @@ func TestConvertResources(t *testing.T) {
 	}
 }
 
+func TestCreateHeadersMatch(t *testing.T) {
+	headerType := func(t string) *string { return &t }
+	cases := []struct {
+		name       string
+		headerType *string
+		want       *istio.StringMatch
+	}{
+		{
+			name: "default",
+			want: &istio.StringMatch{MatchType: &istio.StringMatch_Exact{Exact: "value"}},
+		},
+		{
+			name:       "exact",
+			headerType: headerType(k8s.HeaderTypeExact),
+			want:       &istio.StringMatch{MatchType: &istio.StringMatch_Exact{Exact: "value"}},
+		},
+		{
+			name:       "prefix",
+			headerType: headerType(headerTypePrefix),
+			want:       &istio.StringMatch{MatchType: &istio.StringMatch_Prefix{Prefix: "value"}},
+		},
+		{
+			name:       "regex",
+			headerType: headerType(headerTypeRegularExpression),
+			want:       &istio.StringMatch{MatchType: &istio.StringMatch_Regex{Regex: "value"}},
+		},
+		{
+			name:       "unsupported",
+			headerType: headerType("ImplementationSpecific"),
+		},
+	}
+	for _, tt := range cases {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := createHeadersMatch(&k8s.HTTPRouteMatch{
+				HeaderType: tt.headerType,
+				Header:     map[string]string{"my-header": "value"},
+			})
+			if tt.want == nil {
+				if err == nil {
+					t.Fatalf("expected an error, got %v", got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if diff, eq := messagediff.PrettyDiff(map[string]*istio.StringMatch{"my-header": tt.want}, got); !eq {
+				t.Errorf("unexpected headers match:\n%s", diff)
+			}
+		})
+	}
+}
+
 func splitOutput(configs []model.Config) IstioResources {
 	out := IstioResources{
 		Gateway:        []model.Config{},
@@ -0,0 +1,527 @@
+// Copyright 2020 Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package gateway
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+	"time"
+
+	core "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/rest"
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/utils/clock"
+	k8s "sigs.k8s.io/service-apis/api/v1alpha1"
+
+	"istio.io/pkg/log"
+
+	"istio.io/istio/pilot/pkg/model"
+	"istio.io/istio/pilot/pkg/status"
+	"istio.io/istio/pkg/config/schema/collection"
+	"istio.io/istio/pkg/config/schema/collections"
+)
+
+var scope = log.RegisterScope("gateway",
+	"component for writing the status of Kubernetes gateway API resources", 0)
+
+// Status conditions written on the GatewayClasses and Gateways handled by Istio, in addition to the
+// conditions defined by the gateway API.
+const (
+	// ConditionAccepted is false if parts of the resource are ignored because they cannot be converted.
+	ConditionAccepted = "Accepted"
+	// ConditionResolvedRefs is false if the resource references resources that do not exist or whose
+	// kind is not supported.
+	ConditionResolvedRefs = "ResolvedRefs"
+	// ConditionReady is true if the resource is accepted, its references are resolved and, for a
+	// Gateway, at least one of its listeners is configured.
+	ConditionReady = "Ready"
+)
+
+// desiredStatus is the status to write on a resource.
+type desiredStatus struct {
+	config model.Config
+	// status is a k8s.GatewayClassStatus, a k8s.GatewayStatus or a k8s.HTTPRouteStatus.
+	status interface{}
+	// istioGateways are the Gateways handled by Istio. The other Gateways an HTTPRoute is bound to are
+	// preserved in its status.
+	istioGateways map[k8s.GatewayObjectReference]bool
+}
+
+func newCondition(typ string, ok bool, reason, message string) k8s.GatewayCondition {
+	c := k8s.GatewayCondition{Type: k8s.GatewayConditionType(typ), Status: core.ConditionTrue, Reason: reason, Message: message}
+	if !ok {
+		c.Status = core.ConditionFalse
+	}
+	return c
+}
+
+// newProblemCondition returns a condition of the gateway API, which is true if there are problems, with
+// the problems as message.
+func newProblemCondition(typ, reason string, problems []string, sep string) k8s.GatewayCondition {
+	if len(problems) == 0 {
+		return newCondition(typ, false, "", "")
+	}
+	return newCondition(typ, true, reason, strings.Join(problems, sep))
+}
+
+func newListenerCondition(typ k8s.ListenerConditionType, ok bool, reason, message string) k8s.ListenerCondition {
+	c := k8s.ListenerCondition{Type: typ, Status: core.ConditionTrue, Reason: reason, Message: message}
+	if !ok {
+		c.Status = core.ConditionFalse
+	}
+	return c
+}
+
+// buildConditions returns the Accepted, ResolvedRefs and Ready conditions of a resource, given its
+// conversion errors.
+func buildConditions(errs []ConfigError, notReadyReason, notReadyMessage string) []k8s.GatewayCondition {
+	var refs, others []string
+	otherReason := ""
+	for _, err := range errs {
+		if err.Reason == InvalidRefs {
+			refs = append(refs, err.Message)
+			continue
+		}
+		if otherReason == "" {
+			otherReason = err.Reason
+		}
+		others = append(others, err.Message)
+	}
+
+	accepted := newCondition(ConditionAccepted, true, "Accepted", "")
+	if len(others) > 0 {
+		accepted = newCondition(ConditionAccepted, false, otherReason, strings.Join(others, "; "))
+	}
+	resolvedRefs := newCondition(ConditionResolvedRefs, true, "ResolvedRefs", "")
+	if len(refs) > 0 {
+		resolvedRefs = newCondition(ConditionResolvedRefs, false, InvalidRefs, strings.Join(refs, "; "))
+	}
+	ready := newCondition(ConditionReady, true, "Ready", "")
+	switch {
+	case len(others) > 0:
+		ready = newCondition(ConditionReady, false, "NotAccepted", "")
+	case len(refs) > 0:
+		ready = newCondition(ConditionReady, false, "UnresolvedRefs", "")
+	case notReadyReason != "":
+		ready = newCondition(ConditionReady, false, notReadyReason, notReadyMessage)
+	}
+	return []k8s.GatewayCondition{accepted, resolvedRefs, ready}
+}
+
+// buildListenerStatus returns the status of a listener of a Gateway. A listener is invalid if it cannot
+// be converted to an Istio server.
+func buildListenerStatus(l k8s.Listener) (k8s.ListenerStatus, bool) {
+	invalid := ""
+	switch {
+	case l.Port == nil:
+		invalid = "listener has no port"
+	case l.Protocol == nil:
+		invalid = "listener has no protocol"
+	}
+	status := k8s.ListenerStatus{
+		Name: l.Name,
+		Conditions: []k8s.ListenerCondition{
+			newListenerCondition(k8s.ConditionInvalidListener, false, "", ""),
+			newListenerCondition(k8s.ConditionListenerNotReady, false, "", ""),
+		},
+	}
+	if invalid != "" {
+		status.Conditions = []k8s.ListenerCondition{
+			newListenerCondition(k8s.ConditionInvalidListener, true, UnsupportedFeature, invalid),
+			newListenerCondition(k8s.ConditionListenerNotReady, true, "Invalid", invalid),
+		}
+	}
+	return status, invalid == ""
+}
+
+// toGatewayClassConditions converts Gateway conditions to GatewayClass conditions, whose optional
+// fields are pointers.
+func toGatewayClassConditions(conditions []k8s.GatewayCondition) []k8s.GatewayClassCondition {
+	var out []k8s.GatewayClassCondition
+	for _, c := range conditions {
+		c := c
+		gc := k8s.GatewayClassCondition{Type: k8s.GatewayClassConditionType(c.Type), Status: c.Status}
+		if c.Reason != "" {
+			gc.Reason = &c.Reason
+		}
+		if c.Message != "" {
+			gc.Message = &c.Message
+		}
+		if !c.LastTransitionTime.IsZero() {
+			gc.LastTransitionTime = &c.LastTransitionTime
+		}
+		out = append(out, gc)
+	}
+	return out
+}
+
+// fromGatewayClassConditions is the reverse of toGatewayClassConditions.
+func fromGatewayClassConditions(conditions []k8s.GatewayClassCondition) []k8s.GatewayCondition {
+	var out []k8s.GatewayCondition
+	for _, gc := range conditions {
+		c := k8s.GatewayCondition{Type: k8s.GatewayConditionType(gc.Type), Status: gc.Status}
+		if gc.Reason != nil {
+			c.Reason = *gc.Reason
+		}
+		if gc.Message != nil {
+			c.Message = *gc.Message
+		}
+		if gc.LastTransitionTime != nil {
+			c.LastTransitionTime = *gc.LastTransitionTime
+		}
+		out = append(out, c)
+	}
+	return out
+}
+
+// buildStatuses returns the status of the GatewayClasses and Gateways handled by Istio, and of the
+// HTTPRoutes, given the conversion errors of the resources. The conversion errors of an HTTPRoute, whose
+// status has no conditions, are reported on the Gateways it is bound to.
+func buildStatuses(r *KubernetesResources, errs map[model.ConfigKey][]ConfigError) map[model.ConfigKey]*desiredStatus {
+	out := map[model.ConfigKey]*desiredStatus{}
+	keyOf := func(obj model.Config) model.ConfigKey {
+		return model.ConfigKey{Kind: obj.GroupVersionKind(), Name: obj.Name, Namespace: obj.Namespace}
+	}
+
+	classes := getGatewayClasses(r)
+	for _, obj := range r.GatewayClass {
+		if _, f := classes[obj.Name]; !f {
+			continue
+		}
+		classErrs := errs[keyOf(obj)]
+		invalidParameters := newCondition(string(k8s.GatewayClassConditionStatusInvalidParameters), false, "", "")
+		if obj.Spec.(*k8s.GatewayClassSpec).ParametersRef != nil {
+			const message = "parameters are not supported"
+			classErrs = append(classErrs, ConfigError{Reason: UnsupportedFeature, Message: message})
+			invalidParameters = newCondition(string(k8s.GatewayClassConditionStatusInvalidParameters), true, UnsupportedFeature, message)
+		}
+		conditions := append(buildConditions(classErrs, "", ""), invalidParameters)
+		out[keyOf(obj)] = &desiredStatus{config: obj, status: k8s.GatewayClassStatus{Conditions: toGatewayClassConditions(conditions)}}
+	}
+
+	istioGateways := map[k8s.GatewayObjectReference]bool{}
+	routeGateways := map[model.ConfigKey][]k8s.GatewayObjectReference{}
+	for _, obj := range r.Gateway {
+		kgw := obj.Spec.(*k8s.GatewaySpec)
+		if _, f := classes[kgw.Class]; !f {
+			continue
+		}
+		gwRef := k8s.GatewayObjectReference{Namespace: obj.Namespace, Name: obj.Name}
+		istioGateways[gwRef] = true
+
+		var listeners []k8s.ListenerStatus
+		var invalidListeners []string
+		for _, l := range kgw.Listeners {
+			ls, ok := buildListenerStatus(l)
+			if !ok {
+				invalidListeners = append(invalidListeners, l.Name)
+			}
+			listeners = append(listeners, ls)
+		}
+		reason, message := "", ""
+		if len(invalidListeners) == len(kgw.Listeners) {
+			reason, message = string(k8s.ConditionListenersNotReady), "no listener is configured"
+		}
+
+		var invalidRoutes []string
+		for _, err := range errs[keyOf(obj)] {
+			if err.Reason == InvalidRefs {
+				invalidRoutes = append(invalidRoutes, err.Message)
+			}
+		}
+		for _, ref := range kgw.Routes {
+			route, err := r.LookupReference(ref, obj.Namespace)
+			if err != nil || route.Type != collections.K8SServiceApisV1Alpha1Httproutes.Resource().Kind() {
+				continue
+			}
+			routeGateways[keyOf(route)] = append(routeGateways[keyOf(route)], gwRef)
+			for _, err := range errs[keyOf(route)] {
+				invalidRoutes = append(invalidRoutes, fmt.Sprintf("HTTPRoute %s: %v", route.Name, err))
+			}
+		}
+
+		conditions := append(buildConditions(errs[keyOf(obj)], reason, message),
+			newProblemCondition(string(k8s.ConditionInvalidListeners), UnsupportedFeature, invalidListeners, ", "),
+			newProblemCondition(string(k8s.ConditionListenersNotReady), "InvalidListeners", invalidListeners, ", "),
+			newProblemCondition(string(k8s.ConditionInvalidRoutes), "InvalidRoutes", invalidRoutes, "; "))
+		out[keyOf(obj)] = &desiredStatus{config: obj, status: k8s.GatewayStatus{Conditions: conditions, Listeners: listeners}}
+	}
+
+	for _, obj := range r.HTTPRoute {
+		gateways := routeGateways[keyOf(obj)]
+		sort.Slice(gateways, func(i, j int) bool {
+			return lessGatewayReference(gateways[i], gateways[j])
+		})
+		out[keyOf(obj)] = &desiredStatus{config: obj, status: k8s.HTTPRouteStatus{Gateways: gateways}, istioGateways: istioGateways}
+	}
+	return out
+}
+
+func lessGatewayReference(a, b k8s.GatewayObjectReference) bool {
+	return a.Namespace < b.Namespace || (a.Namespace == b.Namespace && a.Name < b.Name)
+}
+
+// setTransitionTimes sets the transition times of the desired conditions. The transition times of the
+// conditions whose status did not change are preserved.
+func setTransitionTimes(existing, desired []k8s.GatewayCondition, now metav1.Time) []k8s.GatewayCondition {
+	prev := map[k8s.GatewayConditionType]k8s.GatewayCondition{}
+	for _, c := range existing {
+		prev[c.Type] = c
+	}
+	var out []k8s.GatewayCondition
+	for _, c := range desired {
+		if p, f := prev[c.Type]; f && p.Status == c.Status {
+			c.LastTransitionTime = p.LastTransitionTime
+		} else {
+			c.LastTransitionTime = now
+		}
+		out = append(out, c)
+	}
+	return out
+}
+
+// setListenerTransitionTimes is setTransitionTimes for the conditions of a listener.
+func setListenerTransitionTimes(existing, desired []k8s.ListenerCondition, now metav1.Time) []k8s.ListenerCondition {
+	prev := map[k8s.ListenerConditionType]k8s.ListenerCondition{}
+	for _, c := range existing {
+		prev[c.Type] = c
+	}
+	var out []k8s.ListenerCondition
+	for _, c := range desired {
+		if p, f := prev[c.Type]; f && p.Status == c.Status {
+			c.LastTransitionTime = p.LastTransitionTime
+		} else {
+			c.LastTransitionTime = now
+		}
+		out = append(out, c)
+	}
+	return out
+}
+
+// reconcileStatus returns the status to write on a resource whose current status is current, and whether
+// it differs from the current status. The transition times of the conditions whose status did not change
+// are preserved, as are the Gateways not handled by Istio in the status of an HTTPRoute.
+func reconcileStatus(current interface{}, desired *desiredStatus, now time.Time) (interface{}, bool) {
+	decode := func(out interface{}) {
+		if current == nil {
+			return
+		}
+		if b, err := json.Marshal(current); err == nil {
+			_ = json.Unmarshal(b, out)
+		}
+	}
+	transitionTime := metav1.NewTime(now)
+
+	switch d := desired.status.(type) {
+	case k8s.GatewayClassStatus:
+		var existing k8s.GatewayClassStatus
+		decode(&existing)
+		conditions := setTransitionTimes(fromGatewayClassConditions(existing.Conditions),
+			fromGatewayClassConditions(d.Conditions), transitionTime)
+		result := k8s.GatewayClassStatus{Conditions: toGatewayClassConditions(conditions)}
+		return result, !reflect.DeepEqual(existing, result)
+	case k8s.GatewayStatus:
+		var existing k8s.GatewayStatus
+		decode(&existing)
+		existingListeners := map[string]k8s.ListenerStatus{}
+		for _, l := range existing.Listeners {
+			existingListeners[l.Name] = l
+		}
+		result := k8s.GatewayStatus{Conditions: setTransitionTimes(existing.Conditions, d.Conditions, transitionTime)}
+		for _, l := range d.Listeners {
+			l.Conditions = setListenerTransitionTimes(existingListeners[l.Name].Conditions, l.Conditions, transitionTime)
+			result.Listeners = append(result.Listeners, l)
+		}
+		return result, !reflect.DeepEqual(existing, result)
+	case k8s.HTTPRouteStatus:
+		var existing k8s.HTTPRouteStatus
+		decode(&existing)
+		result := k8s.HTTPRouteStatus{Gateways: append([]k8s.GatewayObjectReference(nil), d.Gateways...)}
+		for _, ref := range existing.Gateways {
+			if !desired.istioGateways[ref] {
+				result.Gateways = append(result.Gateways, ref)
+			}
+		}
+		sort.Slice(result.Gateways, func(i, j int) bool {
+			return lessGatewayReference(result.Gateways[i], result.Gateways[j])
+		})
+		return result, !reflect.DeepEqual(existing, result)
+	}
+	return nil, false
+}
+
+// writtenStatus is the last status written on a resource.
+type writtenStatus struct {
+	resourceVersion string
+	status          interface{}
+}
+
+// statusKinds are the kinds of the resources whose changes can change the status written by the controller.
+var statusKinds = []collection.Schema{
+	collections.K8SServiceApisV1Alpha1Gatewayclasses,
+	collections.K8SServiceApisV1Alpha1Gateways,
+	collections.K8SServiceApisV1Alpha1Httproutes,
+	collections.K8SServiceApisV1Alpha1Tcproutes,
+	collections.K8SServiceApisV1Alpha1Trafficsplits,
+}
+
+// StatusController writes the status of the Kubernetes gateway API resources handled by Istio. It should
+// only run on the leader. The status is reconciled when the resources change.
+type StatusController struct {
+	// RetryInterval is the interval before reconciling the status again after a failed update, one second
+	// by default.
+	RetryInterval time.Duration
+	// QPS and Burst limit the rate of the status updates, see features.StatusQPS.
+	QPS   float32
+	Burst int
+
+	store   model.ConfigStoreCache
+	client  dynamic.Interface
+	clock   clock.Clock
+	queue   chan struct{}
+	written map[model.ConfigKey]writtenStatus
+}
+
+// NewStatusController creates a status controller for the Kubernetes gateway API resources of the store.
+// It registers its event handlers on the store, so it must be created before the store runs.
+func NewStatusController(store model.ConfigStoreCache) *StatusController {
+	c := &StatusController{store: store, queue: make(chan struct{}, 1)}
+	for _, s := range statusKinds {
+		store.RegisterEventHandler(s.Resource().GroupVersionKind(), func(model.Config, model.Config, model.Event) {
+			c.enqueue()
+		})
+	}
+	return c
+}
+
+// enqueue requests a reconciliation of the status. Requests are coalesced until the next reconciliation.
+func (c *StatusController) enqueue() {
+	select {
+	case c.queue <- struct{}{}:
+	default:
+	}
+}
+
+func (c *StatusController) Start(restConfig *rest.Config, stop <-chan struct{}) {
+	scope.Info("Starting gateway status controller")
+	if c.RetryInterval == 0 {
+		c.RetryInterval = time.Second
+	}
+	if c.clock == nil {
+		c.clock = clock.RealClock{}
+	}
+	c.written = map[model.ConfigKey]writtenStatus{}
+
+	restConfig = rest.CopyConfig(restConfig)
+	restConfig.QPS = c.QPS
+	restConfig.Burst = c.Burst
+	var err error
+	if c.client, err = dynamic.NewForConfig(restConfig); err != nil {
+		scope.Errorf("Could not connect to kubernetes: %s", err)
+		return
+	}
+	go c.run(status.NewIstioContext(stop))
+}
+
+// run reconciles the status once the store is synced, then on every change of the resources, until the
+// context is done. A failed reconciliation is retried after RetryInterval.
+func (c *StatusController) run(ctx context.Context) {
+	if !cache.WaitForCacheSync(ctx.Done(), c.store.HasSynced) {
+		return
+	}
+	c.enqueue()
+	var retry <-chan time.Time
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-c.queue:
+		case <-retry:
+		}
+		retry = nil
+		if !c.reconcile(ctx) {
+			retry = c.clock.After(c.RetryInterval)
+		}
+	}
+}
+
+// reconcile writes the status of the resources whose version or desired status changed since the last
+// reconciliation. It returns false if the status of some resources could not be written.
+func (c *StatusController) reconcile(ctx context.Context) bool {
+	input, err := listResources(c.store, metav1.NamespaceAll)
+	if err != nil {
+		scope.Errorf("Failed to list gateway resources: %v", err)
+		return false
+	}
+	ok := true
+	desired := buildStatuses(input, convertResources(input).Errors)
+	for key, s := range desired {
+		if w, f := c.written[key]; f && w.resourceVersion == s.config.ResourceVersion && reflect.DeepEqual(w.status, s.status) {
+			continue
+		}
+		resourceVersion, err := c.writeStatus(ctx, s)
+		if err != nil {
+			scope.Errorf("Encountered unexpected error updating status for %s %s/%s, will try again later: %v",
+				s.config.Type, s.config.Namespace, s.config.Name, err)
+			ok = false
+			continue
+		}
+		c.written[key] = writtenStatus{resourceVersion: resourceVersion, status: s.status}
+	}
+	for key := range c.written {
+		if _, f := desired[key]; !f {
+			delete(c.written, key)
+		}
+	}
+	return ok
+}
+
+// writeStatus updates the status of a resource if needed, and returns its resource version.
+func (c *StatusController) writeStatus(ctx context.Context, s *desiredStatus) (string, error) {
+	gvr := status.GVKtoGVR(s.config.GroupVersionKind())
+	if gvr == nil {
+		return "", fmt.Errorf("unknown kind %v", s.config.GroupVersionKind())
+	}
+	resourceInterface := c.client.Resource(*gvr).Namespace(s.config.Namespace)
+	current, err := resourceInterface.Get(ctx, s.config.Name, metav1.GetOptions{})
+	if err != nil {
+		return "", err
+	}
+	result, changed := reconcileStatus(current.Object["status"], s, c.clock.Now())
+	if !changed {
+		return current.GetResourceVersion(), nil
+	}
+
+	b, err := json.Marshal(result)
+	if err != nil {
+		return "", err
+	}
+	var obj map[string]interface{}
+	if err := json.Unmarshal(b, &obj); err != nil {
+		return "", err
+	}
+	current.Object["status"] = obj
+	updated, err := resourceInterface.UpdateStatus(ctx, current, metav1.UpdateOptions{})
+	if err != nil {
+		return "", err
+	}
+	return updated.GetResourceVersion(), nil
+}
@@ -0,0 +1,312 @@
+// Copyright 2020 Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package gateway
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/dynamic/fake"
+	"k8s.io/utils/clock"
+	k8s "sigs.k8s.io/service-apis/api/v1alpha1"
+
+	"istio.io/istio/pilot/pkg/config/memory"
+	"istio.io/istio/pilot/pkg/model"
+	"istio.io/istio/pkg/config/schema/collection"
+	"istio.io/istio/pkg/config/schema/collections"
+	"istio.io/istio/pkg/config/schema/resource"
+	"istio.io/istio/pkg/test/util/retry"
+)
+
+// summarizeConditions returns the type, status and reason of the conditions, "type=status" if the reason is empty.
+func summarizeConditions(conditions []k8s.GatewayCondition) string {
+	var out []string
+	for _, c := range conditions {
+		s := fmt.Sprintf("%s=%s", c.Type, c.Status)
+		if c.Reason != "" {
+			s += ":" + c.Reason
+		}
+		out = append(out, s)
+	}
+	return strings.Join(out, " ")
+}
+
+// summarizeStatus returns the conditions of a GatewayClass or a Gateway, with the conditions of the listeners
+// of a Gateway, or the Gateways of an HTTPRoute.
+func summarizeStatus(status interface{}) string {
+	switch s := status.(type) {
+	case k8s.GatewayClassStatus:
+		return summarizeConditions(fromGatewayClassConditions(s.Conditions))
+	case k8s.GatewayStatus:
+		out := summarizeConditions(s.Conditions)
+		for _, l := range s.Listeners {
+			var conditions []k8s.GatewayCondition
+			for _, c := range l.Conditions {
+				conditions = append(conditions, k8s.GatewayCondition{Type: k8s.GatewayConditionType(c.Type), Status: c.Status, Reason: c.Reason})
+			}
+			out += fmt.Sprintf(" %s[%s]", l.Name, summarizeConditions(conditions))
+		}
+		return out
+	case k8s.HTTPRouteStatus:
+		var gateways []string
+		for _, g := range s.Gateways {
+			gateways = append(gateways, g.Namespace+"/"+g.Name)
+		}
+		return strings.Join(gateways, ",")
+	}
+	return fmt.Sprintf("unexpected status %T", status)
+}
+
+func TestBuildStatuses(t *testing.T) {
+	class := "Accepted=True:Accepted ResolvedRefs=True:ResolvedRefs Ready=True:Ready InvalidParameters=False"
+	listener := "InvalidListener=False ListenerNotReady=False"
+	cases := []struct {
+		name     string
+		expected map[string]string
+	}{
+		{
+			name: "simple",
+			expected: map[string]string{
+				"istio": class,
+				"gateway": "Accepted=True:Accepted ResolvedRefs=True:ResolvedRefs Ready=True:Ready " +
+					"InvalidListeners=False ListenersNotReady=False InvalidRoutes=False primary[" + listener + "]",
+				"http": "istio-system/gateway",
+			},
+		},
+		{
+			// Gateways of other classes are left to their controller.
+			name: "mismatch",
+			expected: map[string]string{
+				"istio": class,
+			},
+		},
+		{
+			// The errors of the HTTPRoute are reported on the Gateway, as InvalidRoutes.
+			name: "invalid",
+			expected: map[string]string{
+				"istio": class,
+				"gateway": "Accepted=False:UnsupportedFeature ResolvedRefs=False:InvalidRefs Ready=False:NotAccepted " +
+					"InvalidListeners=True:UnsupportedFeature ListenersNotReady=True:InvalidListeners InvalidRoutes=True:InvalidRoutes " +
+					"primary[" + listener + "] no-port[InvalidListener=True:UnsupportedFeature ListenerNotReady=True:Invalid]",
+				"http": "istio-system/gateway",
+			},
+		},
+	}
+	for _, tt := range cases {
+		t.Run(tt.name, func(t *testing.T) {
+			input := splitInput(readConfig(t, "testdata/"+tt.name+".yaml"))
+			statuses := buildStatuses(input, convertResources(input).Errors)
+
+			got := map[string]string{}
+			for key, s := range statuses {
+				got[key.Name] = summarizeStatus(s.status)
+			}
+			if !reflect.DeepEqual(got, tt.expected) {
+				t.Errorf("expected %v, got %v", tt.expected, got)
+			}
+		})
+	}
+
+	input := splitInput(readConfig(t, "testdata/invalid.yaml"))
+	for key, s := range buildStatuses(input, convertResources(input).Errors) {
+		if key.Name != "gateway" {
+			continue
+		}
+		for _, c := range s.status.(k8s.GatewayStatus).Conditions {
+			if c.Type == k8s.ConditionInvalidRoutes && !strings.Contains(c.Message, "HTTPRoute http: ") {
+				t.Errorf("expected the errors of the HTTPRoute to be reported on the Gateway, got %v", c)
+			}
+		}
+	}
+}
+
+func TestReconcileStatus(t *testing.T) {
+	then := metav1.NewTime(time.Date(2020, 5, 1, 10, 0, 0, 0, time.UTC))
+	now := time.Date(2020, 5, 2, 10, 0, 0, 0, time.UTC)
+	condition := func(typ, status, reason string) map[string]interface{} {
+		c := map[string]interface{}{"type": typ, "status": status, "lastTransitionTime": then.UTC().Format(time.RFC3339)}
+		if reason != "" {
+			c["reason"] = reason
+		}
+		return c
+	}
+	current := map[string]interface{}{
+		"conditions": []interface{}{
+			condition(ConditionAccepted, "True", "Accepted"),
+			condition(ConditionReady, "True", "Ready"),
+		},
+		"listeners": []interface{}{
+			map[string]interface{}{"name": "primary", "conditions": []interface{}{
+				condition(string(k8s.ConditionInvalidListener), "False", ""),
+			}},
+		},
+	}
+
+	desired := &desiredStatus{status: k8s.GatewayStatus{
+		Conditions: []k8s.GatewayCondition{
+			newCondition(ConditionAccepted, true, "Accepted", ""),
+			newCondition(ConditionReady, true, "Ready", ""),
+		},
+		Listeners: []k8s.ListenerStatus{{
+			Name:       "primary",
+			Conditions: []k8s.ListenerCondition{newListenerCondition(k8s.ConditionInvalidListener, false, "", "")},
+		}},
+	}}
+	result, changed := reconcileStatus(current, desired, now)
+	if changed {
+		t.Errorf("expected no change, got %v", result)
+	}
+
+	desired.status.(k8s.GatewayStatus).Conditions[1] = newCondition(ConditionReady, false, "UnresolvedRefs", "")
+	result, changed = reconcileStatus(current, desired, now)
+	if !changed {
+		t.Fatal("expected a change")
+	}
+	gw := result.(k8s.GatewayStatus)
+	if !gw.Conditions[0].LastTransitionTime.Equal(&then) {
+		t.Errorf("expected the transition time of an unchanged condition to be preserved, got %v", gw.Conditions[0])
+	}
+	if !gw.Conditions[1].LastTransitionTime.Time.Equal(now) {
+		t.Errorf("expected the transition time of a changed condition to be updated, got %v", gw.Conditions[1])
+	}
+	if len(gw.Listeners) != 1 || !gw.Listeners[0].Conditions[0].LastTransitionTime.Equal(&then) {
+		t.Errorf("expected the listener status to be preserved, got %v", gw.Listeners)
+	}
+
+	if _, changed := reconcileStatus(nil, desired, now); !changed {
+		t.Error("expected a resource without status to be changed")
+	}
+
+	class := &desiredStatus{status: k8s.GatewayClassStatus{Conditions: toGatewayClassConditions([]k8s.GatewayCondition{
+		newCondition(ConditionAccepted, true, "Accepted", ""),
+	})}}
+	classStatus := map[string]interface{}{"conditions": []interface{}{condition(ConditionAccepted, "True", "Accepted")}}
+	if result, changed := reconcileStatus(classStatus, class, now); changed {
+		t.Errorf("expected no change of the GatewayClass status, got %v", result)
+	}
+}
+
+func TestReconcileHTTPRouteStatus(t *testing.T) {
+	current := map[string]interface{}{
+		"gateways": []interface{}{
+			map[string]interface{}{"namespace": "other", "name": "foreign"},
+			map[string]interface{}{"namespace": "istio-system", "name": "unbound"},
+		},
+	}
+	desired := &desiredStatus{
+		status: k8s.HTTPRouteStatus{Gateways: []k8s.GatewayObjectReference{{Namespace: "istio-system", Name: "gateway"}}},
+		istioGateways: map[k8s.GatewayObjectReference]bool{
+			{Namespace: "istio-system", Name: "gateway"}: true,
+			{Namespace: "istio-system", Name: "unbound"}: true,
+		},
+	}
+	result, changed := reconcileStatus(current, desired, time.Now())
+	if !changed {
+		t.Fatal("expected a change")
+	}
+	expected := k8s.HTTPRouteStatus{Gateways: []k8s.GatewayObjectReference{
+		{Namespace: "istio-system", Name: "gateway"},
+		{Namespace: "other", Name: "foreign"},
+	}}
+	if !reflect.DeepEqual(result, expected) {
+		t.Errorf("expected the Gateways of other controllers to be preserved: expected %v, got %v", expected, result)
+	}
+}
+
+// lockedStore serializes the accesses to the in-memory store, which is not safe for concurrent use.
+type lockedStore struct {
+	model.ConfigStoreCache
+	mu sync.Mutex
+}
+
+func (s *lockedStore) List(typ resource.GroupVersionKind, namespace string) ([]model.Config, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.ConfigStoreCache.List(typ, namespace)
+}
+
+func (s *lockedStore) Create(config model.Config) (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.ConfigStoreCache.Create(config)
+}
+
+func (s *lockedStore) Update(config model.Config) (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.ConfigStoreCache.Update(config)
+}
+
+func TestStatusControllerReconcilesOnEvents(t *testing.T) {
+	store := &lockedStore{ConfigStoreCache: memory.NewController(memory.Make(collection.SchemasFor(statusKinds...)))}
+	c := NewStatusController(store)
+	c.client = fake.NewSimpleDynamicClient(runtime.NewScheme(), &unstructured.Unstructured{Object: map[string]interface{}{
+		"apiVersion": "networking.x.k8s.io/v1alpha1",
+		"kind":       "GatewayClass",
+		"metadata":   map[string]interface{}{"name": "istio"},
+	}})
+	c.clock = clock.RealClock{}
+	c.RetryInterval = time.Hour
+	c.written = map[model.ConfigKey]writtenStatus{}
+
+	class := collections.K8SServiceApisV1Alpha1Gatewayclasses.Resource()
+	config := model.Config{
+		ConfigMeta: model.ConfigMeta{Type: class.Kind(), Group: class.Group(), Version: class.Version(), Name: "istio"},
+		Spec:       &k8s.GatewayClassSpec{Controller: ControllerName},
+	}
+	if _, err := store.Create(config); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go store.Run(ctx.Done())
+	go c.run(ctx)
+
+	gvr := schema.GroupVersionResource{Group: class.Group(), Version: class.Version(), Resource: class.Plural()}
+	expectInvalidParameters := func(status string) {
+		t.Helper()
+		retry.UntilSuccessOrFail(t, func() error {
+			obj, err := c.client.Resource(gvr).Get(ctx, "istio", metav1.GetOptions{})
+			if err != nil {
+				return err
+			}
+			conditions, _, _ := unstructured.NestedSlice(obj.Object, "status", "conditions")
+			for _, c := range conditions {
+				if c := c.(map[string]interface{}); c["type"] == string(k8s.GatewayClassConditionStatusInvalidParameters) && c["status"] == status {
+					return nil
+				}
+			}
+			return fmt.Errorf("expected InvalidParameters=%s, got %v", status, conditions)
+		}, retry.Timeout(5*time.Second))
+	}
+	expectInvalidParameters("False")
+
+	// The status is reconciled on the update of the GatewayClass.
+	config.Spec = &k8s.GatewayClassSpec{Controller: ControllerName, ParametersRef: &k8s.GatewayClassParametersObjectReference{Name: "params"}}
+	if _, err := store.Update(config); err != nil {
+		t.Fatal(err)
+	}
+	expectInvalidParameters("True")
+}
@@ -80,6 +80,69 @@ var (
 			"for this time, we'll trigger a push.",
 	).Get()
 
+	PushPriorityNamespaces = env.RegisterStringVar(
+		"PILOT_PUSH_PRIORITY_NAMESPACES",
+		"",
+		"Comma separated list of namespaces whose proxies are pushed ahead of other sidecars. "+
+			"Gateways are always pushed ahead of sidecars.",
+	).Get()
+
+	PushPriorityLabels = env.RegisterStringVar(
+		"PILOT_PUSH_PRIORITY_LABELS",
+		"",
+		"Workload labels, in the form k1=v1,k2=v2, selecting proxies that are pushed ahead of other sidecars. "+
+			"A proxy is selected if it has all of the labels.",
+	).Get()
+
+	PushPriorityAging = env.RegisterDurationVar(
+		"PILOT_PUSH_PRIORITY_AGING",
+		5*time.Second,
+		"Proxies waiting in the push queue are raised one priority level for each interval of this length, "+
+			"so lower priority proxies are never starved. If set to 0, priorities are strict.",
+	).Get()
+
+	EnableAdaptiveDebounce = env.RegisterBoolVar(
+		"PILOT_ENABLE_ADAPTIVE_DEBOUNCE",
+		false,
+		"If enabled, the debounce quiet period starts at PILOT_DEBOUNCE_AFTER and adapts to the observed config "+
+			"event rate and push duration, between PILOT_DEBOUNCE_AFTER_MIN and PILOT_DEBOUNCE_AFTER_MAX. "+
+			"PILOT_DEBOUNCE_MAX still bounds the total delay of a push.",
+	).Get()
+
+	DebounceAfterMin = env.RegisterDurationVar(
+		"PILOT_DEBOUNCE_AFTER_MIN",
+		10*time.Millisecond,
+		"The smallest debounce quiet period used when PILOT_ENABLE_ADAPTIVE_DEBOUNCE is set, applied when the mesh is calm.",
+	).Get()
+
+	DebounceAfterMax = env.RegisterDurationVar(
+		"PILOT_DEBOUNCE_AFTER_MAX",
+		time.Second,
+		"The largest debounce quiet period used when PILOT_ENABLE_ADAPTIVE_DEBOUNCE is set, applied under "+
+			"heavy config churn or slow pushes.",
+	).Get()
+
+	EnableConfigCache = env.RegisterBoolVar(
+		"PILOT_ENABLE_CONFIG_CACHE",
+		false,
+		"If enabled, Pilot will cache the generated clusters, listeners and routes of each proxy, and reuse them "+
+			"until a config they depend on changes. Routes are shared by the sidecars of a workload.",
+	).Get()
+
+	EnableNackRollback = env.RegisterBoolVar(
+		"PILOT_ENABLE_NACK_ROLLBACK",
+		false,
+		"If enabled, when a proxy rejects a resource Pilot will keep sending it the last version of that resource "+
+			"the proxy accepted, until the resource changes again. Other resources are pushed as usual.",
+	).Get()
+
+	OnDemandClusterIdleTimeout = env.RegisterDurationVar(
+		"PILOT_ON_DEMAND_CLUSTER_IDLE_TIMEOUT",
+		30*time.Minute,
+		"For sidecars loading clusters on demand (ON_DEMAND_CLUSTERS metadata), the time after which a "+
+			"destination is removed if it was not requested again. The sidecar requests it again on the next request.",
+	).Get()
+
 	EnableEDSDebounce = env.RegisterBoolVar(
 		"PILOT_ENABLE_EDS_DEBOUNCE",
 		true,
@@ -137,6 +200,30 @@ var (
 		"EnableMysqlFilter enables injection of `envoy.filters.network.mysql_proxy` in the filter chain.",
 	).Get()
 
+	// EnableKafkaFilter enables injection of `envoy.filters.network.kafka_broker` in the filter chain.
+	// Pilot injects this inbound and outbound filter if the service port name is `kafka`.
+	EnableKafkaFilter = env.RegisterBoolVar(
+		"PILOT_ENABLE_KAFKA_FILTER",
+		false,
+		"EnableKafkaFilter enables injection of `envoy.filters.network.kafka_broker` in the filter chain.",
+	).Get()
+
+	// EnablePostgresFilter enables injection of `envoy.filters.network.postgres_proxy` in the filter chain.
+	// Pilot injects this outbound filter if the service port name is `postgres`.
+	EnablePostgresFilter = env.RegisterBoolVar(
+		"PILOT_ENABLE_POSTGRES_FILTER",
+		false,
+		"EnablePostgresFilter enables injection of `envoy.filters.network.postgres_proxy` in the filter chain.",
+	).Get()
+
+	// EnableZooKeeperFilter enables injection of `envoy.filters.network.zookeeper_proxy` in the filter chain.
+	// Pilot injects this outbound filter if the service port name is `zookeeper`.
+	EnableZooKeeperFilter = env.RegisterBoolVar(
+		"PILOT_ENABLE_ZOOKEEPER_FILTER",
+		false,
+		"EnableZooKeeperFilter enables injection of `envoy.filters.network.zookeeper_proxy` in the filter chain.",
+	).Get()
+
 	// EnableRedisFilter enables injection of `envoy.filters.network.redis_proxy` in the filter chain.
 	// Pilot injects this outbound filter if the service port name is `redis`.
 	EnableRedisFilter = env.RegisterBoolVar(
@@ -161,6 +248,36 @@ var (
 		"EnableThriftFilter enables injection of `envoy.filters.network.thrift_proxy` in the filter chain.",
 	).Get()
 
+	// EnableUDPProxy enables the UDP service ports. Pilot builds `envoy.filters.udp_listener.udp_proxy`
+	// listeners and clusters for the UDP ports of services and gateway servers.
+	EnableUDPProxy = env.RegisterBoolVar(
+		"PILOT_ENABLE_UDP_PROXY",
+		false,
+		"EnableUDPProxy enables `envoy.filters.udp_listener.udp_proxy` listeners and clusters for UDP service ports.",
+	).Get()
+
+	// EnableHTTPRateLimit enables the global rate limiting of HTTP requests with the rate limit service of the
+	// mesh config, meshConfig.thriftConfig.rateLimitUrl, which is otherwise only used by the Thrift ports.
+	EnableHTTPRateLimit = env.RegisterBoolVar(
+		"PILOT_ENABLE_HTTP_RATE_LIMIT",
+		false,
+		"EnableHTTPRateLimit enables `envoy.filters.http.ratelimit` on the sidecar outbound and gateway HTTP "+
+			"listeners, calling the rate limit service of meshConfig.thriftConfig.rateLimitUrl.",
+	).Get()
+
+	RetryBudgetMinConcurrency = env.RegisterIntVar(
+		"PILOT_RETRY_BUDGET_MIN_CONCURRENCY",
+		3,
+		"The number of concurrent retries always allowed by a retry budget, regardless of the active requests.",
+	).Get()
+
+	ExtAuthzTimeout = env.RegisterDurationVar(
+		"PILOT_EXT_AUTHZ_TIMEOUT",
+		600*time.Millisecond,
+		"The timeout of the calls to the external authorizers. Requests are denied if the external authorizer "+
+			"does not answer in time.",
+	).Get()
+
 	// SkipValidateTrustDomain tells the server proxy to not to check the peer's trust domain when
 	// mTLS is enabled in authentication policy.
 	SkipValidateTrustDomain = env.RegisterBoolVar(
@@ -35,6 +35,8 @@ const (
 	// doing the ingress syncing.
 	IngressController = "istio-leader"
 	StatusController  = "istio-status-leader"
+	// GatewayStatusController writes the status of the Kubernetes gateway API resources.
+	GatewayStatusController = "istio-gateway-status-leader"
 )
 
 type LeaderElection struct {
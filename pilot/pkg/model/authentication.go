@@ -74,9 +74,9 @@ type AuthenticationPolicies struct {
 	rootNamespace string
 }
 
-// initAuthenticationPolicies creates a new AuthenticationPolicies struct and populates with the
+// GetAuthenticationPolicies creates a new AuthenticationPolicies struct and populates with the
 // authentication policies in the mesh environment.
-func initAuthenticationPolicies(env *Environment) (*AuthenticationPolicies, error) {
+func GetAuthenticationPolicies(env *Environment) (*AuthenticationPolicies, error) {
 	policy := &AuthenticationPolicies{
 		requestAuthentications: map[string][]Config{},
 		peerAuthentications:    map[string][]Config{},
@@ -781,7 +781,7 @@ func getTestAuthenticationPolicies(configs []*Config, t *testing.T) *Authenticat
 		IstioConfigStore: MakeIstioStore(configStore),
 		Watcher:          mesh.NewFixedWatcher(&meshconfig.MeshConfig{RootNamespace: rootNamespace}),
 	}
-	authnPolicy, err := initAuthenticationPolicies(environment)
+	authnPolicy, err := GetAuthenticationPolicies(environment)
 	if err != nil {
 		t.Fatalf("getTestAuthenticationPolicies %v", err)
 	}
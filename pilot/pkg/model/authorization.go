@@ -15,6 +15,8 @@
 package model
 
 import (
+	"strconv"
+
 	authpb "istio.io/api/security/v1beta1"
 
 	"istio.io/istio/pkg/config/labels"
@@ -26,10 +28,42 @@ var (
 	authzLog = istiolog.RegisterScope("authorization", "Istio Authorization Policy", 0)
 )
 
+const (
+	// AuthorizationActionAnnotation on an AuthorizationPolicy overrides its action with an action that the
+	// v1beta1 API does not have yet: AuthorizationActionAudit or AuthorizationActionCustom.
+	AuthorizationActionAnnotation = "security.istio.io/action"
+	// AuthorizationProviderAnnotation on a CUSTOM AuthorizationPolicy is the name of the external authorizer
+	// making the decision, declared in the extAuthzProviders extension of the mesh config.
+	AuthorizationProviderAnnotation = "security.istio.io/provider"
+	// AuthorizationDryRunAnnotation set to "true" on an ALLOW or DENY AuthorizationPolicy evaluates the policy
+	// in shadow mode: the result it would have is recorded in the access log metadata and stats, but not
+	// enforced.
+	AuthorizationDryRunAnnotation = "istio.io/dry-run"
+
+	// AuthorizationActionAudit marks the matching requests for access logging, without enforcing anything.
+	AuthorizationActionAudit = "AUDIT"
+	// AuthorizationActionCustom delegates the decision on the matching requests to an external authorizer.
+	AuthorizationActionCustom = "CUSTOM"
+)
+
 type AuthorizationPolicyConfig struct {
 	Name                string                      `json:"name"`
 	Namespace           string                      `json:"namespace"`
 	AuthorizationPolicy *authpb.AuthorizationPolicy `json:"authorization_policy"`
+	// Action is the action set by the AuthorizationActionAnnotation, if any.
+	Action string `json:"action,omitempty"`
+	// Provider is the external authorizer set by the AuthorizationProviderAnnotation, if any.
+	Provider string `json:"provider,omitempty"`
+	// DryRun is set by the AuthorizationDryRunAnnotation.
+	DryRun bool `json:"dry_run,omitempty"`
+}
+
+// AuthorizationPoliciesResult holds the authorization policies of a workload, by action.
+type AuthorizationPoliciesResult struct {
+	Custom []AuthorizationPolicyConfig
+	Deny   []AuthorizationPolicyConfig
+	Allow  []AuthorizationPolicyConfig
+	Audit  []AuthorizationPolicyConfig
 }
 
 // AuthorizationPolicies organizes authorization policies by namespace.
@@ -60,10 +94,10 @@ func GetAuthorizationPolicies(env *Environment) (*AuthorizationPolicies, error)
 	return policy, nil
 }
 
-// ListAuthorizationPolicies returns the AuthorizationPolicy for the workload in root namespace and the config namespace.
-// The first one in the returned tuple is the deny policies and the second one is the allow policies.
+// ListAuthorizationPolicies returns the AuthorizationPolicy for the workload in root namespace and the config namespace,
+// by action.
 func (policy *AuthorizationPolicies) ListAuthorizationPolicies(configNamespace string, workloadLabels labels.Collection) (
-	denyPolicies []AuthorizationPolicyConfig, allowPolicies []AuthorizationPolicyConfig) {
+	result AuthorizationPoliciesResult) {
 	if policy == nil {
 		return
 	}
@@ -81,15 +115,26 @@ func (policy *AuthorizationPolicies) ListAuthorizationPolicies(configNamespace s
 		for _, config := range policy.NamespaceToV1beta1Policies[ns] {
 			spec := config.AuthorizationPolicy
 			selector := labels.Instance(spec.GetSelector().GetMatchLabels())
-			if workloadLabels.IsSupersetOf(selector) {
+			if !workloadLabels.IsSupersetOf(selector) {
+				continue
+			}
+			switch config.Action {
+			case AuthorizationActionAudit:
+				result.Audit = append(result.Audit, config)
+			case AuthorizationActionCustom:
+				result.Custom = append(result.Custom, config)
+			case "":
 				switch config.AuthorizationPolicy.GetAction() {
 				case authpb.AuthorizationPolicy_ALLOW:
-					allowPolicies = append(allowPolicies, config)
+					result.Allow = append(result.Allow, config)
 				case authpb.AuthorizationPolicy_DENY:
-					denyPolicies = append(denyPolicies, config)
+					result.Deny = append(result.Deny, config)
 				default:
 					log.Errorf("found authorization policy with unsupported action: %s", config.AuthorizationPolicy.GetAction())
 				}
+			default:
+				log.Errorf("found authorization policy %s/%s with unsupported %s annotation: %s",
+					config.Namespace, config.Name, AuthorizationActionAnnotation, config.Action)
 			}
 		}
 	}
@@ -107,6 +152,16 @@ func (policy *AuthorizationPolicies) addAuthorizationPolicies(configs []Config)
 			Name:                config.Name,
 			Namespace:           config.Namespace,
 			AuthorizationPolicy: config.Spec.(*authpb.AuthorizationPolicy),
+			Action:              config.Annotations[AuthorizationActionAnnotation],
+			Provider:            config.Annotations[AuthorizationProviderAnnotation],
+		}
+		if value, f := config.Annotations[AuthorizationDryRunAnnotation]; f {
+			dryRun, err := strconv.ParseBool(value)
+			if err != nil {
+				authzLog.Warnf("ignoring invalid %s annotation %q of authorization policy %s/%s",
+					AuthorizationDryRunAnnotation, value, config.Namespace, config.Name)
+			}
+			authzConfig.DryRun = dryRun
 		}
 		policy.NamespaceToV1beta1Policies[config.Namespace] =
 			append(policy.NamespaceToV1beta1Policies[config.Namespace], authzConfig)
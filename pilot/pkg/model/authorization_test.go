@@ -70,6 +70,8 @@ func TestAuthorizationPolicies_ListAuthorizationPolicies(t *testing.T) {
 		configs        []Config
 		wantDeny       []AuthorizationPolicyConfig
 		wantAllow      []AuthorizationPolicyConfig
+		wantAudit      []AuthorizationPolicyConfig
+		wantCustom     []AuthorizationPolicyConfig
 	}{
 		{
 			name:      "no policies",
@@ -265,19 +267,85 @@ func TestAuthorizationPolicies_ListAuthorizationPolicies(t *testing.T) {
 				},
 			},
 		},
+		{
+			name: "audit and custom policies",
+			ns:   "bar",
+			configs: []Config{
+				newConfigWithAnnotations("authz-1", "bar", policy, map[string]string{
+					AuthorizationActionAnnotation: AuthorizationActionAudit,
+				}),
+				newConfigWithAnnotations("authz-2", "bar", policy, map[string]string{
+					AuthorizationActionAnnotation:   AuthorizationActionCustom,
+					AuthorizationProviderAnnotation: "opa",
+				}),
+				newConfigWithAnnotations("authz-3", "bar", policy, map[string]string{
+					AuthorizationActionAnnotation: "LOG",
+				}),
+			},
+			wantAudit: []AuthorizationPolicyConfig{
+				{
+					Name:                "authz-1",
+					Namespace:           "bar",
+					AuthorizationPolicy: policy,
+					Action:              AuthorizationActionAudit,
+				},
+			},
+			wantCustom: []AuthorizationPolicyConfig{
+				{
+					Name:                "authz-2",
+					Namespace:           "bar",
+					AuthorizationPolicy: policy,
+					Action:              AuthorizationActionCustom,
+					Provider:            "opa",
+				},
+			},
+		},
+		{
+			name: "dry-run policies",
+			ns:   "bar",
+			configs: []Config{
+				newConfigWithAnnotations("authz-1", "bar", policy, map[string]string{
+					AuthorizationDryRunAnnotation: "true",
+				}),
+				newConfigWithAnnotations("authz-2", "bar", denyPolicy, map[string]string{
+					AuthorizationDryRunAnnotation: "invalid",
+				}),
+			},
+			wantAllow: []AuthorizationPolicyConfig{
+				{
+					Name:                "authz-1",
+					Namespace:           "bar",
+					AuthorizationPolicy: policy,
+					DryRun:              true,
+				},
+			},
+			wantDeny: []AuthorizationPolicyConfig{
+				{
+					Name:                "authz-2",
+					Namespace:           "bar",
+					AuthorizationPolicy: denyPolicy,
+				},
+			},
+		},
 	}
 
 	for _, tc := range cases {
 		t.Run(tc.name, func(t *testing.T) {
 			authzPolicies := createFakeAuthorizationPolicies(tc.configs, t)
 
-			gotDeny, gotAllow := authzPolicies.ListAuthorizationPolicies(
+			got := authzPolicies.ListAuthorizationPolicies(
 				tc.ns, []labels.Instance{tc.workloadLabels})
-			if !reflect.DeepEqual(tc.wantAllow, gotAllow) {
-				t.Errorf("wantAllow:%v\n but got: %v\n", tc.wantAllow, gotAllow)
+			if !reflect.DeepEqual(tc.wantAllow, got.Allow) {
+				t.Errorf("wantAllow:%v\n but got: %v\n", tc.wantAllow, got.Allow)
+			}
+			if !reflect.DeepEqual(tc.wantDeny, got.Deny) {
+				t.Errorf("wantDeny:%v\n but got: %v\n", tc.wantDeny, got.Deny)
+			}
+			if !reflect.DeepEqual(tc.wantAudit, got.Audit) {
+				t.Errorf("wantAudit:%v\n but got: %v\n", tc.wantAudit, got.Audit)
 			}
-			if !reflect.DeepEqual(tc.wantDeny, gotDeny) {
-				t.Errorf("wantDeny:%v\n but got: %v\n", tc.wantDeny, gotDeny)
+			if !reflect.DeepEqual(tc.wantCustom, got.Custom) {
+				t.Errorf("wantCustom:%v\n but got: %v\n", tc.wantCustom, got.Custom)
 			}
 		})
 	}
@@ -299,6 +367,12 @@ func createFakeAuthorizationPolicies(configs []Config, t *testing.T) *Authorizat
 	return authzPolicies
 }
 
+func newConfigWithAnnotations(name, ns string, spec proto.Message, annotations map[string]string) Config {
+	cfg := newConfig(name, ns, spec)
+	cfg.Annotations = annotations
+	return cfg
+}
+
 func newConfig(name, ns string, spec proto.Message) Config {
 	var kind, version, group string
 
@@ -89,6 +89,16 @@ func (e *Environment) Mesh() *meshconfig.MeshConfig {
 	return nil
 }
 
+// MeshExtensions returns the extensions of the mesh config, which are empty without mesh config.
+func (e *Environment) MeshExtensions() *mesh.MeshExtensions {
+	if e != nil && e.Watcher != nil {
+		if extensions := e.Watcher.MeshExtensions(); extensions != nil {
+			return extensions
+		}
+	}
+	return &mesh.MeshExtensions{}
+}
+
 func (e *Environment) AddMeshHandler(h func()) {
 	if e != nil && e.Watcher != nil {
 		e.Watcher.AddMeshHandler(h)
@@ -236,6 +246,10 @@ type WatchedResource struct {
 
 	// LastSize tracks the size of the last update
 	LastSize int
+
+	// LastRequested tracks, for resources loaded on demand, the last time each of the ResourceNames was
+	// listed by a request or ACK. Resources not listed again within the idle timeout are removed.
+	LastRequested map[string]time.Time
 }
 
 var (
@@ -470,6 +484,11 @@ type NodeMetadata struct {
 	// Generator indicates the client wants to use a custom Generator plugin.
 	Generator string `json:"GENERATOR,omitempty"`
 
+	// OnDemandClusters, if set, makes the sidecar start with a minimal set of outbound clusters. The
+	// virtual hosts of HTTP destinations, and the clusters they use, are loaded the first time the
+	// destination is requested, using VHDS. Requires the incremental ADS protocol.
+	OnDemandClusters StringBool `json:"ON_DEMAND_CLUSTERS,omitempty"`
+
 	// Contains a copy of the raw metadata. This is needed to lookup arbitrary values.
 	// If a value is known ahead of time it should be added to the struct rather than reading from here,
 	Raw map[string]interface{} `json:"-"`
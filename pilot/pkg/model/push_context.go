@@ -30,7 +30,7 @@ import (
 	"istio.io/istio/pkg/config/constants"
 	"istio.io/istio/pkg/config/host"
 	"istio.io/istio/pkg/config/labels"
-	"istio.io/istio/pkg/config/protocol"
+	"istio.io/istio/pkg/config/mesh"
 	"istio.io/istio/pkg/config/schema/collections"
 	"istio.io/istio/pkg/config/visibility"
 )
@@ -116,6 +116,9 @@ type PushContext struct {
 	// Mesh configuration for the mesh.
 	Mesh *meshconfig.MeshConfig `json:"-"`
 
+	// MeshExtensions are the settings of the mesh configuration that MeshConfig does not define.
+	MeshExtensions *mesh.MeshExtensions `json:"-"`
+
 	// Networks configuration.
 	Networks *meshconfig.MeshNetworks `json:"-"`
 
@@ -365,6 +368,13 @@ var (
 		"Number of conflicting wildcard http listeners with current wildcard tcp listener.",
 	)
 
+	// ProxyStatusConflictOutboundListenerUDP metric tracks number of UDP ports
+	// shared by several services, which have no outbound UDP listener
+	ProxyStatusConflictOutboundListenerUDP = monitoring.NewGauge(
+		"pilot_conflict_outbound_listener_udp",
+		"Number of UDP ports shared by several services, without outbound udp listener.",
+	)
+
 	// ProxyStatusConflictInboundListener tracks cases of multiple inbound
 	// listeners - 2 services selecting the same port of the pod.
 	ProxyStatusConflictInboundListener = monitoring.NewGauge(
@@ -424,6 +434,7 @@ var (
 		ProxyStatusConflictOutboundListenerTCPOverHTTP,
 		ProxyStatusConflictOutboundListenerTCPOverTCP,
 		ProxyStatusConflictOutboundListenerHTTPOverTCP,
+		ProxyStatusConflictOutboundListenerUDP,
 		ProxyStatusConflictInboundListener,
 		DuplicatedClusters,
 		ProxyStatusClusterNoInstances,
@@ -700,6 +711,16 @@ func (ps *PushContext) GetAllSidecarScopes() map[string][]*SidecarScope {
 	return ps.sidecarsByNamespace
 }
 
+// MeshDestinationRule returns the mesh-wide destination rule, the public destination rule of the config root
+// namespace for the "*" host, or nil if there is none. Its annotations are the mesh-wide defaults of the
+// annotations of the destination rules.
+func (ps *PushContext) MeshDestinationRule() *Config {
+	if ps.Mesh == nil || ps.namespaceExportedDestRules[ps.Mesh.RootNamespace] == nil {
+		return nil
+	}
+	return ps.namespaceExportedDestRules[ps.Mesh.RootNamespace].destRule[host.Name("*")]
+}
+
 // DestinationRule returns a destination rule for a service name in a given domain.
 func (ps *PushContext) DestinationRule(proxy *Proxy, service *Service) *Config {
 	// If proxy has a sidecar scope that is user supplied, then get the destination rules from the sidecar scope
@@ -807,6 +828,7 @@ func (ps *PushContext) InitContext(env *Environment, oldPushContext *PushContext
 	}
 
 	ps.Mesh = env.Mesh()
+	ps.MeshExtensions = env.MeshExtensions()
 	ps.Networks = env.Networks()
 	ps.ServiceDiscovery = env
 	ps.IstioConfigStore = env
@@ -1065,7 +1087,8 @@ func (ps *PushContext) initServiceAccounts(env *Environment, services []*Service
 			ps.ServiceAccounts[svc.Hostname] = map[int][]string{}
 		}
 		for _, port := range svc.Ports {
-			if port.Protocol == protocol.UDP {
+			if _, f := ps.ServiceAccounts[svc.Hostname][port.Port]; f {
+				// UDP and TCP ports may share a number, the service accounts are looked up by number.
 				continue
 			}
 			ps.ServiceAccounts[svc.Hostname][port.Port] = env.GetIstioServiceAccounts(svc, []int{port.Port})
@@ -1077,7 +1100,7 @@ func (ps *PushContext) initServiceAccounts(env *Environment, services []*Service
 func (ps *PushContext) initAuthnPolicies(env *Environment) error {
 	// Init beta policy.
 	var initBetaPolicyErro error
-	if ps.AuthnBetaPolicies, initBetaPolicyErro = initAuthenticationPolicies(env); initBetaPolicyErro != nil {
+	if ps.AuthnBetaPolicies, initBetaPolicyErro = GetAuthenticationPolicies(env); initBetaPolicyErro != nil {
 		return initBetaPolicyErro
 	}
 
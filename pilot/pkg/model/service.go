@@ -187,6 +187,9 @@ const (
 	trafficDirectionOutboundSrvPrefix = string(TrafficDirectionOutbound) + "_"
 	// trafficDirectionInboundSrvPrefix the prefix for a DNS SRV type subset key
 	trafficDirectionInboundSrvPrefix = string(TrafficDirectionInbound) + "_"
+
+	// udpPortSuffix is appended to the port of the subset keys of UDP ports
+	udpPortSuffix = "/udp"
 )
 
 // Probe represents a health probe associated with an instance of service.
@@ -465,6 +468,17 @@ func (ports PortList) GetByPort(num int) (*Port, bool) {
 	return nil, false
 }
 
+// GetUDPByPort retrieves a UDP port declaration by port value. UDP ports may share their number
+// with a TCP port of the same service, they are not returned by GetByPort.
+func (ports PortList) GetUDPByPort(num int) (*Port, bool) {
+	for _, port := range ports {
+		if port.Port == num && port.Protocol == protocol.UDP {
+			return port, true
+		}
+	}
+	return nil, false
+}
+
 // External predicate checks whether the service is external
 func (s *Service) External() bool {
 	return s.MeshExternal
@@ -539,6 +553,19 @@ func BuildDNSSrvSubsetKey(direction TrafficDirection, subsetName string, hostnam
 	return string(direction) + "_." + strconv.Itoa(port) + "_." + subsetName + "_." + string(hostname)
 }
 
+// BuildUDPSubsetKey generates the subset key of a UDP service port. The port is suffixed with
+// "/udp", so the key differs from the key of a TCP port with the same number, for example for DNS.
+// ParseSubsetKey returns the port number without the suffix.
+func BuildUDPSubsetKey(direction TrafficDirection, subsetName string, hostname host.Name, port int) string {
+	return string(direction) + "|" + strconv.Itoa(port) + udpPortSuffix + "|" + subsetName + "|" + string(hostname)
+}
+
+// IsUDPSubsetKey checks if the subset key was built by BuildUDPSubsetKey.
+func IsUDPSubsetKey(s string) bool {
+	parts := strings.Split(s, "|")
+	return len(parts) == 4 && strings.HasSuffix(parts[1], udpPortSuffix)
+}
+
 // IsValidSubsetKey checks if a string is valid for subset key parsing.
 func IsValidSubsetKey(s string) bool {
 	return strings.Count(s, "|") == 3
@@ -564,7 +591,7 @@ func ParseSubsetKey(s string) (direction TrafficDirection, subsetName string, ho
 	}
 
 	direction = TrafficDirection(strings.TrimSuffix(parts[0], "_"))
-	port, _ = strconv.Atoi(strings.TrimSuffix(parts[1], "_"))
+	port, _ = strconv.Atoi(strings.TrimSuffix(strings.TrimSuffix(parts[1], "_"), udpPortSuffix))
 	subsetName = parts[2]
 
 	if dnsSrvMode {
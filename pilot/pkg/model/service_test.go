@@ -50,6 +50,7 @@ func TestParseSubsetKey(t *testing.T) {
 		port       int
 	}{
 		{"outbound|80|v1|example.com", TrafficDirectionOutbound, "v1", "example.com", 80},
+		{"outbound|53/udp||example.com", TrafficDirectionOutbound, "", "example.com", 53},
 		{"", "", "", "", 0},
 		{"|||", "", "", "", 0},
 		{"outbound_.8080_.v1_.foo.example.org", TrafficDirectionOutbound, "v1", "foo.example.org", 8080},
@@ -15,8 +15,10 @@
 package model
 
 import (
+	"hash/fnv"
 	"sort"
 	"strings"
+	"sync"
 
 	networking "istio.io/api/networking/v1alpha3"
 	"istio.io/istio/pkg/config/schema/resource"
@@ -93,6 +95,10 @@ type SidecarScope struct {
 	// This field will be used to determine the config/resource scope
 	// which means which config changes will affect the proxies within this scope.
 	configDependencies map[ConfigKey]struct{}
+
+	// dependenciesHash is computed lazily from configDependencies, see DependenciesHash.
+	dependenciesHashOnce sync.Once
+	dependenciesHash     uint64
 }
 
 // IstioEgressListenerWrapper is a wrapper for
@@ -471,6 +477,34 @@ func (sc *SidecarScope) DependsOnConfig(config ConfigKey) bool {
 	return exists
 }
 
+// DependenciesHash returns a hash of the Sidecar config and the set of configs this scope depends on.
+// Scopes with the same hash select the same configs, although the content of these configs may
+// differ. Config dependencies must not be added after this is called.
+func (sc *SidecarScope) DependenciesHash() uint64 {
+	if sc == nil {
+		return 0
+	}
+	sc.dependenciesHashOnce.Do(func() {
+		keys := make([]string, 0, len(sc.configDependencies)+1)
+		if sc.Config != nil {
+			keys = append(keys, sc.Config.Namespace+"/"+sc.Config.Name)
+		}
+		for config := range sc.configDependencies {
+			keys = append(keys, config.Kind.String()+"/"+config.Namespace+"/"+config.Name)
+		}
+		// The Sidecar config is always first, sort only the dependencies.
+		sort.Strings(keys[len(keys)-len(sc.configDependencies):])
+
+		h := fnv.New64a()
+		for _, key := range keys {
+			_, _ = h.Write([]byte(key))
+			_, _ = h.Write([]byte{0})
+		}
+		sc.dependenciesHash = h.Sum64()
+	})
+	return sc.dependenciesHash
+}
+
 // AddConfigDependencies add extra config dependencies to this scope. This action should be done before the
 // SidecarScope being used to avoid concurrent read/write.
 func (sc *SidecarScope) AddConfigDependencies(dependencies ...ConfigKey) {
@@ -0,0 +1,191 @@
+// Copyright 2020 Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package apigen serves Istio configs over ADS, for clients mirroring the mesh config without
+// access to the Kubernetes API.
+//
+// The type URL of a request is the GroupVersionKind of an Istio collection, as listed in
+// collections.All - for example "networking.istio.io/v1alpha3/VirtualService". Configs are sent
+// enveloped in MCP Resources, holding the "namespace/name", version, labels and annotations of the
+// config in the metadata and the config spec in the body.
+//
+// The metadata version is the resource version of the config, or a hash of its content, and is used
+// as the version of the resource by the ADS server: the encoding of the configs is not deterministic.
+//
+// The mesh config and the cluster scoped configs are only served to clients in the root namespace.
+package apigen
+
+import (
+	"hash/fnv"
+	"strconv"
+
+	"github.com/gogo/protobuf/jsonpb"
+	"github.com/gogo/protobuf/proto"
+	"github.com/gogo/protobuf/types"
+	"github.com/golang/protobuf/ptypes/any"
+
+	mcp "istio.io/api/mcp/v1alpha1"
+	networking "istio.io/api/networking/v1alpha3"
+	istiolog "istio.io/pkg/log"
+
+	"istio.io/istio/pilot/pkg/model"
+	"istio.io/istio/pkg/config/schema/collection"
+	"istio.io/istio/pkg/config/schema/collections"
+)
+
+// ResourceType is the type URL of the resources sent by the generator.
+const ResourceType = "type.googleapis.com/istio.mcp.v1alpha1.Resource"
+
+var log = istiolog.RegisterScope("apigen", "xDS Generator for Istio configs", 0)
+
+// APIGenerator generates the Istio configs of the requested type visible to the proxy.
+type APIGenerator struct{}
+
+var _ model.XdsResourceGenerator = &APIGenerator{}
+
+// Generate returns the configs of the collection identified by the watched type URL. Unknown types
+// get an empty response, as a client may ask for a valid type this Pilot does not know about.
+func (g *APIGenerator) Generate(proxy *model.Proxy, push *model.PushContext, w *model.WatchedResource) model.Resources {
+	resp := model.Resources{}
+	schema, found := findSchema(w.TypeUrl)
+	if !found {
+		log.Warnf("unknown type %s requested by %s", w.TypeUrl, proxy.ID)
+		return resp
+	}
+
+	if schema.Resource().GroupVersionKind() == collections.IstioMeshV1Alpha1MeshConfig.Resource().GroupVersionKind() {
+		if !inRootNamespace(proxy, push) {
+			log.Debugf("mesh config requested by %s, outside of the root namespace", proxy.ID)
+			return resp
+		}
+		r, err := toResource(&mcp.Metadata{Name: "mesh"}, push.Mesh)
+		if err != nil {
+			log.Warnf("failed to encode mesh config: %v", err)
+			return resp
+		}
+		return append(resp, r)
+	}
+
+	configs, err := push.IstioConfigStore.List(schema.Resource().GroupVersionKind(), "")
+	if err != nil {
+		log.Warnf("failed to list %s: %v", w.TypeUrl, err)
+		return resp
+	}
+	for i := range configs {
+		c := &configs[i]
+		if !isVisible(proxy, push, schema, c) {
+			continue
+		}
+		createTime, err := types.TimestampProto(c.CreationTimestamp)
+		if err != nil {
+			log.Warnf("invalid creation time for %s %s/%s: %v", w.TypeUrl, c.Namespace, c.Name, err)
+			continue
+		}
+		name := c.Name
+		if c.Namespace != "" {
+			name = c.Namespace + "/" + c.Name
+		}
+		r, err := toResource(&mcp.Metadata{
+			Name:        name,
+			CreateTime:  createTime,
+			Version:     c.ResourceVersion,
+			Labels:      c.Labels,
+			Annotations: c.Annotations,
+		}, c.Spec)
+		if err != nil {
+			log.Warnf("failed to encode %s %s: %v", w.TypeUrl, name, err)
+			continue
+		}
+		resp = append(resp, r)
+	}
+	return resp
+}
+
+// findSchema returns the collection with the GroupVersionKind matching the type URL.
+func findSchema(typeURL string) (collection.Schema, bool) {
+	for _, s := range collections.All.All() {
+		if s.Resource().GroupVersionKind().String() == typeURL {
+			return s, true
+		}
+	}
+	return nil, false
+}
+
+// isVisible applies the namespace visibility rules of the proxy. Services, virtual services and
+// destination rules are visible if selected by the proxy's SidecarScope, which takes exportTo and
+// the Sidecar egress hosts into account. Other namespaced configs are visible in their namespace,
+// and from the root namespace. Cluster scoped configs are only visible from the root namespace.
+func isVisible(proxy *model.Proxy, push *model.PushContext, schema collection.Schema, c *model.Config) bool {
+	if schema.Resource().IsClusterScoped() {
+		return inRootNamespace(proxy, push)
+	}
+	gvk := schema.Resource().GroupVersionKind()
+	switch gvk {
+	case model.ServiceEntryKind:
+		// ServiceEntries are tracked by the hosts they define.
+		se, ok := c.Spec.(*networking.ServiceEntry)
+		if !ok {
+			return false
+		}
+		for _, h := range se.Hosts {
+			if proxy.SidecarScope.DependsOnConfig(model.ConfigKey{Kind: gvk, Name: h, Namespace: c.Namespace}) {
+				return true
+			}
+		}
+		return false
+	case model.VirtualServiceKind, model.DestinationRuleKind:
+		return proxy.SidecarScope.DependsOnConfig(model.ConfigKey{Kind: gvk, Name: c.Name, Namespace: c.Namespace})
+	}
+	return c.Namespace == proxy.ConfigNamespace || (push.Mesh != nil && c.Namespace == push.Mesh.RootNamespace)
+}
+
+// inRootNamespace returns true for proxies in the root namespace, which may read the mesh wide configs.
+func inRootNamespace(proxy *model.Proxy, push *model.PushContext) bool {
+	return push.Mesh != nil && push.Mesh.RootNamespace != "" && proxy.ConfigNamespace == push.Mesh.RootNamespace
+}
+
+// toResource envelopes the config in an MCP Resource. The metadata version is set to a hash of the
+// content if the config has no resource version.
+func toResource(metadata *mcp.Metadata, spec proto.Message) (*any.Any, error) {
+	if metadata.Version == "" {
+		version, err := contentVersion(metadata, spec)
+		if err != nil {
+			return nil, err
+		}
+		metadata.Version = version
+	}
+	body, err := types.MarshalAny(spec)
+	if err != nil {
+		return nil, err
+	}
+	b, err := proto.Marshal(&mcp.Resource{Metadata: metadata, Body: body})
+	if err != nil {
+		return nil, err
+	}
+	return &any.Any{TypeUrl: ResourceType, Value: b}, nil
+}
+
+// contentVersion hashes the JSON encoding of the config, which sorts map entries. The generated Marshal
+// methods of the Istio API types do not support deterministic encoding, so the encoded resources
+// cannot be hashed.
+func contentVersion(metadata *mcp.Metadata, spec proto.Message) (string, error) {
+	h := fnv.New64a()
+	m := &jsonpb.Marshaler{}
+	for _, msg := range []proto.Message{metadata, spec} {
+		if err := m.Marshal(h, msg); err != nil {
+			return "", err
+		}
+	}
+	return strconv.FormatUint(h.Sum64(), 16), nil
+}
@@ -0,0 +1,96 @@
+// Copyright 2020 Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package apigen
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/gogo/protobuf/proto"
+	"github.com/gogo/protobuf/types"
+
+	mcp "istio.io/api/mcp/v1alpha1"
+	meshconfig "istio.io/api/mesh/v1alpha1"
+	networking "istio.io/api/networking/v1alpha3"
+
+	"istio.io/istio/pilot/pkg/model"
+	"istio.io/istio/pkg/config/schema/collections"
+)
+
+func TestToResourceVersion(t *testing.T) {
+	labels := map[string]string{}
+	for i := 0; i < 20; i++ {
+		labels[fmt.Sprintf("label-%d", i)] = fmt.Sprintf("value-%d", i)
+	}
+	spec := func(host string) *networking.DestinationRule {
+		return &networking.DestinationRule{
+			Host:    host,
+			Subsets: []*networking.Subset{{Name: "v1", Labels: labels}},
+		}
+	}
+	decode := func(version string, spec proto.Message) *mcp.Resource {
+		t.Helper()
+		r, err := toResource(&mcp.Metadata{Name: "default/foo", Version: version, Labels: labels}, spec)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resource := &mcp.Resource{}
+		if err := proto.Unmarshal(r.Value, resource); err != nil {
+			t.Fatal(err)
+		}
+		return resource
+	}
+
+	// Without a resource version, the version is derived from the content, whatever the map order.
+	first := decode("", spec("foo.default.svc.cluster.local"))
+	if first.Metadata.Version == "" {
+		t.Fatal("expected a content version")
+	}
+	for i := 0; i < 10; i++ {
+		if r := decode("", spec("foo.default.svc.cluster.local")); r.Metadata.Version != first.Metadata.Version {
+			t.Fatalf("expected identical configs to get the same version, got %s and %s",
+				first.Metadata.Version, r.Metadata.Version)
+		}
+	}
+	if r := decode("", spec("bar.default.svc.cluster.local")); r.Metadata.Version == first.Metadata.Version {
+		t.Fatal("expected a different version for a different config")
+	}
+
+	r := decode("42", spec("foo.default.svc.cluster.local"))
+	if r.Metadata.Version != "42" {
+		t.Fatalf("expected the resource version to be kept, got %s", r.Metadata.Version)
+	}
+	got := &networking.DestinationRule{}
+	if err := types.UnmarshalAny(r.Body, got); err != nil {
+		t.Fatal(err)
+	}
+	if !proto.Equal(got, spec("foo.default.svc.cluster.local")) || r.Metadata.Name != "default/foo" {
+		t.Fatalf("unexpected resource %v", r)
+	}
+}
+
+func TestMeshConfigVisibility(t *testing.T) {
+	push := model.NewPushContext()
+	push.Mesh = &meshconfig.MeshConfig{RootNamespace: "istio-system"}
+	w := &model.WatchedResource{TypeUrl: collections.IstioMeshV1Alpha1MeshConfig.Resource().GroupVersionKind().String()}
+	g := &APIGenerator{}
+
+	if got := g.Generate(&model.Proxy{ID: "app.default", ConfigNamespace: "default"}, push, w); len(got) != 0 {
+		t.Fatalf("expected the mesh config to be hidden outside of the root namespace, got %v", got)
+	}
+	if got := g.Generate(&model.Proxy{ID: "app.istio-system", ConfigNamespace: "istio-system"}, push, w); len(got) != 1 {
+		t.Fatalf("expected the mesh config in the root namespace, got %v", got)
+	}
+}
@@ -0,0 +1,308 @@
+// Copyright 2020 Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package core
+
+import (
+	"encoding/json"
+	"hash/fnv"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	v2 "github.com/envoyproxy/go-control-plane/envoy/api/v2"
+
+	meshconfig "istio.io/api/mesh/v1alpha1"
+	"istio.io/pkg/monitoring"
+
+	"istio.io/istio/pilot/pkg/model"
+)
+
+var (
+	typeTag = monitoring.MustCreateLabel("type")
+
+	cacheReads = monitoring.NewSum(
+		"pilot_xds_cache_reads",
+		"Total number of reads of the generated config cache, by result.",
+		monitoring.WithLabels(typeTag),
+	)
+
+	cacheHits   = cacheReads.With(typeTag.Value("hit"))
+	cacheMisses = cacheReads.With(typeTag.Value("miss"))
+
+	cacheSize = monitoring.NewGauge(
+		"pilot_xds_cache_size",
+		"Number of entries in the generated config cache.",
+	)
+)
+
+func init() {
+	monitoring.MustRegister(cacheReads, cacheSize)
+}
+
+const (
+	// maxCacheEntries bounds the size of the cache. Entries of disconnected proxies are only dropped
+	// on invalidation, so the cache is reset when it grows past this size.
+	maxCacheEntries = 50000
+
+	cacheTypeClusters  = "cds"
+	cacheTypeListeners = "lds"
+	cacheTypeRoutes    = "rds"
+)
+
+// cacheKey identifies a generated output. Outputs are shared by proxies with the same key.
+type cacheKey struct {
+	typ string
+	// proxy is a fingerprint of the proxy fields read during generation. For routes, it only covers the
+	// fields shared by the instances of a workload, see proxyClassFingerprint.
+	proxy uint64
+	// scope is the hash of the configs selected by the proxy's SidecarScope.
+	scope uint64
+	// routes holds the requested route names, for RDS.
+	routes string
+}
+
+type cacheEntry struct {
+	// scope used to generate the output, determines which config changes invalidate the entry.
+	scope *model.SidecarScope
+
+	clusters  []*v2.Cluster
+	listeners []*v2.Listener
+	routes    []*v2.RouteConfiguration
+}
+
+// CachedConfigGenerator is a ConfigGenerator reusing previously generated clusters, listeners and
+// routes. Entries are keyed on the proxy and on the set of configs visible through its SidecarScope,
+// and are invalidated when a config the scope depends on is updated (see Invalidate).
+//
+// Routes do not depend on the identity of a proxy instance, so they are shared by all the sidecars
+// with the same SidecarScope dependencies and proxy class: type, namespace, version, labels and
+// metadata other than the instance name and IPs. Clusters and listeners embed the proxy IP addresses
+// and service instances, so they are only shared across pushes and reconnects of the same proxy.
+//
+// The returned configs are shared, and must not be modified.
+type CachedConfigGenerator struct {
+	ConfigGenerator
+
+	mu sync.RWMutex
+	// push is the push context of the last invalidation. Output generated from another push context
+	// is not stored, as it may predate the invalidation.
+	push    *model.PushContext
+	entries map[cacheKey]*cacheEntry
+}
+
+var _ ConfigGenerator = &CachedConfigGenerator{}
+
+// NewCachedConfigGenerator wraps the generator with a cache.
+func NewCachedConfigGenerator(generator ConfigGenerator) *CachedConfigGenerator {
+	return &CachedConfigGenerator{
+		ConfigGenerator: generator,
+		entries:         map[cacheKey]*cacheEntry{},
+	}
+}
+
+// Invalidate must be called with the new push context before it is used for a full push. It drops
+// the entries depending on the updated configs, or all entries if the updated configs are unknown.
+func (c *CachedConfigGenerator) Invalidate(push *model.PushContext, configsUpdated map[model.ConfigKey]struct{}) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.push = push
+	if len(configsUpdated) == 0 {
+		c.entries = map[cacheKey]*cacheEntry{}
+		cacheSize.Record(0)
+		return
+	}
+	for key, entry := range c.entries {
+		for config := range configsUpdated {
+			// DependsOnConfig is true for config kinds not tracked by the scope.
+			if entry.scope.DependsOnConfig(config) {
+				delete(c.entries, key)
+				break
+			}
+		}
+	}
+	cacheSize.Record(float64(len(c.entries)))
+}
+
+// MeshConfigChanged drops all entries, and notifies the wrapped generator.
+func (c *CachedConfigGenerator) MeshConfigChanged(mesh *meshconfig.MeshConfig) {
+	c.mu.Lock()
+	c.entries = map[cacheKey]*cacheEntry{}
+	c.mu.Unlock()
+	cacheSize.Record(0)
+	c.ConfigGenerator.MeshConfigChanged(mesh)
+}
+
+// BuildClusters returns the cached clusters for the proxy, generating them if needed.
+func (c *CachedConfigGenerator) BuildClusters(node *model.Proxy, push *model.PushContext) []*v2.Cluster {
+	key, cacheable := newCacheKey(cacheTypeClusters, node, nil)
+	if cacheable {
+		if entry := c.get(key, push); entry != nil {
+			return entry.clusters
+		}
+	}
+	clusters := c.ConfigGenerator.BuildClusters(node, push)
+	if cacheable {
+		c.add(key, push, &cacheEntry{scope: node.SidecarScope, clusters: clusters})
+	}
+	return clusters
+}
+
+// BuildListeners returns the cached listeners for the proxy, generating them if needed.
+func (c *CachedConfigGenerator) BuildListeners(node *model.Proxy, push *model.PushContext) []*v2.Listener {
+	key, cacheable := newCacheKey(cacheTypeListeners, node, nil)
+	if cacheable {
+		if entry := c.get(key, push); entry != nil {
+			return entry.listeners
+		}
+	}
+	listeners := c.ConfigGenerator.BuildListeners(node, push)
+	if cacheable {
+		c.add(key, push, &cacheEntry{scope: node.SidecarScope, listeners: listeners})
+	}
+	return listeners
+}
+
+// BuildHTTPRoutes returns the cached routes for the proxy, generating them if needed.
+func (c *CachedConfigGenerator) BuildHTTPRoutes(node *model.Proxy, push *model.PushContext, routeNames []string) []*v2.RouteConfiguration {
+	key, cacheable := newCacheKey(cacheTypeRoutes, node, routeNames)
+	if cacheable {
+		if entry := c.get(key, push); entry != nil {
+			return entry.routes
+		}
+	}
+	routes := c.ConfigGenerator.BuildHTTPRoutes(node, push, routeNames)
+	if cacheable {
+		c.add(key, push, &cacheEntry{scope: node.SidecarScope, routes: routes})
+	}
+	return routes
+}
+
+func (c *CachedConfigGenerator) get(key cacheKey, push *model.PushContext) *cacheEntry {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	if c.push != nil && c.push != push {
+		cacheMisses.Increment()
+		return nil
+	}
+	entry := c.entries[key]
+	if entry == nil {
+		cacheMisses.Increment()
+		return nil
+	}
+	cacheHits.Increment()
+	return entry
+}
+
+func (c *CachedConfigGenerator) add(key cacheKey, push *model.PushContext, entry *cacheEntry) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.push != nil && c.push != push {
+		return
+	}
+	if len(c.entries) >= maxCacheEntries {
+		c.entries = map[cacheKey]*cacheEntry{}
+	}
+	c.entries[key] = entry
+	cacheSize.Record(float64(len(c.entries)))
+}
+
+// newCacheKey builds the key for the proxy's generated config. Proxies without a SidecarScope are
+// not cacheable.
+func newCacheKey(typ string, node *model.Proxy, routeNames []string) (cacheKey, bool) {
+	if node.SidecarScope == nil {
+		return cacheKey{}, false
+	}
+	fingerprint, err := proxyFingerprint(node, typ != cacheTypeRoutes)
+	if err != nil {
+		return cacheKey{}, false
+	}
+	key := cacheKey{
+		typ:   typ,
+		proxy: fingerprint,
+		scope: node.SidecarScope.DependenciesHash(),
+	}
+	if len(routeNames) > 0 {
+		routes := append([]string{}, routeNames...)
+		sort.Strings(routes)
+		key.routes = strings.Join(routes, ",")
+	}
+	return key, true
+}
+
+// proxyFingerprint hashes the proxy fields read during config generation. Unless perInstance is set, only
+// the proxy class is hashed, leaving out the fields that differ between the instances of a workload.
+func proxyFingerprint(node *model.Proxy, perInstance bool) (uint64, error) {
+	var metadata []byte
+	if node.Metadata != nil {
+		class := *node.Metadata
+		class.InstanceName = ""
+		class.InstanceIPs = nil
+		class.PodPorts = nil
+		class.PlatformMetadata = nil
+		var err error
+		if metadata, err = json.Marshal(class); err != nil {
+			return 0, err
+		}
+	}
+
+	h := fnv.New64a()
+	write := func(values ...string) {
+		for _, v := range values {
+			_, _ = h.Write([]byte(v))
+			_, _ = h.Write([]byte{0})
+		}
+	}
+	write(string(node.Type), node.DNSDomain, node.ConfigNamespace,
+		strconv.FormatBool(node.SupportsIPv4()), strconv.FormatBool(node.SupportsIPv6()))
+	write(node.Locality.String(), string(metadata))
+	if node.IstioVersion != nil {
+		write(strconv.Itoa(node.IstioVersion.Major), strconv.Itoa(node.IstioVersion.Minor),
+			strconv.Itoa(node.IstioVersion.Patch))
+	}
+	if !perInstance {
+		return h.Sum64(), nil
+	}
+
+	write(node.ID, node.GlobalUnicastIP)
+	write(node.IPAddresses...)
+	if node.Metadata != nil {
+		instanceMetadata, err := json.Marshal(model.NodeMetadata{
+			InstanceName:     node.Metadata.InstanceName,
+			InstanceIPs:      node.Metadata.InstanceIPs,
+			PodPorts:         node.Metadata.PodPorts,
+			PlatformMetadata: node.Metadata.PlatformMetadata,
+		})
+		if err != nil {
+			return 0, err
+		}
+		write(string(instanceMetadata))
+	}
+	for _, instance := range node.ServiceInstances {
+		svc := instance.Service
+		write(string(svc.Hostname), svc.Attributes.Namespace, svc.Address, strconv.Itoa(int(svc.Resolution)),
+			strconv.FormatBool(svc.MeshExternal))
+		for _, port := range svc.Ports {
+			write(port.Name, strconv.Itoa(port.Port), string(port.Protocol))
+		}
+		if instance.ServicePort != nil {
+			write(instance.ServicePort.Name, strconv.Itoa(instance.ServicePort.Port), string(instance.ServicePort.Protocol))
+		}
+		ep := instance.Endpoint
+		write(ep.Address, strconv.Itoa(int(ep.EndpointPort)), ep.ServicePortName, ep.ServiceAccount, ep.Network,
+			ep.TLSMode, ep.Locality.Label, ep.Labels.String())
+	}
+	return h.Sum64(), nil
+}
@@ -159,6 +159,7 @@ func (configgen *ConfigGeneratorImpl) buildOutboundClusters(proxy *model.Proxy,
 		Node: proxy,
 	}
 	networkView := model.GetNetworkView(proxy)
+	sessionHosts := statefulSessionHosts(proxy, push)
 
 	var services []*model.Service
 	if features.FilterGatewayClusterConfig && proxy.Type == model.Router {
@@ -169,6 +170,12 @@ func (configgen *ConfigGeneratorImpl) buildOutboundClusters(proxy *model.Proxy,
 	for _, service := range services {
 		for _, port := range service.Ports {
 			if port.Protocol == protocol.UDP {
+				if !features.EnableUDPProxy {
+					continue
+				}
+				if udpCluster := cb.buildUDPCluster(service, port, networkView); udpCluster != nil {
+					clusters = append(clusters, udpCluster)
+				}
 				continue
 			}
 			inputParams.Service = service
@@ -191,6 +198,12 @@ func (configgen *ConfigGeneratorImpl) buildOutboundClusters(proxy *model.Proxy,
 			setUpstreamProtocol(proxy, defaultCluster, port, model.TrafficDirectionOutbound)
 			clusters = append(clusters, defaultCluster)
 			subsetClusters := cb.applyDestinationRule(proxy, defaultCluster, DefaultClusterMode, service, port, networkView)
+			if features.EnableRedisFilter && port.Protocol == protocol.Redis {
+				cb.applyRedisClusterMode(service, port, append([]*apiv2.Cluster{defaultCluster}, subsetClusters...))
+			}
+			if sessionHosts[service.Hostname] {
+				applyStatefulSessionSubsets(append([]*apiv2.Cluster{defaultCluster}, subsetClusters...))
+			}
 
 			// call plugins for subset clusters.
 			for _, subsetCluster := range subsetClusters {
@@ -777,6 +790,20 @@ func applyConnectionPool(push *model.PushContext, cluster *apiv2.Cluster, settin
 	}
 }
 
+// applyRetryBudget limits the concurrent retries to the cluster with the retry budget, if any, which takes
+// precedence over the max_retries circuit breaker.
+func applyRetryBudget(cluster *apiv2.Cluster, budget *v2Cluster.CircuitBreakers_Thresholds_RetryBudget) {
+	if budget == nil {
+		return
+	}
+	if len(cluster.CircuitBreakers.GetThresholds()) == 0 {
+		cluster.CircuitBreakers = &v2Cluster.CircuitBreakers{
+			Thresholds: []*v2Cluster.CircuitBreakers_Thresholds{getDefaultCircuitBreakerThresholds()},
+		}
+	}
+	cluster.CircuitBreakers.Thresholds[0].RetryBudget = budget
+}
+
 func applyTCPKeepalive(push *model.PushContext, cluster *apiv2.Cluster, settings *networking.ConnectionPoolSettings) {
 	// Apply Keepalive config only if it is configured in mesh config or in destination rule.
 	if push.Mesh.TcpKeepalive != nil || settings.Tcp.TcpKeepalive != nil {
@@ -978,6 +1005,13 @@ func applyUpstreamTLSSettings(opts *buildClusterOpts, tls *networking.ClientTLSS
 		}
 	}
 
+	sni := tls.Sni
+	// Mongo servers behind SNI routers can only be reached with the service hostname in the SNI.
+	if len(sni) == 0 && opts.port != nil && opts.port.Protocol == protocol.Mongo &&
+		(tls.Mode == networking.ClientTLSSettings_SIMPLE || tls.Mode == networking.ClientTLSSettings_MUTUAL) {
+		sni = opts.simpleTLSSni
+	}
+
 	tlsContext := &auth.UpstreamTlsContext{}
 	switch tls.Mode {
 	case networking.ClientTLSSettings_DISABLE:
@@ -989,7 +1023,7 @@ func applyUpstreamTLSSettings(opts *buildClusterOpts, tls *networking.ClientTLSS
 					ValidationContext: certValidationContext,
 				},
 			},
-			Sni: tls.Sni,
+			Sni: sni,
 		}
 		if cluster.Http2ProtocolOptions != nil {
 			// This is HTTP/2 cluster, advertise it with ALPN.
@@ -1004,7 +1038,7 @@ func applyUpstreamTLSSettings(opts *buildClusterOpts, tls *networking.ClientTLSS
 
 		tlsContext = &auth.UpstreamTlsContext{
 			CommonTlsContext: &auth.CommonTlsContext{},
-			Sni:              tls.Sni,
+			Sni:              sni,
 		}
 
 		// Fallback to file mount secret instead of SDS if meshConfig.sdsUdsPath isn't set or tls.mode is TLSSettings_MUTUAL.
@@ -21,10 +21,13 @@ import (
 	core "github.com/envoyproxy/go-control-plane/envoy/api/v2/core"
 	endpoint "github.com/envoyproxy/go-control-plane/envoy/api/v2/endpoint"
 	"github.com/gogo/protobuf/types"
+	"github.com/golang/protobuf/ptypes/wrappers"
 
 	networking "istio.io/api/networking/v1alpha3"
 	"istio.io/istio/pilot/pkg/features"
 	"istio.io/istio/pilot/pkg/model"
+	"istio.io/istio/pilot/pkg/networking/core/v1alpha3/loadbalancer"
+	"istio.io/istio/pilot/pkg/networking/core/v1alpha3/route/retry"
 	"istio.io/istio/pilot/pkg/networking/util"
 	"istio.io/istio/pkg/config/labels"
 	"istio.io/istio/pkg/util/gogo"
@@ -75,15 +78,29 @@ func (cb *ClusterBuilder) applyDestinationRule(proxy *model.Proxy, cluster *apiv
 
 	// Apply traffic policy for the main default cluster.
 	applyTrafficPolicy(opts)
+	var destRuleAnnotations map[string]string
+	if destRule != nil {
+		destRuleAnnotations = destRule.Annotations
+	}
+	var meshAnnotations map[string]string
+	if meshDestRule := cb.push.MeshDestinationRule(); meshDestRule != nil {
+		meshAnnotations = meshDestRule.Annotations
+	}
+	retryBudget := retry.ConvertBudget(destRuleAnnotations, meshAnnotations)
+	applyRetryBudget(cluster, retryBudget)
 
 	// Apply EdsConfig if needed. This should be called after traffic policy is applied because, traffic policy might change
 	// discovery type.
 	maybeApplyEdsConfig(cluster)
 
 	var clusterMetadata *core.Metadata
+	var overprovisioningFactor *wrappers.UInt32Value
 	if destRule != nil {
 		clusterMetadata = util.BuildConfigInfoMetadata(destRule.ConfigMeta)
 		cluster.Metadata = clusterMetadata
+		// EDS clusters get the overprovisioning factor with their endpoints.
+		overprovisioningFactor = loadbalancer.GetOverprovisioningFactor(destRule.Annotations)
+		loadbalancer.ApplyOverprovisioningFactor(cluster.LoadAssignment, overprovisioningFactor)
 	}
 	subsetClusters := make([]*apiv2.Cluster, 0)
 	for _, subset := range destinationRule.Subsets {
@@ -125,8 +142,10 @@ func (cb *ClusterBuilder) applyDestinationRule(proxy *model.Proxy, cluster *apiv
 			opts.policy = subset.TrafficPolicy
 			applyTrafficPolicy(opts)
 		}
+		applyRetryBudget(subsetCluster, retryBudget)
 
 		maybeApplyEdsConfig(subsetCluster)
+		loadbalancer.ApplyOverprovisioningFactor(subsetCluster.LoadAssignment, overprovisioningFactor)
 
 		subsetCluster.Metadata = util.AddSubsetToMetadata(clusterMetadata, subset.Name)
 		subsetClusters = append(subsetClusters, subsetCluster)
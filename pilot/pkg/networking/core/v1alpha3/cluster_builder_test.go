@@ -22,6 +22,7 @@ import (
 	v2Cluster "github.com/envoyproxy/go-control-plane/envoy/api/v2/cluster"
 	core "github.com/envoyproxy/go-control-plane/envoy/api/v2/core"
 	endpoint "github.com/envoyproxy/go-control-plane/envoy/api/v2/endpoint"
+	xdstype "github.com/envoyproxy/go-control-plane/envoy/type"
 
 	"github.com/golang/protobuf/ptypes/duration"
 	"github.com/golang/protobuf/ptypes/wrappers"
@@ -30,6 +31,7 @@ import (
 	"istio.io/istio/pilot/pkg/features"
 	"istio.io/istio/pilot/pkg/model"
 	"istio.io/istio/pilot/pkg/networking/core/v1alpha3/fakes"
+	"istio.io/istio/pilot/pkg/networking/core/v1alpha3/route/retry"
 	"istio.io/istio/pilot/pkg/networking/util"
 	"istio.io/istio/pkg/config/host"
 	"istio.io/istio/pkg/config/protocol"
@@ -474,3 +476,48 @@ func TestBuildPassthroughClusters(t *testing.T) {
 		})
 	}
 }
+
+func TestApplyDestinationRuleRetryBudget(t *testing.T) {
+	meshConfig := testMesh
+	meshConfig.RootNamespace = "istio-system"
+	env := newTestEnvironment(&fakes.ServiceDiscovery{}, meshConfig, &fakes.IstioConfigStore{})
+	// The retry budget of the mesh-wide destination rule applies to all the destinations.
+	env.PushContext.SetDestinationRules([]model.Config{{
+		ConfigMeta: model.ConfigMeta{
+			Type:        collections.IstioNetworkingV1Alpha3Destinationrules.Resource().Kind(),
+			Name:        "default",
+			Namespace:   "istio-system",
+			Annotations: map[string]string{retry.BudgetPercentAnnotation: "20"},
+		},
+		Spec: &networking.DestinationRule{Host: "*", ExportTo: []string{"*"}},
+	}, {
+		ConfigMeta: model.ConfigMeta{
+			Type:      collections.IstioNetworkingV1Alpha3Destinationrules.Resource().Kind(),
+			Name:      "foo",
+			Namespace: "default",
+		},
+		Spec: &networking.DestinationRule{Host: "foo"},
+	}})
+	proxy := &model.Proxy{Metadata: &model.NodeMetadata{}}
+	proxy.SetSidecarScope(env.PushContext)
+	cb := NewClusterBuilder(proxy, env.PushContext)
+
+	cluster := &apiv2.Cluster{Name: "foo", ClusterDiscoveryType: &apiv2.Cluster_Type{Type: apiv2.Cluster_EDS}}
+	service := &model.Service{Hostname: "foo", Attributes: model.ServiceAttributes{Namespace: "default"}}
+	cb.applyDestinationRule(proxy, cluster, DefaultClusterMode, service, &model.Port{Port: 8080}, nil)
+
+	thresholds := cluster.CircuitBreakers.GetThresholds()
+	if len(thresholds) != 1 {
+		t.Fatalf("expected default circuit breaker thresholds, got %v", cluster.CircuitBreakers)
+	}
+	expected := &v2Cluster.CircuitBreakers_Thresholds_RetryBudget{
+		BudgetPercent:       &xdstype.Percent{Value: 20},
+		MinRetryConcurrency: &wrappers.UInt32Value{Value: 3},
+	}
+	if !reflect.DeepEqual(thresholds[0].RetryBudget, expected) {
+		t.Errorf("expected retry budget %v, got %v", expected, thresholds[0].RetryBudget)
+	}
+	if !reflect.DeepEqual(thresholds[0].MaxRetries, getDefaultCircuitBreakerThresholds().MaxRetries) {
+		t.Errorf("expected the default thresholds to be kept, got %v", thresholds[0])
+	}
+}
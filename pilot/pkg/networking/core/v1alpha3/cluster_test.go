@@ -2288,6 +2288,68 @@ func TestApplyUpstreamTLSSettings(t *testing.T) {
 
 }
 
+func TestApplyUpstreamTLSSettingsMongoSni(t *testing.T) {
+	proxy := &model.Proxy{
+		Type:         model.SidecarProxy,
+		Metadata:     &model.NodeMetadata{},
+		IstioVersion: &model.IstioVersion{Major: 1, Minor: 5},
+	}
+	push := model.NewPushContext()
+	push.Mesh = &meshconfig.MeshConfig{}
+
+	tests := []struct {
+		name        string
+		protocol    protocol.Instance
+		tls         *networking.ClientTLSSettings
+		expectedSni string
+	}{
+		{
+			name:     "mongo mutual with file certs",
+			protocol: protocol.Mongo,
+			tls: &networking.ClientTLSSettings{
+				Mode:              networking.ClientTLSSettings_MUTUAL,
+				CaCertificates:    "/etc/certs/mongo/root-cert.pem",
+				ClientCertificate: "/etc/certs/mongo/cert-chain.pem",
+				PrivateKey:        "/etc/certs/mongo/key.pem",
+			},
+			expectedSni: "mongo.default.svc.cluster.local",
+		},
+		{
+			name:        "mongo simple with sni",
+			protocol:    protocol.Mongo,
+			tls:         &networking.ClientTLSSettings{Mode: networking.ClientTLSSettings_SIMPLE, Sni: "custom.foo.com"},
+			expectedSni: "custom.foo.com",
+		},
+		{
+			name:        "tcp simple",
+			protocol:    protocol.TCP,
+			tls:         &networking.ClientTLSSettings{Mode: networking.ClientTLSSettings_SIMPLE},
+			expectedSni: "",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			opts := &buildClusterOpts{
+				cluster:      &apiv2.Cluster{ClusterDiscoveryType: &apiv2.Cluster_Type{Type: apiv2.Cluster_EDS}},
+				port:         &model.Port{Port: 27017, Protocol: test.protocol},
+				simpleTLSSni: "mongo.default.svc.cluster.local",
+				proxy:        proxy,
+				push:         push,
+			}
+			applyUpstreamTLSSettings(opts, test.tls, userSupplied, proxy)
+
+			tlsContext := getTLSContext(t, opts.cluster)
+			if tlsContext == nil {
+				t.Fatalf("expected a TLS context")
+			}
+			if tlsContext.Sni != test.expectedSni {
+				t.Errorf("expected SNI %q, got %q", test.expectedSni, tlsContext.Sni)
+			}
+		})
+	}
+}
+
 // Helper function to extract TLS context from a cluster
 func getTLSContext(t *testing.T, c *apiv2.Cluster) *envoy_api_v2_auth.UpstreamTlsContext {
 	t.Helper()
@@ -19,6 +19,7 @@ import (
 	cors "github.com/envoyproxy/go-control-plane/envoy/config/filter/http/cors/v2"
 	fault "github.com/envoyproxy/go-control-plane/envoy/config/filter/http/fault/v2"
 	grpcweb "github.com/envoyproxy/go-control-plane/envoy/config/filter/http/grpc_web/v2"
+	ondemand "github.com/envoyproxy/go-control-plane/envoy/config/filter/http/on_demand/v2"
 	router "github.com/envoyproxy/go-control-plane/envoy/config/filter/http/router/v2"
 	httpinspector "github.com/envoyproxy/go-control-plane/envoy/config/filter/listener/http_inspector/v2"
 	originaldst "github.com/envoyproxy/go-control-plane/envoy/config/filter/listener/original_dst/v2"
@@ -50,6 +51,14 @@ var (
 			TypedConfig: util.MessageToAny(&router.Router{}),
 		},
 	}
+	// onDemandFilter requests the virtual host of unknown destinations with VHDS, for sidecars
+	// loading clusters on demand.
+	onDemandFilter = &http_conn.HttpFilter{
+		Name: OnDemandFilterName,
+		ConfigType: &http_conn.HttpFilter_TypedConfig{
+			TypedConfig: util.MessageToAny(&ondemand.OnDemand{}),
+		},
+	}
 	grpcWebFilter = &http_conn.HttpFilter{
 		Name: wellknown.GRPCWeb,
 		ConfigType: &http_conn.HttpFilter_TypedConfig{
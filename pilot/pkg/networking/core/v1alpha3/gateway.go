@@ -89,6 +89,15 @@ func (configgen *ConfigGeneratorImpl) buildGatewayListeners(
 		}
 
 		p := protocol.Parse(servers[0].Port.Protocol)
+		if p == protocol.UDP && features.EnableUDPProxy {
+			// UDP servers are forwarded by the udp_proxy listener filter, without filter chains.
+			server := servers[0]
+			if l := buildGatewayUDPListener(node, push, server, actualWildcard, int(portNumber),
+				map[string]bool{mergedGateway.GatewayNameForServer[server]: true}); l != nil {
+				listeners = append(listeners, l)
+			}
+			continue
+		}
 		listenerProtocol := istionetworking.ModelProtocolToListenerProtocol(node, p, core.TrafficDirection_OUTBOUND)
 		filterChains := make([]istionetworking.FilterChain, 0)
 		if p.IsHTTP() {
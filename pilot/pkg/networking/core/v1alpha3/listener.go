@@ -146,6 +146,9 @@ const (
 	// Alpn HTTP filter name which will override the ALPN for upstream TLS connection.
 	AlpnFilterName = "istio.alpn"
 
+	// OnDemandFilterName is the name of the HTTP filter loading virtual hosts on demand.
+	OnDemandFilterName = "envoy.filters.http.on_demand"
+
 	ThriftRLSDefaultTimeoutMS = 50
 )
 
@@ -1276,9 +1279,10 @@ func (configgen *ConfigGeneratorImpl) buildSidecarOutboundHTTPListenerOptsForPor
 	}}
 }
 
-func (configgen *ConfigGeneratorImpl) buildSidecarOutboundThriftListenerOptsForPortOrUDS(_ *model.Proxy, listenerMapKey *string,
+func (configgen *ConfigGeneratorImpl) buildSidecarOutboundThriftListenerOptsForPortOrUDS(node *model.Proxy, listenerMapKey *string,
 	currentListenerEntry **outboundListenerEntry, listenerOpts *buildListenerOpts,
-	pluginParams *plugin.InputParams, listenerMap map[string]*outboundListenerEntry, actualWildcard string) (bool, []*filterChainOpts) {
+	pluginParams *plugin.InputParams, listenerMap map[string]*outboundListenerEntry,
+	virtualServices []model.Config, actualWildcard string) (bool, []*filterChainOpts) {
 	// first identify the bind if its not set. Then construct the key
 	// used to lookup the listener in the conflict map.
 	if len(listenerOpts.bind) == 0 { // no user specified bind. Use 0.0.0.0:Port
@@ -1313,11 +1317,11 @@ func (configgen *ConfigGeneratorImpl) buildSidecarOutboundThriftListenerOptsForP
 	}
 
 	// No conflicts. Add a thrift filter chain option to the listenerOpts
-	clusterName := model.BuildSubsetKey(model.TrafficDirectionOutbound, "", pluginParams.Service.Hostname, pluginParams.Port.Port)
 	thriftOpts := &thriftListenerOpts{
-		protocol:    thrift_proxy.ProtocolType_AUTO_PROTOCOL,
-		transport:   thrift_proxy.TransportType_AUTO_TRANSPORT,
-		routeConfig: configgen.buildSidecarThriftRouteConfig(clusterName, pluginParams.Push.Mesh.ThriftConfig.RateLimitUrl),
+		protocol:  thrift_proxy.ProtocolType_AUTO_PROTOCOL,
+		transport: thrift_proxy.TransportType_AUTO_TRANSPORT,
+		routeConfig: configgen.buildSidecarOutboundThriftRouteConfig(node, pluginParams.Push, pluginParams.Service,
+			pluginParams.Port.Port, virtualServices),
 	}
 
 	return true, []*filterChainOpts{{
@@ -1502,7 +1506,7 @@ func (configgen *ConfigGeneratorImpl) buildSidecarOutboundListenerForPortOrUDS(n
 			// Hard code the service IP for outbound thrift service listeners. HTTP services
 			// use RDS but the Thrift stack has no such dynamic configuration option.
 			if ret, opts = configgen.buildSidecarOutboundThriftListenerOptsForPortOrUDS(node, &listenerMapKey, &currentListenerEntry,
-				&listenerOpts, pluginParams, listenerMap, actualWildcard); !ret {
+				&listenerOpts, pluginParams, listenerMap, virtualServices, actualWildcard); !ret {
 				return
 			}
 
@@ -1782,7 +1786,8 @@ func buildSidecarInboundMgmtListeners(node *model.Proxy, push *model.PushContext
 	for _, mPort := range managementPorts {
 		switch mPort.Protocol {
 		case protocol.HTTP, protocol.HTTP2, protocol.GRPC, protocol.GRPCWeb, protocol.TCP,
-			protocol.HTTPS, protocol.TLS, protocol.Mongo, protocol.Redis, protocol.MySQL:
+			protocol.HTTPS, protocol.TLS, protocol.Mongo, protocol.Redis, protocol.MySQL, protocol.Kafka,
+			protocol.Postgres, protocol.ZooKeeper:
 
 			instance := &model.ServiceInstance{
 				Service: &model.Service{
@@ -1931,6 +1936,27 @@ func buildHTTPConnectionManager(pluginParams *plugin.InputParams, httpOpts *http
 		})
 	}
 
+	// Sidecars loading clusters on demand request the virtual host of unknown destinations.
+	if pluginParams.ListenerCategory == networking.EnvoyFilter_SIDECAR_OUTBOUND &&
+		bool(pluginParams.Node.Metadata.OnDemandClusters) && httpOpts.rds != "" {
+		filters = append(filters, onDemandFilter)
+	}
+
+	// Requests are rate limited before the CORS and fault filters apply.
+	if pluginParams.ListenerCategory == networking.EnvoyFilter_SIDECAR_OUTBOUND ||
+		pluginParams.ListenerCategory == networking.EnvoyFilter_GATEWAY {
+		if rateLimitFilter := buildHTTPRateLimitFilter(pluginParams.Push.Mesh); rateLimitFilter != nil {
+			filters = append(filters, rateLimitFilter)
+		}
+	}
+
+	// Gateways pin the endpoint of stateful sessions before routing the request.
+	if pluginParams.ListenerCategory == networking.EnvoyFilter_GATEWAY {
+		if sessionFilter := buildStatefulSessionFilter(statefulSessionCookies(pluginParams.Node, pluginParams.Push)); sessionFilter != nil {
+			filters = append(filters, sessionFilter)
+		}
+	}
+
 	filters = append(filters, corsFilter, faultFilter, routerFilter)
 
 	if httpOpts.connectionManager == nil {
@@ -2109,7 +2135,7 @@ func buildThriftRatelimit(domain string, thriftconfig *meshconfig.MeshConfig_Thr
 		},
 	}
 
-	rlsClusterName, err := thriftRLSClusterNameFromAuthority(thriftconfig.RateLimitUrl)
+	rlsClusterName, err := rlsClusterNameFromAuthority(thriftconfig.RateLimitUrl)
 	if err != nil {
 		log.Errorf("unable to generate thrift rls cluster name: %s\n", rlsClusterName)
 		return nil
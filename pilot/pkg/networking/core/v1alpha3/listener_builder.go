@@ -191,6 +191,9 @@ func (lb *ListenerBuilder) buildSidecarInboundListeners(configgen *ConfigGenerat
 
 func (lb *ListenerBuilder) buildSidecarOutboundListeners(configgen *ConfigGeneratorImpl) *ListenerBuilder {
 	lb.outboundListeners = configgen.buildSidecarOutboundListeners(lb.node, lb.push)
+	if features.EnableUDPProxy {
+		lb.outboundListeners = append(lb.outboundListeners, buildSidecarOutboundUDPListeners(lb.node, lb.push)...)
+	}
 	return lb
 }
 
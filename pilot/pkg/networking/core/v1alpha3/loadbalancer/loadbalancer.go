@@ -18,15 +18,25 @@ package loadbalancer
 import (
 	"math"
 	"sort"
+	"strconv"
 
 	apiv2 "github.com/envoyproxy/go-control-plane/envoy/api/v2"
 	core "github.com/envoyproxy/go-control-plane/envoy/api/v2/core"
 	"github.com/golang/protobuf/ptypes/wrappers"
 
 	"istio.io/api/networking/v1alpha3"
+	"istio.io/pkg/log"
+
 	"istio.io/istio/pilot/pkg/networking/util"
+	"istio.io/istio/pkg/config/annotation"
 )
 
+// OverprovisioningFactorAnnotation on a DestinationRule sets the overprovisioning factor of the service endpoints,
+// as a percentage: the endpoints of a priority are considered fully available while the healthy ratio multiplied by
+// the factor is above 100%. Envoy defaults to 140. The panic threshold of the destination is set with the
+// minHealthPercent of its outlier detection.
+const OverprovisioningFactorAnnotation = annotation.OverprovisioningFactor
+
 func GetLocalityLbSetting(
 	mesh *v1alpha3.LocalityLoadBalancerSetting,
 	destrule *v1alpha3.LocalityLoadBalancerSetting,
@@ -76,6 +86,32 @@ func ApplyLocalityLBSetting(
 	}
 }
 
+// GetOverprovisioningFactor returns the overprovisioning factor set by the annotations of a destination rule, or
+// nil if it is not set or invalid.
+func GetOverprovisioningFactor(annotations map[string]string) *wrappers.UInt32Value {
+	value, f := annotations[OverprovisioningFactorAnnotation]
+	if !f {
+		return nil
+	}
+	factor, err := strconv.ParseUint(value, 10, 32)
+	if err != nil || factor == 0 {
+		log.Warnf("ignoring invalid %s annotation %q", OverprovisioningFactorAnnotation, value)
+		return nil
+	}
+	return &wrappers.UInt32Value{Value: uint32(factor)}
+}
+
+// ApplyOverprovisioningFactor sets the overprovisioning factor of the load assignment, if the factor is not nil.
+func ApplyOverprovisioningFactor(loadAssignment *apiv2.ClusterLoadAssignment, factor *wrappers.UInt32Value) {
+	if loadAssignment == nil || factor == nil {
+		return
+	}
+	if loadAssignment.Policy == nil {
+		loadAssignment.Policy = &apiv2.ClusterLoadAssignment_Policy{}
+	}
+	loadAssignment.Policy.OverprovisioningFactor = factor
+}
+
 // set locality loadbalancing weight
 func applyLocalityWeight(
 	locality *core.Locality,
@@ -136,6 +172,8 @@ func applyLocalityWeight(
 }
 
 // set locality loadbalancing priority
+// The failover tiers are, in order: the same zone and subzone, the same zone, the same region, then the
+// regions of the failover settings of the proxy region, in the order of the settings, and finally any region.
 func applyLocalityFailover(
 	locality *core.Locality,
 	loadAssignment *apiv2.ClusterLoadAssignment,
@@ -143,6 +181,14 @@ func applyLocalityFailover(
 	// key is priority, value is the index of the LocalityLbEndpoints in ClusterLoadAssignment
 	priorityMap := map[int][]int{}
 
+	// the failover regions of the proxy region, in order
+	failoverRegions := make([]string, 0)
+	for _, failoverSetting := range failover {
+		if failoverSetting.From == locality.Region {
+			failoverRegions = append(failoverRegions, failoverSetting.To)
+		}
+	}
+
 	// 1. calculate the LocalityLbEndpoints.Priority compared with proxy locality
 	for i, localityEndpoint := range loadAssignment.Endpoints {
 		// if region/zone/subZone all match, the priority is 0.
@@ -151,13 +197,13 @@ func applyLocalityFailover(
 		// if locality not match, the priority is 3.
 		priority := util.LbPriority(locality, localityEndpoint.Locality)
 		// region not match, apply failover settings when specified
-		// update localityLbEndpoints' priority to 4 if failover not match
-		if priority == 3 {
-			for _, failoverSetting := range failover {
-				if failoverSetting.From == locality.Region {
-					if localityEndpoint.Locality == nil || localityEndpoint.Locality.Region != failoverSetting.To {
-						priority = 4
-					}
+		// update localityLbEndpoints' priority to 3 + the index of the failover region,
+		// or to 3 + the number of failover regions if none matches
+		if priority == 3 && len(failoverRegions) > 0 {
+			priority += len(failoverRegions)
+			for j, region := range failoverRegions {
+				if localityEndpoint.Locality != nil && localityEndpoint.Locality.Region == region {
+					priority = 3 + j
 					break
 				}
 			}
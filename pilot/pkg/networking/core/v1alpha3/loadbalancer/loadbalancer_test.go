@@ -157,6 +157,28 @@ func TestApplyLocalitySetting(t *testing.T) {
 		}
 	})
 
+	t.Run("Failover: ordered failover regions", func(t *testing.T) {
+		g := NewGomegaWithT(t)
+		cluster := buildFakeCluster()
+		cluster.LoadAssignment.Endpoints = append(cluster.LoadAssignment.Endpoints, &endpoint.LocalityLbEndpoints{
+			Locality: &envoycore.Locality{Region: "region4"},
+		})
+		lbsetting := &networking.LocalityLoadBalancerSetting{
+			Failover: []*networking.LocalityLoadBalancerSetting_Failover{
+				{From: "region1", To: "region3"},
+				{From: "region2", To: "region4"},
+				{From: "region1", To: "region2"},
+			},
+		}
+		ApplyLocalityLBSetting(locality, cluster.LoadAssignment, lbsetting, true)
+		priorities := make([]uint32, 0)
+		for _, localityEndpoint := range cluster.LoadAssignment.Endpoints {
+			priorities = append(priorities, localityEndpoint.Priority)
+		}
+		// subzone, zone, region, then region3 and region2 in order, then any region.
+		g.Expect(priorities).To(Equal([]uint32{0, 0, 1, 1, 2, 4, 3, 5}))
+	})
+
 	t.Run("Failover: with locality lb disabled", func(t *testing.T) {
 		g := NewGomegaWithT(t)
 		cluster := buildSmallClusterWithNilLocalities()
@@ -467,3 +489,19 @@ func buildSmallClusterWithNilLocalities() *apiv2.Cluster {
 		},
 	}
 }
+
+func TestOverprovisioningFactor(t *testing.T) {
+	g := NewGomegaWithT(t)
+
+	g.Expect(GetOverprovisioningFactor(nil)).To(BeNil())
+	g.Expect(GetOverprovisioningFactor(map[string]string{OverprovisioningFactorAnnotation: "high"})).To(BeNil())
+	g.Expect(GetOverprovisioningFactor(map[string]string{OverprovisioningFactorAnnotation: "0"})).To(BeNil())
+
+	factor := GetOverprovisioningFactor(map[string]string{OverprovisioningFactorAnnotation: "100"})
+	g.Expect(factor.GetValue()).To(Equal(uint32(100)))
+
+	cluster := buildSmallCluster()
+	ApplyOverprovisioningFactor(cluster.LoadAssignment, factor)
+	g.Expect(cluster.LoadAssignment.Policy.OverprovisioningFactor.GetValue()).To(Equal(uint32(100)))
+	ApplyOverprovisioningFactor(nil, factor)
+}
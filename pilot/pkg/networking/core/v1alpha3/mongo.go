@@ -0,0 +1,68 @@
+// Copyright 2020 Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package v1alpha3
+
+import (
+	listener "github.com/envoyproxy/go-control-plane/envoy/api/v2/listener"
+	xdsfault "github.com/envoyproxy/go-control-plane/envoy/config/filter/fault/v2"
+	mongo_proxy "github.com/envoyproxy/go-control-plane/envoy/config/filter/network/mongo_proxy/v2"
+	"github.com/envoyproxy/go-control-plane/pkg/wellknown"
+	"github.com/golang/protobuf/ptypes"
+
+	"istio.io/pkg/log"
+
+	"istio.io/istio/pilot/pkg/model"
+	istio_route "istio.io/istio/pilot/pkg/networking/core/v1alpha3/route"
+	"istio.io/istio/pilot/pkg/networking/util"
+)
+
+// Mongo ports are configured as follows:
+//
+// - TLS origination uses the TLS settings of the DestinationRule of the service, as for any TCP service. For
+//   SIMPLE and MUTUAL TLS, the service hostname is the default SNI, as required by Mongo SNI routers.
+// - the delay fault of the HTTP routes of the virtual services is injected by the Mongo proxy, see
+//   istio_route.BuildMongoFaultDelayForVirtualService.
+
+// buildMongoFaultDelay returns the delay of the first virtual service with a delay fault for the port.
+func buildMongoFaultDelay(node *model.Proxy, listenPort *model.Port, gateways map[string]bool,
+	configs []model.Config) *xdsfault.FaultDelay {
+	for _, cfg := range configs {
+		if delay := istio_route.BuildMongoFaultDelayForVirtualService(node, cfg, listenPort.Port, gateways); delay != nil {
+			return delay
+		}
+	}
+	return nil
+}
+
+// applyMongoFaultDelay sets the delay of the Mongo proxy filters of the filter chains.
+func applyMongoFaultDelay(opts []*filterChainOpts, delay *xdsfault.FaultDelay) {
+	if delay == nil {
+		return
+	}
+	for _, opt := range opts {
+		for _, filter := range opt.networkFilters {
+			if filter.Name != wellknown.MongoProxy {
+				continue
+			}
+			mongoProxy := &mongo_proxy.MongoProxy{}
+			if err := ptypes.UnmarshalAny(filter.GetTypedConfig(), mongoProxy); err != nil {
+				log.Warnf("failed to apply the Mongo fault delay: %v", err)
+				continue
+			}
+			mongoProxy.Delay = delay
+			filter.ConfigType = &listener.Filter_TypedConfig{TypedConfig: util.MessageToAny(mongoProxy)}
+		}
+	}
+}
@@ -0,0 +1,50 @@
+// Copyright 2020 Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package v1alpha3
+
+import (
+	"testing"
+	"time"
+
+	listener "github.com/envoyproxy/go-control-plane/envoy/api/v2/listener"
+	xdsfault "github.com/envoyproxy/go-control-plane/envoy/config/filter/fault/v2"
+	mongo_proxy "github.com/envoyproxy/go-control-plane/envoy/config/filter/network/mongo_proxy/v2"
+	"github.com/envoyproxy/go-control-plane/pkg/wellknown"
+	"github.com/golang/protobuf/ptypes"
+)
+
+func TestApplyMongoFaultDelay(t *testing.T) {
+	tcpFilter := &listener.Filter{Name: wellknown.TCPProxy}
+	opts := []*filterChainOpts{{networkFilters: []*listener.Filter{buildMongoFilter("mongo"), tcpFilter}}}
+	delay := &xdsfault.FaultDelay{
+		FaultDelaySecifier: &xdsfault.FaultDelay_FixedDelay{FixedDelay: ptypes.DurationProto(time.Second)},
+	}
+
+	applyMongoFaultDelay(opts, delay)
+
+	mongoProxy := &mongo_proxy.MongoProxy{}
+	if err := ptypes.UnmarshalAny(opts[0].networkFilters[0].GetTypedConfig(), mongoProxy); err != nil {
+		t.Fatal(err)
+	}
+	if mongoProxy.StatPrefix != "mongo" {
+		t.Errorf("expected the stat prefix to be kept, got %q", mongoProxy.StatPrefix)
+	}
+	if mongoProxy.Delay.GetFixedDelay().GetSeconds() != 1 {
+		t.Errorf("expected a fixed delay of 1s, got %v", mongoProxy.Delay)
+	}
+	if opts[0].networkFilters[1] != tcpFilter {
+		t.Errorf("the tcp proxy filter must not be modified")
+	}
+}
@@ -17,17 +17,21 @@ package v1alpha3
 import (
 	"time"
 
+	udpa "github.com/cncf/udpa/go/udpa/type/v1"
 	core "github.com/envoyproxy/go-control-plane/envoy/api/v2/core"
 	listener "github.com/envoyproxy/go-control-plane/envoy/api/v2/listener"
 	accesslogconfig "github.com/envoyproxy/go-control-plane/envoy/config/accesslog/v2"
 	accesslog "github.com/envoyproxy/go-control-plane/envoy/config/filter/accesslog/v2"
+	kafka_broker "github.com/envoyproxy/go-control-plane/envoy/config/filter/network/kafka_broker/v2alpha1"
 	mongo_proxy "github.com/envoyproxy/go-control-plane/envoy/config/filter/network/mongo_proxy/v2"
 	mysql_proxy "github.com/envoyproxy/go-control-plane/envoy/config/filter/network/mysql_proxy/v1alpha1"
 	redis_proxy "github.com/envoyproxy/go-control-plane/envoy/config/filter/network/redis_proxy/v2"
 	tcp_proxy "github.com/envoyproxy/go-control-plane/envoy/config/filter/network/tcp_proxy/v2"
 	thrift_proxy "github.com/envoyproxy/go-control-plane/envoy/config/filter/network/thrift_proxy/v2alpha1"
+	zookeeper_proxy "github.com/envoyproxy/go-control-plane/envoy/config/filter/network/zookeeper_proxy/v1alpha1"
 	"github.com/envoyproxy/go-control-plane/pkg/wellknown"
 	"github.com/golang/protobuf/ptypes"
+	structpb "github.com/golang/protobuf/ptypes/struct"
 
 	networking "istio.io/api/networking/v1alpha3"
 
@@ -39,6 +43,19 @@ import (
 	"istio.io/istio/pkg/config/protocol"
 )
 
+const (
+	// KafkaBrokerFilterName is the name of the Envoy Kafka broker network filter.
+	KafkaBrokerFilterName = "envoy.filters.network.kafka_broker"
+	// PostgresProxyFilterName is the name of the Envoy Postgres proxy network filter.
+	PostgresProxyFilterName = "envoy.filters.network.postgres_proxy"
+	// ZooKeeperProxyFilterName is the name of the Envoy ZooKeeper proxy network filter.
+	ZooKeeperProxyFilterName = "envoy.filters.network.zookeeper_proxy"
+
+	// postgresProxyTypeURL is the type of the Postgres proxy configuration, which has no Go binding in the
+	// vendored go-control-plane; it is sent as a TypedStruct.
+	postgresProxyTypeURL = "type.googleapis.com/envoy.extensions.filters.network.postgres_proxy.v3alpha.PostgresProxy"
+)
+
 var (
 	// redisOpTimeout is the default operation timeout for the Redis proxy filter.
 	redisOpTimeout = 5 * time.Second
@@ -164,6 +181,21 @@ func buildNetworkFiltersStack(_ *model.Proxy, port *model.Port, tcpFilter *liste
 			filterstack = append(filterstack, buildMySQLFilter(statPrefix))
 		}
 		filterstack = append(filterstack, tcpFilter)
+	case protocol.Kafka:
+		if features.EnableKafkaFilter {
+			filterstack = append(filterstack, buildKafkaBrokerFilter(statPrefix))
+		}
+		filterstack = append(filterstack, tcpFilter)
+	case protocol.Postgres:
+		if features.EnablePostgresFilter {
+			filterstack = append(filterstack, buildPostgresFilter(statPrefix))
+		}
+		filterstack = append(filterstack, tcpFilter)
+	case protocol.ZooKeeper:
+		if features.EnableZooKeeperFilter {
+			filterstack = append(filterstack, buildZooKeeperFilter(statPrefix))
+		}
+		filterstack = append(filterstack, tcpFilter)
 	case protocol.Thrift:
 		if features.EnableThriftFilter {
 			// Thrift filter has route config, it is a terminating filter, no need append tcp filter.
@@ -214,12 +246,9 @@ func buildThriftFilter(statPrefix string) *listener.Filter {
 
 // buildMongoFilter builds an outbound Envoy MongoProxy filter.
 func buildMongoFilter(statPrefix string) *listener.Filter {
-	// TODO: add a watcher for /var/lib/istio/mongo/certs
-	// if certs are found use, TLS or mTLS clusters for talking to MongoDB.
-	// User is responsible for mounting those certs in the pod.
+	// TLS origination uses the cluster TLS settings, and faults are set by applyMongoFaultDelay.
 	mongoProxy := &mongo_proxy.MongoProxy{
 		StatPrefix: statPrefix, // mongo stats are prefixed with mongo.<statPrefix> by Envoy
-		// TODO enable faults in mongo
 	}
 
 	out := &listener.Filter{
@@ -245,40 +274,74 @@ func buildOutboundAutoPassthroughFilterStack(push *model.PushContext, node *mode
 	return filterstack
 }
 
-// buildRedisFilter builds an outbound Envoy RedisProxy filter.
+// buildRedisFilter builds an outbound Envoy RedisProxy filter routing all the keys to the cluster.
 // Currently, if multiple clusters are defined, one of them will be picked for
 // configuring the Redis proxy.
 func buildRedisFilter(statPrefix, clusterName string) *listener.Filter {
-	redisProxy := &redis_proxy.RedisProxy{
-		LatencyInMicros: true,       // redis latency stats are captured in micro seconds which is typically the case.
-		StatPrefix:      statPrefix, // redis stats are prefixed with redis.<statPrefix> by Envoy
-		Settings: &redis_proxy.RedisProxy_ConnPoolSettings{
-			OpTimeout: ptypes.DurationProto(redisOpTimeout), // TODO: Make this user configurable
+	return buildRedisProxyFilter(statPrefix, buildRedisConnPoolSettings(nil), &redis_proxy.RedisProxy_PrefixRoutes{
+		CatchAllRoute: &redis_proxy.RedisProxy_PrefixRoutes_Route{
+			Cluster: clusterName,
 		},
-		PrefixRoutes: &redis_proxy.RedisProxy_PrefixRoutes{
-			CatchAllRoute: &redis_proxy.RedisProxy_PrefixRoutes_Route{
-				Cluster: clusterName,
+	})
+}
+
+// buildMySQLFilter builds an outbound Envoy MySQLProxy filter.
+func buildMySQLFilter(statPrefix string) *listener.Filter {
+	mySQLProxy := &mysql_proxy.MySQLProxy{
+		StatPrefix: statPrefix, // MySQL stats are prefixed with mysql.<statPrefix> by Envoy.
+	}
+
+	out := &listener.Filter{
+		Name:       wellknown.MySQLProxy,
+		ConfigType: &listener.Filter_TypedConfig{TypedConfig: util.MessageToAny(mySQLProxy)},
+	}
+
+	return out
+}
+
+// buildKafkaBrokerFilter builds an Envoy KafkaBroker filter.
+func buildKafkaBrokerFilter(statPrefix string) *listener.Filter {
+	kafkaBroker := &kafka_broker.KafkaBroker{
+		StatPrefix: statPrefix, // Kafka stats are prefixed with kafka.<statPrefix> by Envoy.
+	}
+
+	out := &listener.Filter{
+		Name:       KafkaBrokerFilterName,
+		ConfigType: &listener.Filter_TypedConfig{TypedConfig: util.MessageToAny(kafkaBroker)},
+	}
+
+	return out
+}
+
+// buildPostgresFilter builds an Envoy PostgresProxy filter.
+func buildPostgresFilter(statPrefix string) *listener.Filter {
+	postgresProxy := &udpa.TypedStruct{
+		TypeUrl: postgresProxyTypeURL,
+		Value: &structpb.Struct{
+			Fields: map[string]*structpb.Value{
+				// Postgres stats are prefixed with postgres.<statPrefix> by Envoy.
+				"stat_prefix": {Kind: &structpb.Value_StringValue{StringValue: statPrefix}},
 			},
 		},
 	}
 
 	out := &listener.Filter{
-		Name:       wellknown.RedisProxy,
-		ConfigType: &listener.Filter_TypedConfig{TypedConfig: util.MessageToAny(redisProxy)},
+		Name:       PostgresProxyFilterName,
+		ConfigType: &listener.Filter_TypedConfig{TypedConfig: util.MessageToAny(postgresProxy)},
 	}
 
 	return out
 }
 
-// buildMySQLFilter builds an outbound Envoy MySQLProxy filter.
-func buildMySQLFilter(statPrefix string) *listener.Filter {
-	mySQLProxy := &mysql_proxy.MySQLProxy{
-		StatPrefix: statPrefix, // MySQL stats are prefixed with mysql.<statPrefix> by Envoy.
+// buildZooKeeperFilter builds an Envoy ZooKeeperProxy filter.
+func buildZooKeeperFilter(statPrefix string) *listener.Filter {
+	zooKeeperProxy := &zookeeper_proxy.ZooKeeperProxy{
+		StatPrefix: statPrefix, // ZooKeeper stats are prefixed with <statPrefix>.zookeeper by Envoy.
 	}
 
 	out := &listener.Filter{
-		Name:       wellknown.MySQLProxy,
-		ConfigType: &listener.Filter_TypedConfig{TypedConfig: util.MessageToAny(mySQLProxy)},
+		Name:       ZooKeeperProxyFilterName,
+		ConfigType: &listener.Filter_TypedConfig{TypedConfig: util.MessageToAny(zooKeeperProxy)},
 	}
 
 	return out
@@ -17,14 +17,18 @@ package v1alpha3
 import (
 	"testing"
 
+	udpa "github.com/cncf/udpa/go/udpa/type/v1"
 	listener "github.com/envoyproxy/go-control-plane/envoy/api/v2/listener"
+	kafka_broker "github.com/envoyproxy/go-control-plane/envoy/config/filter/network/kafka_broker/v2alpha1"
 	redis_proxy "github.com/envoyproxy/go-control-plane/envoy/config/filter/network/redis_proxy/v2"
 	tcp_proxy "github.com/envoyproxy/go-control-plane/envoy/config/filter/network/tcp_proxy/v2"
+	zookeeper_proxy "github.com/envoyproxy/go-control-plane/envoy/config/filter/network/zookeeper_proxy/v1alpha1"
 	xdsutil "github.com/envoyproxy/go-control-plane/pkg/wellknown"
 
 	"github.com/golang/protobuf/ptypes"
 
 	networking "istio.io/api/networking/v1alpha3"
+	"istio.io/istio/pilot/pkg/features"
 	"istio.io/istio/pilot/pkg/model"
 	"istio.io/istio/pkg/config/protocol"
 )
@@ -53,6 +57,80 @@ func TestBuildRedisFilter(t *testing.T) {
 	}
 }
 
+func TestBuildKafkaNetworkFiltersStack(t *testing.T) {
+	defaultValue := features.EnableKafkaFilter
+	defer func() { features.EnableKafkaFilter = defaultValue }()
+
+	port := &model.Port{Name: "kafka-broker", Port: 9092, Protocol: protocol.Kafka}
+	tcpFilter := &listener.Filter{Name: xdsutil.TCPProxy}
+
+	features.EnableKafkaFilter = false
+	filters := buildNetworkFiltersStack(nil, port, tcpFilter, "kafka-stats", "kafka-cluster")
+	if len(filters) != 1 || filters[0].Name != xdsutil.TCPProxy {
+		t.Fatalf("expected only the tcp proxy filter when kafka filter is disabled, got %v", filters)
+	}
+
+	features.EnableKafkaFilter = true
+	filters = buildNetworkFiltersStack(nil, port, tcpFilter, "kafka-stats", "kafka-cluster")
+	if len(filters) != 2 || filters[0].Name != KafkaBrokerFilterName || filters[1].Name != xdsutil.TCPProxy {
+		t.Fatalf("expected the kafka broker filter before the tcp proxy filter, got %v", filters)
+	}
+	kafkaBroker := &kafka_broker.KafkaBroker{}
+	if err := ptypes.UnmarshalAny(filters[0].GetTypedConfig(), kafkaBroker); err != nil {
+		t.Fatalf("unmarshal failed: %v", err)
+	}
+	if kafkaBroker.StatPrefix != "kafka-stats" {
+		t.Errorf("kafka broker statPrefix is %s", kafkaBroker.StatPrefix)
+	}
+}
+
+func TestBuildPostgresAndZooKeeperNetworkFiltersStack(t *testing.T) {
+	tcpFilter := &listener.Filter{Name: xdsutil.TCPProxy}
+	postgres := &model.Port{Name: "postgres", Port: 5432, Protocol: protocol.Postgres}
+	zooKeeper := &model.Port{Name: "zookeeper", Port: 2181, Protocol: protocol.ZooKeeper}
+
+	// The filters are only added when enabled.
+	for _, port := range []*model.Port{postgres, zooKeeper} {
+		filters := buildNetworkFiltersStack(nil, port, tcpFilter, "stats", "cluster")
+		if len(filters) != 1 || filters[0].Name != xdsutil.TCPProxy {
+			t.Fatalf("expected only the tcp proxy filter for %s, got %v", port.Name, filters)
+		}
+	}
+
+	defaultPostgres, defaultZooKeeper := features.EnablePostgresFilter, features.EnableZooKeeperFilter
+	features.EnablePostgresFilter, features.EnableZooKeeperFilter = true, true
+	defer func() {
+		features.EnablePostgresFilter, features.EnableZooKeeperFilter = defaultPostgres, defaultZooKeeper
+	}()
+
+	filters := buildNetworkFiltersStack(nil, postgres, tcpFilter, "postgres-stats", "postgres-cluster")
+	if len(filters) != 2 || filters[0].Name != PostgresProxyFilterName || filters[1].Name != xdsutil.TCPProxy {
+		t.Fatalf("expected the postgres proxy filter before the tcp proxy filter, got %v", filters)
+	}
+	postgresProxy := &udpa.TypedStruct{}
+	if err := ptypes.UnmarshalAny(filters[0].GetTypedConfig(), postgresProxy); err != nil {
+		t.Fatalf("unmarshal failed: %v", err)
+	}
+	if postgresProxy.TypeUrl != postgresProxyTypeURL {
+		t.Errorf("postgres proxy type is %s", postgresProxy.TypeUrl)
+	}
+	if prefix := postgresProxy.Value.Fields["stat_prefix"].GetStringValue(); prefix != "postgres-stats" {
+		t.Errorf("postgres proxy statPrefix is %s", prefix)
+	}
+
+	filters = buildNetworkFiltersStack(nil, zooKeeper, tcpFilter, "zookeeper-stats", "zookeeper-cluster")
+	if len(filters) != 2 || filters[0].Name != ZooKeeperProxyFilterName || filters[1].Name != xdsutil.TCPProxy {
+		t.Fatalf("expected the zookeeper proxy filter before the tcp proxy filter, got %v", filters)
+	}
+	zooKeeperProxy := &zookeeper_proxy.ZooKeeperProxy{}
+	if err := ptypes.UnmarshalAny(filters[0].GetTypedConfig(), zooKeeperProxy); err != nil {
+		t.Fatalf("unmarshal failed: %v", err)
+	}
+	if zooKeeperProxy.StatPrefix != "zookeeper-stats" {
+		t.Errorf("zookeeper proxy statPrefix is %s", zooKeeperProxy.StatPrefix)
+	}
+}
+
 func TestInboundNetworkFilterStatPrefix(t *testing.T) {
 	cases := []struct {
 		name               string
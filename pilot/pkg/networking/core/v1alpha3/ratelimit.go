@@ -0,0 +1,154 @@
+// Copyright 2020 Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package v1alpha3
+
+import (
+	"time"
+
+	core "github.com/envoyproxy/go-control-plane/envoy/api/v2/core"
+	listener "github.com/envoyproxy/go-control-plane/envoy/api/v2/listener"
+	http_ratelimit "github.com/envoyproxy/go-control-plane/envoy/config/filter/http/rate_limit/v2"
+	http_conn "github.com/envoyproxy/go-control-plane/envoy/config/filter/network/http_connection_manager/v2"
+	local_ratelimit "github.com/envoyproxy/go-control-plane/envoy/config/filter/network/local_rate_limit/v2alpha"
+	ratelimit "github.com/envoyproxy/go-control-plane/envoy/config/ratelimit/v2"
+	xdstype "github.com/envoyproxy/go-control-plane/envoy/type"
+	"github.com/envoyproxy/go-control-plane/pkg/wellknown"
+	"github.com/golang/protobuf/ptypes"
+	"github.com/golang/protobuf/ptypes/wrappers"
+
+	meshconfig "istio.io/api/mesh/v1alpha1"
+	"istio.io/pkg/log"
+
+	"istio.io/istio/pilot/pkg/model"
+	istio_route "istio.io/istio/pilot/pkg/networking/core/v1alpha3/route"
+	"istio.io/istio/pilot/pkg/networking/util"
+	"istio.io/istio/pkg/config/annotation"
+	"istio.io/istio/pkg/util/gogo"
+)
+
+// Rate limiting is configured without Mixer as follows:
+//
+// - global rate limiting of HTTP requests, enabled by PILOT_ENABLE_HTTP_RATE_LIMIT, uses the rate limit
+//   service of the mesh config, set by meshConfig.thriftConfig.rateLimitUrl and rateLimitTimeout for both the
+//   Thrift and HTTP ports. The sidecar outbound and gateway HTTP connection managers call the rate limit
+//   service with the descriptors of the route, see istio_route.BuildRateLimits.
+// - the rate of the TCP connections to a service, not of its requests, is limited by the
+//   ConnectionRateLimitAnnotation of its DestinationRule. Each client proxy enforces the limit with a token
+//   bucket, without a rate limit service. Envoy has no local rate limit filter for HTTP requests yet.
+
+const (
+	// ConnectionRateLimitAnnotation on a DestinationRule limits the rate of the TCP connections opened by
+	// each client proxy to the service, in the <connections>/<interval> form, e.g. "100/1s".
+	ConnectionRateLimitAnnotation = annotation.ConnectionRateLimit
+	// ConnectionRateLimitFilterName is the name of the network filter enforcing ConnectionRateLimitAnnotation.
+	ConnectionRateLimitFilterName = "envoy.filters.network.local_ratelimit"
+
+	// HTTPRateLimitDomain is the domain of the descriptors of the HTTP routes sent to the rate limit service.
+	HTTPRateLimitDomain = "istio"
+	// defaultHTTPRateLimitTimeout is the timeout of the calls to the rate limit service, unless set by the
+	// mesh config. Requests are allowed if the rate limit service does not answer in time.
+	defaultHTTPRateLimitTimeout = 50 * time.Millisecond
+)
+
+// buildHTTPRateLimitFilter builds the HTTP filter calling the rate limit service of the mesh, or returns nil
+// if global rate limiting is disabled.
+func buildHTTPRateLimitFilter(mesh *meshconfig.MeshConfig) *http_conn.HttpFilter {
+	rateLimitURL := istio_route.RateLimitServiceURL(mesh)
+	if rateLimitURL == "" {
+		return nil
+	}
+	rlsClusterName, err := rlsClusterNameFromAuthority(rateLimitURL)
+	if err != nil {
+		log.Errorf("unable to generate the rate limit service cluster name: %v", err)
+		return nil
+	}
+
+	rateLimit := &http_ratelimit.RateLimit{
+		Domain:          HTTPRateLimitDomain,
+		Timeout:         ptypes.DurationProto(defaultHTTPRateLimitTimeout),
+		FailureModeDeny: false,
+		RateLimitService: &ratelimit.RateLimitServiceConfig{
+			GrpcService: &core.GrpcService{
+				TargetSpecifier: &core.GrpcService_EnvoyGrpc_{
+					EnvoyGrpc: &core.GrpcService_EnvoyGrpc{
+						ClusterName: rlsClusterName,
+					},
+				},
+			},
+		},
+	}
+	if timeout := mesh.GetThriftConfig().GetRateLimitTimeout(); timeout != nil {
+		rateLimit.Timeout = gogo.DurationToProtoDuration(timeout)
+	}
+
+	return &http_conn.HttpFilter{
+		Name:       wellknown.HTTPRateLimit,
+		ConfigType: &http_conn.HttpFilter_TypedConfig{TypedConfig: util.MessageToAny(rateLimit)},
+	}
+}
+
+// parseConnectionRateLimit parses the value of the ConnectionRateLimitAnnotation.
+func parseConnectionRateLimit(value string) (*xdstype.TokenBucket, error) {
+	tokens, interval, err := annotation.ParseConnectionRateLimit(value)
+	if err != nil {
+		return nil, err
+	}
+	return &xdstype.TokenBucket{
+		MaxTokens:     tokens,
+		TokensPerFill: &wrappers.UInt32Value{Value: tokens},
+		FillInterval:  ptypes.DurationProto(interval),
+	}, nil
+}
+
+// buildConnectionRateLimitFilter builds the network filter limiting the rate of the connections to a service,
+// or returns nil if its destination rule, which may be nil, has no valid ConnectionRateLimitAnnotation.
+func buildConnectionRateLimitFilter(destinationRule *model.Config, statPrefix string) *listener.Filter {
+	if destinationRule == nil {
+		return nil
+	}
+	value, f := destinationRule.Annotations[ConnectionRateLimitAnnotation]
+	if !f {
+		return nil
+	}
+	tokenBucket, err := parseConnectionRateLimit(value)
+	if err != nil {
+		log.Warnf("ignoring invalid %s annotation of destination rule %s/%s: %v",
+			ConnectionRateLimitAnnotation, destinationRule.Namespace, destinationRule.Name, err)
+		return nil
+	}
+
+	return &listener.Filter{
+		Name: ConnectionRateLimitFilterName,
+		ConfigType: &listener.Filter_TypedConfig{TypedConfig: util.MessageToAny(&local_ratelimit.LocalRateLimit{
+			StatPrefix:  statPrefix,
+			TokenBucket: tokenBucket,
+		})},
+	}
+}
+
+// applyConnectionRateLimit adds the connection rate limit filter of the service, if any, in front of the network
+// filters of the outbound filter chains.
+func applyConnectionRateLimit(opts []*filterChainOpts, node *model.Proxy, push *model.PushContext, service *model.Service) {
+	if service == nil {
+		return
+	}
+	filter := buildConnectionRateLimitFilter(push.DestinationRule(node, service), string(service.Hostname))
+	if filter == nil {
+		return
+	}
+	for _, opt := range opts {
+		opt.networkFilters = append([]*listener.Filter{filter}, opt.networkFilters...)
+	}
+}
@@ -0,0 +1,135 @@
+// Copyright 2020 Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package v1alpha3
+
+import (
+	"testing"
+	"time"
+
+	http_ratelimit "github.com/envoyproxy/go-control-plane/envoy/config/filter/http/rate_limit/v2"
+	local_ratelimit "github.com/envoyproxy/go-control-plane/envoy/config/filter/network/local_rate_limit/v2alpha"
+	"github.com/gogo/protobuf/types"
+	"github.com/golang/protobuf/ptypes"
+
+	meshconfig "istio.io/api/mesh/v1alpha1"
+
+	"istio.io/istio/pilot/pkg/features"
+	"istio.io/istio/pilot/pkg/model"
+	"istio.io/istio/pkg/config/mesh"
+)
+
+func TestBuildHTTPRateLimitFilter(t *testing.T) {
+	meshConfig := mesh.DefaultMeshConfig()
+	if filter := buildHTTPRateLimitFilter(&meshConfig); filter != nil {
+		t.Fatalf("expected no filter without a rate limit service, got %v", filter)
+	}
+
+	meshConfig.ThriftConfig = &meshconfig.MeshConfig_ThriftConfig{
+		RateLimitUrl:     "ratelimit.istio-system.svc.cluster.local:8081",
+		RateLimitTimeout: &types.Duration{Nanos: int32(100 * time.Millisecond)},
+	}
+	// The rate limit service of the Thrift ports is only used for HTTP requests when opted in.
+	if filter := buildHTTPRateLimitFilter(&meshConfig); filter != nil {
+		t.Fatalf("expected no filter without PILOT_ENABLE_HTTP_RATE_LIMIT, got %v", filter)
+	}
+	defaultValue := features.EnableHTTPRateLimit
+	features.EnableHTTPRateLimit = true
+	defer func() { features.EnableHTTPRateLimit = defaultValue }()
+
+	filter := buildHTTPRateLimitFilter(&meshConfig)
+	if filter == nil {
+		t.Fatal("expected a rate limit filter")
+	}
+	rateLimit := &http_ratelimit.RateLimit{}
+	if err := ptypes.UnmarshalAny(filter.GetTypedConfig(), rateLimit); err != nil {
+		t.Fatal(err)
+	}
+	if rateLimit.Domain != "istio" {
+		t.Errorf("expected the istio domain, got %q", rateLimit.Domain)
+	}
+	if timeout, _ := ptypes.Duration(rateLimit.Timeout); timeout != 100*time.Millisecond {
+		t.Errorf("expected the timeout of the mesh config, got %v", timeout)
+	}
+	cluster := rateLimit.RateLimitService.GrpcService.GetEnvoyGrpc().GetClusterName()
+	if cluster != "outbound|8081||ratelimit.istio-system.svc.cluster.local" {
+		t.Errorf("unexpected rate limit service cluster %q", cluster)
+	}
+	if err := rateLimit.Validate(); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestParseConnectionRateLimit(t *testing.T) {
+	cases := []struct {
+		value    string
+		tokens   uint32
+		interval time.Duration
+		valid    bool
+	}{
+		{value: "100/1s", tokens: 100, interval: time.Second, valid: true},
+		{value: " 10 / 1m ", tokens: 10, interval: time.Minute, valid: true},
+		{value: "100"},
+		{value: "0/1s"},
+		{value: "-1/1s"},
+		{value: "100/forever"},
+		{value: "100/10ms"},
+	}
+	for _, tt := range cases {
+		t.Run(tt.value, func(t *testing.T) {
+			tokenBucket, err := parseConnectionRateLimit(tt.value)
+			if !tt.valid {
+				if err == nil {
+					t.Fatalf("expected an error, got %v", tokenBucket)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			interval, _ := ptypes.Duration(tokenBucket.FillInterval)
+			if tokenBucket.MaxTokens != tt.tokens || tokenBucket.TokensPerFill.GetValue() != tt.tokens || interval != tt.interval {
+				t.Errorf("expected %d tokens every %v, got %v", tt.tokens, tt.interval, tokenBucket)
+			}
+		})
+	}
+}
+
+func TestBuildConnectionRateLimitFilter(t *testing.T) {
+	if filter := buildConnectionRateLimitFilter(nil, "foo.com"); filter != nil {
+		t.Errorf("expected no filter without destination rule, got %v", filter)
+	}
+
+	destinationRule := &model.Config{ConfigMeta: model.ConfigMeta{Name: "foo", Namespace: "default",
+		Annotations: map[string]string{ConnectionRateLimitAnnotation: "invalid"}}}
+	if filter := buildConnectionRateLimitFilter(destinationRule, "foo.com"); filter != nil {
+		t.Errorf("expected no filter for an invalid annotation, got %v", filter)
+	}
+
+	destinationRule.Annotations[ConnectionRateLimitAnnotation] = "100/1s"
+	filter := buildConnectionRateLimitFilter(destinationRule, "foo.com")
+	if filter == nil || filter.Name != ConnectionRateLimitFilterName {
+		t.Fatalf("expected a connection rate limit filter, got %v", filter)
+	}
+	localRateLimit := &local_ratelimit.LocalRateLimit{}
+	if err := ptypes.UnmarshalAny(filter.GetTypedConfig(), localRateLimit); err != nil {
+		t.Fatal(err)
+	}
+	if localRateLimit.StatPrefix != "foo.com" || localRateLimit.TokenBucket.MaxTokens != 100 {
+		t.Errorf("unexpected local rate limit %v", localRateLimit)
+	}
+	if err := localRateLimit.Validate(); err != nil {
+		t.Error(err)
+	}
+}
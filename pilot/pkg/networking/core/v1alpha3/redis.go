@@ -0,0 +1,215 @@
+// Copyright 2020 Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package v1alpha3
+
+import (
+	"strconv"
+	"strings"
+
+	apiv2 "github.com/envoyproxy/go-control-plane/envoy/api/v2"
+	endpoint "github.com/envoyproxy/go-control-plane/envoy/api/v2/endpoint"
+	listener "github.com/envoyproxy/go-control-plane/envoy/api/v2/listener"
+	redis_cluster "github.com/envoyproxy/go-control-plane/envoy/config/cluster/redis"
+	redis_proxy "github.com/envoyproxy/go-control-plane/envoy/config/filter/network/redis_proxy/v2"
+	"github.com/envoyproxy/go-control-plane/pkg/wellknown"
+	"github.com/golang/protobuf/ptypes"
+
+	networking "istio.io/api/networking/v1alpha3"
+	"istio.io/pkg/log"
+
+	"istio.io/istio/pilot/pkg/model"
+	istio_route "istio.io/istio/pilot/pkg/networking/core/v1alpha3/route"
+	"istio.io/istio/pilot/pkg/networking/util"
+	"istio.io/istio/pkg/config/annotation"
+	"istio.io/istio/pkg/config/host"
+	"istio.io/istio/pkg/config/labels"
+)
+
+// When the Redis filter is enabled, sidecars configure the Redis proxy of a Redis port as follows:
+//
+// - the HTTP routes of the virtual services are key prefix routes, see istio_route.BuildRedisPrefixRoutesForVirtualService.
+//   Without a catch all HTTP route, the first matching TCP route or the service itself is the catch all route.
+// - the DestinationRule of the service selects the read policy with the RedisReadPolicyAnnotation, and the Redis
+//   Cluster mode with the RedisClusterModeAnnotation, as the DestinationRule API has no Redis specific settings.
+
+const (
+	// RedisReadPolicyAnnotation on a DestinationRule selects the Redis proxy read policy for the service.
+	RedisReadPolicyAnnotation = annotation.RedisReadPolicy
+	// RedisClusterModeAnnotation on a DestinationRule discovers the service as a Redis Cluster.
+	RedisClusterModeAnnotation = annotation.RedisClusterMode
+	// RedisClusterType is the name of the Envoy Redis Cluster custom cluster type.
+	RedisClusterType = "envoy.clusters.redis"
+)
+
+// isRedisClusterMode returns true if the destination rule enables the Redis Cluster mode.
+func isRedisClusterMode(destinationRule *model.Config) bool {
+	if destinationRule == nil {
+		return false
+	}
+	enabled, _ := strconv.ParseBool(destinationRule.Annotations[RedisClusterModeAnnotation])
+	return enabled
+}
+
+// buildRedisConnPoolSettings builds the Redis proxy connection pool settings for the destination rule
+// of a service, which may be nil.
+func buildRedisConnPoolSettings(destinationRule *model.Config) *redis_proxy.RedisProxy_ConnPoolSettings {
+	settings := &redis_proxy.RedisProxy_ConnPoolSettings{
+		OpTimeout: ptypes.DurationProto(redisOpTimeout), // TODO: Make this user configurable
+	}
+	if destinationRule == nil {
+		return settings
+	}
+
+	if policy := destinationRule.Annotations[RedisReadPolicyAnnotation]; policy != "" {
+		if value, f := redis_proxy.RedisProxy_ConnPoolSettings_ReadPolicy_value[strings.ToUpper(policy)]; f {
+			settings.ReadPolicy = redis_proxy.RedisProxy_ConnPoolSettings_ReadPolicy(value)
+		} else {
+			log.Warnf("ignoring invalid %s annotation %q of destination rule %s/%s",
+				RedisReadPolicyAnnotation, policy, destinationRule.Namespace, destinationRule.Name)
+		}
+	}
+	if isRedisClusterMode(destinationRule) {
+		// Follow the MOVED and ASK redirections of the cluster, and keep the keys of a hash tag on the same slot.
+		settings.EnableRedirection = true
+		settings.EnableHashtagging = true
+	}
+	return settings
+}
+
+// buildRedisProxyFilter builds an outbound Envoy RedisProxy filter.
+func buildRedisProxyFilter(statPrefix string, settings *redis_proxy.RedisProxy_ConnPoolSettings,
+	prefixRoutes *redis_proxy.RedisProxy_PrefixRoutes) *listener.Filter {
+	redisProxy := &redis_proxy.RedisProxy{
+		LatencyInMicros: true,       // redis latency stats are captured in micro seconds which is typically the case.
+		StatPrefix:      statPrefix, // redis stats are prefixed with redis.<statPrefix> by Envoy
+		Settings:        settings,
+		PrefixRoutes:    prefixRoutes,
+	}
+
+	return &listener.Filter{
+		Name:       wellknown.RedisProxy,
+		ConfigType: &listener.Filter_TypedConfig{TypedConfig: util.MessageToAny(redisProxy)},
+	}
+}
+
+// applyRedisClusterMode converts the default and subset clusters of a Redis service port to Redis Clusters,
+// if enabled by the destination rule of the service. The subsets of a Redis Cluster are not distinguished:
+// the topology is discovered from the service host.
+func (cb *ClusterBuilder) applyRedisClusterMode(service *model.Service, port *model.Port, clusters []*apiv2.Cluster) {
+	if !isRedisClusterMode(cb.push.DestinationRule(cb.proxy, service)) {
+		return
+	}
+
+	for _, cluster := range clusters {
+		cluster.ClusterDiscoveryType = &apiv2.Cluster_ClusterType{
+			ClusterType: &apiv2.Cluster_CustomClusterType{
+				Name:        RedisClusterType,
+				TypedConfig: util.MessageToAny(&redis_cluster.RedisClusterConfig{}),
+			},
+		}
+		// The Redis Cluster load balancer routes the requests to the owner of the key slot.
+		cluster.LbPolicy = apiv2.Cluster_CLUSTER_PROVIDED
+		cluster.LbConfig = nil
+		cluster.EdsClusterConfig = nil
+		cluster.LbSubsetConfig = nil
+		cluster.DnsLookupFamily = apiv2.Cluster_V4_ONLY
+		cluster.LoadAssignment = &apiv2.ClusterLoadAssignment{
+			ClusterName: cluster.Name,
+			Endpoints: []*endpoint.LocalityLbEndpoints{{
+				LbEndpoints: []*endpoint.LbEndpoint{{
+					HostIdentifier: &endpoint.LbEndpoint_Endpoint{
+						Endpoint: &endpoint.Endpoint{Address: util.BuildAddress(string(service.Hostname), uint32(port.Port))},
+					},
+				}},
+			}},
+		}
+	}
+}
+
+// buildSidecarOutboundRedisFilterChainOpts builds the filter chain of a Redis port, routing the keys with the
+// HTTP routes of the virtual services.
+func buildSidecarOutboundRedisFilterChainOpts(node *model.Proxy, push *model.PushContext, destinationCIDR string,
+	service *model.Service, listenPort *model.Port, gateways map[string]bool, configs []model.Config) []*filterChainOpts {
+	// In case of a sidecar config with user defined port, if the user specified port is not the same as the
+	// service's port, then pick the service port if and only if the service has only one port.
+	port := listenPort.Port
+	if len(service.Ports) == 1 {
+		port = service.Ports[0].Port
+	}
+	clusterName := model.BuildSubsetKey(model.TrafficDirectionOutbound, "", service.Hostname, port)
+	statPrefix := clusterName
+	// If stat name is configured, use it to build the stat prefix.
+	if len(push.Mesh.OutboundClusterStatName) != 0 {
+		statPrefix = util.BuildStatPrefix(push.Mesh.OutboundClusterStatName, string(service.Hostname), "", &model.Port{Port: port}, service.Attributes)
+	}
+
+	prefixRoutes := &redis_proxy.RedisProxy_PrefixRoutes{}
+	// The Redis proxy rejects duplicate prefixes: the route of the first virtual service is kept.
+	prefixes := map[string]bool{}
+	for _, cfg := range configs {
+		routes, catchAll := istio_route.BuildRedisPrefixRoutesForVirtualService(node, push, cfg, listenPort.Port, gateways)
+		for _, route := range routes {
+			if prefixes[route.Prefix] {
+				log.Debugf("ignoring the duplicate Redis prefix %q of virtual service %s/%s", route.Prefix, cfg.Namespace, cfg.Name)
+				continue
+			}
+			prefixes[route.Prefix] = true
+			prefixRoutes.Routes = append(prefixRoutes.Routes, route)
+		}
+		if catchAll != nil {
+			prefixRoutes.CatchAllRoute = catchAll
+			break
+		}
+	}
+	if prefixRoutes.CatchAllRoute == nil {
+		prefixRoutes.CatchAllRoute = &redis_proxy.RedisProxy_PrefixRoutes_Route{
+			Cluster: redisTCPCatchAllCluster(node, push, listenPort, gateways, configs, clusterName),
+		}
+	}
+
+	settings := buildRedisConnPoolSettings(push.DestinationRule(node, service))
+	return []*filterChainOpts{{
+		destinationCIDRs: []string{destinationCIDR},
+		networkFilters:   []*listener.Filter{buildRedisProxyFilter(statPrefix, settings, prefixRoutes)},
+	}}
+}
+
+// redisTCPCatchAllCluster returns the first destination of the first TCP route matching the Redis port, or the
+// default cluster. The Redis proxy has no weighted clusters, so the first destination with a weight is used.
+func redisTCPCatchAllCluster(node *model.Proxy, push *model.PushContext, listenPort *model.Port,
+	gateways map[string]bool, configs []model.Config, defaultCluster string) string {
+	for _, cfg := range configs {
+		virtualService := cfg.Spec.(*networking.VirtualService)
+		for _, tcp := range virtualService.Tcp {
+			matched := len(tcp.Match) == 0
+			for _, match := range tcp.Match {
+				if matchTCP(match, labels.Collection{node.Metadata.Labels}, gateways, listenPort.Port, node.Metadata.Namespace) {
+					matched = true
+					break
+				}
+			}
+			if !matched {
+				continue
+			}
+			for _, route := range tcp.Route {
+				if route.Weight > 0 || len(tcp.Route) == 1 {
+					service := node.SidecarScope.ServiceForHostname(host.Name(route.Destination.Host), push.ServiceByHostnameAndNamespace)
+					return istio_route.GetDestinationCluster(route.Destination, service, listenPort.Port)
+				}
+			}
+		}
+	}
+	return defaultCluster
+}
@@ -0,0 +1,217 @@
+// Copyright 2020 Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package v1alpha3
+
+import (
+	"testing"
+
+	apiv2 "github.com/envoyproxy/go-control-plane/envoy/api/v2"
+	redis_proxy "github.com/envoyproxy/go-control-plane/envoy/config/filter/network/redis_proxy/v2"
+	"github.com/envoyproxy/go-control-plane/pkg/wellknown"
+	"github.com/golang/protobuf/ptypes"
+
+	networking "istio.io/api/networking/v1alpha3"
+
+	"istio.io/istio/pilot/pkg/features"
+	"istio.io/istio/pilot/pkg/model"
+	"istio.io/istio/pilot/pkg/networking/core/v1alpha3/fakes"
+	"istio.io/istio/pilot/pkg/networking/plugin"
+	"istio.io/istio/pkg/config/host"
+	"istio.io/istio/pkg/config/protocol"
+	"istio.io/istio/pkg/config/schema/collections"
+	"istio.io/istio/pkg/config/schema/resource"
+)
+
+func buildRedisTestEnv(t *testing.T, service *model.Service, annotations map[string]string) (*model.Environment, *model.Proxy) {
+	t.Helper()
+	destinationRule := model.Config{
+		ConfigMeta: model.ConfigMeta{
+			Type:        collections.IstioNetworkingV1Alpha3Destinationrules.Resource().Kind(),
+			Version:     collections.IstioNetworkingV1Alpha3Destinationrules.Resource().Version(),
+			Name:        "redis",
+			Namespace:   "default",
+			Annotations: annotations,
+		},
+		Spec: &networking.DestinationRule{
+			Host:    string(service.Hostname),
+			Subsets: []*networking.Subset{{Name: "v1", Labels: map[string]string{"version": "v1"}}},
+		},
+	}
+	configStore := &fakes.IstioConfigStore{
+		ListStub: func(kind resource.GroupVersionKind, namespace string) ([]model.Config, error) {
+			if kind == collections.IstioNetworkingV1Alpha3Destinationrules.Resource().GroupVersionKind() {
+				return []model.Config{destinationRule}, nil
+			}
+			return nil, nil
+		},
+	}
+	serviceDiscovery := &fakes.ServiceDiscovery{}
+	serviceDiscovery.ServicesReturns([]*model.Service{service}, nil)
+
+	env := newTestEnvironment(serviceDiscovery, testMesh, configStore)
+	proxy := &model.Proxy{
+		Type:         model.SidecarProxy,
+		IPAddresses:  []string{"6.6.6.6"},
+		DNSDomain:    "default.svc.cluster.local",
+		Metadata:     &model.NodeMetadata{Namespace: "default"},
+		IstioVersion: model.MaxIstioVersion,
+	}
+	proxy.SetSidecarScope(env.PushContext)
+	proxy.DiscoverIPVersions()
+	return env, proxy
+}
+
+func buildRedisTestService() *model.Service {
+	return &model.Service{
+		Hostname:    host.Name("redis.default.svc.cluster.local"),
+		Address:     "10.0.0.20",
+		ClusterVIPs: make(map[string]string),
+		Ports:       model.PortList{{Name: "redis", Port: 6379, Protocol: protocol.Redis}},
+		Resolution:  model.ClientSideLB,
+		Attributes:  model.ServiceAttributes{Namespace: "default"},
+	}
+}
+
+func TestRedisClusterMode(t *testing.T) {
+	defaultValue := features.EnableRedisFilter
+	features.EnableRedisFilter = true
+	defer func() { features.EnableRedisFilter = defaultValue }()
+
+	env, proxy := buildRedisTestEnv(t, buildRedisTestService(), map[string]string{RedisClusterModeAnnotation: "true"})
+	clusters := NewConfigGenerator([]plugin.Plugin{}).BuildClusters(proxy, env.PushContext)
+	found := 0
+	for _, c := range clusters {
+		switch c.Name {
+		case "outbound|6379||redis.default.svc.cluster.local", "outbound|6379|v1|redis.default.svc.cluster.local":
+		default:
+			continue
+		}
+		found++
+		if err := c.Validate(); err != nil {
+			t.Fatalf("cluster %s failed validation with error %v", c.Name, err)
+		}
+		if got := c.GetClusterType().GetName(); got != RedisClusterType {
+			t.Errorf("expected the %s cluster type for %s, got %v", RedisClusterType, c.Name, c.ClusterDiscoveryType)
+		}
+		if c.LbPolicy != apiv2.Cluster_CLUSTER_PROVIDED {
+			t.Errorf("expected the cluster provided load balancer for %s, got %v", c.Name, c.LbPolicy)
+		}
+		seed := c.GetLoadAssignment().GetEndpoints()[0].GetLbEndpoints()[0].GetEndpoint().GetAddress().GetSocketAddress()
+		if seed.GetAddress() != "redis.default.svc.cluster.local" || seed.GetPortValue() != 6379 {
+			t.Errorf("unexpected seed %v for %s", seed, c.Name)
+		}
+	}
+	if found != 2 {
+		t.Fatalf("expected the default and subset redis clusters in %v", clusters)
+	}
+}
+
+func TestSidecarOutboundRedisFilterChainOpts(t *testing.T) {
+	service := buildRedisTestService()
+	env, proxy := buildRedisTestEnv(t, service, map[string]string{RedisReadPolicyAnnotation: "prefer_replica"})
+	virtualService := model.Config{
+		ConfigMeta: model.ConfigMeta{
+			Type:      collections.IstioNetworkingV1Alpha3Virtualservices.Resource().Kind(),
+			Name:      "redis",
+			Namespace: "default",
+		},
+		Spec: &networking.VirtualService{
+			Hosts: []string{"redis.default.svc.cluster.local"},
+			Http: []*networking.HTTPRoute{
+				{
+					Match: []*networking.HTTPMatchRequest{{
+						Uri: &networking.StringMatch{MatchType: &networking.StringMatch_Prefix{Prefix: "session:"}},
+					}},
+					Route: []*networking.HTTPRouteDestination{{
+						Destination: &networking.Destination{Host: "sessions.default.svc.cluster.local", Port: &networking.PortSelector{Number: 6379}},
+					}},
+					Mirror: &networking.Destination{Host: "shadow.default.svc.cluster.local", Port: &networking.PortSelector{Number: 6379}},
+				},
+			},
+		},
+	}
+
+	// The prefix of the first virtual service is kept, as the Redis proxy rejects duplicate prefixes.
+	duplicate := model.Config{
+		ConfigMeta: model.ConfigMeta{
+			Type:      collections.IstioNetworkingV1Alpha3Virtualservices.Resource().Kind(),
+			Name:      "redis-duplicate",
+			Namespace: "default",
+		},
+		Spec: &networking.VirtualService{
+			Hosts: []string{"redis.default.svc.cluster.local"},
+			Http: []*networking.HTTPRoute{
+				{
+					Match: []*networking.HTTPMatchRequest{{
+						Uri: &networking.StringMatch{MatchType: &networking.StringMatch_Prefix{Prefix: "session:"}},
+					}},
+					Route: []*networking.HTTPRouteDestination{{
+						Destination: &networking.Destination{Host: "redis.default.svc.cluster.local"},
+					}},
+				},
+			},
+		},
+	}
+
+	opts := buildSidecarOutboundRedisFilterChainOpts(proxy, env.PushContext, "10.0.0.20/32", service, service.Ports[0],
+		map[string]bool{"mesh": true}, []model.Config{virtualService, duplicate})
+	if len(opts) != 1 || len(opts[0].networkFilters) != 1 {
+		t.Fatalf("expected a single filter chain with the redis filter, got %v", opts)
+	}
+	redisProxy := &redis_proxy.RedisProxy{}
+	if err := ptypes.UnmarshalAny(opts[0].networkFilters[0].GetTypedConfig(), redisProxy); err != nil {
+		t.Fatal(err)
+	}
+	if err := redisProxy.Validate(); err != nil {
+		t.Fatalf("redis proxy failed validation with error %v", err)
+	}
+	if redisProxy.Settings.ReadPolicy != redis_proxy.RedisProxy_ConnPoolSettings_PREFER_REPLICA {
+		t.Errorf("expected the PREFER_REPLICA read policy, got %v", redisProxy.Settings.ReadPolicy)
+	}
+	if redisProxy.Settings.EnableRedirection {
+		t.Errorf("redirection must only be enabled in cluster mode")
+	}
+	routes := redisProxy.PrefixRoutes
+	if len(routes.Routes) != 1 || routes.Routes[0].Prefix != "session:" ||
+		routes.Routes[0].Cluster != "outbound|6379||sessions.default.svc.cluster.local" {
+		t.Fatalf("unexpected prefix routes %v", routes.Routes)
+	}
+	if mirror := routes.Routes[0].RequestMirrorPolicy; len(mirror) != 1 || mirror[0].Cluster != "outbound|6379||shadow.default.svc.cluster.local" {
+		t.Errorf("unexpected mirror policy %v", mirror)
+	}
+	if routes.CatchAllRoute.Cluster != "outbound|6379||redis.default.svc.cluster.local" {
+		t.Errorf("expected the service as catch all route, got %v", routes.CatchAllRoute)
+	}
+}
+
+func TestSidecarOutboundRedisConnectionRateLimit(t *testing.T) {
+	defaultValue := features.EnableRedisFilter
+	features.EnableRedisFilter = true
+	defer func() { features.EnableRedisFilter = defaultValue }()
+
+	service := buildRedisTestService()
+	env, proxy := buildRedisTestEnv(t, service, map[string]string{ConnectionRateLimitAnnotation: "100/1s"})
+	opts := buildSidecarOutboundTCPFilterChainOpts(proxy, env.PushContext, "10.0.0.20/32", service, service.Ports[0],
+		map[string]bool{"mesh": true}, nil)
+	if len(opts) != 1 || len(opts[0].networkFilters) != 2 {
+		t.Fatalf("expected a single filter chain with the rate limit and redis filters, got %v", opts)
+	}
+	if name := opts[0].networkFilters[0].Name; name != ConnectionRateLimitFilterName {
+		t.Errorf("expected the connection rate limit filter first, got %s", name)
+	}
+	if name := opts[0].networkFilters[1].Name; name != wellknown.RedisProxy {
+		t.Errorf("expected the redis filter last, got %s", name)
+	}
+}
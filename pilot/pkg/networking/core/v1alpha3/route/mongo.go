@@ -0,0 +1,71 @@
+// Copyright 2020 Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package route
+
+import (
+	xdsfault "github.com/envoyproxy/go-control-plane/envoy/config/filter/fault/v2"
+
+	networking "istio.io/api/networking/v1alpha3"
+	"istio.io/pkg/log"
+
+	"istio.io/istio/pilot/pkg/model"
+	"istio.io/istio/pkg/config/labels"
+)
+
+// BuildMongoFaultDelayForVirtualService returns the delay to inject in the Mongo operations of the given port,
+// taken from the fault of the first HTTP route of the virtual service matching the port. As TCP routes have no
+// fault injection, the HTTP routes carry the faults of Mongo ports; their destinations are not used.
+// Only the routes with a match naming the port apply, so that the faults of the HTTP ports of the same host
+// are not injected in the Mongo operations. The Mongo proxy only supports fixed delays: aborts are ignored.
+func BuildMongoFaultDelayForVirtualService(
+	node *model.Proxy,
+	virtualService model.Config,
+	listenPort int,
+	gatewayNames map[string]bool) *xdsfault.FaultDelay {
+
+	vs, ok := virtualService.Spec.(*networking.VirtualService)
+	if !ok { // should never happen
+		return nil
+	}
+
+	for _, http := range vs.Http {
+		if http.Fault == nil || !mongoRouteMatches(node, http, listenPort, gatewayNames) {
+			continue
+		}
+		if http.Fault.Abort != nil {
+			log.Debugf("ignoring abort fault of virtual service %s/%s for Mongo: aborts are not supported",
+				virtualService.Namespace, virtualService.Name)
+		}
+		if fault := translateFault(http.Fault); fault != nil && fault.Delay != nil {
+			return fault.Delay
+		}
+	}
+	return nil
+}
+
+// mongoRouteMatches returns true if the HTTP route has a match for the port. The routes without match, or
+// with matches without port, are HTTP routes and do not apply to Mongo ports.
+func mongoRouteMatches(node *model.Proxy, http *networking.HTTPRoute, listenPort int, gatewayNames map[string]bool) bool {
+	for _, match := range http.Match {
+		// Match by source labels/gateway names and by the destination port specified in the match condition
+		if !sourceMatchHTTP(match, labels.Collection{node.Metadata.Labels}, gatewayNames, node.Metadata.Namespace) {
+			continue
+		}
+		if match != nil && match.Port == uint32(listenPort) {
+			return true
+		}
+	}
+	return false
+}
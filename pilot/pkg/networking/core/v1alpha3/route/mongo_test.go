@@ -0,0 +1,96 @@
+// Copyright 2020 Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package route_test
+
+import (
+	"testing"
+	"time"
+
+	envoy_type "github.com/envoyproxy/go-control-plane/envoy/type"
+	"github.com/gogo/protobuf/types"
+	"github.com/golang/protobuf/ptypes"
+	"github.com/onsi/gomega"
+
+	networking "istio.io/api/networking/v1alpha3"
+
+	"istio.io/istio/pilot/pkg/model"
+	"istio.io/istio/pilot/pkg/networking/core/v1alpha3/route"
+	"istio.io/istio/pkg/config/schema/collections"
+)
+
+func TestBuildMongoFaultDelayForVirtualService(t *testing.T) {
+	g := gomega.NewGomegaWithT(t)
+
+	virtualService := model.Config{
+		ConfigMeta: model.ConfigMeta{
+			Type:      collections.IstioNetworkingV1Alpha3Virtualservices.Resource().Kind(),
+			Name:      "mongo",
+			Namespace: "default",
+		},
+		Spec: &networking.VirtualService{
+			Hosts: []string{"mongo.default.svc.cluster.local"},
+			Http: []*networking.HTTPRoute{
+				{
+					Match: []*networking.HTTPMatchRequest{{Port: 27018}},
+					Fault: &networking.HTTPFaultInjection{
+						Delay: &networking.HTTPFaultInjection_Delay{
+							HttpDelayType: &networking.HTTPFaultInjection_Delay_FixedDelay{FixedDelay: &types.Duration{Seconds: 5}},
+						},
+					},
+				},
+				{
+					// Routes that do not name the port are HTTP routes.
+					Fault: &networking.HTTPFaultInjection{
+						Delay: &networking.HTTPFaultInjection_Delay{
+							HttpDelayType: &networking.HTTPFaultInjection_Delay_FixedDelay{FixedDelay: &types.Duration{Seconds: 1}},
+						},
+					},
+				},
+				{
+					Match: []*networking.HTTPMatchRequest{{Port: 27017}},
+					Fault: &networking.HTTPFaultInjection{
+						Delay: &networking.HTTPFaultInjection_Delay{
+							Percentage:    &networking.Percent{Value: 25},
+							HttpDelayType: &networking.HTTPFaultInjection_Delay_FixedDelay{FixedDelay: &types.Duration{Seconds: 2}},
+						},
+						Abort: &networking.HTTPFaultInjection_Abort{
+							ErrorType: &networking.HTTPFaultInjection_Abort_HttpStatus{HttpStatus: 500},
+						},
+					},
+				},
+			},
+		},
+	}
+	node := &model.Proxy{
+		Type:     model.SidecarProxy,
+		Metadata: &model.NodeMetadata{},
+	}
+
+	delay := route.BuildMongoFaultDelayForVirtualService(node, virtualService, 27017, map[string]bool{"mesh": true})
+	g.Expect(delay).NotTo(gomega.BeNil())
+	d, err := ptypes.Duration(delay.GetFixedDelay())
+	g.Expect(err).NotTo(gomega.HaveOccurred())
+	g.Expect(d).To(gomega.Equal(2 * time.Second))
+	g.Expect(delay.Percentage.Numerator).To(gomega.Equal(uint32(250000)))
+	g.Expect(delay.Percentage.Denominator).To(gomega.Equal(envoy_type.FractionalPercent_MILLION))
+
+	delay = route.BuildMongoFaultDelayForVirtualService(node, virtualService, 27018, map[string]bool{"mesh": true})
+	d, err = ptypes.Duration(delay.GetFixedDelay())
+	g.Expect(err).NotTo(gomega.HaveOccurred())
+	g.Expect(d).To(gomega.Equal(5 * time.Second))
+
+	delay = route.BuildMongoFaultDelayForVirtualService(node, virtualService, 27019, map[string]bool{"mesh": true})
+	g.Expect(delay).To(gomega.BeNil())
+}
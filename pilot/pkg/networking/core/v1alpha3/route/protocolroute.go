@@ -0,0 +1,73 @@
+// Copyright 2020 Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package route
+
+import (
+	"fmt"
+
+	networking "istio.io/api/networking/v1alpha3"
+)
+
+// protocolRoute describes which parts of the HTTP routes of virtual services are translated to the
+// routes of a protocol proxy, such as the Thrift or Redis proxy. The other fields of the HTTP routes
+// are ignored, as they have no equivalent in the protocol proxy. The matches that cannot be
+// translated are skipped, as ignoring a condition would route more requests than configured.
+type protocolRoute struct {
+	// mirror is true if the protocol proxy mirrors requests.
+	mirror bool
+	// singleDestination is true if the protocol proxy only routes to the first destination.
+	singleDestination bool
+	// isMatch checks if a match can be translated.
+	isMatch func(*networking.HTTPMatchRequest) bool
+}
+
+// ignoredFields returns the fields of an HTTP route that are ignored by the protocol proxy, including
+// the matches that are skipped. The route is skipped if it has no destination.
+func (p protocolRoute) ignoredFields(http *networking.HTTPRoute) []string {
+	if len(http.Route) == 0 {
+		return []string{"route"}
+	}
+	var out []string
+	for _, f := range []struct {
+		name  string
+		isSet bool
+	}{
+		{"redirect", http.Redirect != nil},
+		{"rewrite", http.Rewrite != nil},
+		{"timeout", http.Timeout != nil},
+		{"retries", http.Retries != nil},
+		{"fault", http.Fault != nil},
+		{"mirror", http.Mirror != nil && !p.mirror},
+		{"corsPolicy", http.CorsPolicy != nil},
+		{"headers", http.Headers != nil},
+	} {
+		if f.isSet {
+			out = append(out, f.name)
+		}
+	}
+	for i, destination := range http.Route {
+		if p.singleDestination && i > 0 {
+			out = append(out, fmt.Sprintf("route[%d]", i))
+		} else if destination.Headers != nil {
+			out = append(out, fmt.Sprintf("route[%d].headers", i))
+		}
+	}
+	for i, match := range http.Match {
+		if !p.isMatch(match) {
+			out = append(out, fmt.Sprintf("match[%d]", i))
+		}
+	}
+	return out
+}
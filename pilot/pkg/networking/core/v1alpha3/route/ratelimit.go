@@ -0,0 +1,105 @@
+// Copyright 2020 Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package route
+
+import (
+	"strings"
+
+	route "github.com/envoyproxy/go-control-plane/envoy/api/v2/route"
+
+	meshconfig "istio.io/api/mesh/v1alpha1"
+
+	"istio.io/istio/pilot/pkg/features"
+	"istio.io/istio/pilot/pkg/model"
+	"istio.io/istio/pkg/config/annotation"
+)
+
+// When global rate limiting of HTTP requests is enabled (RateLimitServiceURL), each route sends the following
+// descriptors to the rate limit service, all starting with a generic_key entry identifying the route:
+//
+// - (generic_key, route): the route is <namespace>/<virtual service>[/<route name>] for the routes of
+//   virtual services, and <hostname>:<port> for the default route of a service.
+// - (generic_key, route), (source_cluster, service cluster): the service cluster of the proxy sending the
+//   request, <app>.<namespace> for sidecars, is filled in by Envoy so that the routes are the same for all
+//   the proxies. It stands for the source principal: the Envoy route API has no rate limit action reading
+//   the peer identity or the dynamic metadata, and the generic_key entries have a fixed descriptor key.
+// - (generic_key, route), (<header>, value): for each of the RateLimitDescriptorHeaders of the virtual
+//   service present in the request.
+
+// RateLimitServiceURL returns the address of the rate limit service of the HTTP routes, or an empty string
+// if global rate limiting of HTTP requests is disabled. The HTTP ports share the rate limit service of the
+// Thrift ports, and only use it when opted in with features.EnableHTTPRateLimit, as the meshes setting it
+// for Thrift do not expect HTTP requests to be rate limited.
+func RateLimitServiceURL(mesh *meshconfig.MeshConfig) string {
+	if !features.EnableHTTPRateLimit {
+		return ""
+	}
+	return mesh.GetThriftConfig().GetRateLimitUrl()
+}
+
+// BuildRateLimits builds the rate limit actions of a route, identified by routeKey, given the annotations of
+// its virtual service, which may be nil. It returns nil if global rate limiting is disabled.
+func BuildRateLimits(push *model.PushContext, routeKey string, annotations map[string]string) []*route.RateLimit {
+	if push == nil || RateLimitServiceURL(push.Mesh) == "" || routeKey == "" {
+		return nil
+	}
+
+	routeAction := genericKeyAction(routeKey)
+	out := []*route.RateLimit{
+		{Actions: []*route.RateLimit_Action{routeAction}},
+		{Actions: []*route.RateLimit_Action{routeAction, {
+			ActionSpecifier: &route.RateLimit_Action_SourceCluster_{SourceCluster: &route.RateLimit_Action_SourceCluster{}},
+		}}},
+	}
+
+	for _, header := range strings.Split(annotations[annotation.RateLimitDescriptorHeaders], ",") {
+		header = strings.ToLower(strings.TrimSpace(header))
+		if header == "" {
+			continue
+		}
+		out = append(out, &route.RateLimit{
+			Actions: []*route.RateLimit_Action{
+				routeAction,
+				{
+					ActionSpecifier: &route.RateLimit_Action_RequestHeaders_{
+						RequestHeaders: &route.RateLimit_Action_RequestHeaders{
+							HeaderName:    header,
+							DescriptorKey: header,
+						},
+					},
+				},
+			},
+		})
+	}
+
+	return out
+}
+
+// virtualServiceRouteKey identifies a route of a virtual service in the rate limit descriptors.
+func virtualServiceRouteKey(virtualService model.Config, routeName string) string {
+	key := virtualService.Namespace + "/" + virtualService.Name
+	if routeName != "" {
+		key += "/" + routeName
+	}
+	return key
+}
+
+func genericKeyAction(value string) *route.RateLimit_Action {
+	return &route.RateLimit_Action{
+		ActionSpecifier: &route.RateLimit_Action_GenericKey_{
+			GenericKey: &route.RateLimit_Action_GenericKey{DescriptorValue: value},
+		},
+	}
+}
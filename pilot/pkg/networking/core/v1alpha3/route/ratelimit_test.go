@@ -0,0 +1,121 @@
+// Copyright 2020 Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package route_test
+
+import (
+	"reflect"
+	"testing"
+
+	envoyroute "github.com/envoyproxy/go-control-plane/envoy/api/v2/route"
+
+	meshconfig "istio.io/api/mesh/v1alpha1"
+
+	"istio.io/istio/pilot/pkg/features"
+	"istio.io/istio/pilot/pkg/model"
+	"istio.io/istio/pilot/pkg/networking/core/v1alpha3/route"
+	"istio.io/istio/pkg/config/annotation"
+	"istio.io/istio/pkg/config/host"
+	"istio.io/istio/pkg/config/mesh"
+	"istio.io/istio/pkg/config/protocol"
+)
+
+func genericKey(value string) *envoyroute.RateLimit_Action {
+	return &envoyroute.RateLimit_Action{
+		ActionSpecifier: &envoyroute.RateLimit_Action_GenericKey_{
+			GenericKey: &envoyroute.RateLimit_Action_GenericKey{DescriptorValue: value},
+		},
+	}
+}
+
+// enableHTTPRateLimit enables the global rate limiting of HTTP requests, until the returned function is called.
+func enableHTTPRateLimit() func() {
+	defaultValue := features.EnableHTTPRateLimit
+	features.EnableHTTPRateLimit = true
+	return func() { features.EnableHTTPRateLimit = defaultValue }
+}
+
+// rateLimitPush returns a push context whose mesh config has a rate limit service.
+func rateLimitPush() *model.PushContext {
+	meshConfig := mesh.DefaultMeshConfig()
+	meshConfig.ThriftConfig = &meshconfig.MeshConfig_ThriftConfig{RateLimitUrl: "ratelimit.istio-system.svc.cluster.local:8081"}
+	return &model.PushContext{Mesh: &meshConfig}
+}
+
+func TestBuildRateLimits(t *testing.T) {
+	annotations := map[string]string{annotation.RateLimitDescriptorHeaders: "x-user, ,X-Tenant"}
+	meshConfig := mesh.DefaultMeshConfig()
+	if rateLimits := route.BuildRateLimits(&model.PushContext{Mesh: &meshConfig}, "default/reviews", annotations); rateLimits != nil {
+		t.Fatalf("expected no rate limits without a rate limit service, got %v", rateLimits)
+	}
+	// The rate limit service of the Thrift ports is only used by the HTTP routes when opted in.
+	if rateLimits := route.BuildRateLimits(rateLimitPush(), "default/reviews", annotations); rateLimits != nil {
+		t.Fatalf("expected no rate limits without PILOT_ENABLE_HTTP_RATE_LIMIT, got %v", rateLimits)
+	}
+	defer enableHTTPRateLimit()()
+	if rateLimits := route.BuildRateLimits(&model.PushContext{Mesh: &meshConfig}, "default/reviews", annotations); rateLimits != nil {
+		t.Fatalf("expected no rate limits without a rate limit service, got %v", rateLimits)
+	}
+
+	sourceCluster := &envoyroute.RateLimit_Action{
+		ActionSpecifier: &envoyroute.RateLimit_Action_SourceCluster_{SourceCluster: &envoyroute.RateLimit_Action_SourceCluster{}},
+	}
+	expected := []*envoyroute.RateLimit{
+		{Actions: []*envoyroute.RateLimit_Action{genericKey("default/reviews")}},
+		{Actions: []*envoyroute.RateLimit_Action{genericKey("default/reviews"), sourceCluster}},
+		{Actions: []*envoyroute.RateLimit_Action{genericKey("default/reviews"), {
+			ActionSpecifier: &envoyroute.RateLimit_Action_RequestHeaders_{
+				RequestHeaders: &envoyroute.RateLimit_Action_RequestHeaders{HeaderName: "x-user", DescriptorKey: "x-user"},
+			},
+		}}},
+		{Actions: []*envoyroute.RateLimit_Action{genericKey("default/reviews"), {
+			ActionSpecifier: &envoyroute.RateLimit_Action_RequestHeaders_{
+				RequestHeaders: &envoyroute.RateLimit_Action_RequestHeaders{HeaderName: "x-tenant", DescriptorKey: "x-tenant"},
+			},
+		}}},
+	}
+	if got := route.BuildRateLimits(rateLimitPush(), "default/reviews", annotations); !reflect.DeepEqual(got, expected) {
+		t.Errorf("expected %v, got %v", expected, got)
+	}
+
+	// The routes of services without virtual service only send the route and source descriptors.
+	if got := route.BuildRateLimits(rateLimitPush(), "reviews.default.svc.cluster.local:9080", nil); len(got) != 2 {
+		t.Errorf("expected 2 rate limits without descriptor headers, got %v", got)
+	}
+}
+
+func TestBuildHTTPRoutesRateLimits(t *testing.T) {
+	defer enableHTTPRateLimit()()
+	serviceRegistry := map[host.Name]*model.Service{
+		"*.example.org": {
+			Hostname: "*.example.org",
+			Ports:    model.PortList{{Name: "default", Port: 8080, Protocol: protocol.HTTP}},
+		},
+	}
+	node := &model.Proxy{Type: model.SidecarProxy, Metadata: &model.NodeMetadata{}}
+
+	vs := virtualServicePlain
+	vs.Namespace = "default"
+	routes, err := route.BuildHTTPRoutesForVirtualService(node, rateLimitPush(), vs, serviceRegistry, 8080,
+		map[string]bool{"some-gateway": true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(routes) != 1 {
+		t.Fatalf("expected 1 route, got %v", routes)
+	}
+	if got := routes[0].GetRoute().RateLimits; len(got) != 2 || !reflect.DeepEqual(got[0].Actions, []*envoyroute.RateLimit_Action{genericKey("default/acme")}) {
+		t.Errorf("expected the rate limits of default/acme, got %v", got)
+	}
+}
@@ -0,0 +1,115 @@
+// Copyright 2020 Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package route
+
+import (
+	redis_proxy "github.com/envoyproxy/go-control-plane/envoy/config/filter/network/redis_proxy/v2"
+
+	networking "istio.io/api/networking/v1alpha3"
+
+	"istio.io/istio/pilot/pkg/model"
+	"istio.io/istio/pkg/config/labels"
+)
+
+// Redis ports are routed with the HTTP routes of the virtual services: a uri prefix match is a key prefix
+// match, and a route without match is the catch all route. Commands are sent to the first destination of
+// the route, and mirrored with mirror and mirrorPercentage. Redis commands have no headers, so the header
+// matches and manipulations are not supported, see RedisIgnoredFields.
+
+// BuildRedisPrefixRoutesForVirtualService translates the HTTP routes of a virtual service to Redis prefix
+// routes for the given port. The catch all route is nil if the virtual service has no route without match.
+// The Redis proxy rejects duplicate prefixes, so only the first route of a prefix is kept, like the first
+// matching HTTP route.
+func BuildRedisPrefixRoutesForVirtualService(
+	node *model.Proxy,
+	push *model.PushContext,
+	virtualService model.Config,
+	listenPort int,
+	gatewayNames map[string]bool) (routes []*redis_proxy.RedisProxy_PrefixRoutes_Route, catchAll *redis_proxy.RedisProxy_PrefixRoutes_Route) {
+
+	vs, ok := virtualService.Spec.(*networking.VirtualService)
+	if !ok { // should never happen
+		return nil, nil
+	}
+
+	prefixes := map[string]bool{}
+	for _, http := range vs.Http {
+		if len(http.Route) == 0 {
+			continue
+		}
+		if len(http.Match) == 0 {
+			// We have a rule with catch all match. Other rules are of no use.
+			return routes, translateRedisRoute(node, push, http, "", listenPort)
+		}
+		for _, match := range http.Match {
+			// Match by source labels/gateway names and by the destination port specified in the match condition
+			if !sourceMatchHTTP(match, labels.Collection{node.Metadata.Labels}, gatewayNames, node.Metadata.Namespace) {
+				continue
+			}
+			if match != nil && match.Port != 0 && match.Port != uint32(listenPort) {
+				continue
+			}
+			if !IsRedisMatch(match) {
+				continue
+			}
+			prefix := match.GetUri().GetPrefix()
+			if prefixes[prefix] {
+				continue
+			}
+			prefixes[prefix] = true
+			routes = append(routes, translateRedisRoute(node, push, http, prefix, listenPort))
+		}
+	}
+	return routes, nil
+}
+
+var redisRoute = protocolRoute{mirror: true, singleDestination: true, isMatch: IsRedisMatch}
+
+// RedisIgnoredFields returns the fields of an HTTP route that are ignored when the route is applied to a
+// Redis port, including the matches that are skipped.
+func RedisIgnoredFields(http *networking.HTTPRoute) []string {
+	return redisRoute.ignoredFields(http)
+}
+
+// IsRedisMatch checks if an HTTP match can be translated to a Redis prefix route, which only matches a key
+// prefix (uri prefix).
+func IsRedisMatch(match *networking.HTTPMatchRequest) bool {
+	if match == nil {
+		return true
+	}
+	if prefix, ok := match.Uri.GetMatchType().(*networking.StringMatch_Prefix); !ok || prefix.Prefix == "" {
+		return false
+	}
+	return !match.IgnoreUriCase && match.Scheme == nil && match.Method == nil && match.Authority == nil &&
+		len(match.Headers) == 0 && len(match.WithoutHeaders) == 0 && len(match.QueryParams) == 0
+}
+
+// translateRedisRoute translates an HTTP route to a Redis prefix route.
+func translateRedisRoute(node *model.Proxy, push *model.PushContext, in *networking.HTTPRoute,
+	prefix string, port int) *redis_proxy.RedisProxy_PrefixRoutes_Route {
+	out := &redis_proxy.RedisProxy_PrefixRoutes_Route{
+		Prefix:  prefix,
+		Cluster: serviceDestinationCluster(node, push, in.Route[0].Destination, port),
+	}
+	if in.Mirror != nil {
+		if mp := mirrorPercent(in); mp != nil {
+			out.RequestMirrorPolicy = []*redis_proxy.RedisProxy_PrefixRoutes_Route_RequestMirrorPolicy{{
+				Cluster:         serviceDestinationCluster(node, push, in.Mirror, port),
+				RuntimeFraction: mp,
+			}}
+		}
+	}
+	return out
+}
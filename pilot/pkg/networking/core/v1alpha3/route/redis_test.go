@@ -0,0 +1,199 @@
+// Copyright 2020 Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package route_test
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/onsi/gomega"
+
+	networking "istio.io/api/networking/v1alpha3"
+
+	"istio.io/istio/pilot/pkg/model"
+	"istio.io/istio/pilot/pkg/networking/core/v1alpha3/route"
+	"istio.io/istio/pkg/config/mesh"
+	"istio.io/istio/pkg/config/schema/collections"
+)
+
+var virtualServiceRedis = model.Config{
+	ConfigMeta: model.ConfigMeta{
+		Type:      collections.IstioNetworkingV1Alpha3Virtualservices.Resource().Kind(),
+		Version:   collections.IstioNetworkingV1Alpha3Virtualservices.Resource().Version(),
+		Name:      "redis",
+		Namespace: "default",
+	},
+	Spec: &networking.VirtualService{
+		Hosts: []string{"redis.default.svc.cluster.local"},
+		Http: []*networking.HTTPRoute{
+			{
+				Name: "headers",
+				Match: []*networking.HTTPMatchRequest{{
+					Uri:     &networking.StringMatch{MatchType: &networking.StringMatch_Prefix{Prefix: "cache:"}},
+					Headers: map[string]*networking.StringMatch{"x-canary": {MatchType: &networking.StringMatch_Exact{Exact: "true"}}},
+				}},
+				Route: []*networking.HTTPRouteDestination{{
+					Destination: &networking.Destination{Host: "redis.default.svc.cluster.local", Subset: "v2"},
+				}},
+			},
+			{
+				Name: "weighted",
+				Match: []*networking.HTTPMatchRequest{
+					{Uri: &networking.StringMatch{MatchType: &networking.StringMatch_Prefix{Prefix: "session:"}}},
+				},
+				Route: []*networking.HTTPRouteDestination{
+					{Destination: &networking.Destination{Host: "redis.default.svc.cluster.local", Subset: "v1"}, Weight: 50},
+					{Destination: &networking.Destination{Host: "redis.default.svc.cluster.local", Subset: "v2"}, Weight: 50},
+				},
+			},
+			{
+				Name: "users",
+				Match: []*networking.HTTPMatchRequest{
+					{Uri: &networking.StringMatch{MatchType: &networking.StringMatch_Prefix{Prefix: "user:"}}},
+					{Uri: &networking.StringMatch{MatchType: &networking.StringMatch_Prefix{Prefix: "account:"}}, Port: 6380},
+				},
+				Route: []*networking.HTTPRouteDestination{{
+					Destination: &networking.Destination{Host: "redis.default.svc.cluster.local", Subset: "users"},
+				}},
+				Mirror:           &networking.Destination{Host: "redis.default.svc.cluster.local", Subset: "shadow"},
+				MirrorPercentage: &networking.Percent{Value: 0},
+			},
+			{
+				Name: "default",
+				Route: []*networking.HTTPRouteDestination{{
+					Destination: &networking.Destination{Host: "redis.default.svc.cluster.local", Subset: "v1"},
+				}},
+				Mirror: &networking.Destination{Host: "redis.default.svc.cluster.local", Subset: "shadow"},
+			},
+		},
+	},
+}
+
+func TestBuildRedisPrefixRoutesForVirtualService(t *testing.T) {
+	g := gomega.NewGomegaWithT(t)
+
+	m := mesh.DefaultMeshConfig()
+	push := model.NewPushContext()
+	push.Mesh = &m
+	node := &model.Proxy{
+		Type:        model.SidecarProxy,
+		IPAddresses: []string{"1.1.1.1"},
+		ID:          "someID",
+		DNSDomain:   "default.svc.cluster.local",
+		Metadata:    &model.NodeMetadata{},
+	}
+	node.SidecarScope = model.DefaultSidecarScopeForNamespace(push, "default")
+
+	// The header match is skipped, the weighted route only uses its first destination, and the account
+	// prefix match is for another port.
+	routes, catchAll := route.BuildRedisPrefixRoutesForVirtualService(node, push, virtualServiceRedis, 6379,
+		map[string]bool{"mesh": true})
+	g.Expect(len(routes)).To(gomega.Equal(2))
+	g.Expect(routes[0].Prefix).To(gomega.Equal("session:"))
+	g.Expect(routes[0].Cluster).To(gomega.Equal("outbound|6379|v1|redis.default.svc.cluster.local"))
+	g.Expect(routes[1].Prefix).To(gomega.Equal("user:"))
+	g.Expect(routes[1].Cluster).To(gomega.Equal("outbound|6379|users|redis.default.svc.cluster.local"))
+	// An explicit zero mirror percentage disables the mirror.
+	g.Expect(routes[1].RequestMirrorPolicy).To(gomega.BeNil())
+
+	g.Expect(catchAll).NotTo(gomega.BeNil())
+	g.Expect(catchAll.Prefix).To(gomega.Equal(""))
+	g.Expect(catchAll.Cluster).To(gomega.Equal("outbound|6379|v1|redis.default.svc.cluster.local"))
+	g.Expect(len(catchAll.RequestMirrorPolicy)).To(gomega.Equal(1))
+	g.Expect(catchAll.RequestMirrorPolicy[0].Cluster).To(gomega.Equal("outbound|6379|shadow|redis.default.svc.cluster.local"))
+
+	routes, _ = route.BuildRedisPrefixRoutesForVirtualService(node, push, virtualServiceRedis, 6380,
+		map[string]bool{"mesh": true})
+	g.Expect(len(routes)).To(gomega.Equal(3))
+	g.Expect(routes[2].Prefix).To(gomega.Equal("account:"))
+}
+
+func TestBuildRedisPrefixRoutesDuplicatePrefixes(t *testing.T) {
+	g := gomega.NewGomegaWithT(t)
+
+	m := mesh.DefaultMeshConfig()
+	push := model.NewPushContext()
+	push.Mesh = &m
+	node := &model.Proxy{
+		Type:        model.SidecarProxy,
+		IPAddresses: []string{"1.1.1.1"},
+		ID:          "someID",
+		DNSDomain:   "default.svc.cluster.local",
+		Metadata:    &model.NodeMetadata{Labels: map[string]string{"app": "client"}},
+	}
+	node.SidecarScope = model.DefaultSidecarScopeForNamespace(push, "default")
+
+	prefix := &networking.StringMatch{MatchType: &networking.StringMatch_Prefix{Prefix: "cache:"}}
+	virtualService := model.Config{
+		ConfigMeta: model.ConfigMeta{
+			Type:      collections.IstioNetworkingV1Alpha3Virtualservices.Resource().Kind(),
+			Name:      "redis-duplicates",
+			Namespace: "default",
+		},
+		Spec: &networking.VirtualService{
+			Hosts: []string{"redis.default.svc.cluster.local"},
+			Http: []*networking.HTTPRoute{
+				{
+					// The matches only differ in port and source labels.
+					Match: []*networking.HTTPMatchRequest{
+						{Uri: prefix, Port: 6379},
+						{Uri: prefix, SourceLabels: map[string]string{"app": "client"}},
+						{Uri: prefix},
+					},
+					Route: []*networking.HTTPRouteDestination{{
+						Destination: &networking.Destination{Host: "redis.default.svc.cluster.local", Subset: "v1"},
+					}},
+				},
+				{
+					Match: []*networking.HTTPMatchRequest{{Uri: prefix}},
+					Route: []*networking.HTTPRouteDestination{{
+						Destination: &networking.Destination{Host: "redis.default.svc.cluster.local", Subset: "v2"},
+					}},
+				},
+			},
+		},
+	}
+
+	// Only the first route of the prefix is kept, as the Redis proxy rejects duplicate prefixes.
+	routes, _ := route.BuildRedisPrefixRoutesForVirtualService(node, push, virtualService, 6379,
+		map[string]bool{"mesh": true})
+	g.Expect(len(routes)).To(gomega.Equal(1))
+	g.Expect(routes[0].Prefix).To(gomega.Equal("cache:"))
+	g.Expect(routes[0].Cluster).To(gomega.Equal("outbound|6379|v1|redis.default.svc.cluster.local"))
+}
+
+func TestRedisIgnoredFields(t *testing.T) {
+	spec := virtualServiceRedis.Spec.(*networking.VirtualService)
+	cases := []struct {
+		route *networking.HTTPRoute
+		want  []string
+	}{
+		{spec.Http[0], []string{"match[0]"}},
+		{spec.Http[1], []string{"route[1]"}},
+		{spec.Http[2], nil},
+		{&networking.HTTPRoute{
+			Retries: &networking.HTTPRetry{Attempts: 3},
+			Route: []*networking.HTTPRouteDestination{{
+				Destination: &networking.Destination{Host: "redis.default.svc.cluster.local"},
+				Headers:     &networking.Headers{},
+			}},
+		}, []string{"retries", "route[0].headers"}},
+	}
+	for _, tc := range cases {
+		if got := route.RedisIgnoredFields(tc.route); !reflect.DeepEqual(got, tc.want) {
+			t.Errorf("RedisIgnoredFields(%v): got %v, want %v", tc.route, got, tc.want)
+		}
+	}
+}
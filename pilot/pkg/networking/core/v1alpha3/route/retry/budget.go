@@ -0,0 +1,71 @@
+// Copyright 2020 Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package retry
+
+import (
+	"strconv"
+
+	v2Cluster "github.com/envoyproxy/go-control-plane/envoy/api/v2/cluster"
+	xdstype "github.com/envoyproxy/go-control-plane/envoy/type"
+	"github.com/golang/protobuf/ptypes/wrappers"
+
+	"istio.io/pkg/log"
+
+	"istio.io/istio/pilot/pkg/features"
+	"istio.io/istio/pkg/config/annotation"
+)
+
+const (
+	// BudgetPercentAnnotation on a DestinationRule limits the concurrent retries to the destination to this
+	// percentage of the active requests. On the mesh-wide destination rule, the DestinationRule of the root
+	// namespace for the "*" host, it sets the default retry budget of all the destinations. "0" disables the
+	// retry budget.
+	BudgetPercentAnnotation = annotation.RetryBudgetPercent
+)
+
+// ConvertBudget returns the retry budget of a destination, given the annotations of its destination rule and
+// of the mesh-wide destination rule, which may be nil. It returns nil if the destination has no retry budget,
+// in which case the concurrent retries are limited by the max_retries circuit breaker.
+func ConvertBudget(annotations, meshAnnotations map[string]string) *v2Cluster.CircuitBreakers_Thresholds_RetryBudget {
+	percent, f := budgetPercent(annotations)
+	if !f {
+		percent, _ = budgetPercent(meshAnnotations)
+	}
+	if percent <= 0 {
+		return nil
+	}
+
+	budget := &v2Cluster.CircuitBreakers_Thresholds_RetryBudget{
+		BudgetPercent: &xdstype.Percent{Value: percent},
+	}
+	if features.RetryBudgetMinConcurrency >= 0 {
+		budget.MinRetryConcurrency = &wrappers.UInt32Value{Value: uint32(features.RetryBudgetMinConcurrency)}
+	}
+	return budget
+}
+
+// budgetPercent returns the retry budget percentage set by the annotations, if it is set and valid.
+func budgetPercent(annotations map[string]string) (float64, bool) {
+	value, f := annotations[BudgetPercentAnnotation]
+	if !f {
+		return 0, false
+	}
+	percent, err := strconv.ParseFloat(value, 64)
+	if err != nil || percent < 0 || percent > 100 {
+		log.Warnf("ignoring invalid %s annotation %q", BudgetPercentAnnotation, value)
+		return 0, false
+	}
+	return percent, true
+}
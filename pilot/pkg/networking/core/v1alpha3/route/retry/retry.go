@@ -26,6 +26,14 @@ import (
 
 	networking "istio.io/api/networking/v1alpha3"
 	"istio.io/istio/pilot/pkg/networking/util"
+	"istio.io/istio/pkg/config/annotation"
+)
+
+const (
+	// HedgeOnPerTryTimeoutAnnotation on a VirtualService lists the HTTP routes, by name, that are hedged on per try
+	// timeouts: instead of canceling the request timing out, Envoy sends a retry and keeps the first response.
+	// Only idempotent routes should be hedged. "*" hedges all the routes of the virtual service.
+	HedgeOnPerTryTimeoutAnnotation = annotation.HedgeOnPerTryTimeout
 )
 
 var (
@@ -65,6 +73,8 @@ func DefaultPolicy() *route.RetryPolicy {
 // is appended when encountering parts that are valid HTTP status codes.
 //
 // - PerTryTimeout: set from in.PerTryTimeout (if specified)
+//
+// Per try idle timeouts are not supported by the Envoy route API yet.
 func ConvertPolicy(in *networking.HTTPRetry) *route.RetryPolicy {
 	if in == nil {
 		// No policy was set, use a default.
@@ -102,6 +112,24 @@ func ConvertPolicy(in *networking.HTTPRetry) *route.RetryPolicy {
 	return out
 }
 
+// ConvertHedgePolicy returns the hedge policy of the HTTP route routeName, given the retry policy of the route
+// and the annotations of its virtual service. Routes are hedged if listed in the HedgeOnPerTryTimeoutAnnotation
+// and if they have a per try timeout.
+func ConvertHedgePolicy(in *networking.HTTPRetry, routeName string, annotations map[string]string) *route.HedgePolicy {
+	value := annotations[HedgeOnPerTryTimeoutAnnotation]
+	if value == "" || in == nil || in.Attempts <= 0 || in.PerTryTimeout == nil {
+		return nil
+	}
+
+	for _, name := range strings.Split(value, ",") {
+		name = strings.TrimSpace(name)
+		if name == "*" || (name != "" && name == routeName) {
+			return &route.HedgePolicy{HedgeOnPerTryTimeout: true}
+		}
+	}
+	return nil
+}
+
 func parseRetryOn(retryOn string) (string, []uint32) {
 	codes := make([]uint32, 0)
 	tojoin := make([]string, 0)
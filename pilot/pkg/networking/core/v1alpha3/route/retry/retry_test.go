@@ -23,10 +23,14 @@ import (
 	"github.com/golang/protobuf/ptypes"
 	. "github.com/onsi/gomega"
 
+	v2Cluster "github.com/envoyproxy/go-control-plane/envoy/api/v2/cluster"
 	envoyroute "github.com/envoyproxy/go-control-plane/envoy/api/v2/route"
 	previouspriorities "github.com/envoyproxy/go-control-plane/envoy/config/retry/previous_priorities"
+	xdstype "github.com/envoyproxy/go-control-plane/envoy/type"
+	"github.com/golang/protobuf/ptypes/wrappers"
 
 	networking "istio.io/api/networking/v1alpha3"
+	"istio.io/istio/pilot/pkg/features"
 	"istio.io/istio/pilot/pkg/networking/core/v1alpha3/route/retry"
 	"istio.io/istio/pilot/pkg/networking/util"
 )
@@ -213,3 +217,54 @@ func TestRetryRemoteLocalities(t *testing.T) {
 		t.Fatalf("Expected %v, actual %v", expected, policy.RetryPriority)
 	}
 }
+
+func TestHedgePolicy(t *testing.T) {
+	g := NewGomegaWithT(t)
+
+	retries := &networking.HTTPRetry{
+		Attempts:      2,
+		PerTryTimeout: gogoTypes.DurationProto(time.Second),
+	}
+	hedged := &envoyroute.HedgePolicy{HedgeOnPerTryTimeout: true}
+
+	g.Expect(retry.ConvertHedgePolicy(retries, "reads", nil)).To(BeNil())
+	g.Expect(retry.ConvertHedgePolicy(retries, "reads",
+		map[string]string{retry.HedgeOnPerTryTimeoutAnnotation: "writes"})).To(BeNil())
+	g.Expect(retry.ConvertHedgePolicy(retries, "reads",
+		map[string]string{retry.HedgeOnPerTryTimeoutAnnotation: "writes, reads"})).To(Equal(hedged))
+	g.Expect(retry.ConvertHedgePolicy(retries, "",
+		map[string]string{retry.HedgeOnPerTryTimeoutAnnotation: "*"})).To(Equal(hedged))
+
+	// Routes without per try timeout, or without retries, are not hedged.
+	all := map[string]string{retry.HedgeOnPerTryTimeoutAnnotation: "*"}
+	g.Expect(retry.ConvertHedgePolicy(nil, "reads", all)).To(BeNil())
+	g.Expect(retry.ConvertHedgePolicy(&networking.HTTPRetry{Attempts: 2}, "reads", all)).To(BeNil())
+	g.Expect(retry.ConvertHedgePolicy(&networking.HTTPRetry{PerTryTimeout: retries.PerTryTimeout}, "reads", all)).To(BeNil())
+}
+
+func TestBudget(t *testing.T) {
+	g := NewGomegaWithT(t)
+
+	g.Expect(retry.ConvertBudget(nil, nil)).To(BeNil())
+
+	defer func(concurrency int) {
+		features.RetryBudgetMinConcurrency = concurrency
+	}(features.RetryBudgetMinConcurrency)
+	features.RetryBudgetMinConcurrency = 5
+
+	budget := func(percent float64) *v2Cluster.CircuitBreakers_Thresholds_RetryBudget {
+		return &v2Cluster.CircuitBreakers_Thresholds_RetryBudget{
+			BudgetPercent:       &xdstype.Percent{Value: percent},
+			MinRetryConcurrency: &wrappers.UInt32Value{Value: 5},
+		}
+	}
+
+	mesh := map[string]string{retry.BudgetPercentAnnotation: "20"}
+	g.Expect(retry.ConvertBudget(nil, mesh)).To(Equal(budget(20)))
+	g.Expect(retry.ConvertBudget(map[string]string{retry.BudgetPercentAnnotation: "12.5"}, nil)).To(Equal(budget(12.5)))
+	g.Expect(retry.ConvertBudget(map[string]string{retry.BudgetPercentAnnotation: "12.5"}, mesh)).To(Equal(budget(12.5)))
+	g.Expect(retry.ConvertBudget(map[string]string{retry.BudgetPercentAnnotation: "0"}, mesh)).To(BeNil())
+	g.Expect(retry.ConvertBudget(map[string]string{retry.BudgetPercentAnnotation: "150"}, mesh)).To(Equal(budget(20)))
+	g.Expect(retry.ConvertBudget(map[string]string{retry.BudgetPercentAnnotation: "all"}, mesh)).To(Equal(budget(20)))
+	g.Expect(retry.ConvertBudget(map[string]string{}, map[string]string{retry.BudgetPercentAnnotation: "all"})).To(BeNil())
+}
@@ -134,6 +134,7 @@ func BuildSidecarVirtualHostsFromConfigAndRegistry(
 				cluster := model.BuildSubsetKey(model.TrafficDirectionOutbound, "", svc.Hostname, port.Port)
 				traceOperation := traceOperation(string(svc.Hostname), port.Port)
 				httpRoute := BuildDefaultHTTPOutboundRoute(node, cluster, traceOperation)
+				httpRoute.GetRoute().RateLimits = BuildRateLimits(push, traceOperation, nil)
 
 				// if this host has no virtualservice, the consistentHash on its destinationRule will be useless
 				if hashPolicy := getHashPolicyByService(node, push, svc, port); hashPolicy != nil {
@@ -288,11 +289,12 @@ func BuildHTTPRoutesForVirtualService(
 	}
 
 	out := make([]*route.Route, 0, len(vs.Http))
+	sessionCookie := StatefulSessionCookie(node, virtualService)
 
 	for _, http := range vs.Http {
 		if len(http.Match) == 0 {
 			if r := translateRoute(push, node, http, nil, listenPort, virtualService, serviceRegistry, gatewayNames); r != nil {
-				out = append(out, r)
+				out = appendStatefulSessionRoutes(out, r, sessionCookie)
 			}
 			// We have a rule with catch all match prefix: /. Other rules are of no use.
 			break
@@ -302,13 +304,13 @@ func BuildHTTPRoutesForVirtualService(
 				// (translateRoute returns nil), if source or port match fails.
 				if r := translateRoute(push, node, http, match, listenPort, virtualService, serviceRegistry, gatewayNames); r != nil {
 					// We have a valid catch all route. No point building other routes, with match conditions.
-					out = append(out, r)
+					out = appendStatefulSessionRoutes(out, r, sessionCookie)
 					break
 				}
 			}
 			for _, match := range http.Match {
 				if r := translateRoute(push, node, http, match, listenPort, virtualService, serviceRegistry, gatewayNames); r != nil {
-					out = append(out, r)
+					out = appendStatefulSessionRoutes(out, r, sessionCookie)
 				}
 			}
 		}
@@ -404,6 +406,8 @@ func translateRoute(push *model.PushContext, node *model.Proxy, in *networking.H
 		action := &route.RouteAction{
 			Cors:        translateCORSPolicy(in.CorsPolicy),
 			RetryPolicy: retry.ConvertPolicy(in.Retries),
+			HedgePolicy: retry.ConvertHedgePolicy(in.Retries, in.Name, virtualService.Annotations),
+			RateLimits:  BuildRateLimits(push, virtualServiceRouteKey(virtualService, routeName), virtualService.Annotations),
 		}
 
 		// Configure timeouts specified by Virtual Service if they are provided, otherwise set it to defaults.
@@ -0,0 +1,134 @@
+// Copyright 2020 Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package route
+
+import (
+	"fmt"
+	"hash/fnv"
+	"regexp"
+
+	core "github.com/envoyproxy/go-control-plane/envoy/api/v2/core"
+	route "github.com/envoyproxy/go-control-plane/envoy/api/v2/route"
+	matcher "github.com/envoyproxy/go-control-plane/envoy/type/matcher"
+	"github.com/golang/protobuf/proto"
+	"github.com/golang/protobuf/ptypes/wrappers"
+
+	"istio.io/pkg/log"
+
+	"istio.io/istio/pilot/pkg/model"
+	"istio.io/istio/pkg/config/annotation"
+)
+
+// Stateful sessions pin the clients of a gateway to the subset and the endpoint that served their first
+// request, with two session cookies:
+//
+// - <name>-subset identifies the destination chosen by the weighted routing. It is set by the weighted
+//   route, and requests carrying it are routed to that destination only, ahead of the weighted route.
+//   A client whose destination is no longer part of the route is assigned a new one.
+// - <name> holds the address of the endpoint that served the request. It is set on every response, and
+//   copied by the gateway to the request metadata, which the subset load balancer of the destination
+//   matches against the address metadata of the endpoints, see util.StatefulSessionEndpointKey. The
+//   client stays on its endpoint while the endpoint is healthy, whatever the other endpoints. Once the
+//   endpoint is removed from the healthy endpoints of the destination, the request is load balanced as
+//   usual, and the cookie pins the client to its new endpoint.
+//
+// The stateful session replaces the consistent hash policies of the destination rules on the routes.
+
+const (
+	// StatefulSessionAnnotation on a VirtualService enables stateful sessions on its gateway routes. Its
+	// value is the name of the session cookie.
+	StatefulSessionAnnotation = annotation.StatefulSessionCookie
+
+	// statefulSessionSubsetSuffix is appended to the session cookie name to name the subset cookie.
+	statefulSessionSubsetSuffix = "-subset"
+)
+
+// StatefulSessionCookie returns the name of the session cookie of the virtual service, or an empty string
+// if stateful sessions are disabled for the proxy.
+func StatefulSessionCookie(node *model.Proxy, virtualService model.Config) string {
+	if node.Type != model.Router {
+		return ""
+	}
+	name, f := virtualService.Annotations[StatefulSessionAnnotation]
+	if !f {
+		return ""
+	}
+	if err := annotation.Lookup(StatefulSessionAnnotation).Validate(name); err != nil {
+		log.Warnf("ignoring invalid %s annotation of virtual service %s/%s: %v",
+			StatefulSessionAnnotation, virtualService.Namespace, virtualService.Name, err)
+		return ""
+	}
+	return name
+}
+
+// sessionToken is the opaque value of the subset cookie of a cluster.
+func sessionToken(clusterName string) string {
+	h := fnv.New32a()
+	_, _ = h.Write([]byte(clusterName))
+	return fmt.Sprintf("%08x", h.Sum32())
+}
+
+// appendStatefulSessionRoutes appends the route to out. If the session cookie is set, the route issues
+// the session cookies and is preceded by a route pinned to each of its weighted destinations.
+func appendStatefulSessionRoutes(out []*route.Route, r *route.Route, cookie string) []*route.Route {
+	action := r.GetRoute()
+	if cookie == "" || action == nil {
+		return append(out, r)
+	}
+
+	action.HashPolicy = nil
+	// The upstream address is formatted as the address metadata of the endpoints.
+	r.ResponseHeadersToAdd = append(r.ResponseHeadersToAdd, &core.HeaderValueOption{
+		Header: &core.HeaderValue{
+			Key:   "set-cookie",
+			Value: cookie + "=%UPSTREAM_REMOTE_ADDRESS%; Path=/; HttpOnly",
+		},
+		Append: &wrappers.BoolValue{Value: true},
+	})
+
+	weighted := action.GetWeightedClusters()
+	if weighted == nil {
+		return append(out, r)
+	}
+	for _, cluster := range weighted.Clusters {
+		token := sessionToken(cluster.Name)
+
+		pinned := proto.Clone(r).(*route.Route)
+		pinned.Match.Headers = append(pinned.Match.Headers, &route.HeaderMatcher{
+			Name: "cookie",
+			HeaderMatchSpecifier: &route.HeaderMatcher_SafeRegexMatch{
+				SafeRegexMatch: &matcher.RegexMatcher{
+					EngineType: regexEngine,
+					Regex:      "(.*;\\s*)?" + regexp.QuoteMeta(cookie+statefulSessionSubsetSuffix+"="+token) + "(;.*)?",
+				},
+			},
+		})
+		pinned.GetRoute().ClusterSpecifier = &route.RouteAction_Cluster{Cluster: cluster.Name}
+		pinned.RequestHeadersToAdd = append(pinned.RequestHeadersToAdd, cluster.RequestHeadersToAdd...)
+		pinned.RequestHeadersToRemove = append(pinned.RequestHeadersToRemove, cluster.RequestHeadersToRemove...)
+		pinned.ResponseHeadersToAdd = append(pinned.ResponseHeadersToAdd, cluster.ResponseHeadersToAdd...)
+		pinned.ResponseHeadersToRemove = append(pinned.ResponseHeadersToRemove, cluster.ResponseHeadersToRemove...)
+		out = append(out, pinned)
+
+		cluster.ResponseHeadersToAdd = append(cluster.ResponseHeadersToAdd, &core.HeaderValueOption{
+			Header: &core.HeaderValue{
+				Key:   "set-cookie",
+				Value: cookie + statefulSessionSubsetSuffix + "=" + token + "; Path=/; HttpOnly",
+			},
+			Append: &wrappers.BoolValue{Value: true},
+		})
+	}
+	return append(out, r)
+}
@@ -0,0 +1,147 @@
+// Copyright 2020 Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package route_test
+
+import (
+	"regexp"
+	"strings"
+	"testing"
+
+	networking "istio.io/api/networking/v1alpha3"
+
+	"istio.io/istio/pilot/pkg/model"
+	"istio.io/istio/pilot/pkg/networking/core/v1alpha3/route"
+	"istio.io/istio/pkg/config/host"
+	"istio.io/istio/pkg/config/protocol"
+	"istio.io/istio/pkg/config/schema/collections"
+)
+
+func statefulSessionVirtualService(cookie string) model.Config {
+	return model.Config{
+		ConfigMeta: model.ConfigMeta{
+			Type:        collections.IstioNetworkingV1Alpha3Virtualservices.Resource().Kind(),
+			Version:     collections.IstioNetworkingV1Alpha3Virtualservices.Resource().Version(),
+			Name:        "reviews",
+			Namespace:   "default",
+			Annotations: map[string]string{route.StatefulSessionAnnotation: cookie},
+		},
+		Spec: &networking.VirtualService{
+			Hosts:    []string{"reviews.default.svc.cluster.local"},
+			Gateways: []string{"some-gateway"},
+			Http: []*networking.HTTPRoute{{
+				Route: []*networking.HTTPRouteDestination{
+					{
+						Destination: &networking.Destination{Host: "reviews.default.svc.cluster.local", Subset: "v1"},
+						Weight:      90,
+					},
+					{
+						Destination: &networking.Destination{Host: "reviews.default.svc.cluster.local", Subset: "v2"},
+						Weight:      10,
+					},
+				},
+			}},
+		},
+	}
+}
+
+func TestStatefulSessionRoutes(t *testing.T) {
+	serviceRegistry := map[host.Name]*model.Service{
+		"reviews.default.svc.cluster.local": {
+			Hostname: "reviews.default.svc.cluster.local",
+			Ports:    model.PortList{{Name: "http", Port: 9080, Protocol: protocol.HTTP}},
+		},
+	}
+	gateway := &model.Proxy{Type: model.Router, Metadata: &model.NodeMetadata{}}
+
+	routes, err := route.BuildHTTPRoutesForVirtualService(gateway, nil, statefulSessionVirtualService("session"),
+		serviceRegistry, 9080, map[string]bool{"some-gateway": true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(routes) != 3 {
+		t.Fatalf("expected a pinned route per subset and the weighted route, got %v", routes)
+	}
+
+	weighted := routes[2].GetRoute().GetWeightedClusters()
+	if weighted == nil || len(weighted.Clusters) != 2 {
+		t.Fatalf("expected the last route to be weighted, got %v", routes[2])
+	}
+	for i, cluster := range weighted.Clusters {
+		var setCookie string
+		for _, h := range cluster.ResponseHeadersToAdd {
+			if h.Header.Key == "set-cookie" {
+				setCookie = h.Header.Value
+			}
+		}
+		if !strings.HasPrefix(setCookie, "session-subset=") {
+			t.Fatalf("expected %s to set the subset cookie, got %v", cluster.Name, cluster.ResponseHeadersToAdd)
+		}
+		cookie := strings.Split(setCookie, ";")[0]
+
+		pinned := routes[i]
+		if got := pinned.GetRoute().GetCluster(); got != cluster.Name {
+			t.Errorf("expected route %d to be pinned to %s, got %s", i, cluster.Name, got)
+		}
+		headers := pinned.Match.Headers
+		if len(headers) != 1 || headers[0].Name != "cookie" {
+			t.Fatalf("expected route %d to match the cookie header, got %v", i, headers)
+		}
+		re := regexp.MustCompile("^" + headers[0].GetSafeRegexMatch().Regex + "$")
+		for _, header := range []string{cookie, "a=b; " + cookie, cookie + "; a=b", "a=b;" + cookie + ";c=d"} {
+			if !re.MatchString(header) {
+				t.Errorf("expected route %d to match cookie header %q", i, header)
+			}
+		}
+		for _, header := range []string{"", "a=b", "x" + cookie, cookie + "0"} {
+			if re.MatchString(header) {
+				t.Errorf("expected route %d not to match cookie header %q", i, header)
+			}
+		}
+	}
+
+	for _, r := range routes {
+		if hashPolicies := r.GetRoute().HashPolicy; len(hashPolicies) != 0 {
+			t.Errorf("expected the session cookie to replace the hash policies, got %v", hashPolicies)
+		}
+		found := false
+		for _, h := range r.ResponseHeadersToAdd {
+			if h.Header.Key == "set-cookie" && strings.HasPrefix(h.Header.Value, "session=%UPSTREAM_REMOTE_ADDRESS%;") {
+				found = true
+			}
+		}
+		if !found {
+			t.Errorf("expected the routes to set the endpoint cookie, got %v", r.ResponseHeadersToAdd)
+		}
+	}
+
+	// Sidecars and invalid cookie names do not get stateful sessions.
+	sidecar := &model.Proxy{Type: model.SidecarProxy, Metadata: &model.NodeMetadata{}}
+	routes, err = route.BuildHTTPRoutesForVirtualService(sidecar, nil, statefulSessionVirtualService("session"),
+		serviceRegistry, 9080, map[string]bool{"some-gateway": true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(routes) != 1 {
+		t.Errorf("expected no stateful session for sidecars, got %v", routes)
+	}
+	routes, err = route.BuildHTTPRoutesForVirtualService(gateway, nil, statefulSessionVirtualService("bad;name"),
+		serviceRegistry, 9080, map[string]bool{"some-gateway": true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(routes) != 1 {
+		t.Errorf("expected no stateful session for an invalid cookie name, got %v", routes)
+	}
+}
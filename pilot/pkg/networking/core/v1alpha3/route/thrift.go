@@ -0,0 +1,168 @@
+// Copyright 2020 Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package route
+
+import (
+	"sort"
+
+	route "github.com/envoyproxy/go-control-plane/envoy/api/v2/route"
+	thrift_proxy "github.com/envoyproxy/go-control-plane/envoy/config/filter/network/thrift_proxy/v2alpha1"
+	"github.com/golang/protobuf/ptypes/wrappers"
+
+	networking "istio.io/api/networking/v1alpha3"
+
+	"istio.io/istio/pilot/pkg/model"
+	"istio.io/istio/pkg/config/host"
+	"istio.io/istio/pkg/config/labels"
+	"istio.io/istio/pkg/config/validation"
+)
+
+// Thrift ports are routed with the HTTP routes of the virtual services, which are translated as:
+//
+// - an exact uri match is a method name match, a prefix uri match is a service name match for
+//   multiplexed Thrift services. Header matches apply to the Thrift headers.
+// - destinations are routed with weighted clusters, so that subsets can be canaried.
+//
+// Retries, timeouts, faults, mirroring and header manipulation are not supported by the Thrift proxy, see
+// ThriftIgnoredFields.
+// The matches the Thrift proxy cannot express are skipped. Validation rejects them on the ports listed by the
+// networking.istio.io/thriftPorts annotation of the virtual service.
+
+// BuildThriftRoutesForVirtualService translates the HTTP routes of a virtual service to Thrift routes for the
+// given port. The rate limits are attached to each route action.
+func BuildThriftRoutesForVirtualService(
+	node *model.Proxy,
+	push *model.PushContext,
+	virtualService model.Config,
+	listenPort int,
+	gatewayNames map[string]bool,
+	rateLimits []*route.RateLimit) []*thrift_proxy.Route {
+
+	vs, ok := virtualService.Spec.(*networking.VirtualService)
+	if !ok { // should never happen
+		return nil
+	}
+
+	out := make([]*thrift_proxy.Route, 0, len(vs.Http))
+	for _, http := range vs.Http {
+		if len(http.Route) == 0 {
+			continue
+		}
+		if len(http.Match) == 0 {
+			out = append(out, translateThriftRoute(node, push, http, nil, listenPort, rateLimits))
+			// We have a rule with catch all match. Other rules are of no use.
+			break
+		}
+		for _, match := range http.Match {
+			// Match by source labels/gateway names and by the destination port specified in the match condition
+			if !sourceMatchHTTP(match, labels.Collection{node.Metadata.Labels}, gatewayNames, node.Metadata.Namespace) {
+				continue
+			}
+			if match != nil && match.Port != 0 && match.Port != uint32(listenPort) {
+				continue
+			}
+			if !IsThriftMatch(match) {
+				continue
+			}
+			out = append(out, translateThriftRoute(node, push, http, match, listenPort, rateLimits))
+		}
+	}
+	return out
+}
+
+var thriftRoute = protocolRoute{isMatch: IsThriftMatch}
+
+// ThriftIgnoredFields returns the fields of an HTTP route that are ignored when the route is applied to a
+// Thrift port, including the matches that are skipped.
+func ThriftIgnoredFields(http *networking.HTTPRoute) []string {
+	return thriftRoute.ignoredFields(http)
+}
+
+// IsThriftMatch checks if an HTTP match can be translated to a Thrift route match, see
+// validation.ValidateThriftMatch.
+func IsThriftMatch(match *networking.HTTPMatchRequest) bool {
+	return match == nil || validation.ValidateThriftMatch(match) == nil
+}
+
+// translateThriftRoute translates an HTTP route with the given match to a Thrift route.
+func translateThriftRoute(node *model.Proxy, push *model.PushContext, in *networking.HTTPRoute,
+	match *networking.HTTPMatchRequest, port int, rateLimits []*route.RateLimit) *thrift_proxy.Route {
+	action := &thrift_proxy.RouteAction{
+		RateLimits: rateLimits,
+	}
+
+	if len(in.Route) == 1 {
+		action.ClusterSpecifier = &thrift_proxy.RouteAction_Cluster{
+			Cluster: serviceDestinationCluster(node, push, in.Route[0].Destination, port),
+		}
+	} else {
+		weighted := make([]*thrift_proxy.WeightedCluster_ClusterWeight, 0, len(in.Route))
+		for _, dst := range in.Route {
+			if dst.Weight == 0 {
+				continue
+			}
+			weighted = append(weighted, &thrift_proxy.WeightedCluster_ClusterWeight{
+				Name:   serviceDestinationCluster(node, push, dst.Destination, port),
+				Weight: &wrappers.UInt32Value{Value: uint32(dst.Weight)},
+			})
+		}
+		action.ClusterSpecifier = &thrift_proxy.RouteAction_WeightedClusters{
+			WeightedClusters: &thrift_proxy.WeightedCluster{Clusters: weighted},
+		}
+	}
+
+	return &thrift_proxy.Route{
+		Match: translateThriftRouteMatch(match),
+		Route: action,
+	}
+}
+
+// translateThriftRouteMatch translates an HTTP match to a Thrift route match. An empty method name matches
+// all the requests.
+func translateThriftRouteMatch(in *networking.HTTPMatchRequest) *thrift_proxy.RouteMatch {
+	out := &thrift_proxy.RouteMatch{MatchSpecifier: &thrift_proxy.RouteMatch_MethodName{MethodName: ""}}
+	if in == nil {
+		return out
+	}
+
+	switch m := in.Uri.GetMatchType().(type) {
+	case *networking.StringMatch_Exact:
+		out.MatchSpecifier = &thrift_proxy.RouteMatch_MethodName{MethodName: m.Exact}
+	case *networking.StringMatch_Prefix:
+		out.MatchSpecifier = &thrift_proxy.RouteMatch_ServiceName{ServiceName: m.Prefix}
+	}
+
+	for name, stringMatch := range in.Headers {
+		matcher := translateHeaderMatch(name, stringMatch)
+		out.Headers = append(out.Headers, &matcher)
+	}
+	for name, stringMatch := range in.WithoutHeaders {
+		matcher := translateHeaderMatch(name, stringMatch)
+		matcher.InvertMatch = true
+		out.Headers = append(out.Headers, &matcher)
+	}
+	// guarantee ordering of headers
+	sort.Slice(out.Headers, func(i, j int) bool {
+		return out.Headers[i].Name < out.Headers[j].Name
+	})
+
+	return out
+}
+
+// serviceDestinationCluster returns the cluster of a destination, resolving its service in the proxy scope.
+func serviceDestinationCluster(node *model.Proxy, push *model.PushContext, destination *networking.Destination, port int) string {
+	service := node.SidecarScope.ServiceForHostname(host.Name(destination.Host), push.ServiceByHostnameAndNamespace)
+	return GetDestinationCluster(destination, service, port)
+}
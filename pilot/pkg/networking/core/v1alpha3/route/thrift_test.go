@@ -0,0 +1,160 @@
+// Copyright 2020 Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package route_test
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/gogo/protobuf/types"
+	"github.com/onsi/gomega"
+
+	networking "istio.io/api/networking/v1alpha3"
+
+	"istio.io/istio/pilot/pkg/model"
+	"istio.io/istio/pilot/pkg/networking/core/v1alpha3/route"
+	"istio.io/istio/pkg/config/mesh"
+	"istio.io/istio/pkg/config/schema/collections"
+)
+
+var virtualServiceThrift = model.Config{
+	ConfigMeta: model.ConfigMeta{
+		Type:      collections.IstioNetworkingV1Alpha3Virtualservices.Resource().Kind(),
+		Version:   collections.IstioNetworkingV1Alpha3Virtualservices.Resource().Version(),
+		Name:      "thrift",
+		Namespace: "default",
+	},
+	Spec: &networking.VirtualService{
+		Hosts: []string{"thrift.default.svc.cluster.local"},
+		Http: []*networking.HTTPRoute{
+			{
+				Name: "timeout",
+				Match: []*networking.HTTPMatchRequest{{
+					Uri: &networking.StringMatch{MatchType: &networking.StringMatch_Exact{Exact: "slow"}},
+				}},
+				Timeout: &types.Duration{Seconds: 1},
+				Route: []*networking.HTTPRouteDestination{{
+					Destination: &networking.Destination{Host: "thrift.default.svc.cluster.local"},
+				}},
+			},
+			{
+				Name: "canary",
+				Match: []*networking.HTTPMatchRequest{
+					{
+						Uri: &networking.StringMatch{MatchType: &networking.StringMatch_Exact{Exact: "getUser"}},
+						Headers: map[string]*networking.StringMatch{
+							"x-canary": {MatchType: &networking.StringMatch_Exact{Exact: "true"}},
+						},
+					},
+					{
+						Uri:  &networking.StringMatch{MatchType: &networking.StringMatch_Prefix{Prefix: "UserService"}},
+						Port: 9091,
+					},
+				},
+				Route: []*networking.HTTPRouteDestination{
+					{
+						Destination: &networking.Destination{Host: "thrift.default.svc.cluster.local", Subset: "v1"},
+						Weight:      90,
+					},
+					{
+						Destination: &networking.Destination{Host: "thrift.default.svc.cluster.local", Subset: "v2"},
+						Weight:      10,
+					},
+				},
+			},
+			{
+				Name: "regex",
+				Match: []*networking.HTTPMatchRequest{{
+					Uri: &networking.StringMatch{MatchType: &networking.StringMatch_Regex{Regex: "get.*"}},
+				}},
+				Route: []*networking.HTTPRouteDestination{{
+					Destination: &networking.Destination{Host: "thrift.default.svc.cluster.local", Subset: "v2"},
+				}},
+			},
+			{
+				Name: "default",
+				Route: []*networking.HTTPRouteDestination{{
+					Destination: &networking.Destination{Host: "thrift.default.svc.cluster.local", Subset: "v1"},
+				}},
+			},
+		},
+	},
+}
+
+func TestBuildThriftRoutesForVirtualService(t *testing.T) {
+	g := gomega.NewGomegaWithT(t)
+
+	m := mesh.DefaultMeshConfig()
+	push := model.NewPushContext()
+	push.Mesh = &m
+	node := &model.Proxy{
+		Type:        model.SidecarProxy,
+		IPAddresses: []string{"1.1.1.1"},
+		ID:          "someID",
+		DNSDomain:   "default.svc.cluster.local",
+		Metadata:    &model.NodeMetadata{},
+	}
+	node.SidecarScope = model.DefaultSidecarScopeForNamespace(push, "default")
+
+	routes := route.BuildThriftRoutesForVirtualService(node, push, virtualServiceThrift, 9090,
+		map[string]bool{"mesh": true}, nil)
+	for _, r := range routes {
+		if err := r.Validate(); err != nil {
+			t.Fatalf("Route %v validation failed with error %v", r, err)
+		}
+	}
+
+	// The timeout is ignored, the regex match is skipped, and the service name match is for another port.
+	g.Expect(len(routes)).To(gomega.Equal(3))
+
+	g.Expect(routes[0].Match.GetMethodName()).To(gomega.Equal("slow"))
+	g.Expect(routes[0].Route.GetCluster()).To(gomega.Equal("outbound|9090||thrift.default.svc.cluster.local"))
+
+	g.Expect(routes[1].Match.GetMethodName()).To(gomega.Equal("getUser"))
+	g.Expect(len(routes[1].Match.Headers)).To(gomega.Equal(1))
+	g.Expect(routes[1].Match.Headers[0].Name).To(gomega.Equal("x-canary"))
+	clusters := routes[1].Route.GetWeightedClusters().GetClusters()
+	g.Expect(len(clusters)).To(gomega.Equal(2))
+	g.Expect(clusters[0].Name).To(gomega.Equal("outbound|9090|v1|thrift.default.svc.cluster.local"))
+	g.Expect(clusters[0].Weight.Value).To(gomega.Equal(uint32(90)))
+	g.Expect(clusters[1].Name).To(gomega.Equal("outbound|9090|v2|thrift.default.svc.cluster.local"))
+	g.Expect(clusters[1].Weight.Value).To(gomega.Equal(uint32(10)))
+
+	g.Expect(routes[2].Match.GetMethodName()).To(gomega.Equal(""))
+	g.Expect(routes[2].Route.GetCluster()).To(gomega.Equal("outbound|9090|v1|thrift.default.svc.cluster.local"))
+
+	routes = route.BuildThriftRoutesForVirtualService(node, push, virtualServiceThrift, 9091,
+		map[string]bool{"mesh": true}, nil)
+	g.Expect(len(routes)).To(gomega.Equal(4))
+	g.Expect(routes[2].Match.GetServiceName()).To(gomega.Equal("UserService"))
+}
+
+func TestThriftIgnoredFields(t *testing.T) {
+	spec := virtualServiceThrift.Spec.(*networking.VirtualService)
+	cases := []struct {
+		route *networking.HTTPRoute
+		want  []string
+	}{
+		{spec.Http[0], []string{"timeout"}},
+		{spec.Http[1], nil},
+		{spec.Http[2], []string{"match[0]"}},
+		{&networking.HTTPRoute{Redirect: &networking.HTTPRedirect{Uri: "/"}}, []string{"route"}},
+	}
+	for _, tc := range cases {
+		if got := route.ThriftIgnoredFields(tc.route); !reflect.DeepEqual(got, tc.want) {
+			t.Errorf("ThriftIgnoredFields(%v): got %v, want %v", tc.route, got, tc.want)
+		}
+	}
+}
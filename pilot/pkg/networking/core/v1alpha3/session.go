@@ -0,0 +1,153 @@
+// Copyright 2020 Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package v1alpha3
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	apiv2 "github.com/envoyproxy/go-control-plane/envoy/api/v2"
+	lua "github.com/envoyproxy/go-control-plane/envoy/config/filter/http/lua/v2"
+	http_conn "github.com/envoyproxy/go-control-plane/envoy/config/filter/network/http_connection_manager/v2"
+	"github.com/envoyproxy/go-control-plane/pkg/wellknown"
+
+	networking "istio.io/api/networking/v1alpha3"
+
+	"istio.io/istio/pilot/pkg/model"
+	istio_route "istio.io/istio/pilot/pkg/networking/core/v1alpha3/route"
+	"istio.io/istio/pilot/pkg/networking/util"
+	"istio.io/istio/pkg/config/host"
+)
+
+// Stateful sessions pin the endpoint with the endpoint cookie, see istio_route.StatefulSessionCookie. Gateways
+// copy the endpoint cookie to the util.EnvoyLbMetadataKey request metadata, and the destinations of the virtual
+// services with stateful sessions select their endpoints with the subset load balancer: the subset of the
+// endpoint with the address of the cookie, or any endpoint if it is no longer a healthy endpoint of the cluster.
+
+// statefulSessionVirtualServices returns the virtual services of a gateway with stateful sessions, by session
+// cookie, or nil for other proxies.
+func statefulSessionVirtualServices(proxy *model.Proxy, push *model.PushContext) map[string][]*networking.VirtualService {
+	if proxy.Type != model.Router || proxy.MergedGateway == nil {
+		return nil
+	}
+	gateways := map[string]bool{}
+	for _, gw := range proxy.MergedGateway.GatewayNameForServer {
+		gateways[gw] = true
+	}
+
+	var out map[string][]*networking.VirtualService
+	for _, cfg := range push.VirtualServices(proxy, gateways) {
+		cookie := istio_route.StatefulSessionCookie(proxy, cfg)
+		if cookie == "" {
+			continue
+		}
+		vs, ok := cfg.Spec.(*networking.VirtualService)
+		if !ok { // should never happen
+			continue
+		}
+		if out == nil {
+			out = map[string][]*networking.VirtualService{}
+		}
+		out[cookie] = append(out[cookie], vs)
+	}
+	return out
+}
+
+// statefulSessionHosts returns the destination hosts of the virtual services of a gateway with stateful
+// sessions, or nil for other proxies.
+func statefulSessionHosts(proxy *model.Proxy, push *model.PushContext) map[host.Name]bool {
+	var out map[host.Name]bool
+	for _, virtualServices := range statefulSessionVirtualServices(proxy, push) {
+		for _, vs := range virtualServices {
+			for _, http := range vs.Http {
+				for _, dst := range http.Route {
+					if out == nil {
+						out = map[host.Name]bool{}
+					}
+					out[host.Name(dst.Destination.GetHost())] = true
+				}
+			}
+		}
+	}
+	return out
+}
+
+// statefulSessionCookies returns the sorted session cookies of the virtual services of a gateway.
+func statefulSessionCookies(proxy *model.Proxy, push *model.PushContext) []string {
+	var out []string
+	for cookie := range statefulSessionVirtualServices(proxy, push) {
+		out = append(out, cookie)
+	}
+	sort.Strings(out)
+	return out
+}
+
+// applyStatefulSessionSubsets makes the EDS clusters select the endpoint of the stateful sessions by address,
+// with the load balancer of the cluster. Clusters with a cluster provided load balancer are unchanged.
+func applyStatefulSessionSubsets(clusters []*apiv2.Cluster) {
+	for _, c := range clusters {
+		if c.GetType() != apiv2.Cluster_EDS || c.LbPolicy == apiv2.Cluster_CLUSTER_PROVIDED {
+			continue
+		}
+		c.LbSubsetConfig = &apiv2.Cluster_LbSubsetConfig{
+			FallbackPolicy: apiv2.Cluster_LbSubsetConfig_ANY_ENDPOINT,
+			SubsetSelectors: []*apiv2.Cluster_LbSubsetConfig_LbSubsetSelector{{
+				Keys: []string{util.StatefulSessionEndpointKey},
+			}},
+		}
+	}
+}
+
+// buildStatefulSessionFilter builds the gateway filter copying the endpoint cookie of a request, the first of the
+// cookies in name order, to the request metadata matched by the subset load balancer. It is nil without cookie.
+func buildStatefulSessionFilter(cookies []string) *http_conn.HttpFilter {
+	if len(cookies) == 0 {
+		return nil
+	}
+	// The cookie names are tokens, which need no escaping in Lua strings.
+	names := make([]string, 0, len(cookies))
+	for _, cookie := range cookies {
+		names = append(names, `"`+cookie+`"`)
+	}
+	code := fmt.Sprintf(`local cookies = {%s}
+
+function envoy_on_request(request_handle)
+  local header = request_handle:headers():get("cookie")
+  if header == nil then
+    return
+  end
+  local values = {}
+  for name, value in string.gmatch(header, "([^=;%%s]+)=([^;]*)") do
+    if values[name] == nil then
+      values[name] = string.match(value, "^%%s*(.-)%%s*$")
+    end
+  end
+  for _, name in ipairs(cookies) do
+    if values[name] ~= nil and values[name] ~= "" then
+      request_handle:streamInfo():dynamicMetadata():set("%s", "%s", values[name])
+      return
+    end
+  end
+end
+`, strings.Join(names, ", "), util.EnvoyLbMetadataKey, util.StatefulSessionEndpointKey)
+
+	return &http_conn.HttpFilter{
+		Name: wellknown.Lua,
+		ConfigType: &http_conn.HttpFilter_TypedConfig{
+			TypedConfig: util.MessageToAny(&lua.Lua{InlineCode: code}),
+		},
+	}
+}
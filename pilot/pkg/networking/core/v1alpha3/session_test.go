@@ -0,0 +1,145 @@
+// Copyright 2020 Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package v1alpha3
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	apiv2 "github.com/envoyproxy/go-control-plane/envoy/api/v2"
+	lua "github.com/envoyproxy/go-control-plane/envoy/config/filter/http/lua/v2"
+	"github.com/envoyproxy/go-control-plane/pkg/wellknown"
+	"github.com/golang/protobuf/ptypes"
+
+	networking "istio.io/api/networking/v1alpha3"
+
+	"istio.io/istio/pilot/pkg/model"
+	istio_route "istio.io/istio/pilot/pkg/networking/core/v1alpha3/route"
+	"istio.io/istio/pilot/pkg/networking/util"
+	"istio.io/istio/pkg/config/host"
+	"istio.io/istio/pkg/config/schema/collections"
+)
+
+func TestStatefulSessionSubsets(t *testing.T) {
+	gateway := model.Config{
+		ConfigMeta: model.ConfigMeta{
+			Type:      collections.IstioNetworkingV1Alpha3Gateways.Resource().Kind(),
+			Name:      "gateway",
+			Namespace: "default",
+		},
+		Spec: &networking.Gateway{
+			Selector: map[string]string{"istio": "ingressgateway"},
+			Servers: []*networking.Server{{
+				Hosts: []string{"*"},
+				Port:  &networking.Port{Name: "http", Number: 80, Protocol: "HTTP"},
+			}},
+		},
+	}
+	virtualService := func(name, cookie, destination string) model.Config {
+		cfg := model.Config{
+			ConfigMeta: model.ConfigMeta{
+				Type:      collections.IstioNetworkingV1Alpha3Virtualservices.Resource().Kind(),
+				Name:      name,
+				Namespace: "default",
+			},
+			Spec: &networking.VirtualService{
+				Hosts:    []string{name + ".example.com"},
+				Gateways: []string{"gateway"},
+				Http: []*networking.HTTPRoute{{
+					Route: []*networking.HTTPRouteDestination{{
+						Destination: &networking.Destination{Host: destination},
+					}},
+				}},
+			},
+		}
+		if cookie != "" {
+			cfg.Annotations = map[string]string{istio_route.StatefulSessionAnnotation: cookie}
+		}
+		return cfg
+	}
+
+	env := buildEnv(t, []model.Config{gateway}, []model.Config{
+		virtualService("shop", "session", "shop.default.svc.cluster.local"),
+		virtualService("docs", "", "docs.default.svc.cluster.local"),
+		virtualService("invalid", "not a cookie", "invalid.default.svc.cluster.local"),
+	})
+	gatewayProxy := proxyGateway
+	gatewayProxy.SetGatewaysForProxy(env.PushContext)
+
+	want := map[host.Name]bool{"shop.default.svc.cluster.local": true}
+	if got := statefulSessionHosts(&gatewayProxy, env.PushContext); !reflect.DeepEqual(got, want) {
+		t.Errorf("expected the stateful session hosts %v, got %v", want, got)
+	}
+	if got := statefulSessionHosts(&proxy, env.PushContext); got != nil {
+		t.Errorf("expected no stateful session hosts for sidecars, got %v", got)
+	}
+
+	if got, want := statefulSessionCookies(&gatewayProxy, env.PushContext), []string{"session"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("expected the stateful session cookies %v, got %v", want, got)
+	}
+	if got := statefulSessionCookies(&proxy, env.PushContext); got != nil {
+		t.Errorf("expected no stateful session cookies for sidecars, got %v", got)
+	}
+
+	eds := &apiv2.Cluster_Type{Type: apiv2.Cluster_EDS}
+	clusters := []*apiv2.Cluster{
+		{Name: "round-robin", ClusterDiscoveryType: eds, LbPolicy: apiv2.Cluster_ROUND_ROBIN},
+		{Name: "ring-hash", ClusterDiscoveryType: eds, LbPolicy: apiv2.Cluster_RING_HASH},
+		{Name: "redis-cluster", ClusterDiscoveryType: eds, LbPolicy: apiv2.Cluster_CLUSTER_PROVIDED},
+		{Name: "dns", ClusterDiscoveryType: &apiv2.Cluster_Type{Type: apiv2.Cluster_STRICT_DNS}},
+	}
+	applyStatefulSessionSubsets(clusters)
+	for i, want := range []bool{true, true, false, false} {
+		subsets := clusters[i].LbSubsetConfig
+		if !want {
+			if subsets != nil {
+				t.Errorf("expected no subset load balancer for %s, got %v", clusters[i].Name, subsets)
+			}
+			continue
+		}
+		if subsets.GetFallbackPolicy() != apiv2.Cluster_LbSubsetConfig_ANY_ENDPOINT ||
+			len(subsets.GetSubsetSelectors()) != 1 ||
+			!reflect.DeepEqual(subsets.GetSubsetSelectors()[0].Keys, []string{util.StatefulSessionEndpointKey}) {
+			t.Errorf("expected %s to select the endpoint by address, or any endpoint, got %v", clusters[i].Name, subsets)
+		}
+	}
+	if clusters[1].LbPolicy != apiv2.Cluster_RING_HASH {
+		t.Errorf("expected the load balancer of the cluster to be kept, got %v", clusters[1].LbPolicy)
+	}
+}
+
+func TestStatefulSessionFilter(t *testing.T) {
+	if f := buildStatefulSessionFilter(nil); f != nil {
+		t.Errorf("expected no filter without session cookie, got %v", f)
+	}
+
+	f := buildStatefulSessionFilter([]string{"cart", "session"})
+	if f.Name != wellknown.Lua {
+		t.Fatalf("expected a Lua filter, got %s", f.Name)
+	}
+	config := &lua.Lua{}
+	if err := ptypes.UnmarshalAny(f.GetTypedConfig(), config); err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{
+		`local cookies = {"cart", "session"}`,
+		`dynamicMetadata():set("envoy.lb", "istio-session-endpoint", values[name])`,
+	} {
+		if !strings.Contains(config.InlineCode, want) {
+			t.Errorf("expected the Lua code to contain %q, got:\n%s", want, config.InlineCode)
+		}
+	}
+}
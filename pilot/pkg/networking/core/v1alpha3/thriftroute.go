@@ -24,6 +24,8 @@ import (
 	thrift_proxy "github.com/envoyproxy/go-control-plane/envoy/config/filter/network/thrift_proxy/v2alpha1"
 
 	"istio.io/istio/pilot/pkg/model"
+	istio_route "istio.io/istio/pilot/pkg/networking/core/v1alpha3/route"
+	"istio.io/istio/pkg/config/constants"
 	"istio.io/istio/pkg/config/host"
 	"istio.io/pkg/log"
 )
@@ -65,11 +67,81 @@ func buildDefaultThriftRoute(clusterName, rateLimitClusterName string) *thrift_p
 	}
 }
 
-// Builds the route config with a single blank method route on the inbound path.
-// We route inbound and outbound identically.
+// buildThriftVirtualServiceRateLimits builds the rate limits of the routes generated from virtual services.
+// In addition to the source cluster descriptor of the default route, a descriptor with the destination
+// cluster and the method name allows to limit the requests per subset and method.
+func buildThriftVirtualServiceRateLimits(rateLimitClusterName string) []*route.RateLimit {
+	if rateLimitClusterName == "" {
+		return nil
+	}
+	return []*route.RateLimit{
+		{
+			Actions: []*route.RateLimit_Action{
+				{
+					ActionSpecifier: &route.RateLimit_Action_SourceCluster_{
+						SourceCluster: &route.RateLimit_Action_SourceCluster{},
+					},
+				},
+			},
+		},
+		{
+			Actions: []*route.RateLimit_Action{
+				{
+					ActionSpecifier: &route.RateLimit_Action_SourceCluster_{
+						SourceCluster: &route.RateLimit_Action_SourceCluster{},
+					},
+				},
+				{
+					ActionSpecifier: &route.RateLimit_Action_DestinationCluster_{
+						DestinationCluster: &route.RateLimit_Action_DestinationCluster{},
+					},
+				},
+				{
+					ActionSpecifier: &route.RateLimit_Action_RequestHeaders_{
+						RequestHeaders: &route.RateLimit_Action_RequestHeaders{
+							HeaderName:    ":method-name",
+							DescriptorKey: "method_name",
+						},
+					},
+				},
+			},
+		},
+	}
+}
+
+// Builds the route config of an outbound Thrift port from the HTTP routes of the virtual services
+// of the service. The default route is used when no virtual service route applies to Thrift.
+func (configgen *ConfigGeneratorImpl) buildSidecarOutboundThriftRouteConfig(node *model.Proxy, push *model.PushContext,
+	service *model.Service, port int, virtualServices []model.Config) *thrift_proxy.RouteConfiguration {
+	clusterName := model.BuildSubsetKey(model.TrafficDirectionOutbound, "", service.Hostname, port)
+	rateLimitURL := push.Mesh.ThriftConfig.GetRateLimitUrl()
+
+	rlsClusterName, err := rlsClusterNameFromAuthority(rateLimitURL)
+	if err != nil {
+		rlsClusterName = ""
+	}
+
+	meshGateway := map[string]bool{constants.IstioMeshGateway: true}
+	rateLimits := buildThriftVirtualServiceRateLimits(rlsClusterName)
+	routes := make([]*thrift_proxy.Route, 0)
+	for _, vs := range getConfigsForHost(service.Hostname, virtualServices) {
+		routes = append(routes, istio_route.BuildThriftRoutesForVirtualService(node, push, vs, port, meshGateway, rateLimits)...)
+	}
+	if len(routes) == 0 {
+		return configgen.buildSidecarThriftRouteConfig(clusterName, rateLimitURL)
+	}
+
+	return &thrift_proxy.RouteConfiguration{
+		Name:   clusterName,
+		Routes: routes,
+	}
+}
+
+// Builds the route config with a single blank method route, used on the inbound path
+// and on the outbound path when no virtual service applies.
 func (configgen *ConfigGeneratorImpl) buildSidecarThriftRouteConfig(clusterName, rateLimitURL string) *thrift_proxy.RouteConfiguration {
 
-	rlsClusterName, err := thriftRLSClusterNameFromAuthority(rateLimitURL)
+	rlsClusterName, err := rlsClusterNameFromAuthority(rateLimitURL)
 	if err != nil {
 		rlsClusterName = ""
 	}
@@ -86,7 +158,7 @@ func (configgen *ConfigGeneratorImpl) buildSidecarThriftRouteConfig(clusterName,
 
 // Build a cluster name from an authority (host[:port]) string. If an error is
 // encountered, an empty string is returned as the cluster name.
-func thriftRLSClusterNameFromAuthority(authority string) (string, error) {
+func rlsClusterNameFromAuthority(authority string) (string, error) {
 	rlsPort := 8081
 
 	if authority == "" {
@@ -17,11 +17,11 @@ package v1alpha3
 import "testing"
 
 func TestGetClusterNameFromURL(t *testing.T) {
-	cluster, err := thriftRLSClusterNameFromAuthority("")
+	cluster, err := rlsClusterNameFromAuthority("")
 	if err == nil || cluster != "" {
 		t.Fatalf("should error and return empty url (got %v)", cluster)
 	}
-	cluster, err = thriftRLSClusterNameFromAuthority("host.com:80")
+	cluster, err = rlsClusterNameFromAuthority("host.com:80")
 	if err != nil {
 		t.Fatal("host without port should not cause error")
 	}
@@ -29,3 +29,16 @@ func TestGetClusterNameFromURL(t *testing.T) {
 		t.Fatalf("Should return correct cluster name (got %v)", cluster)
 	}
 }
+
+func TestBuildThriftVirtualServiceRateLimits(t *testing.T) {
+	if rateLimits := buildThriftVirtualServiceRateLimits(""); rateLimits != nil {
+		t.Fatalf("should not build rate limits without rate limit service (got %v)", rateLimits)
+	}
+	rateLimits := buildThriftVirtualServiceRateLimits("outbound|80||host.com")
+	if len(rateLimits) != 2 {
+		t.Fatalf("should build source cluster and destination rate limits (got %v)", rateLimits)
+	}
+	if header := rateLimits[1].Actions[2].GetRequestHeaders(); header.GetHeaderName() != ":method-name" {
+		t.Fatalf("should rate limit by method name (got %v)", rateLimits[1].Actions)
+	}
+}
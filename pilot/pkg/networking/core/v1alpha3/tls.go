@@ -21,10 +21,12 @@ import (
 
 	"istio.io/api/networking/v1alpha3"
 
+	"istio.io/istio/pilot/pkg/features"
 	"istio.io/istio/pilot/pkg/model"
 	"istio.io/istio/pilot/pkg/networking/util"
 	"istio.io/istio/pkg/config/host"
 	"istio.io/istio/pkg/config/labels"
+	"istio.io/istio/pkg/config/protocol"
 
 	"istio.io/pkg/log"
 )
@@ -211,6 +213,12 @@ func buildSidecarOutboundTCPFilterChainOpts(node *model.Proxy, push *model.PushC
 		return nil
 	}
 
+	if features.EnableRedisFilter && listenPort.Protocol == protocol.Redis {
+		out := buildSidecarOutboundRedisFilterChainOpts(node, push, destinationCIDR, service, listenPort, gateways, configs)
+		applyConnectionRateLimit(out, node, push, service)
+		return out
+	}
+
 	out := make([]*filterChainOpts, 0)
 
 	// very basic TCP
@@ -303,6 +311,11 @@ TcpLoop:
 		})
 	}
 
+	if listenPort.Protocol == protocol.Mongo {
+		applyMongoFaultDelay(out, buildMongoFaultDelay(node, listenPort, gateways, configs))
+	}
+	applyConnectionRateLimit(out, node, push, service)
+
 	return out
 }
 
@@ -0,0 +1,173 @@
+// Copyright 2020 Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package v1alpha3
+
+import (
+	"fmt"
+	"strings"
+
+	xdsapi "github.com/envoyproxy/go-control-plane/envoy/api/v2"
+	core "github.com/envoyproxy/go-control-plane/envoy/api/v2/core"
+	listener "github.com/envoyproxy/go-control-plane/envoy/api/v2/listener"
+	udp_proxy "github.com/envoyproxy/go-control-plane/envoy/config/filter/udp/udp_proxy/v2alpha"
+
+	networking "istio.io/api/networking/v1alpha3"
+
+	"istio.io/istio/pilot/pkg/model"
+	"istio.io/istio/pilot/pkg/networking/util"
+	"istio.io/istio/pkg/config/host"
+	"istio.io/istio/pkg/config/protocol"
+	"istio.io/pkg/log"
+)
+
+// UDP services are supported with Envoy's udp_proxy listener filter, which forwards all the
+// datagrams received by a listener to a single cluster:
+//
+// - each UDP service port has an outbound cluster, named with model.BuildUDPSubsetKey so it does not
+//   collide with a TCP port of the same number. Destination rules and mTLS are not applied.
+// - sidecars get a listener on localhost for each UDP service port. istio-iptables redirects the
+//   outbound UDP traffic of the configured ports to it, which loses the original destination: the
+//   ports shared by several services have no listener, as the datagrams could not be routed to the
+//   right service, and are reported with the pilot_conflict_outbound_listener_udp metric. They must
+//   not be captured.
+// - gateways get a listener for each UDP server, forwarding to the first destination of the matching
+//   TCP route of a VirtualService bound to the gateway. The other destinations and the subsets are
+//   ignored, which the virtualservice.UDPRouteAnalyzer reports.
+
+// UDPProxyListenerFilterName is the name of the Envoy UDP proxy listener filter.
+const UDPProxyListenerFilterName = "envoy.filters.udp_listener.udp_proxy"
+
+// buildUDPCluster builds the outbound cluster of a UDP service port.
+func (cb *ClusterBuilder) buildUDPCluster(service *model.Service, port *model.Port,
+	networkView map[string]bool) *xdsapi.Cluster {
+	lbEndpoints := buildLocalityLbEndpoints(cb.proxy, cb.push, networkView, service, port.Port, nil)
+	clusterName := model.BuildUDPSubsetKey(model.TrafficDirectionOutbound, "", service.Hostname, port.Port)
+	cluster := cb.buildDefaultCluster(clusterName, convertResolution(cb.proxy, service), lbEndpoints,
+		model.TrafficDirectionOutbound, port, service.MeshExternal)
+	if cluster == nil {
+		return nil
+	}
+	// Istio mTLS, including auto mTLS, does not apply to UDP.
+	cluster.TransportSocket = nil
+	cluster.TransportSocketMatches = nil
+	cluster.TlsContext = nil // nolint: staticcheck
+	return cluster
+}
+
+// buildUDPListener builds a listener forwarding the UDP datagrams received on the address to the cluster.
+func buildUDPListener(bind string, port int, clusterName string) *xdsapi.Listener {
+	udpProxy := &udp_proxy.UdpProxyConfig{
+		StatPrefix:     clusterName,
+		RouteSpecifier: &udp_proxy.UdpProxyConfig_Cluster{Cluster: clusterName},
+	}
+	return &xdsapi.Listener{
+		Name: fmt.Sprintf("%s_%d/udp", bind, port),
+		Address: &core.Address{
+			Address: &core.Address_SocketAddress{
+				SocketAddress: &core.SocketAddress{
+					Protocol:      core.SocketAddress_UDP,
+					Address:       bind,
+					PortSpecifier: &core.SocketAddress_PortValue{PortValue: uint32(port)},
+				},
+			},
+		},
+		ListenerFilters: []*listener.ListenerFilter{{
+			Name:       UDPProxyListenerFilterName,
+			ConfigType: &listener.ListenerFilter_TypedConfig{TypedConfig: util.MessageToAny(udpProxy)},
+		}},
+		TrafficDirection: core.TrafficDirection_OUTBOUND,
+	}
+}
+
+// buildSidecarOutboundUDPListeners builds the localhost listeners of the UDP service ports visible
+// to the sidecar. Ports the workload itself serves over UDP are skipped, as the listener would
+// conflict with the application, and so are the ports shared by several services.
+func buildSidecarOutboundUDPListeners(node *model.Proxy, push *model.PushContext) []*xdsapi.Listener {
+	served := map[uint32]struct{}{}
+	for _, si := range node.ServiceInstances {
+		if si.ServicePort.Protocol == protocol.UDP {
+			served[si.Endpoint.EndpointPort] = struct{}{}
+		}
+	}
+
+	var ports []int
+	servicesByPort := map[int][]*model.Service{}
+	for _, service := range push.Services(node) {
+		for _, port := range service.Ports {
+			if port.Protocol != protocol.UDP {
+				continue
+			}
+			if _, f := served[uint32(port.Port)]; f {
+				continue
+			}
+			if _, f := servicesByPort[port.Port]; !f {
+				ports = append(ports, port.Port)
+			}
+			servicesByPort[port.Port] = append(servicesByPort[port.Port], service)
+		}
+	}
+
+	_, localhost := getActualWildcardAndLocalHost(node)
+	listeners := make([]*xdsapi.Listener, 0, len(ports))
+	for _, port := range ports {
+		services := servicesByPort[port]
+		if len(services) > 1 {
+			hostnames := make([]string, 0, len(services))
+			for _, service := range services {
+				hostnames = append(hostnames, string(service.Hostname))
+			}
+			log.Warnf("buildSidecarOutboundUDPListeners: UDP port %d is shared by %s, skipping it for %s",
+				port, strings.Join(hostnames, ","), node.ID)
+			push.AddMetric(model.ProxyStatusConflictOutboundListenerUDP, fmt.Sprintf("%s_%d/udp", localhost, port), node,
+				fmt.Sprintf("Listener=%s_%d/udp RejectedUDP=%s", localhost, port, strings.Join(hostnames, ",")))
+			continue
+		}
+		clusterName := model.BuildUDPSubsetKey(model.TrafficDirectionOutbound, "", services[0].Hostname, port)
+		listeners = append(listeners, buildUDPListener(localhost, port, clusterName))
+	}
+	return listeners
+}
+
+// buildGatewayUDPListener builds the listener of a UDP gateway server, forwarding to the destination
+// of the first TCP route matching the server. Destinations with subsets are forwarded to the
+// default cluster of the service port, and only the first destination of the route is used, see
+// virtualservice.UDPRouteAnalyzer.
+func buildGatewayUDPListener(node *model.Proxy, push *model.PushContext, server *networking.Server,
+	bind string, port int, gatewaysForWorkload map[string]bool) *xdsapi.Listener {
+	gatewayServerHosts := make(map[host.Name]bool, len(server.Hosts))
+	for _, hostname := range server.Hosts {
+		gatewayServerHosts[host.Name(hostname)] = true
+	}
+
+	for _, v := range push.VirtualServices(node, gatewaysForWorkload) {
+		vsvc := v.Spec.(*networking.VirtualService)
+		if len(pickMatchingGatewayHosts(gatewayServerHosts, v)) == 0 {
+			continue
+		}
+		for _, tcp := range vsvc.Tcp {
+			if !l4MultiMatch(tcp.Match, server, gatewaysForWorkload) || len(tcp.Route) == 0 {
+				continue
+			}
+			destination := tcp.Route[0].Destination
+			destinationPort := int(server.Port.Number)
+			if destination.GetPort() != nil {
+				destinationPort = int(destination.GetPort().GetNumber())
+			}
+			clusterName := model.BuildUDPSubsetKey(model.TrafficDirectionOutbound, "", host.Name(destination.Host), destinationPort)
+			return buildUDPListener(bind, port, clusterName)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,231 @@
+// Copyright 2020 Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package v1alpha3
+
+import (
+	"testing"
+	"time"
+
+	core "github.com/envoyproxy/go-control-plane/envoy/api/v2/core"
+	udp_proxy "github.com/envoyproxy/go-control-plane/envoy/config/filter/udp/udp_proxy/v2alpha"
+	"github.com/gogo/protobuf/types"
+	"github.com/golang/protobuf/ptypes"
+
+	networking "istio.io/api/networking/v1alpha3"
+
+	"istio.io/istio/pilot/pkg/features"
+	"istio.io/istio/pilot/pkg/model"
+	"istio.io/istio/pilot/pkg/networking/core/v1alpha3/fakes"
+	"istio.io/istio/pilot/pkg/networking/plugin"
+	"istio.io/istio/pkg/config/host"
+	"istio.io/istio/pkg/config/protocol"
+	"istio.io/istio/pkg/config/schema/collections"
+)
+
+func TestBuildUDPClusters(t *testing.T) {
+	tcpPort := &model.Port{Name: "dns-tcp", Port: 53, Protocol: protocol.TCP}
+	udpPort := &model.Port{Name: "dns-udp", Port: 53, Protocol: protocol.UDP}
+	service := &model.Service{
+		Hostname:    host.Name("dns.default.svc.cluster.local"),
+		Address:     "10.0.0.10",
+		ClusterVIPs: make(map[string]string),
+		Ports:       model.PortList{tcpPort, udpPort},
+		Resolution:  model.ClientSideLB,
+		Attributes:  model.ServiceAttributes{Namespace: "default"},
+	}
+	instances := []*model.ServiceInstance{
+		{
+			Service:     service,
+			ServicePort: udpPort,
+			Endpoint: &model.IstioEndpoint{
+				Address:      "192.168.1.1",
+				EndpointPort: 53,
+				TLSMode:      model.IstioMutualTLSModeLabel,
+			},
+		},
+	}
+
+	serviceDiscovery := &fakes.ServiceDiscovery{}
+	serviceDiscovery.ServicesReturns([]*model.Service{service}, nil)
+	serviceDiscovery.InstancesByPortReturns(instances, nil)
+
+	m := testMesh
+	m.EnableAutoMtls = &types.BoolValue{Value: true}
+	env := newTestEnvironment(serviceDiscovery, m, &fakes.IstioConfigStore{})
+
+	p := &model.Proxy{
+		Type:         model.SidecarProxy,
+		IPAddresses:  []string{"6.6.6.6"},
+		DNSDomain:    "default.svc.cluster.local",
+		Metadata:     &model.NodeMetadata{},
+		IstioVersion: model.MaxIstioVersion,
+	}
+	p.SetSidecarScope(env.PushContext)
+	p.DiscoverIPVersions()
+
+	defaultValue := features.EnableUDPProxy
+	defer func() { features.EnableUDPProxy = defaultValue }()
+
+	// UDP ports are ignored unless the UDP proxy is enabled.
+	features.EnableUDPProxy = false
+	for _, c := range NewConfigGenerator([]plugin.Plugin{}).BuildClusters(p, env.PushContext) {
+		if model.IsUDPSubsetKey(c.Name) {
+			t.Fatalf("expected no UDP cluster with the UDP proxy disabled, got %s", c.Name)
+		}
+	}
+
+	features.EnableUDPProxy = true
+	clusters := NewConfigGenerator([]plugin.Plugin{}).BuildClusters(p, env.PushContext)
+	names := map[string]bool{}
+	for _, c := range clusters {
+		if err := c.Validate(); err != nil {
+			t.Fatalf("cluster %s failed validation with error %v", c.Name, err)
+		}
+		names[c.Name] = true
+		if c.Name != "outbound|53/udp||dns.default.svc.cluster.local" {
+			continue
+		}
+		if c.TransportSocket != nil || len(c.TransportSocketMatches) != 0 {
+			t.Errorf("expected no TLS settings for the UDP cluster, got %v %v", c.TransportSocket, c.TransportSocketMatches)
+		}
+	}
+	for _, name := range []string{"outbound|53||dns.default.svc.cluster.local", "outbound|53/udp||dns.default.svc.cluster.local"} {
+		if !names[name] {
+			t.Errorf("expected cluster %s in %v", name, names)
+		}
+	}
+}
+
+func TestSidecarOutboundUDPListeners(t *testing.T) {
+	older := buildServiceWithPort("statsd.default.svc.cluster.local", 8125, protocol.UDP, tnow.Add(-time.Hour))
+	newer := buildServiceWithPort("statsd.other.svc.cluster.local", 8125, protocol.UDP, tnow)
+	dns := buildServiceWithPort("dns.default.svc.cluster.local", 5353, protocol.UDP, tnow)
+	tcp := buildServiceWithPort("tcp.default.svc.cluster.local", 9000, protocol.TCP, tnow)
+
+	env := buildListenerEnv([]*model.Service{newer, tcp, dns, older}, nil)
+	if err := env.PushContext.InitContext(&env, nil, nil); err != nil {
+		t.Fatal(err)
+	}
+	p := &model.Proxy{
+		Type:        model.SidecarProxy,
+		IPAddresses: []string{"1.1.1.1"},
+		ID:          "v0.default",
+		DNSDomain:   "default.example.org",
+		Metadata:    &model.NodeMetadata{},
+	}
+	p.SidecarScope = model.DefaultSidecarScopeForNamespace(env.PushContext, "default")
+	p.DiscoverIPVersions()
+
+	listeners := buildSidecarOutboundUDPListeners(p, env.PushContext)
+	if len(listeners) != 1 {
+		t.Fatalf("expected a single UDP listener, got %d", len(listeners))
+	}
+	l := listeners[0]
+	if err := l.Validate(); err != nil {
+		t.Fatalf("listener %s failed validation with error %v", l.Name, err)
+	}
+	if l.Name != "127.0.0.1_5353/udp" {
+		t.Errorf("unexpected listener name %s", l.Name)
+	}
+	if l.Address.GetSocketAddress().Protocol != core.SocketAddress_UDP {
+		t.Errorf("expected an UDP address, got %v", l.Address)
+	}
+	if len(l.ListenerFilters) != 1 || l.ListenerFilters[0].Name != UDPProxyListenerFilterName {
+		t.Fatalf("expected the udp_proxy listener filter, got %v", l.ListenerFilters)
+	}
+	cfg := &udp_proxy.UdpProxyConfig{}
+	if err := ptypes.UnmarshalAny(l.ListenerFilters[0].GetTypedConfig(), cfg); err != nil {
+		t.Fatal(err)
+	}
+	if want := "outbound|5353/udp||dns.default.svc.cluster.local"; cfg.GetCluster() != want {
+		t.Errorf("expected the service cluster %s, got %s", want, cfg.GetCluster())
+	}
+
+	// The port shared by the statsd services has no listener, as the datagrams could not be routed to
+	// the right service, and is reported.
+	conflicts := env.PushContext.ProxyStatus[model.ProxyStatusConflictOutboundListenerUDP.Name()]
+	if _, f := conflicts["127.0.0.1_8125/udp"]; !f || len(conflicts) != 1 {
+		t.Errorf("expected the conflict of the UDP port 8125 to be reported, got %v", conflicts)
+	}
+}
+
+func TestGatewayUDPListener(t *testing.T) {
+	gateway := model.Config{
+		ConfigMeta: model.ConfigMeta{
+			Name:      "gateway",
+			Namespace: "default",
+		},
+		Spec: &networking.Gateway{
+			Selector: map[string]string{"istio": "ingressgateway"},
+			Servers: []*networking.Server{
+				{
+					Hosts: []string{"*"},
+					Port:  &networking.Port{Name: "dns", Number: 5353, Protocol: "UDP"},
+				},
+			},
+		},
+	}
+	virtualService := model.Config{
+		ConfigMeta: model.ConfigMeta{
+			Type:      collections.IstioNetworkingV1Alpha3Virtualservices.Resource().Kind(),
+			Name:      "dns",
+			Namespace: "default",
+		},
+		Spec: &networking.VirtualService{
+			Hosts:    []string{"*"},
+			Gateways: []string{"gateway"},
+			Tcp: []*networking.TCPRoute{
+				{
+					Match: []*networking.L4MatchAttributes{{Port: 5353}},
+					Route: []*networking.RouteDestination{
+						{
+							Destination: &networking.Destination{
+								Host: "dns.default.svc.cluster.local",
+								Port: &networking.PortSelector{Number: 53},
+							},
+						},
+					},
+				},
+			},
+		},
+	}
+
+	defaultValue := features.EnableUDPProxy
+	features.EnableUDPProxy = true
+	defer func() { features.EnableUDPProxy = defaultValue }()
+
+	env := buildEnv(t, []model.Config{gateway}, []model.Config{virtualService})
+	proxyGateway.SetGatewaysForProxy(env.PushContext)
+	proxyGateway.ServiceInstances = nil
+	proxyGateway.DiscoverIPVersions()
+	builder := NewConfigGenerator([]plugin.Plugin{&fakePlugin{}}).buildGatewayListeners(&proxyGateway, env.PushContext, &ListenerBuilder{})
+	if len(builder.gatewayListeners) != 1 {
+		t.Fatalf("expected a single listener, got %d", len(builder.gatewayListeners))
+	}
+	l := builder.gatewayListeners[0]
+	if err := l.Validate(); err != nil {
+		t.Fatalf("listener %s failed validation with error %v", l.Name, err)
+	}
+	if l.Name != "0.0.0.0_5353/udp" {
+		t.Errorf("unexpected listener name %s", l.Name)
+	}
+	cfg := &udp_proxy.UdpProxyConfig{}
+	if err := ptypes.UnmarshalAny(l.ListenerFilters[0].GetTypedConfig(), cfg); err != nil {
+		t.Fatal(err)
+	}
+	if want := "outbound|53/udp||dns.default.svc.cluster.local"; cfg.GetCluster() != want {
+		t.Errorf("expected cluster %s, got %s", want, cfg.GetCluster())
+	}
+}
@@ -0,0 +1,240 @@
+// Copyright 2020 Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package grpcgen generates the minimal xDS configuration used by proxyless gRPC clients.
+//
+// A gRPC client dialing "xds:///hostname:port" requests a listener named "hostname:port", holding
+// an API listener which references a route configuration with the same name. The route sends all
+// requests to the "outbound|port||hostname" cluster, whose endpoints are discovered with EDS.
+// Endpoints are not generated here, the server's EDS generator is used for them.
+package grpcgen
+
+import (
+	"net"
+	"sort"
+	"strconv"
+
+	xdsapi "github.com/envoyproxy/go-control-plane/envoy/api/v2"
+	core "github.com/envoyproxy/go-control-plane/envoy/api/v2/core"
+	route "github.com/envoyproxy/go-control-plane/envoy/api/v2/route"
+	http_conn "github.com/envoyproxy/go-control-plane/envoy/config/filter/network/http_connection_manager/v2"
+	listener "github.com/envoyproxy/go-control-plane/envoy/config/listener/v2"
+
+	istiolog "istio.io/pkg/log"
+
+	"istio.io/istio/pilot/pkg/model"
+	"istio.io/istio/pilot/pkg/networking/util"
+	"istio.io/istio/pkg/config/host"
+)
+
+// To avoid a recursive dependency to v2.
+const (
+	typePrefix = "type.googleapis.com/envoy.api.v2."
+
+	ClusterType  = typePrefix + "Cluster"
+	ListenerType = typePrefix + "Listener"
+	RouteType    = typePrefix + "RouteConfiguration"
+)
+
+var log = istiolog.RegisterScope("grpcgen", "xDS Generator for Proxyless gRPC", 0)
+
+// GrpcConfigGenerator generates listeners, routes and clusters for proxyless gRPC clients.
+type GrpcConfigGenerator struct{}
+
+var _ model.XdsResourceGenerator = &GrpcConfigGenerator{}
+
+// target is a host:port a gRPC client dials, resolved to a service port.
+type target struct {
+	name     string
+	hostname host.Name
+	port     int
+}
+
+func (t target) clusterName() string {
+	return model.BuildSubsetKey(model.TrafficDirectionOutbound, "", t.hostname, t.port)
+}
+
+// Generate returns the resources of the watched type. Listeners and routes are named after the
+// dialed targets, clusters after the standard outbound cluster names. A watch without resource
+// names gets the resources for all the service ports visible to the proxy.
+func (g *GrpcConfigGenerator) Generate(proxy *model.Proxy, push *model.PushContext, w *model.WatchedResource) model.Resources {
+	switch w.TypeUrl {
+	case ListenerType:
+		return g.buildListeners(proxy, push, w.ResourceNames)
+	case RouteType:
+		return g.buildRoutes(proxy, push, w.ResourceNames)
+	case ClusterType:
+		return g.buildClusters(proxy, push, w.ResourceNames)
+	}
+	log.Debugf("unsupported type %s requested by %s", w.TypeUrl, proxy.ID)
+	return nil
+}
+
+func (g *GrpcConfigGenerator) buildListeners(proxy *model.Proxy, push *model.PushContext, names []string) model.Resources {
+	resp := model.Resources{}
+	for _, t := range resolveTargets(proxy, push, names) {
+		hcm := &http_conn.HttpConnectionManager{
+			RouteSpecifier: &http_conn.HttpConnectionManager_Rds{
+				Rds: &http_conn.Rds{
+					ConfigSource:    adsConfigSource(),
+					RouteConfigName: t.name,
+				},
+			},
+		}
+		resp = append(resp, util.MessageToAny(&xdsapi.Listener{
+			Name: t.name,
+			ApiListener: &listener.ApiListener{
+				ApiListener: util.MessageToAny(hcm),
+			},
+		}))
+	}
+	return resp
+}
+
+func (g *GrpcConfigGenerator) buildRoutes(proxy *model.Proxy, push *model.PushContext, names []string) model.Resources {
+	resp := model.Resources{}
+	for _, t := range resolveTargets(proxy, push, names) {
+		resp = append(resp, util.MessageToAny(&xdsapi.RouteConfiguration{
+			Name: t.name,
+			VirtualHosts: []*route.VirtualHost{{
+				Name:    t.name,
+				Domains: []string{string(t.hostname), t.name},
+				Routes: []*route.Route{{
+					Match: &route.RouteMatch{PathSpecifier: &route.RouteMatch_Prefix{Prefix: ""}},
+					Action: &route.Route_Route{
+						Route: &route.RouteAction{
+							ClusterSpecifier: &route.RouteAction_Cluster{Cluster: t.clusterName()},
+						},
+					},
+				}},
+			}},
+		}))
+	}
+	return resp
+}
+
+func (g *GrpcConfigGenerator) buildClusters(proxy *model.Proxy, push *model.PushContext, names []string) model.Resources {
+	var clusters []string
+	if len(names) == 0 {
+		for _, t := range resolveTargets(proxy, push, nil) {
+			clusters = append(clusters, t.clusterName())
+		}
+	} else {
+		services := visibleServices(proxy, push)
+		for _, name := range names {
+			if !isClusterOf(name, services) {
+				log.Debugf("%s requested unknown cluster %s", proxy.ID, name)
+				continue
+			}
+			clusters = append(clusters, name)
+		}
+	}
+	resp := model.Resources{}
+	for _, name := range clusters {
+		resp = append(resp, util.MessageToAny(&xdsapi.Cluster{
+			Name:                 name,
+			ClusterDiscoveryType: &xdsapi.Cluster_Type{Type: xdsapi.Cluster_EDS},
+			EdsClusterConfig: &xdsapi.Cluster_EdsClusterConfig{
+				ServiceName: name,
+				EdsConfig:   adsConfigSource(),
+			},
+			LbPolicy: xdsapi.Cluster_ROUND_ROBIN,
+		}))
+	}
+	return resp
+}
+
+// isClusterOf checks if a cluster name is the outbound cluster of a port of one of the services.
+// Only the default subsets are generated, as the routes do not reference the others.
+func isClusterOf(name string, services map[host.Name]*model.Service) bool {
+	direction, subset, hostname, port := model.ParseSubsetKey(name)
+	if direction != model.TrafficDirectionOutbound || subset != "" {
+		return false
+	}
+	svc := services[hostname]
+	if svc == nil {
+		return false
+	}
+	_, f := svc.Ports.GetByPort(port)
+	return f
+}
+
+// visibleServices returns the services visible to the proxy, by hostname.
+func visibleServices(proxy *model.Proxy, push *model.PushContext) map[host.Name]*model.Service {
+	services := map[host.Name]*model.Service{}
+	for _, svc := range push.Services(proxy) {
+		services[svc.Hostname] = svc
+	}
+	return services
+}
+
+// resolveTargets maps the requested names to service ports visible to the proxy. Names are either
+// "hostname:port", or "hostname" for services with a single port. Names that can not be resolved
+// are skipped. Without names, all the visible service ports are returned.
+func resolveTargets(proxy *model.Proxy, push *model.PushContext, names []string) []target {
+	services := visibleServices(proxy, push)
+
+	var targets []target
+	if len(names) == 0 {
+		for hostname, svc := range services {
+			for _, port := range svc.Ports {
+				name := net.JoinHostPort(string(hostname), strconv.Itoa(port.Port))
+				targets = append(targets, target{name: name, hostname: hostname, port: port.Port})
+			}
+		}
+		sort.Slice(targets, func(i, j int) bool {
+			return targets[i].name < targets[j].name
+		})
+		return targets
+	}
+
+	for _, name := range names {
+		hostname, portStr, err := net.SplitHostPort(name)
+		if err != nil {
+			hostname = name
+		}
+		svc := services[host.Name(hostname)]
+		if svc == nil {
+			log.Debugf("%s requested unknown service %s", proxy.ID, name)
+			continue
+		}
+		port := 0
+		if portStr != "" {
+			port, err = strconv.Atoi(portStr)
+			if err != nil {
+				log.Debugf("%s requested invalid port %s", proxy.ID, name)
+				continue
+			}
+			if _, f := svc.Ports.GetByPort(port); !f {
+				log.Debugf("%s requested unknown port %s", proxy.ID, name)
+				continue
+			}
+		} else if len(svc.Ports) == 1 {
+			port = svc.Ports[0].Port
+		} else {
+			log.Debugf("%s requested %s without port, but the service has %d ports", proxy.ID, name, len(svc.Ports))
+			continue
+		}
+		targets = append(targets, target{name: name, hostname: svc.Hostname, port: port})
+	}
+	return targets
+}
+
+func adsConfigSource() *core.ConfigSource {
+	return &core.ConfigSource{
+		ConfigSourceSpecifier: &core.ConfigSource_Ads{
+			Ads: &core.AggregatedConfigSource{},
+		},
+	}
+}
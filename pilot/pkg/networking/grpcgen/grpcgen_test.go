@@ -0,0 +1,222 @@
+// Copyright 2020 Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package grpcgen
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	xdsapi "github.com/envoyproxy/go-control-plane/envoy/api/v2"
+	http_conn "github.com/envoyproxy/go-control-plane/envoy/config/filter/network/http_connection_manager/v2"
+	"github.com/golang/protobuf/proto"
+	"github.com/golang/protobuf/ptypes"
+
+	"istio.io/istio/pilot/pkg/config/memory"
+	"istio.io/istio/pilot/pkg/model"
+	"istio.io/istio/pilot/pkg/serviceregistry/mock"
+	"istio.io/istio/pkg/config/host"
+	"istio.io/istio/pkg/config/mesh"
+	"istio.io/istio/pkg/config/protocol"
+	"istio.io/istio/pkg/config/schema/collections"
+)
+
+const endpointType = typePrefix + "ClusterLoadAssignment"
+
+func newTestPush(t *testing.T) *model.PushContext {
+	t.Helper()
+	services := map[host.Name]*model.Service{
+		"echo.default.svc.cluster.local": {
+			CreationTime: time.Now(),
+			Hostname:     "echo.default.svc.cluster.local",
+			Address:      "10.0.0.1",
+			Ports:        model.PortList{{Name: "grpc", Port: 7070, Protocol: protocol.GRPC}},
+			Attributes:   model.ServiceAttributes{Namespace: "default"},
+		},
+		"multi.default.svc.cluster.local": {
+			CreationTime: time.Now(),
+			Hostname:     "multi.default.svc.cluster.local",
+			Address:      "10.0.0.2",
+			Ports: model.PortList{
+				{Name: "grpc", Port: 7070, Protocol: protocol.GRPC},
+				{Name: "grpc-admin", Port: 7071, Protocol: protocol.GRPC},
+			},
+			Attributes: model.ServiceAttributes{Namespace: "default"},
+		},
+	}
+	meshConfig := mesh.DefaultMeshConfig()
+	env := &model.Environment{
+		ServiceDiscovery: mock.NewDiscovery(services, 0),
+		IstioConfigStore: model.MakeIstioStore(memory.Make(collections.Pilot)),
+		Watcher:          mesh.NewFixedWatcher(&meshConfig),
+	}
+	push := model.NewPushContext()
+	if err := push.InitContext(env, nil, nil); err != nil {
+		t.Fatal(err)
+	}
+	return push
+}
+
+func TestGenerate(t *testing.T) {
+	push := newTestPush(t)
+	proxy := &model.Proxy{ID: "app.default", Type: model.SidecarProxy, ConfigNamespace: "default"}
+
+	cases := []struct {
+		name    string
+		typeURL string
+		names   []string
+		want    []string
+	}{
+		{
+			name:    "lds all",
+			typeURL: ListenerType,
+			want: []string{
+				"echo.default.svc.cluster.local:7070",
+				"multi.default.svc.cluster.local:7070",
+				"multi.default.svc.cluster.local:7071",
+			},
+		},
+		{
+			name:    "lds named",
+			typeURL: ListenerType,
+			names:   []string{"echo.default.svc.cluster.local", "multi.default.svc.cluster.local:7071"},
+			want:    []string{"echo.default.svc.cluster.local", "multi.default.svc.cluster.local:7071"},
+		},
+		{
+			name:    "lds unknown",
+			typeURL: ListenerType,
+			names: []string{
+				"unknown.default.svc.cluster.local:7070",
+				"echo.default.svc.cluster.local:8080",
+				"echo.default.svc.cluster.local:port",
+				"multi.default.svc.cluster.local",
+			},
+		},
+		{
+			name:    "rds all",
+			typeURL: RouteType,
+			want: []string{
+				"echo.default.svc.cluster.local:7070",
+				"multi.default.svc.cluster.local:7070",
+				"multi.default.svc.cluster.local:7071",
+			},
+		},
+		{
+			name:    "rds named",
+			typeURL: RouteType,
+			names:   []string{"echo.default.svc.cluster.local:7070"},
+			want:    []string{"echo.default.svc.cluster.local:7070"},
+		},
+		{
+			name:    "rds unknown",
+			typeURL: RouteType,
+			names:   []string{"unknown.default.svc.cluster.local:7070"},
+		},
+		{
+			name:    "cds all",
+			typeURL: ClusterType,
+			want: []string{
+				"outbound|7070||echo.default.svc.cluster.local",
+				"outbound|7070||multi.default.svc.cluster.local",
+				"outbound|7071||multi.default.svc.cluster.local",
+			},
+		},
+		{
+			name:    "cds named",
+			typeURL: ClusterType,
+			names:   []string{"outbound|7071||multi.default.svc.cluster.local"},
+			want:    []string{"outbound|7071||multi.default.svc.cluster.local"},
+		},
+		{
+			name:    "cds unknown",
+			typeURL: ClusterType,
+			names: []string{
+				"outbound|7070||unknown.default.svc.cluster.local",
+				"outbound|8080||echo.default.svc.cluster.local",
+				"outbound|7070|v1|echo.default.svc.cluster.local",
+				"inbound|7070||echo.default.svc.cluster.local",
+				"echo.default.svc.cluster.local:7070",
+			},
+		},
+		{
+			// Endpoints are generated by the EDS generator of the server.
+			name:    "eds",
+			typeURL: endpointType,
+			names:   []string{"outbound|7070||echo.default.svc.cluster.local"},
+		},
+		{
+			name:    "eds all",
+			typeURL: endpointType,
+		},
+	}
+
+	g := &GrpcConfigGenerator{}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			resources := g.Generate(proxy, push, &model.WatchedResource{TypeUrl: tc.typeURL, ResourceNames: tc.names})
+			var got []string
+			for _, r := range resources {
+				if r.TypeUrl != tc.typeURL {
+					t.Errorf("expected type %s, got %s", tc.typeURL, r.TypeUrl)
+				}
+				got = append(got, resourceName(t, tc.typeURL, r.Value))
+			}
+			if !reflect.DeepEqual(got, tc.want) {
+				t.Errorf("expected %v, got %v", tc.want, got)
+			}
+		})
+	}
+}
+
+// resourceName unmarshals a generated resource, checking that its references match its name.
+func resourceName(t *testing.T, typeURL string, value []byte) string {
+	t.Helper()
+	switch typeURL {
+	case ListenerType:
+		l := &xdsapi.Listener{}
+		if err := proto.Unmarshal(value, l); err != nil {
+			t.Fatal(err)
+		}
+		hcm := &http_conn.HttpConnectionManager{}
+		if err := ptypes.UnmarshalAny(l.GetApiListener().GetApiListener(), hcm); err != nil {
+			t.Fatal(err)
+		}
+		if rds := hcm.GetRds().GetRouteConfigName(); rds != l.Name {
+			t.Errorf("expected listener %s to reference the route %s, got %s", l.Name, l.Name, rds)
+		}
+		return l.Name
+	case RouteType:
+		r := &xdsapi.RouteConfiguration{}
+		if err := proto.Unmarshal(value, r); err != nil {
+			t.Fatal(err)
+		}
+		cluster := r.GetVirtualHosts()[0].GetRoutes()[0].GetRoute().GetCluster()
+		if _, _, hostname, _ := model.ParseSubsetKey(cluster); r.GetVirtualHosts()[0].GetDomains()[0] != string(hostname) {
+			t.Errorf("expected route %s to send the requests to the service cluster, got %s", r.Name, cluster)
+		}
+		return r.Name
+	case ClusterType:
+		c := &xdsapi.Cluster{}
+		if err := proto.Unmarshal(value, c); err != nil {
+			t.Fatal(err)
+		}
+		if c.GetType() != xdsapi.Cluster_EDS || c.GetEdsClusterConfig().GetServiceName() != c.Name {
+			t.Errorf("expected cluster %s to discover its endpoints with EDS, got %v", c.Name, c)
+		}
+		return c.Name
+	}
+	t.Fatalf("unexpected resource type %s", typeURL)
+	return ""
+}
@@ -76,6 +76,15 @@ func TestModelProtocolToListenerProtocol(t *testing.T) {
 			true,
 			ListenerProtocolTCP,
 		},
+		{
+			"Kafka to TCP",
+			proxy,
+			protocol.Kafka,
+			core.TrafficDirection_OUTBOUND,
+			true,
+			true,
+			ListenerProtocolTCP,
+		},
 		{
 			"Inbound unknown to Auto",
 			proxy,
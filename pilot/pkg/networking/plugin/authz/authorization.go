@@ -81,7 +81,8 @@ func buildFilter(in *plugin.InputParams, mutable *networking.MutableObjects) {
 	tdBundle := trustdomain.NewBundle(spiffe.GetTrustDomain(), in.Push.Mesh.TrustDomainAliases)
 	namespace := in.Node.ConfigNamespace
 	workload := labels.Collection{in.Node.Metadata.Labels}
-	b := builder.New(tdBundle, workload, namespace, in.Push.AuthzPolicies, util.IsIstioVersionGE15(in.Node))
+	b := builder.New(tdBundle, workload, namespace, in.Push.AuthzPolicies, util.IsIstioVersionGE15(in.Node),
+		in.Push.MeshExtensions.GetExtAuthzProviders())
 	if b == nil {
 		authzLog.Debugf("no authorization policy for workload %v in %s", workload, namespace)
 		return
@@ -81,6 +81,14 @@ const (
 	// which determines the endpoint level transport socket configuration.
 	EnvoyTransportSocketMetadataKey = "envoy.transport_socket_match"
 
+	// EnvoyLbMetadataKey is the key under which the metadata of an endpoint is matched by the subset load
+	// balancer, against the metadata of the route and of the request.
+	EnvoyLbMetadataKey = "envoy.lb"
+
+	// StatefulSessionEndpointKey is the key of the endpoint metadata holding the address of the endpoint,
+	// which gateways match against the endpoint cookie of stateful sessions.
+	StatefulSessionEndpointKey = "istio-session-endpoint"
+
 	// EnvoyRawBufferSocketName matched with hardcoded built-in Envoy transport name which determines
 	// endpoint level plantext transport socket configuration
 	EnvoyRawBufferSocketName = "envoy.transport_sockets.raw_buffer"
@@ -556,6 +564,25 @@ func BuildLbEndpointMetadata(uid string, network string, tlsMode string, push *m
 	return metadata
 }
 
+// AddStatefulSessionEndpointMetadata adds the address of an endpoint to its metadata, in the form Envoy
+// reports the upstream address of the requests it serves, so that gateways can pin stateful sessions to it.
+func AddStatefulSessionEndpointMetadata(metadata *core.Metadata, address string, port uint32) *core.Metadata {
+	if metadata == nil {
+		metadata = &core.Metadata{}
+	}
+	if metadata.FilterMetadata == nil {
+		metadata.FilterMetadata = map[string]*pstruct.Struct{}
+	}
+	metadata.FilterMetadata[EnvoyLbMetadataKey] = &pstruct.Struct{
+		Fields: map[string]*pstruct.Value{
+			StatefulSessionEndpointKey: {Kind: &pstruct.Value_StringValue{
+				StringValue: net.JoinHostPort(address, strconv.Itoa(int(port))),
+			}},
+		},
+	}
+	return metadata
+}
+
 // IsAllowAnyOutbound checks if allow_any is enabled for outbound traffic
 func IsAllowAnyOutbound(node *model.Proxy) bool {
 	return node.SidecarScope != nil &&
@@ -416,6 +416,38 @@ func TestAddSubsetToMetadata(t *testing.T) {
 	}
 }
 
+func TestAddStatefulSessionEndpointMetadata(t *testing.T) {
+	cases := []struct {
+		name     string
+		metadata *core.Metadata
+		address  string
+		want     string
+	}{
+		{name: "no metadata", address: "10.0.0.1", want: "10.0.0.1:8080"},
+		{name: "ipv6", address: "2001:db8::1", want: "[2001:db8::1]:8080"},
+		{
+			name: "istio metadata",
+			metadata: &core.Metadata{FilterMetadata: map[string]*structpb.Struct{
+				IstioMetadataKey: {Fields: map[string]*structpb.Value{"network": {Kind: &structpb.Value_StringValue{StringValue: "n1"}}}},
+			}},
+			address: "10.0.0.1",
+			want:    "10.0.0.1:8080",
+		},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			hadIstio := tc.metadata.GetFilterMetadata()[IstioMetadataKey] != nil
+			got := AddStatefulSessionEndpointMetadata(tc.metadata, tc.address, 8080)
+			if endpoint := got.FilterMetadata[EnvoyLbMetadataKey].GetFields()[StatefulSessionEndpointKey].GetStringValue(); endpoint != tc.want {
+				t.Errorf("expected the endpoint %s, got %s", tc.want, endpoint)
+			}
+			if hadIstio && got.FilterMetadata[IstioMetadataKey] == nil {
+				t.Errorf("expected the istio metadata to be kept, got %v", got)
+			}
+		})
+	}
+}
+
 func TestCloneCluster(t *testing.T) {
 	cluster := buildFakeCluster()
 	clone := CloneCluster(cluster)
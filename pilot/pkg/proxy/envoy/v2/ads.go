@@ -98,17 +98,29 @@ type XdsConnection struct {
 	// CDSWatch is set if the remote server is watching Clusters
 	CDSWatch bool
 
-	// Envoy may request different versions of configuration (XDS v2 vs v3). While internally Pilot will
-	// only generate one version or the other, because the protos are wire compatible we can cast to the
-	// requested version. This struct keeps track of the types requested for each resource type.
-	// For example, if Envoy requests Clusters v3, we would track that here. Pilot would generate a v2
-	// cluster response, but change the TypeUrl in the response to be v3.
+	// Envoy may request different versions of configuration (XDS v2 vs v3), over either version of
+	// the ADS service. Pilot generates v2 resources, which are converted to the v3 messages when
+	// requested (see resourceOfType). This struct keeps track of the types requested for each resource
+	// type. For example, if Envoy requests Clusters v3, we would track that here, and all the CDS
+	// responses would hold v3 clusters.
 	RequestedTypes struct {
-		CDS string
-		EDS string
-		RDS string
-		LDS string
-	}
+		CDS  string
+		EDS  string
+		RDS  string
+		LDS  string
+		VHDS string
+	}
+
+	// nackStates tracks the responses sent for each type, to attribute NACKs to resources.
+	nackStates map[string]*nackState
+	// nackHistory holds the most recent NACKs received on the connection.
+	nackHistory []NackRecord
+	// pushConfigs is the set of configs updated by the push in progress, recorded with the responses
+	// it sends. Only accessed from the connection's stream goroutine.
+	pushConfigs map[model.ConfigKey]struct{}
+
+	// onDemandExpiry is the time the first virtual host loaded on demand expires, zero if none.
+	onDemandExpiry time.Time
 }
 
 // XdsEvent represents a config or registry event that results in a push.
@@ -139,6 +151,7 @@ func newXdsConnection(peerAddr string, stream DiscoveryStream) *XdsConnection {
 		stream:       stream,
 		LDSListeners: []*xdsapi.Listener{},
 		RouteConfigs: map[string]*xdsapi.RouteConfiguration{},
+		nackStates:   map[string]*nackState{},
 	}
 }
 
@@ -186,6 +199,13 @@ func receiveThread(con *XdsConnection, reqChannel chan *xdsapi.DiscoveryRequest,
 
 // StreamAggregatedResources implements the ADS interface.
 func (s *DiscoveryServer) StreamAggregatedResources(stream ads.AggregatedDiscoveryService_StreamAggregatedResourcesServer) error {
+	return s.processStream(stream)
+}
+
+// processStream handles a single ADS stream until it is closed. It is shared by the state of the
+// world and the incremental (delta) ADS services - the latter wraps its stream in a DiscoveryStream
+// adapter translating between the two protocols.
+func (s *DiscoveryServer) processStream(stream DiscoveryStream) error {
 	peerInfo, ok := peer.FromContext(stream.Context())
 	peerAddr := "0.0.0.0"
 	if ok {
@@ -237,11 +257,15 @@ func (s *DiscoveryServer) StreamAggregatedResources(stream ads.AggregatedDiscove
 			if s.StatusReporter != nil {
 				s.StatusReporter.RegisterEvent(con.ConID, discReq.TypeUrl, discReq.ResponseNonce)
 			}
+			if s.handleAckState(con, discReq) {
+				if err := s.pushRolledBack(con, discReq.TypeUrl); err != nil {
+					return err
+				}
+			}
 
 			// Based on node metadata a different generator was selected, use it instead of the default
 			// behavior.
-			if con.node.XdsResourceGenerator != nil && discReq.TypeUrl != EndpointType {
-				// Endpoints are special - will use the optimized code path.
+			if s.findGenerator(con.node, discReq.TypeUrl) != nil {
 				err = s.handleCustomGenerator(con, discReq)
 				if err != nil {
 					return err
@@ -278,6 +302,13 @@ func (s *DiscoveryServer) StreamAggregatedResources(stream ads.AggregatedDiscove
 				if err := s.handleEds(con, discReq); err != nil {
 					return err
 				}
+			case VirtualHostType, v3.VirtualHostType:
+				if err := s.handleTypeURL(discReq.TypeUrl, &con.RequestedTypes.VHDS); err != nil {
+					return err
+				}
+				if err := s.handleVhds(con, discReq); err != nil {
+					return err
+				}
 			default:
 				adsLog.Warnf("ADS: Unknown watched resources %s", discReq.String())
 			}
@@ -293,7 +324,9 @@ func (s *DiscoveryServer) StreamAggregatedResources(stream ads.AggregatedDiscove
 			// It is very tricky to handle due to the protocol - but the periodic push recovers
 			// from it.
 
+			con.pushConfigs = pushEv.configsUpdated
 			err := s.pushConnection(con, pushEv)
+			con.pushConfigs = nil
 			pushEv.done()
 			if err != nil {
 				return nil
@@ -472,8 +505,8 @@ func (s *DiscoveryServer) initConnection(node *core.Node, con *XdsConnection) er
 		return err
 	}
 
-	// Based on node metadata and version, we can associate a different generator.
-	// TODO: use a map of generators, so it's easily customizable and to avoid deps
+	// Based on node metadata and version, we can associate a different generator. Generators
+	// registered for a specific type are looked up by findGenerator.
 	proxy.Active = map[string]*model.WatchedResource{}
 	if proxy.Metadata.Generator != "" {
 		proxy.XdsResourceGenerator = s.Generators[proxy.Metadata.Generator]
@@ -558,16 +591,13 @@ func (s *DiscoveryServer) setProxyState(proxy *model.Proxy, push *model.PushCont
 	return nil
 }
 
-// DeltaAggregatedResources is not implemented.
-// Instead, Generators may send only updates/add, with Delete indicated by an empty spec.
-// This works if both ends follow this model. For example EDS and the API generator follow this
-// pattern.
-//
-// The delta protocol changes the request, adding unsubscribe/subscribe instead of sending full
-// list of resources. On the response it adds 'removed resources' and sends changes for everything.
-// TODO: we could implement this method if needed, the change is not very big.
+// DeltaAggregatedResources implements the incremental ADS interface.
+// The stream is adapted to the state of the world protocol (see deltaStream), so request handling,
+// ACK/NACK processing and pushes use the same code path as StreamAggregatedResources. Responses are
+// diffed per resource before being sent: only added or changed resources are included, and resources
+// no longer generated are listed as removed.
 func (s *DiscoveryServer) DeltaAggregatedResources(stream ads.AggregatedDiscoveryService_DeltaAggregatedResourcesServer) error {
-	return status.Errorf(codes.Unimplemented, "not implemented")
+	return s.processStream(newDeltaStream(stream))
 }
 
 // Compute and send the new configuration for a connection. This is blocking and may be slow
@@ -588,6 +618,12 @@ func (s *DiscoveryServer) pushConnection(con *XdsConnection, pushEv *XdsEvent) e
 				return err
 			}
 		}
+		// Clients using a generator watch endpoints through a WatchedResource.
+		if w := con.node.Active[EndpointType]; w != nil && len(edsUpdatedServices) > 0 {
+			if err := s.pushGeneratorV2(con, pushEv.push, versionInfo(), w); err != nil {
+				return err
+			}
+		}
 		return nil
 	}
 
@@ -595,6 +631,7 @@ func (s *DiscoveryServer) pushConnection(con *XdsConnection, pushEv *XdsEvent) e
 	if err := s.updateProxy(con.node, pushEv.push); err != nil {
 		return nil
 	}
+	s.expireOnDemand(con)
 
 	// This depends on SidecarScope updates, so it should be called after SetSidecarScope.
 	if !ProxyNeedsPush(con.node, pushEv) {
@@ -624,7 +661,7 @@ func (s *DiscoveryServer) pushConnection(con *XdsConnection, pushEv *XdsEvent) e
 	// 'LDSWatch', etc.
 	// Each Generator is responsible for determining if the push event requires a push -
 	// returning nil if the push is not needed.
-	if con.node.XdsResourceGenerator != nil {
+	if len(con.node.Active) > 0 {
 		for _, w := range con.node.Active {
 			err := s.pushGeneratorV2(con, pushEv.push, currentVersion, w)
 			if err != nil {
@@ -668,6 +705,11 @@ func (s *DiscoveryServer) pushConnection(con *XdsConnection, pushEv *XdsEvent) e
 	} else if s.StatusReporter != nil {
 		s.StatusReporter.RegisterEvent(con.ConID, RouteType, pushEv.noncePrefix)
 	}
+	if con.node.Active[VirtualHostType] != nil && (pushTypes[CDS] || pushTypes[RDS]) {
+		if err := s.pushVhds(con, pushEv.push, currentVersion); err != nil {
+			return err
+		}
+	}
 	proxiesConvergeDelay.Record(time.Since(pushEv.start).Seconds())
 	return nil
 }
@@ -794,6 +836,11 @@ func (conn *XdsConnection) send(res *xdsapi.DiscoveryResponse) error {
 	done := make(chan error, 1)
 	// hardcoded for now - not sure if we need a setting
 	t := time.NewTimer(SendTimeout)
+	if res.Nonce != "" {
+		conn.mu.Lock()
+		conn.nackState(res.TypeUrl).recordSent(res, conn.pushConfigs)
+		conn.mu.Unlock()
+	}
 	go func() {
 		err := conn.stream.Send(res)
 		conn.mu.Lock()
@@ -807,8 +854,13 @@ func (conn *XdsConnection) send(res *xdsapi.DiscoveryResponse) error {
 				conn.RouteNonceSent = res.Nonce
 			case EndpointType, v3.EndpointType:
 				conn.EndpointNonceSent = res.Nonce
+			case VirtualHostType, v3.VirtualHostType:
+				// Tracked by the WatchedResource.
 			default:
-				adsLog.Warnf("sent unknown XDS type: %v", res.TypeUrl)
+				// Clients using a generator may watch other types, such as Istio configs.
+				if conn.node == nil || conn.node.Metadata.Generator == "" {
+					adsLog.Warnf("sent unknown XDS type: %v", res.TypeUrl)
+				}
 			}
 		}
 		if res.TypeUrl == RouteType || res.TypeUrl == v3.RouteType {
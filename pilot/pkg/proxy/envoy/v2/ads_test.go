@@ -14,13 +14,20 @@
 package v2_test
 
 import (
+	"context"
 	"fmt"
 	"io/ioutil"
+	"strings"
 	"testing"
 	"time"
 
+	corev3 "github.com/envoyproxy/go-control-plane/envoy/config/core/v3"
+	listenerv3 "github.com/envoyproxy/go-control-plane/envoy/config/listener/v3"
 	ads "github.com/envoyproxy/go-control-plane/envoy/service/discovery/v2"
+	discovery "github.com/envoyproxy/go-control-plane/envoy/service/discovery/v3"
 	"github.com/golang/protobuf/proto"
+	"github.com/golang/protobuf/ptypes"
+	"google.golang.org/grpc"
 
 	networking "istio.io/api/networking/v1alpha3"
 
@@ -190,47 +197,117 @@ func TestAdsVersioning(t *testing.T) {
 	})
 }
 
-func TestAdsClusterUpdate(t *testing.T) {
+// The version of the resources follows the type requested, independently of the transport.
+func TestAdsV3Transport(t *testing.T) {
 	_, tearDown := initLocalPilotTestEnv(t)
 	defer tearDown()
+	node := sidecarID(app3Ip, "app3")
 
-	edsstr, cancel, err := connectADS(util.MockPilotGrpcAddr)
-	if err != nil {
-		t.Fatal(err)
+	for _, typeURL := range []string{v2.ListenerType, v3.ListenerType} {
+		t.Run(typeURL, func(t *testing.T) {
+			conn, err := grpc.Dial(util.MockPilotGrpcAddr, grpc.WithInsecure(), grpc.WithBlock())
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer conn.Close()
+			client, err := discovery.NewAggregatedDiscoveryServiceClient(conn).StreamAggregatedResources(context.Background())
+			if err != nil {
+				t.Fatal(err)
+			}
+			err = client.Send(&discovery.DiscoveryRequest{
+				Node:    &corev3.Node{Id: node, Metadata: nodeMetadata},
+				TypeUrl: typeURL,
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+			res, err := client.Recv()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if res.TypeUrl != typeURL || len(res.Resources) == 0 {
+				t.Fatalf("expected %s resources, got %v", typeURL, res.TypeUrl)
+			}
+			for _, r := range res.Resources {
+				if r.TypeUrl != typeURL {
+					t.Fatalf("expected %s resource, got %s", typeURL, r.TypeUrl)
+				}
+			}
+			if typeURL != v3.ListenerType {
+				return
+			}
+
+			// Typed configs are converted to v3 as well.
+			hcm := "type.googleapis.com/envoy.extensions.filters.network.http_connection_manager.v3.HttpConnectionManager"
+			found := false
+			for _, r := range res.Resources {
+				l := &listenerv3.Listener{}
+				if err := ptypes.UnmarshalAny(r, l); err != nil {
+					t.Fatal(err)
+				}
+				for _, fc := range l.FilterChains {
+					for _, f := range fc.Filters {
+						if f.GetTypedConfig().GetTypeUrl() == hcm {
+							found = true
+						}
+						if strings.Contains(f.GetTypedConfig().GetTypeUrl(), "envoy.config.filter.network.http_connection_manager.v2") {
+							t.Fatalf("unexpected v2 filter in listener %s", l.Name)
+						}
+					}
+				}
+			}
+			if !found {
+				t.Fatal("expected a v3 HttpConnectionManager")
+			}
+		})
 	}
-	defer cancel()
+}
 
-	var sendEDSReqAndVerify = func(clusterName string) {
-		err = sendEDSReq([]string{clusterName}, sidecarID("1.1.1.1", "app3"), edsstr)
-		if err != nil {
-			t.Fatal(err)
-		}
-		res, err := adsReceive(edsstr, 15*time.Second)
-		if err != nil {
-			t.Fatal("Recv failed", err)
-		}
+func TestAdsClusterUpdate(t *testing.T) {
+	_, tearDown := initLocalPilotTestEnv(t)
+	defer tearDown()
 
-		if res.TypeUrl != "type.googleapis.com/envoy.api.v2.ClusterLoadAssignment" {
-			t.Error("Expecting type.googleapis.com/envoy.api.v2.ClusterLoadAssignment got ", res.TypeUrl)
-		}
-		if res.Resources[0].TypeUrl != "type.googleapis.com/envoy.api.v2.ClusterLoadAssignment" {
-			t.Error("Expecting type.googleapis.com/envoy.api.v2.ClusterLoadAssignment got ", res.Resources[0].TypeUrl)
-		}
+	for _, version := range xdsVersions {
+		t.Run(version, func(t *testing.T) {
+			edsstr, cancel, err := connectADSVersion(util.MockPilotGrpcAddr, version)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer cancel()
 
-		cla, err := getLoadAssignment(res)
-		if err != nil {
-			t.Fatal("Invalid EDS response ", err)
-		}
-		if cla.ClusterName != clusterName {
-			t.Error(fmt.Sprintf("Expecting %s got ", clusterName), cla.ClusterName)
-		}
-	}
+			var sendEDSReqAndVerify = func(clusterName string) {
+				err = sendEDSReq([]string{clusterName}, sidecarID("1.1.1.1", "app3"), edsstr)
+				if err != nil {
+					t.Fatal(err)
+				}
+				res, err := adsReceive(edsstr, 15*time.Second)
+				if err != nil {
+					t.Fatal("Recv failed", err)
+				}
 
-	cluster1 := "outbound|80||local.default.svc.cluster.local"
-	sendEDSReqAndVerify(cluster1)
+				if res.TypeUrl != "type.googleapis.com/envoy.api.v2.ClusterLoadAssignment" {
+					t.Error("Expecting type.googleapis.com/envoy.api.v2.ClusterLoadAssignment got ", res.TypeUrl)
+				}
+				if res.Resources[0].TypeUrl != "type.googleapis.com/envoy.api.v2.ClusterLoadAssignment" {
+					t.Error("Expecting type.googleapis.com/envoy.api.v2.ClusterLoadAssignment got ", res.Resources[0].TypeUrl)
+				}
 
-	cluster2 := "outbound|80||hello.default.svc.cluster.local"
-	sendEDSReqAndVerify(cluster2)
+				cla, err := getLoadAssignment(res)
+				if err != nil {
+					t.Fatal("Invalid EDS response ", err)
+				}
+				if cla.ClusterName != clusterName {
+					t.Error(fmt.Sprintf("Expecting %s got ", clusterName), cla.ClusterName)
+				}
+			}
+
+			cluster1 := "outbound|80||local.default.svc.cluster.local"
+			sendEDSReqAndVerify(cluster1)
+
+			cluster2 := "outbound|80||hello.default.svc.cluster.local"
+			sendEDSReqAndVerify(cluster2)
+		})
+	}
 }
 
 // nolint: lll
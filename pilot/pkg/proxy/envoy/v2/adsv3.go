@@ -0,0 +1,126 @@
+// Copyright 2020 Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package v2
+
+import (
+	xdsapi "github.com/envoyproxy/go-control-plane/envoy/api/v2"
+	ads "github.com/envoyproxy/go-control-plane/envoy/service/discovery/v2"
+	discovery "github.com/envoyproxy/go-control-plane/envoy/service/discovery/v3"
+	"github.com/golang/protobuf/proto"
+	"github.com/golang/protobuf/ptypes/any"
+
+	v3 "istio.io/istio/pilot/pkg/proxy/envoy/v3"
+)
+
+// adsV3 implements the v3 ADS service. Streams are adapted to the v2 DiscoveryStream, so v2 and v3
+// clients share the request handling and push code. The version of the resources sent follows the
+// type URLs requested by the client, independently of the version of the transport.
+type adsV3 struct {
+	s *DiscoveryServer
+}
+
+var _ discovery.AggregatedDiscoveryServiceServer = &adsV3{}
+
+// StreamAggregatedResources implements the v3 ADS interface.
+func (a *adsV3) StreamAggregatedResources(stream discovery.AggregatedDiscoveryService_StreamAggregatedResourcesServer) error {
+	return a.s.processStream(&v3Stream{stream})
+}
+
+// DeltaAggregatedResources implements the v3 incremental ADS interface.
+func (a *adsV3) DeltaAggregatedResources(stream discovery.AggregatedDiscoveryService_DeltaAggregatedResourcesServer) error {
+	return a.s.processStream(newDeltaStream(&v3DeltaStream{stream}))
+}
+
+// v3Stream adapts a v3 ADS stream to the DiscoveryStream.
+type v3Stream struct {
+	discovery.AggregatedDiscoveryService_StreamAggregatedResourcesServer
+}
+
+var _ DiscoveryStream = &v3Stream{}
+
+func (s *v3Stream) Recv() (*xdsapi.DiscoveryRequest, error) {
+	req, err := s.AggregatedDiscoveryService_StreamAggregatedResourcesServer.Recv()
+	if err != nil {
+		return nil, err
+	}
+	out := &xdsapi.DiscoveryRequest{}
+	if err := convertMessage(req, out); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (s *v3Stream) Send(res *xdsapi.DiscoveryResponse) error {
+	out := &discovery.DiscoveryResponse{}
+	if err := convertMessage(res, out); err != nil {
+		return err
+	}
+	return s.AggregatedDiscoveryService_StreamAggregatedResourcesServer.Send(out)
+}
+
+// v3DeltaStream adapts a v3 incremental ADS stream to the v2 one, which is then handled by deltaStream.
+type v3DeltaStream struct {
+	discovery.AggregatedDiscoveryService_DeltaAggregatedResourcesServer
+}
+
+var _ ads.AggregatedDiscoveryService_DeltaAggregatedResourcesServer = &v3DeltaStream{}
+
+func (s *v3DeltaStream) Recv() (*xdsapi.DeltaDiscoveryRequest, error) {
+	req, err := s.AggregatedDiscoveryService_DeltaAggregatedResourcesServer.Recv()
+	if err != nil {
+		return nil, err
+	}
+	out := &xdsapi.DeltaDiscoveryRequest{}
+	if err := convertMessage(req, out); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (s *v3DeltaStream) Send(res *xdsapi.DeltaDiscoveryResponse) error {
+	out := &discovery.DeltaDiscoveryResponse{}
+	if err := convertMessage(res, out); err != nil {
+		return err
+	}
+	return s.AggregatedDiscoveryService_DeltaAggregatedResourcesServer.Send(out)
+}
+
+// convertMessage copies a discovery message to its equivalent in the other xDS version. The v2 and
+// v3 discovery messages are wire compatible, the resources they hold are not modified.
+func convertMessage(from, to proto.Message) error {
+	b := proto.NewBuffer(nil)
+	b.SetDeterministic(true)
+	if err := b.Marshal(from); err != nil {
+		return err
+	}
+	return proto.Unmarshal(b.Bytes(), to)
+}
+
+// resourceOfType returns the generated v2 resource as the requested type. Resources requested with
+// a v3 type URL are converted to the v3 message.
+func resourceOfType(r *any.Any, typeURL string) *any.Any {
+	switch typeURL {
+	case v3.ClusterType, v3.ListenerType, v3.RouteType, v3.EndpointType, v3.VirtualHostType:
+		converted, err := v3.ConvertResource(r)
+		if err == nil {
+			return converted
+		}
+		// The messages are wire compatible, the v2 resource is sent as is.
+		adsLog.Errorf("failed to convert resource to %s: %v", typeURL, err)
+		totalXDSInternalErrors.Increment()
+	}
+	r.TypeUrl = typeURL
+	return r
+}
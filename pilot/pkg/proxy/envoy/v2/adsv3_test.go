@@ -0,0 +1,107 @@
+// Copyright 2020 Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package v2
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/golang/protobuf/ptypes/any"
+
+	"istio.io/istio/pilot/pkg/networking/util"
+	v3 "istio.io/istio/pilot/pkg/proxy/envoy/v3"
+)
+
+// TestResourceOfTypeV3 verifies every typed config generated by Pilot is sent as a v3 message to v3 clients.
+func TestResourceOfTypeV3(t *testing.T) {
+	for _, tt := range testCases {
+		t.Run(tt, func(t *testing.T) {
+			env, configgen, proxy := setupTest(t, tt)
+			push := env.PushContext
+			listeners := configgen.BuildListeners(&proxy, push)
+
+			resources := []*any.Any{}
+			for _, c := range configgen.BuildClusters(&proxy, push) {
+				resources = append(resources, resourceOfType(util.MessageToAny(c), v3.ClusterType))
+			}
+			for _, l := range listeners {
+				resources = append(resources, resourceOfType(util.MessageToAny(l), v3.ListenerType))
+			}
+			for _, r := range configgen.BuildHTTPRoutes(&proxy, push, routesFromListeners(listeners)) {
+				resources = append(resources, resourceOfType(util.MessageToAny(r), v3.RouteType))
+			}
+			if len(resources) == 0 {
+				t.Fatal("expected resources to be generated")
+			}
+			for _, r := range resources {
+				assertV3TypedConfigs(t, r)
+			}
+		})
+	}
+}
+
+// assertV3TypedConfigs fails if the resource, or any typed config it holds, is an envoy v2 message.
+func assertV3TypedConfigs(t *testing.T, r *any.Any) {
+	t.Helper()
+	name := strings.TrimPrefix(r.TypeUrl, "type.googleapis.com/")
+	// The UDP filters have no v3 version yet.
+	if strings.HasPrefix(name, "envoy.") && !strings.Contains(name, ".v3.") && !strings.HasPrefix(name, "envoy.config.filter.udp.") {
+		t.Errorf("%s was not converted to v3", name)
+	}
+	msgType := proto.MessageType(name)
+	if msgType == nil {
+		// Istio filter configs are not registered with golang/protobuf.
+		return
+	}
+	msg := reflect.New(msgType.Elem()).Interface().(proto.Message)
+	if err := proto.Unmarshal(r.Value, msg); err != nil {
+		t.Fatalf("failed to unmarshal %s: %v", name, err)
+	}
+	forEachAny(reflect.ValueOf(msg), func(a *any.Any) {
+		assertV3TypedConfigs(t, a)
+	})
+}
+
+// forEachAny calls f with each Any field found in the value.
+func forEachAny(v reflect.Value, f func(*any.Any)) {
+	switch v.Kind() {
+	case reflect.Ptr, reflect.Interface:
+		if v.IsNil() {
+			return
+		}
+		if a, ok := v.Interface().(*any.Any); ok {
+			f(a)
+			return
+		}
+		forEachAny(v.Elem(), f)
+	case reflect.Struct:
+		for i := 0; i < v.NumField(); i++ {
+			if !strings.HasPrefix(v.Type().Field(i).Name, "XXX_") {
+				forEachAny(v.Field(i), f)
+			}
+		}
+	case reflect.Slice:
+		for i := 0; i < v.Len(); i++ {
+			forEachAny(v.Index(i), f)
+		}
+	case reflect.Map:
+		iter := v.MapRange()
+		for iter.Next() {
+			forEachAny(iter.Value(), f)
+		}
+	}
+}
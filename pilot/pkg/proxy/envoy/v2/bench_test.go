@@ -27,6 +27,7 @@ import (
 	"istio.io/istio/pkg/test"
 
 	http_conn "github.com/envoyproxy/go-control-plane/envoy/config/filter/network/http_connection_manager/v2"
+	"github.com/golang/protobuf/proto"
 	"github.com/golang/protobuf/ptypes"
 
 	"istio.io/istio/pilot/pkg/networking/plugin"
@@ -259,6 +260,110 @@ var testCases = []string{
 	"virtualservice",
 }
 
+// TestCachedConfigGeneration verifies the cached generator returns the same output as the uncached one.
+func TestCachedConfigGeneration(t *testing.T) {
+	for _, tt := range testCases {
+		t.Run(tt, func(t *testing.T) {
+			env, configgen, proxy := setupTest(t, tt)
+			cached := core.NewCachedConfigGenerator(configgen)
+			push := env.PushContext
+			routeNames := routesFromListeners(configgen.BuildListeners(&proxy, push))
+
+			// The second round is served from the cache.
+			for i := 0; i < 2; i++ {
+				assertMessagesEqual(t, "clusters", clustersToMessages(configgen.BuildClusters(&proxy, push)),
+					clustersToMessages(cached.BuildClusters(&proxy, push)))
+				assertMessagesEqual(t, "listeners", listenersToMessages(configgen.BuildListeners(&proxy, push)),
+					listenersToMessages(cached.BuildListeners(&proxy, push)))
+				assertMessagesEqual(t, "routes", routesToMessages(configgen.BuildHTTPRoutes(&proxy, push, routeNames)),
+					routesToMessages(cached.BuildHTTPRoutes(&proxy, push, routeNames)))
+			}
+
+			// Another instance of the workload shares the routes, but not the clusters embedding its IP.
+			other := proxy
+			other.ID = "v1.default"
+			other.IPAddresses = []string{"1.1.1.2"}
+			if len(routeNames) > 0 {
+				routes := cached.BuildHTTPRoutes(&proxy, push, routeNames)
+				if shared := cached.BuildHTTPRoutes(&other, push, routeNames); shared[0] != routes[0] {
+					t.Fatalf("expected routes to be shared by the instances of a workload")
+				}
+			}
+			if clusters := cached.BuildClusters(&proxy, push); len(clusters) > 0 {
+				if again := cached.BuildClusters(&other, push); clusters[0] == again[0] {
+					t.Fatalf("expected clusters to be generated for each instance")
+				}
+			}
+
+			// A change to a config the proxy depends on invalidates the entry.
+			first := cached.BuildClusters(&proxy, push)
+			cached.Invalidate(push, map[model.ConfigKey]struct{}{{
+				Kind:      model.ServiceEntryKind,
+				Name:      "service-0.namespace.svc.cluster.local",
+				Namespace: "",
+			}: {}})
+			if again := cached.BuildClusters(&proxy, push); len(first) > 0 && len(again) > 0 && first[0] == again[0] {
+				t.Fatalf("expected clusters to be regenerated after invalidation")
+			}
+
+			// A change to an unrelated config keeps it.
+			first = cached.BuildClusters(&proxy, push)
+			cached.Invalidate(push, map[model.ConfigKey]struct{}{{
+				Kind:      model.DestinationRuleKind,
+				Name:      "unrelated",
+				Namespace: "unrelated",
+			}: {}})
+			if again := cached.BuildClusters(&proxy, push); len(first) > 0 && first[0] != again[0] {
+				t.Fatalf("expected clusters to be served from the cache")
+			}
+		})
+	}
+}
+
+func clustersToMessages(in []*envoy_api_v2.Cluster) []proto.Message {
+	out := make([]proto.Message, 0, len(in))
+	for _, c := range in {
+		out = append(out, c)
+	}
+	return out
+}
+
+func listenersToMessages(in []*envoy_api_v2.Listener) []proto.Message {
+	out := make([]proto.Message, 0, len(in))
+	for _, l := range in {
+		out = append(out, l)
+	}
+	return out
+}
+
+func routesToMessages(in []*envoy_api_v2.RouteConfiguration) []proto.Message {
+	out := make([]proto.Message, 0, len(in))
+	for _, r := range in {
+		out = append(out, r)
+	}
+	return out
+}
+
+// assertMessagesEqual compares the generated resources, ignoring their order which is not
+// deterministic for listeners.
+func assertMessagesEqual(t *testing.T, name string, expected, got []proto.Message) {
+	t.Helper()
+	if len(expected) != len(got) {
+		t.Fatalf("%s: expected %d resources, got %d", name, len(expected), len(got))
+	}
+	want := map[string]int{}
+	for _, m := range expected {
+		want[proto.CompactTextString(m)]++
+	}
+	for _, m := range got {
+		text := proto.CompactTextString(m)
+		if want[text] == 0 {
+			t.Fatalf("%s: unexpected resource %v", name, m)
+		}
+		want[text]--
+	}
+}
+
 func BenchmarkRouteGeneration(b *testing.B) {
 	for _, tt := range testCases {
 		b.Run(tt, func(b *testing.B) {
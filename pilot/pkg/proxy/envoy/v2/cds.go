@@ -38,9 +38,7 @@ func cdsDiscoveryResponse(response []*xdsapi.Cluster, noncePrefix, typeURL strin
 	}
 
 	for _, c := range response {
-		cc := util.MessageToAny(c)
-		cc.TypeUrl = typeURL
-		out.Resources = append(out.Resources, cc)
+		out.Resources = append(out.Resources, resourceOfType(util.MessageToAny(c), typeURL))
 	}
 
 	return out
@@ -50,6 +48,9 @@ func (s *DiscoveryServer) pushCds(con *XdsConnection, push *model.PushContext, v
 	// TODO: Modify interface to take services, and config instead of making library query registry
 	pushStart := time.Now()
 	rawClusters := s.ConfigGenerator.BuildClusters(con.node, push)
+	if isOnDemand(con.node) {
+		rawClusters = s.filterOnDemandClusters(con, push, rawClusters)
+	}
 
 	if s.DebugConfigs {
 		con.CDSClusters = rawClusters
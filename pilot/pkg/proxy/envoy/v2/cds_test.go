@@ -26,28 +26,32 @@ func TestCDS(t *testing.T) {
 	_, tearDown := initLocalPilotTestEnv(t)
 	defer tearDown()
 
-	cdsr, cancel, err := connectADS(util.MockPilotGrpcAddr)
-	if err != nil {
-		t.Fatal(err)
-	}
-
-	err = sendCDSReq(sidecarID(app3Ip, "app3"), cdsr)
-	if err != nil {
-		t.Fatal(err)
-	}
-	defer cancel()
-	res, err := cdsr.Recv()
-	if err != nil {
-		t.Fatal("Failed to receive CDS", err)
-		return
-	}
-
-	strResponse, _ := gogoprotomarshal.ToJSONWithIndent(res, " ")
-	_ = ioutil.WriteFile(env.IstioOut+"/cdsv2_sidecar.json", []byte(strResponse), 0644)
-
-	t.Log("CDS response", strResponse)
-	if len(res.Resources) == 0 {
-		t.Fatal("No response")
+	for _, version := range xdsVersions {
+		t.Run(version, func(t *testing.T) {
+			cdsr, cancel, err := connectADSVersion(util.MockPilotGrpcAddr, version)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			err = sendCDSReq(sidecarID(app3Ip, "app3"), cdsr)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer cancel()
+			res, err := cdsr.Recv()
+			if err != nil {
+				t.Fatal("Failed to receive CDS", err)
+				return
+			}
+
+			strResponse, _ := gogoprotomarshal.ToJSONWithIndent(res, " ")
+			_ = ioutil.WriteFile(env.IstioOut+"/cds"+version+"_sidecar.json", []byte(strResponse), 0644)
+
+			t.Log("CDS response", strResponse)
+			if len(res.Resources) == 0 {
+				t.Fatal("No response")
+			}
+		})
 	}
 
 	// TODO: dump the response resources, compare with some golden once it's stable
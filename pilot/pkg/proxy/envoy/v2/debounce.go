@@ -0,0 +1,184 @@
+// Copyright 2020 Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package v2
+
+import (
+	"math"
+	"sync"
+	"time"
+)
+
+const (
+	// Weight of the latest observation in the moving averages of event rate and push time.
+	debounceSmoothing = 0.3
+
+	// Below this number of events per base quiet period, and with pushes completing quickly,
+	// the mesh is considered calm and the smallest quiet period is used.
+	debounceCalmChurn = 0.1
+
+	// Reasons for the chosen debounce quiet period.
+	debounceReasonDefault     = "default"
+	debounceReasonCalm        = "calm"
+	debounceReasonChurn       = "event churn"
+	debounceReasonPushLatency = "push latency"
+)
+
+// DebounceStatus describes the debounce quiet period currently in use.
+type DebounceStatus struct {
+	// Window is the quiet period a config event must be followed by before a push starts.
+	Window string `json:"window"`
+	// Reason explains why the window was chosen.
+	Reason string `json:"reason"`
+	// EventRate is the moving average of config events per second when the window was computed, decayed
+	// over the time since the last event.
+	EventRate float64 `json:"eventRate"`
+	// PushTime is the moving average of the duration of debounced pushes.
+	PushTime string `json:"pushTime"`
+}
+
+// adaptiveDebounce computes the debounce quiet period from the observed rate of config events and
+// the duration of pushes. The quiet period is widened when events arrive faster than it, or when
+// pushes take longer than it, trading freshness for fewer pushes. It shrinks when the mesh is calm.
+type adaptiveDebounce struct {
+	mu sync.RWMutex
+
+	// base is the quiet period used without churn, min and max bound the adapted quiet period.
+	base time.Duration
+	min  time.Duration
+	max  time.Duration
+
+	// eventRate is the moving average of events per second, as of lastEvent.
+	eventRate float64
+	// rateMeasured is true once an event rate was measured, which takes two events.
+	rateMeasured bool
+	// pushTime is the moving average of push durations.
+	pushTime time.Duration
+
+	lastEvent time.Time
+
+	// current, reason and currentRate are the quiet period, its reason and the decayed event rate of the
+	// last computed window.
+	current     time.Duration
+	reason      string
+	currentRate float64
+}
+
+func newAdaptiveDebounce(base, min, max time.Duration) *adaptiveDebounce {
+	if min > base {
+		min = base
+	}
+	if max < base {
+		max = base
+	}
+	return &adaptiveDebounce{
+		base:    base,
+		min:     min,
+		max:     max,
+		current: base,
+		reason:  debounceReasonDefault,
+	}
+}
+
+// recordEvent records a config event received at the given time.
+func (a *adaptiveDebounce) recordEvent(now time.Time) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if !a.lastEvent.IsZero() {
+		interval := now.Sub(a.lastEvent)
+		if interval < time.Millisecond {
+			interval = time.Millisecond
+		}
+		a.eventRate = debounceSmoothing/interval.Seconds() + (1-debounceSmoothing)*a.decayedEventRate(now)
+		a.rateMeasured = true
+	}
+	a.lastEvent = now
+}
+
+// decayedEventRate returns the event rate decayed over the time since the last event. Each interval of the
+// current rate without event weighs like an observation of a zero rate, so the churn of a past burst fades
+// once the events stop, instead of lasting until the next event.
+func (a *adaptiveDebounce) decayedEventRate(now time.Time) float64 {
+	if a.lastEvent.IsZero() || a.eventRate == 0 {
+		return a.eventRate
+	}
+	// The interval ending with the next event is not missed, it is observed by recordEvent.
+	missed := a.eventRate*now.Sub(a.lastEvent).Seconds() - 1
+	if missed <= 0 {
+		return a.eventRate
+	}
+	return a.eventRate * math.Pow(1-debounceSmoothing, missed)
+}
+
+// recordPush records the duration of a debounced push.
+func (a *adaptiveDebounce) recordPush(d time.Duration) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.pushTime = time.Duration(debounceSmoothing*float64(d) + (1-debounceSmoothing)*float64(a.pushTime))
+}
+
+// window computes the quiet period to use at the given time, based on the current observations.
+func (a *adaptiveDebounce) window(now time.Time) time.Duration {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	window, reason := a.base, debounceReasonDefault
+	rate := a.decayedEventRate(now)
+	churn := rate * a.base.Seconds()
+	if churn > 1 {
+		// More than one event per base quiet period: widen it in proportion, so each window is
+		// expected to batch the events that keep arriving.
+		window, reason = time.Duration(float64(a.base)*churn), debounceReasonChurn
+	} else if a.rateMeasured && churn < debounceCalmChurn && a.pushTime < a.base/2 {
+		// Few events and fast pushes. The mesh is only considered calm once an event rate was
+		// measured, which takes two events.
+		window, reason = a.min, debounceReasonCalm
+	}
+	// Starting pushes more often than they complete only queues them up.
+	if a.pushTime > window {
+		window, reason = a.pushTime, debounceReasonPushLatency
+	}
+	if window > a.max {
+		window = a.max
+	}
+	if window < a.min {
+		window = a.min
+	}
+
+	a.current, a.reason, a.currentRate = window, reason, rate
+	debounceWindow.Record(window.Seconds())
+	return window
+}
+
+// status returns the last computed quiet period and the reason for it.
+func (a *adaptiveDebounce) status() *DebounceStatus {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+	return &DebounceStatus{
+		Window:    a.current.String(),
+		Reason:    a.reason,
+		EventRate: a.currentRate,
+		PushTime:  a.pushTime.String(),
+	}
+}
+
+// debounceReason returns the reason for the current quiet period, for metrics.
+func (a *adaptiveDebounce) debounceReason() string {
+	if a == nil {
+		return debounceReasonDefault
+	}
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+	return a.reason
+}
@@ -37,6 +37,7 @@ import (
 
 	"istio.io/istio/pilot/pkg/model"
 	"istio.io/istio/pilot/pkg/networking/util"
+	v3 "istio.io/istio/pilot/pkg/proxy/envoy/v3"
 	"istio.io/istio/pilot/pkg/serviceregistry"
 	"istio.io/istio/pilot/pkg/serviceregistry/aggregate"
 	"istio.io/istio/pkg/config/host"
@@ -116,6 +117,7 @@ func (s *DiscoveryServer) InitDebug(mux *http.ServeMux, sctl *aggregate.Controll
 	s.addDebugHandler(mux, "/debug/cdsz", "Status and debug interface for CDS", s.cdsz)
 
 	s.addDebugHandler(mux, "/debug/syncz", "Synchronization status of all Envoys connected to this Pilot instance", s.Syncz)
+	s.addDebugHandler(mux, "/debug/nackz", "Recent configuration rejections (NACKs) of the Envoys connected to this Pilot instance", s.nackz)
 	s.addDebugHandler(mux, "/debug/config_distribution", "Version status of all Envoys connected to this Pilot instance", s.distributedVersions)
 
 	s.addDebugHandler(mux, "/debug/registryz", "Debug support for registry", s.registryz)
@@ -127,6 +129,7 @@ func (s *DiscoveryServer) InitDebug(mux *http.ServeMux, sctl *aggregate.Controll
 	s.addDebugHandler(mux, "/debug/authorizationz", "Internal authorization policies", s.Authorizationz)
 	s.addDebugHandler(mux, "/debug/config_dump", "ConfigDump in the form of the Envoy admin config dump API for passed in proxyID", s.ConfigDump)
 	s.addDebugHandler(mux, "/debug/push_status", "Last PushContext Details", s.PushStatusHandler)
+	s.addDebugHandler(mux, "/debug/push_snapshot", "Snapshot of the push state and connected proxies, for `pilot-discovery replay`", s.pushSnapshotz)
 
 	s.addDebugHandler(mux, "/debug/inject", "Active inject template", s.InjectTemplateHandler(webhook))
 }
@@ -150,6 +153,11 @@ type SyncStatus struct {
 	RouteAcked    string `json:"route_acked,omitempty"`
 	EndpointSent  string `json:"endpoint_sent,omitempty"`
 	EndpointAcked string `json:"endpoint_acked,omitempty"`
+	// The nonces of the last rejected responses, see /debug/nackz for details.
+	ClusterNacked  string `json:"cluster_nacked,omitempty"`
+	ListenerNacked string `json:"listener_nacked,omitempty"`
+	RouteNacked    string `json:"route_nacked,omitempty"`
+	EndpointNacked string `json:"endpoint_nacked,omitempty"`
 }
 
 // Syncz dumps the synchronization status of all Envoys connected to this Pilot instance
@@ -170,6 +178,11 @@ func (s *DiscoveryServer) Syncz(w http.ResponseWriter, _ *http.Request) {
 				RouteAcked:    con.RouteNonceAcked,
 				EndpointSent:  con.EndpointNonceSent,
 				EndpointAcked: con.EndpointNonceAcked,
+
+				ClusterNacked:  con.lastNack(ClusterType, v3.ClusterType),
+				ListenerNacked: con.lastNack(ListenerType, v3.ListenerType),
+				RouteNacked:    con.lastNack(RouteType, v3.RouteType),
+				EndpointNacked: con.lastNack(EndpointType, v3.EndpointType),
 			})
 		}
 		con.mu.RUnlock()
@@ -554,6 +567,9 @@ func (s *DiscoveryServer) PushStatusHandler(w http.ResponseWriter, req *http.Req
 		return
 	}
 	out, err := model.LastPushStatus.StatusJSON()
+	if err == nil && s.adaptiveDebounce != nil {
+		out, err = addDebounceStatus(out, s.adaptiveDebounce.status())
+	}
 	if err != nil {
 		w.WriteHeader(http.StatusInternalServerError)
 		_, _ = fmt.Fprintf(w, "unable to marshal push information: %v", err)
@@ -564,6 +580,16 @@ func (s *DiscoveryServer) PushStatusHandler(w http.ResponseWriter, req *http.Req
 	_, _ = w.Write(out)
 }
 
+// addDebounceStatus adds the adaptive debounce status to the push status, under the "debounce" key.
+func addDebounceStatus(pushStatus []byte, status *DebounceStatus) ([]byte, error) {
+	out := map[string]interface{}{}
+	if err := json.Unmarshal(pushStatus, &out); err != nil {
+		return nil, err
+	}
+	out["debounce"] = status
+	return json.MarshalIndent(out, "", "    ")
+}
+
 // lists all the supported debug endpoints.
 func (s *DiscoveryServer) Debug(w http.ResponseWriter, req *http.Request) {
 	type debugEndpoint struct {
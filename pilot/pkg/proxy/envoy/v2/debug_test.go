@@ -22,7 +22,12 @@ import (
 	"testing"
 	"time"
 
+	xdsapi "github.com/envoyproxy/go-control-plane/envoy/api/v2"
+	"github.com/golang/protobuf/proto"
+	"github.com/golang/protobuf/ptypes"
+
 	"istio.io/istio/istioctl/pkg/util/configdump"
+	"istio.io/istio/pilot/pkg/bootstrap"
 	"istio.io/istio/pilot/pkg/model"
 	v2 "istio.io/istio/pilot/pkg/proxy/envoy/v2"
 	"istio.io/istio/tests/util"
@@ -298,3 +303,103 @@ func TestDebugHandlers(t *testing.T) {
 		t.Errorf("Error in generatating debug endpoint list")
 	}
 }
+
+func TestPushSnapshotReplay(t *testing.T) {
+	s, tearDown := initLocalPilotTestEnv(t)
+	defer tearDown()
+
+	adsstr, cancel, err := connectADS(util.MockPilotGrpcAddr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cancel()
+
+	node := sidecarID(app3Ip, "replayApp")
+	if err := sendCDSReq(node, adsstr); err != nil {
+		t.Fatal(err)
+	}
+	cds, err := adsReceive(adsstr, 5*time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := sendLDSReq(node, adsstr); err != nil {
+		t.Fatal(err)
+	}
+	lds, err := adsReceive(adsstr, 5*time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The snapshot is replayed from its serialized form, as written by /debug/push_snapshot.
+	exported, err := s.EnvoyXdsServer.Snapshot("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := json.Marshal(exported)
+	if err != nil {
+		t.Fatal(err)
+	}
+	snap := &v2.PushSnapshot{}
+	if err := json.Unmarshal(b, snap); err != nil {
+		t.Fatal(err)
+	}
+	if len(snap.Configs) == 0 || len(snap.Services) == 0 || len(snap.Endpoints) == 0 {
+		t.Fatalf("incomplete snapshot: %d configs, %d services, %d endpoints",
+			len(snap.Configs), len(snap.Services), len(snap.Endpoints))
+	}
+	proxy := snap.Proxy(node)
+	if proxy == nil {
+		t.Fatalf("proxy %s not found in snapshot", node)
+	}
+
+	replay, err := v2.NewReplayServer(snap, bootstrap.DefaultPlugins)
+	if err != nil {
+		t.Fatal(err)
+	}
+	responses, err := replay.Replay(snap, proxy, []string{v2.ClusterType, v2.ListenerType})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(responses) != 2 {
+		t.Fatalf("expected CDS and LDS responses, got %d", len(responses))
+	}
+	for i, live := range []*xdsapi.DiscoveryResponse{cds, lds} {
+		got, want := resourcesByName(t, responses[i]), resourcesByName(t, live)
+		if len(got) != len(want) {
+			t.Errorf("replayed %d %s resources, pushed %d", len(got), live.TypeUrl, len(want))
+		}
+		for name, w := range want {
+			g, f := got[name]
+			if !f {
+				t.Errorf("replayed %s misses the pushed resource %s", live.TypeUrl, name)
+				continue
+			}
+			if !proto.Equal(g, w) {
+				t.Errorf("replayed %s resource %s differs from the pushed resource:\ngot  %v\nwant %v", live.TypeUrl, name, g, w)
+			}
+		}
+	}
+}
+
+// resourcesByName unmarshals the clusters or listeners of a response, keyed by name.
+func resourcesByName(t *testing.T, res *xdsapi.DiscoveryResponse) map[string]proto.Message {
+	t.Helper()
+	resources := make(map[string]proto.Message, len(res.Resources))
+	for _, r := range res.Resources {
+		switch res.TypeUrl {
+		case v2.ClusterType:
+			c := &xdsapi.Cluster{}
+			if err := ptypes.UnmarshalAny(r, c); err != nil {
+				t.Fatal(err)
+			}
+			resources[c.Name] = c
+		case v2.ListenerType:
+			l := &xdsapi.Listener{}
+			if err := ptypes.UnmarshalAny(r, l); err != nil {
+				t.Fatal(err)
+			}
+			resources[l.Name] = l
+		}
+	}
+	return resources
+}
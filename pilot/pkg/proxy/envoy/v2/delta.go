@@ -0,0 +1,272 @@
+// Copyright 2020 Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package v2
+
+import (
+	"hash/fnv"
+	"sort"
+	"strconv"
+	"sync"
+
+	xdsapi "github.com/envoyproxy/go-control-plane/envoy/api/v2"
+	ads "github.com/envoyproxy/go-control-plane/envoy/service/discovery/v2"
+	"github.com/golang/protobuf/proto"
+	"github.com/golang/protobuf/ptypes/any"
+
+	"istio.io/istio/pilot/pkg/networking/apigen"
+)
+
+// deltaStream adapts an incremental (delta) ADS stream to the state of the world DiscoveryStream.
+//
+// Incoming DeltaDiscoveryRequests update the set of subscribed resources for the type, and are
+// converted to a DiscoveryRequest listing all currently subscribed resources - exactly what a state
+// of the world client would send. Outgoing DiscoveryResponses are compared with the versions the
+// client is known to have: only new or modified resources are sent, and for wildcard watches
+// (CDS, LDS) resources that are no longer generated are reported as removed.
+type deltaStream struct {
+	ads.AggregatedDiscoveryService_DeltaAggregatedResourcesServer
+
+	// mu protects watched. Recv is called from the receive goroutine, Send from the push path.
+	mu sync.Mutex
+
+	// watched holds the delta state for each type URL requested on the stream.
+	watched map[string]*deltaWatch
+}
+
+// deltaWatch tracks the incremental protocol state of a single type URL.
+type deltaWatch struct {
+	// subscribed is the set of resource names the client subscribed to. An empty set is a wildcard
+	// subscription, used by CDS and LDS.
+	subscribed map[string]struct{}
+
+	// sent maps resource names to the version last sent to (or reported by) the client.
+	sent map[string]string
+
+	// nonceSent and versionSent are taken from the last response generated for this type. The response
+	// may not have been written to the stream if it carried no changes.
+	nonceSent   string
+	versionSent string
+
+	// nonceWritten is the nonce of the last response written to the stream, and writtenNames the
+	// resources it included.
+	nonceWritten string
+	writtenNames []string
+}
+
+var _ DiscoveryStream = &deltaStream{}
+
+func newDeltaStream(stream ads.AggregatedDiscoveryService_DeltaAggregatedResourcesServer) *deltaStream {
+	return &deltaStream{
+		AggregatedDiscoveryService_DeltaAggregatedResourcesServer: stream,
+		watched: map[string]*deltaWatch{},
+	}
+}
+
+func (d *deltaStream) watch(typeURL string) *deltaWatch {
+	w := d.watched[typeURL]
+	if w == nil {
+		w = &deltaWatch{
+			subscribed: map[string]struct{}{},
+			sent:       map[string]string{},
+		}
+		d.watched[typeURL] = w
+	}
+	return w
+}
+
+// Recv reads the next DeltaDiscoveryRequest and converts it to the equivalent DiscoveryRequest.
+func (d *deltaStream) Recv() (*xdsapi.DiscoveryRequest, error) {
+	req, err := d.AggregatedDiscoveryService_DeltaAggregatedResourcesServer.Recv()
+	if err != nil {
+		return nil, err
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	w := d.watch(req.TypeUrl)
+	for _, name := range req.ResourceNamesSubscribe {
+		w.subscribed[name] = struct{}{}
+	}
+	for _, name := range req.ResourceNamesUnsubscribe {
+		delete(w.subscribed, name)
+		// Forget the version, so the resource is sent again if it is subscribed later.
+		delete(w.sent, name)
+	}
+	// On reconnect the client reports the versions it already has. Versions are content hashes, so
+	// unchanged resources are not sent again, even if generated by a different istiod instance.
+	for name, version := range req.InitialResourceVersions {
+		w.sent[name] = version
+	}
+
+	out := &xdsapi.DiscoveryRequest{
+		Node:          req.Node,
+		TypeUrl:       req.TypeUrl,
+		ResponseNonce: req.ResponseNonce,
+		ErrorDetail:   req.ErrorDetail,
+	}
+	if len(w.subscribed) > 0 {
+		out.ResourceNames = make([]string, 0, len(w.subscribed))
+		for name := range w.subscribed {
+			out.ResourceNames = append(out.ResourceNames, name)
+		}
+		sort.Strings(out.ResourceNames)
+	}
+
+	if req.ResponseNonce != "" && req.ResponseNonce == w.nonceWritten {
+		if req.ErrorDetail != nil {
+			// The client rejected the resources in the last response, make sure they are sent again
+			// on the next push instead of being considered up to date.
+			for _, name := range w.writtenNames {
+				delete(w.sent, name)
+			}
+		}
+		// Responses generated after the last written one carried no changes, so acknowledging the
+		// last written response acknowledges them as well.
+		out.ResponseNonce = w.nonceSent
+		out.VersionInfo = w.versionSent
+	}
+	return out, nil
+}
+
+// Send converts a DiscoveryResponse to a DeltaDiscoveryResponse holding only the changes since the
+// previous response, and writes it to the stream. Responses without changes are not written.
+func (d *deltaStream) Send(res *xdsapi.DiscoveryResponse) error {
+	d.mu.Lock()
+	w := d.watch(res.TypeUrl)
+	w.nonceSent = res.Nonce
+	w.versionSent = res.VersionInfo
+
+	resp := &xdsapi.DeltaDiscoveryResponse{
+		TypeUrl:           res.TypeUrl,
+		SystemVersionInfo: res.VersionInfo,
+		Nonce:             res.Nonce,
+	}
+	names := make(map[string]struct{}, len(res.Resources))
+	written := make([]string, 0, len(res.Resources))
+	for _, r := range res.Resources {
+		name := resourceName(r)
+		names[name] = struct{}{}
+		version := resourceVersion(r)
+		if v, f := w.sent[name]; f && v == version {
+			continue
+		}
+		w.sent[name] = version
+		written = append(written, name)
+		resource := &xdsapi.Resource{
+			Name:     name,
+			Version:  version,
+			Resource: r,
+		}
+		if isOnDemandType(res.TypeUrl) {
+			// Virtual hosts are requested by the alias they are named after.
+			resource.Aliases = []string{name}
+		}
+		resp.Resources = append(resp.Resources, resource)
+	}
+
+	// Only a wildcard watch receives the complete set of resources in every response. Named watches
+	// (RDS, EDS) may legitimately get a subset, for example on incremental EDS pushes, and their
+	// resources are removed by the client unsubscribing. Resources loaded on demand are removed by
+	// Pilot when they expire, and must be requested again.
+	onDemand := isOnDemandType(res.TypeUrl)
+	if len(w.subscribed) == 0 || onDemand {
+		for name := range w.sent {
+			if _, f := names[name]; !f {
+				resp.RemovedResources = append(resp.RemovedResources, name)
+				delete(w.sent, name)
+				if onDemand {
+					delete(w.subscribed, name)
+				}
+			}
+		}
+		sort.Strings(resp.RemovedResources)
+	}
+
+	// The first response for a type is always sent, even if empty, so the client can complete
+	// its initialization.
+	if len(resp.Resources) == 0 && len(resp.RemovedResources) == 0 && w.nonceWritten != "" {
+		d.mu.Unlock()
+		adsLog.Debugf("ADS: delta response for %s has no changes, skipping", res.TypeUrl)
+		return nil
+	}
+	w.nonceWritten = res.Nonce
+	w.writtenNames = written
+	d.mu.Unlock()
+
+	deltaResources.Record(float64(len(resp.Resources)))
+	return d.AggregatedDiscoveryService_DeltaAggregatedResourcesServer.Send(resp)
+}
+
+// resourceName returns the name of an encoded xDS resource. All Envoy xDS resources, including
+// ClusterLoadAssignment, hold their name in field 1, so it is read from the encoded bytes directly
+// instead of unmarshalling the entire resource. Istio configs are enveloped in MCP Resources, which
+// hold the name in field 1 of the metadata, itself field 1 of the resource.
+func resourceName(r *any.Any) string {
+	if r.TypeUrl == apigen.ResourceType {
+		metadata, _ := field(r.Value, 1)
+		name, _ := field(metadata, 1)
+		return string(name)
+	}
+	name, _ := field(r.Value, 1)
+	return string(name)
+}
+
+// field returns the content of the given field of an encoded message, if it is a length delimited field.
+func field(value []byte, number uint64) ([]byte, bool) {
+	b := proto.NewBuffer(value)
+	for {
+		key, err := b.DecodeVarint()
+		if err != nil {
+			return nil, false
+		}
+		switch key & 7 {
+		case proto.WireVarint:
+			_, err = b.DecodeVarint()
+		case proto.WireFixed64:
+			_, err = b.DecodeFixed64()
+		case proto.WireFixed32:
+			_, err = b.DecodeFixed32()
+		case proto.WireBytes:
+			if key>>3 == number {
+				f, err := b.DecodeRawBytes(false)
+				if err != nil {
+					return nil, false
+				}
+				return f, true
+			}
+			_, err = b.DecodeRawBytes(false)
+		default:
+			return nil, false
+		}
+		if err != nil {
+			return nil, false
+		}
+	}
+}
+
+// resourceVersion returns a content based version for the resource. Resources are marshaled
+// deterministically, so identical resources always get the same version. Istio configs are not, and
+// use the version in their metadata instead, which is set from their content by the API generator.
+func resourceVersion(r *any.Any) string {
+	if r.TypeUrl == apigen.ResourceType {
+		metadata, _ := field(r.Value, 1)
+		if version, f := field(metadata, 3); f && len(version) > 0 {
+			return string(version)
+		}
+	}
+	h := fnv.New64a()
+	_, _ = h.Write(r.Value)
+	return strconv.FormatUint(h.Sum64(), 16)
+}
@@ -0,0 +1,227 @@
+// Copyright 2020 Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package v2
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	xdsapi "github.com/envoyproxy/go-control-plane/envoy/api/v2"
+	ads "github.com/envoyproxy/go-control-plane/envoy/service/discovery/v2"
+	gogoproto "github.com/gogo/protobuf/proto"
+	"github.com/golang/protobuf/ptypes/any"
+	"google.golang.org/genproto/googleapis/rpc/status"
+
+	mcp "istio.io/api/mcp/v1alpha1"
+
+	"istio.io/istio/pilot/pkg/networking/apigen"
+)
+
+// fakeDeltaStream replays requests and records the responses written to the stream.
+type fakeDeltaStream struct {
+	ads.AggregatedDiscoveryService_DeltaAggregatedResourcesServer
+	requests  []*xdsapi.DeltaDiscoveryRequest
+	responses []*xdsapi.DeltaDiscoveryResponse
+}
+
+func (f *fakeDeltaStream) Recv() (*xdsapi.DeltaDiscoveryRequest, error) {
+	req := f.requests[0]
+	f.requests = f.requests[1:]
+	return req, nil
+}
+
+func (f *fakeDeltaStream) Send(res *xdsapi.DeltaDiscoveryResponse) error {
+	f.responses = append(f.responses, res)
+	return nil
+}
+
+type deltaTest struct {
+	t      *testing.T
+	fake   *fakeDeltaStream
+	stream *deltaStream
+}
+
+func newDeltaTest(t *testing.T) *deltaTest {
+	fake := &fakeDeltaStream{}
+	return &deltaTest{t: t, fake: fake, stream: newDeltaStream(fake)}
+}
+
+func (d *deltaTest) recv(req *xdsapi.DeltaDiscoveryRequest) *xdsapi.DiscoveryRequest {
+	d.t.Helper()
+	d.fake.requests = append(d.fake.requests, req)
+	out, err := d.stream.Recv()
+	if err != nil {
+		d.t.Fatal(err)
+	}
+	return out
+}
+
+// send sends a state of the world response and returns the delta response written to the stream, if any.
+func (d *deltaTest) send(typeURL, nonce string, resources ...*any.Any) *xdsapi.DeltaDiscoveryResponse {
+	d.t.Helper()
+	written := len(d.fake.responses)
+	err := d.stream.Send(&xdsapi.DiscoveryResponse{
+		TypeUrl:     typeURL,
+		VersionInfo: "v-" + nonce,
+		Nonce:       nonce,
+		Resources:   resources,
+	})
+	if err != nil {
+		d.t.Fatal(err)
+	}
+	if len(d.fake.responses) == written {
+		return nil
+	}
+	return d.fake.responses[written]
+}
+
+func deltaNames(res *xdsapi.DeltaDiscoveryResponse) []string {
+	out := []string{}
+	for _, r := range res.Resources {
+		out = append(out, r.Name)
+	}
+	return out
+}
+
+func TestDeltaStreamUnchangedResourcesNotResent(t *testing.T) {
+	d := newDeltaTest(t)
+	d.recv(&xdsapi.DeltaDiscoveryRequest{TypeUrl: ClusterType})
+
+	res := d.send(ClusterType, "1", testCluster("a", time.Second), testCluster("b", time.Second))
+	if got := deltaNames(res); !reflect.DeepEqual(got, []string{"a", "b"}) {
+		t.Fatalf("expected a and b to be sent, got %v", got)
+	}
+
+	// A push with the same resources writes nothing.
+	if res := d.send(ClusterType, "2", testCluster("a", time.Second), testCluster("b", time.Second)); res != nil {
+		t.Fatalf("expected no response for an unchanged push, got %v", res)
+	}
+
+	// Only the modified resource is sent.
+	res = d.send(ClusterType, "3", testCluster("a", time.Second), testCluster("b", 2*time.Second))
+	if got := deltaNames(res); !reflect.DeepEqual(got, []string{"b"}) {
+		t.Fatalf("expected only b to be sent, got %v", got)
+	}
+
+	// The first response of a type is written even if it is empty.
+	d.recv(&xdsapi.DeltaDiscoveryRequest{TypeUrl: ListenerType})
+	if res := d.send(ListenerType, "4"); res == nil {
+		t.Fatal("expected the initial empty response to be written")
+	}
+}
+
+func TestDeltaStreamRemovedResources(t *testing.T) {
+	d := newDeltaTest(t)
+
+	// Resources missing from a wildcard response are removed.
+	d.recv(&xdsapi.DeltaDiscoveryRequest{TypeUrl: ClusterType})
+	d.send(ClusterType, "1", testCluster("a", time.Second), testCluster("b", time.Second))
+	res := d.send(ClusterType, "2", testCluster("a", time.Second))
+	if len(res.Resources) != 0 || !reflect.DeepEqual(res.RemovedResources, []string{"b"}) {
+		t.Fatalf("expected b to be removed, got %v", res)
+	}
+	res = d.send(ClusterType, "3", testCluster("a", time.Second), testCluster("b", time.Second))
+	if got := deltaNames(res); !reflect.DeepEqual(got, []string{"b"}) || len(res.RemovedResources) != 0 {
+		t.Fatalf("expected b to be sent again, got %v", res)
+	}
+
+	// Resources of a named watch are not removed by a partial response, only by unsubscribing.
+	d.recv(&xdsapi.DeltaDiscoveryRequest{TypeUrl: EndpointType, ResourceNamesSubscribe: []string{"a", "b"}})
+	d.send(EndpointType, "4", testCluster("a", time.Second), testCluster("b", time.Second))
+	if res := d.send(EndpointType, "5", testCluster("a", time.Second)); res != nil {
+		t.Fatalf("expected no response for a partial named push, got %v", res)
+	}
+	req := d.recv(&xdsapi.DeltaDiscoveryRequest{TypeUrl: EndpointType, ResourceNamesUnsubscribe: []string{"b"}})
+	if !reflect.DeepEqual(req.ResourceNames, []string{"a"}) {
+		t.Fatalf("expected the request to list a, got %v", req.ResourceNames)
+	}
+	req = d.recv(&xdsapi.DeltaDiscoveryRequest{TypeUrl: EndpointType, ResourceNamesSubscribe: []string{"b"}})
+	if !reflect.DeepEqual(req.ResourceNames, []string{"a", "b"}) {
+		t.Fatalf("expected the request to list a and b, got %v", req.ResourceNames)
+	}
+	res = d.send(EndpointType, "6", testCluster("a", time.Second), testCluster("b", time.Second))
+	if got := deltaNames(res); !reflect.DeepEqual(got, []string{"b"}) {
+		t.Fatalf("expected b to be sent after subscribing again, got %v", got)
+	}
+}
+
+func TestDeltaStreamAckAndNack(t *testing.T) {
+	d := newDeltaTest(t)
+	d.recv(&xdsapi.DeltaDiscoveryRequest{TypeUrl: ClusterType})
+	d.send(ClusterType, "1", testCluster("a", time.Second), testCluster("b", time.Second))
+
+	// Acknowledging the last written response acknowledges the unchanged responses generated since.
+	d.send(ClusterType, "2", testCluster("a", time.Second), testCluster("b", time.Second))
+	req := d.recv(&xdsapi.DeltaDiscoveryRequest{TypeUrl: ClusterType, ResponseNonce: "1"})
+	if req.ResponseNonce != "2" || req.VersionInfo != "v-2" {
+		t.Fatalf("expected the ACK to be for nonce 2, got %v", req)
+	}
+
+	// Rejected resources are sent again on the next push, even if unchanged.
+	d.send(ClusterType, "3", testCluster("a", time.Second), testCluster("b", 2*time.Second))
+	req = d.recv(&xdsapi.DeltaDiscoveryRequest{
+		TypeUrl:       ClusterType,
+		ResponseNonce: "3",
+		ErrorDetail:   &status.Status{Code: 3, Message: "invalid b"},
+	})
+	if req.ErrorDetail == nil || req.ResponseNonce != "3" {
+		t.Fatalf("expected a NACK for nonce 3, got %v", req)
+	}
+	res := d.send(ClusterType, "4", testCluster("a", time.Second), testCluster("b", 2*time.Second))
+	if got := deltaNames(res); !reflect.DeepEqual(got, []string{"b"}) {
+		t.Fatalf("expected the rejected b to be sent again, got %v", got)
+	}
+
+	// A NACK of an older response does not affect the resources sent since.
+	req = d.recv(&xdsapi.DeltaDiscoveryRequest{
+		TypeUrl:       ClusterType,
+		ResponseNonce: "1",
+		ErrorDetail:   &status.Status{Code: 3, Message: "stale"},
+	})
+	if req.ResponseNonce != "1" {
+		t.Fatalf("expected a stale NACK to keep its nonce, got %v", req)
+	}
+	if res := d.send(ClusterType, "5", testCluster("a", time.Second), testCluster("b", 2*time.Second)); res != nil {
+		t.Fatalf("expected no response after a stale NACK, got %v", res)
+	}
+}
+
+func TestResourceVersion(t *testing.T) {
+	config := func(version, annotation string) *any.Any {
+		b, err := gogoproto.Marshal(&mcp.Resource{Metadata: &mcp.Metadata{
+			Name:        "default/foo",
+			Version:     version,
+			Annotations: map[string]string{"a": annotation},
+		}})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return &any.Any{TypeUrl: apigen.ResourceType, Value: b}
+	}
+	if resourceName(config("1", "a")) != "default/foo" {
+		t.Fatalf("unexpected name %s", resourceName(config("1", "a")))
+	}
+	// Istio configs are versioned by their metadata, as their encoding is not deterministic.
+	if v := resourceVersion(config("1", "a")); v != "1" {
+		t.Fatalf("expected the metadata version, got %s", v)
+	}
+	if resourceVersion(config("", "a")) == resourceVersion(config("", "b")) {
+		t.Fatal("expected configs without a version to be versioned by their content")
+	}
+	if resourceVersion(testCluster("a", time.Second)) != resourceVersion(testCluster("a", time.Second)) {
+		t.Fatal("expected identical resources to get the same version")
+	}
+}
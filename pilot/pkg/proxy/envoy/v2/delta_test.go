@@ -0,0 +1,266 @@
+// Copyright 2020 Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package v2_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	xdsapi "github.com/envoyproxy/go-control-plane/envoy/api/v2"
+	core "github.com/envoyproxy/go-control-plane/envoy/api/v2/core"
+	route "github.com/envoyproxy/go-control-plane/envoy/api/v2/route"
+	clusterv3 "github.com/envoyproxy/go-control-plane/envoy/config/cluster/v3"
+	corev3 "github.com/envoyproxy/go-control-plane/envoy/config/core/v3"
+	ads "github.com/envoyproxy/go-control-plane/envoy/service/discovery/v2"
+	discovery "github.com/envoyproxy/go-control-plane/envoy/service/discovery/v3"
+	"github.com/golang/protobuf/ptypes"
+	structpb "github.com/golang/protobuf/ptypes/struct"
+	"google.golang.org/grpc"
+
+	v2 "istio.io/istio/pilot/pkg/proxy/envoy/v2"
+	v3 "istio.io/istio/pilot/pkg/proxy/envoy/v3"
+	"istio.io/istio/tests/util"
+)
+
+func connectDeltaADS(t *testing.T, url string) (ads.AggregatedDiscoveryService_DeltaAggregatedResourcesClient, util.TearDownFunc) {
+	conn, err := grpc.Dial(url, grpc.WithInsecure(), grpc.WithBlock())
+	if err != nil {
+		t.Fatalf("GRPC dial failed: %s", err)
+	}
+	client, err := ads.NewAggregatedDiscoveryServiceClient(conn).DeltaAggregatedResources(context.Background())
+	if err != nil {
+		t.Fatalf("delta stream failed: %s", err)
+	}
+	return client, func() {
+		_ = client.CloseSend()
+		_ = conn.Close()
+	}
+}
+
+func deltaReceive(t *testing.T, client ads.AggregatedDiscoveryService_DeltaAggregatedResourcesClient) *xdsapi.DeltaDiscoveryResponse {
+	t.Helper()
+	type result struct {
+		res *xdsapi.DeltaDiscoveryResponse
+		err error
+	}
+	ch := make(chan result, 1)
+	go func() {
+		res, err := client.Recv()
+		ch <- result{res, err}
+	}()
+	select {
+	case r := <-ch:
+		if r.err != nil {
+			t.Fatalf("failed to receive delta response: %v", r.err)
+		}
+		return r.res
+	case <-time.After(15 * time.Second):
+		t.Fatal("timed out waiting for delta response")
+	}
+	return nil
+}
+
+func TestDeltaAds(t *testing.T) {
+	_, tearDown := initLocalPilotTestEnv(t)
+	defer tearDown()
+
+	client, cancel := connectDeltaADS(t, util.MockPilotGrpcAddr)
+	defer cancel()
+	node := &core.Node{Id: sidecarID(app3Ip, "app3"), Metadata: nodeMetadata}
+
+	// Wildcard CDS subscription gets the full set of clusters.
+	if err := client.Send(&xdsapi.DeltaDiscoveryRequest{Node: node, TypeUrl: v2.ClusterType}); err != nil {
+		t.Fatal(err)
+	}
+	cds := deltaReceive(t, client)
+	if cds.TypeUrl != v2.ClusterType || len(cds.Resources) == 0 {
+		t.Fatalf("expected clusters, got %v", cds)
+	}
+	cluster := "outbound|80||service3.default.svc.cluster.local"
+	found := false
+	for _, r := range cds.Resources {
+		if r.Name == "" || r.Version == "" {
+			t.Errorf("resource without name or version: %v", r)
+		}
+		if r.Name == cluster {
+			found = true
+		}
+	}
+	if !found {
+		t.Fatalf("cluster %s not found in delta response", cluster)
+	}
+
+	// Subscribe to the endpoints of a single cluster, acking the CDS response.
+	if err := client.Send(&xdsapi.DeltaDiscoveryRequest{Node: node, TypeUrl: v2.ClusterType, ResponseNonce: cds.Nonce}); err != nil {
+		t.Fatal(err)
+	}
+	if err := client.Send(&xdsapi.DeltaDiscoveryRequest{
+		Node:                   node,
+		TypeUrl:                v2.EndpointType,
+		ResourceNamesSubscribe: []string{cluster},
+	}); err != nil {
+		t.Fatal(err)
+	}
+	eds := deltaReceive(t, client)
+	if eds.TypeUrl != v2.EndpointType || len(eds.Resources) != 1 || eds.Resources[0].Name != cluster {
+		t.Fatalf("expected endpoints for %s, got %v", cluster, eds)
+	}
+	if err := client.Send(&xdsapi.DeltaDiscoveryRequest{Node: node, TypeUrl: v2.EndpointType, ResponseNonce: eds.Nonce}); err != nil {
+		t.Fatal(err)
+	}
+
+	// Subscribing to an additional cluster only sends the new cluster.
+	other := "outbound|80||hello.default.svc.cluster.local"
+	if err := client.Send(&xdsapi.DeltaDiscoveryRequest{
+		Node:                   node,
+		TypeUrl:                v2.EndpointType,
+		ResourceNamesSubscribe: []string{other},
+		ResponseNonce:          eds.Nonce,
+	}); err != nil {
+		t.Fatal(err)
+	}
+	eds = deltaReceive(t, client)
+	if len(eds.Resources) != 1 || eds.Resources[0].Name != other {
+		t.Fatalf("expected only endpoints for %s, got %v", other, eds)
+	}
+}
+
+func TestDeltaAdsV3(t *testing.T) {
+	_, tearDown := initLocalPilotTestEnv(t)
+	defer tearDown()
+
+	conn, err := grpc.Dial(util.MockPilotGrpcAddr, grpc.WithInsecure(), grpc.WithBlock())
+	if err != nil {
+		t.Fatalf("GRPC dial failed: %s", err)
+	}
+	defer conn.Close()
+	client, err := discovery.NewAggregatedDiscoveryServiceClient(conn).DeltaAggregatedResources(context.Background())
+	if err != nil {
+		t.Fatalf("delta stream failed: %s", err)
+	}
+
+	err = client.Send(&discovery.DeltaDiscoveryRequest{
+		Node:    &corev3.Node{Id: sidecarID(app3Ip, "app3"), Metadata: nodeMetadata},
+		TypeUrl: v3.ClusterType,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	cds, err := client.Recv()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cds.TypeUrl != v3.ClusterType || len(cds.Resources) == 0 {
+		t.Fatalf("expected clusters, got %v", cds)
+	}
+	for _, r := range cds.Resources {
+		c := &clusterv3.Cluster{}
+		if err := ptypes.UnmarshalAny(r.Resource, c); err != nil {
+			t.Fatal(err)
+		}
+		if r.Name == "" || r.Name != c.Name {
+			t.Errorf("unexpected resource name %q for cluster %q", r.Name, c.Name)
+		}
+	}
+}
+
+func TestDeltaAdsOnDemand(t *testing.T) {
+	_, tearDown := initLocalPilotTestEnv(t)
+	defer tearDown()
+
+	client, cancel := connectDeltaADS(t, util.MockPilotGrpcAddr)
+	defer cancel()
+	node := &core.Node{Id: sidecarID(app3Ip, "app3"), Metadata: &structpb.Struct{Fields: map[string]*structpb.Value{
+		"ISTIO_VERSION":      {Kind: &structpb.Value_StringValue{StringValue: "1.3"}},
+		"ON_DEMAND_CLUSTERS": {Kind: &structpb.Value_StringValue{StringValue: "true"}},
+	}}}
+	cluster := "outbound|80||hello.default.svc.cluster.local"
+	hasCluster := func(res *xdsapi.DeltaDiscoveryResponse) bool {
+		for _, r := range res.Resources {
+			if r.Name == cluster {
+				return true
+			}
+		}
+		return false
+	}
+
+	// HTTP destinations are not sent until requested.
+	if err := client.Send(&xdsapi.DeltaDiscoveryRequest{Node: node, TypeUrl: v2.ClusterType}); err != nil {
+		t.Fatal(err)
+	}
+	cds := deltaReceive(t, client)
+	if len(cds.Resources) == 0 || hasCluster(cds) {
+		t.Fatalf("expected clusters without %s, got %v", cluster, cds)
+	}
+	if err := client.Send(&xdsapi.DeltaDiscoveryRequest{Node: node, TypeUrl: v2.ClusterType, ResponseNonce: cds.Nonce}); err != nil {
+		t.Fatal(err)
+	}
+
+	// Route configurations reference VHDS instead of holding the virtual hosts.
+	if err := client.Send(&xdsapi.DeltaDiscoveryRequest{Node: node, TypeUrl: v2.RouteType, ResourceNamesSubscribe: []string{"80"}}); err != nil {
+		t.Fatal(err)
+	}
+	rds := deltaReceive(t, client)
+	if len(rds.Resources) != 1 {
+		t.Fatalf("expected route 80, got %v", rds)
+	}
+	rc := &xdsapi.RouteConfiguration{}
+	if err := ptypes.UnmarshalAny(rds.Resources[0].Resource, rc); err != nil {
+		t.Fatal(err)
+	}
+	if rc.Vhds == nil || len(rc.VirtualHosts) != 0 {
+		t.Fatalf("expected route 80 to use VHDS, got %v", rc)
+	}
+	if err := client.Send(&xdsapi.DeltaDiscoveryRequest{Node: node, TypeUrl: v2.RouteType, ResponseNonce: rds.Nonce}); err != nil {
+		t.Fatal(err)
+	}
+
+	// The initial VHDS request is answered, even without virtual hosts.
+	if err := client.Send(&xdsapi.DeltaDiscoveryRequest{Node: node, TypeUrl: v2.VirtualHostType}); err != nil {
+		t.Fatal(err)
+	}
+	if vhds := deltaReceive(t, client); vhds.TypeUrl != v2.VirtualHostType || len(vhds.Resources) != 0 {
+		t.Fatalf("expected empty virtual hosts, got %v", vhds)
+	}
+
+	// Requesting the destination sends its cluster, then its virtual host.
+	vhost := "80/hello.default.svc.cluster.local"
+	if err := client.Send(&xdsapi.DeltaDiscoveryRequest{
+		Node:                   node,
+		TypeUrl:                v2.VirtualHostType,
+		ResourceNamesSubscribe: []string{vhost},
+	}); err != nil {
+		t.Fatal(err)
+	}
+	cds = deltaReceive(t, client)
+	if cds.TypeUrl != v2.ClusterType || !hasCluster(cds) {
+		t.Fatalf("expected cluster %s, got %v", cluster, cds)
+	}
+	vhds := deltaReceive(t, client)
+	if vhds.TypeUrl != v2.VirtualHostType || len(vhds.Resources) != 1 {
+		t.Fatalf("expected virtual host %s, got %v", vhost, vhds)
+	}
+	if r := vhds.Resources[0]; r.Name != vhost || len(r.Aliases) != 1 || r.Aliases[0] != vhost {
+		t.Fatalf("unexpected virtual host resource %v", r)
+	}
+	vh := &route.VirtualHost{}
+	if err := ptypes.UnmarshalAny(vhds.Resources[0].Resource, vh); err != nil {
+		t.Fatal(err)
+	}
+	if len(vh.Domains) != 1 || vh.Domains[0] != "hello.default.svc.cluster.local" || len(vh.Routes) == 0 {
+		t.Fatalf("unexpected virtual host %v", vh)
+	}
+}
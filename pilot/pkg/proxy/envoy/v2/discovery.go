@@ -20,13 +20,16 @@ import (
 	"time"
 
 	ads "github.com/envoyproxy/go-control-plane/envoy/service/discovery/v2"
+	discovery "github.com/envoyproxy/go-control-plane/envoy/service/discovery/v3"
 	"github.com/google/uuid"
 	"go.uber.org/atomic"
 	"google.golang.org/grpc"
 
 	"istio.io/istio/pilot/pkg/features"
 	"istio.io/istio/pilot/pkg/model"
+	"istio.io/istio/pilot/pkg/networking/apigen"
 	"istio.io/istio/pilot/pkg/networking/core"
+	"istio.io/istio/pilot/pkg/networking/grpcgen"
 	"istio.io/istio/pilot/pkg/util/sets"
 )
 
@@ -54,6 +57,10 @@ var (
 
 	// enableEDSDebounce indicates whether EDS pushes should be debounced.
 	enableEDSDebounce bool
+
+	// enableAdaptiveDebounce indicates whether the debounce quiet period adapts to the observed
+	// event rate and push duration, instead of always being debounceAfter.
+	enableAdaptiveDebounce bool
 )
 
 const (
@@ -69,12 +76,22 @@ const (
 	ListenerType = typePrefix + "Listener"
 	// RouteType is sent after listeners.
 	RouteType = typePrefix + "RouteConfiguration"
+	// VirtualHostType is used by sidecars loading destinations on demand (VHDS).
+	VirtualHostType = typePrefix + "route.VirtualHost"
+
+	// GrpcGenerator is the name of the generator for proxyless gRPC clients, selected with the
+	// GENERATOR node metadata.
+	GrpcGenerator = "grpc"
+	// APIGenerator is the name of the generator serving Istio configs, with type URLs matching the
+	// GroupVersionKind of the config collections.
+	APIGenerator = "api"
 )
 
 func init() {
 	debounceAfter = features.DebounceAfter
 	debounceMax = features.DebounceMax
 	enableEDSDebounce = features.EnableEDSDebounce.Get()
+	enableAdaptiveDebounce = features.EnableAdaptiveDebounce
 }
 
 // DiscoveryServer is Pilot's gRPC implementation for Envoy's v2 xds APIs
@@ -93,6 +110,7 @@ type DiscoveryServer struct {
 	ConfigGenerator core.ConfigGenerator
 
 	// Generators allow customizing the generated config, based on the client metadata.
+	// Use RegisterGenerator to add generators, before the server is started.
 	Generators map[string]model.XdsResourceGenerator
 
 	concurrentPushLimit chan struct{}
@@ -125,6 +143,9 @@ type DiscoveryServer struct {
 	adsClientsMutex sync.RWMutex
 
 	StatusReporter DistributionEventHandler
+
+	// adaptiveDebounce computes the debounce quiet period, if adaptive debouncing is enabled.
+	adaptiveDebounce *adaptiveDebounce
 }
 
 // EndpointShards holds the set of endpoint shards of a service. Registries update
@@ -149,9 +170,13 @@ type EndpointShards struct {
 
 // NewDiscoveryServer creates DiscoveryServer that sources data from Pilot's internal mesh data structures
 func NewDiscoveryServer(env *model.Environment, plugins []string) *DiscoveryServer {
+	configGenerator := core.NewConfigGenerator(plugins)
+	if features.EnableConfigCache {
+		configGenerator = core.NewCachedConfigGenerator(configGenerator)
+	}
 	out := &DiscoveryServer{
 		Env:                     env,
-		ConfigGenerator:         core.NewConfigGenerator(plugins),
+		ConfigGenerator:         configGenerator,
 		Generators:              map[string]model.XdsResourceGenerator{},
 		EndpointShardsByService: map[string]map[string]*EndpointShards{},
 		concurrentPushLimit:     make(chan struct{}, features.PushThrottle),
@@ -162,6 +187,12 @@ func NewDiscoveryServer(env *model.Environment, plugins []string) *DiscoveryServ
 		adsClients:              map[string]*XdsConnection{},
 	}
 
+	if enableAdaptiveDebounce {
+		out.adaptiveDebounce = newAdaptiveDebounce(debounceAfter, features.DebounceAfterMin, features.DebounceAfterMax)
+	}
+
+	out.initGenerators()
+
 	// Flush cached discovery responses when detecting jwt public key change.
 	model.JwtKeyResolver.PushFunc = func() {
 		out.ConfigUpdate(&model.PushRequest{Full: true, Reason: []model.TriggerReason{model.UnknownTrigger}})
@@ -170,9 +201,42 @@ func NewDiscoveryServer(env *model.Environment, plugins []string) *DiscoveryServ
 	return out
 }
 
-// Register adds the ADS and EDS handles to the grpc server
+// RegisterGenerator registers a generator under the name clients select with the GENERATOR node
+// metadata. If typeURL is not empty, the generator is only used for that type and takes precedence
+// over the generator registered with the same name for all types. Generators must be registered
+// before the server is started.
+func (s *DiscoveryServer) RegisterGenerator(name, typeURL string, generator model.XdsResourceGenerator) {
+	if typeURL != "" {
+		name = name + "/" + typeURL
+	}
+	s.Generators[name] = generator
+}
+
+// initGenerators registers the built-in generators.
+func (s *DiscoveryServer) initGenerators() {
+	edsGen := &EdsGenerator{Server: s}
+	s.RegisterGenerator(GrpcGenerator, "", &grpcgen.GrpcConfigGenerator{})
+	s.RegisterGenerator(GrpcGenerator, EndpointType, edsGen)
+	s.RegisterGenerator(APIGenerator, "", &apigen.APIGenerator{})
+	s.RegisterGenerator(APIGenerator, EndpointType, edsGen)
+}
+
+// findGenerator returns the generator used for the type, or nil if the proxy did not select a
+// generator and uses the default code path.
+func (s *DiscoveryServer) findGenerator(proxy *model.Proxy, typeURL string) model.XdsResourceGenerator {
+	if proxy.Metadata.Generator == "" {
+		return nil
+	}
+	if g, f := s.Generators[proxy.Metadata.Generator+"/"+typeURL]; f {
+		return g
+	}
+	return proxy.XdsResourceGenerator
+}
+
+// Register adds the v2 and v3 ADS handlers to the grpc server
 func (s *DiscoveryServer) Register(rpcs *grpc.Server) {
 	ads.RegisterAggregatedDiscoveryServiceServer(rpcs, s)
+	discovery.RegisterAggregatedDiscoveryServiceServer(rpcs, &adsV3{s})
 }
 
 func (s *DiscoveryServer) Start(stopCh <-chan struct{}) {
@@ -180,6 +244,7 @@ func (s *DiscoveryServer) Start(stopCh <-chan struct{}) {
 	go s.handleUpdates(stopCh)
 	go s.periodicRefreshMetrics(stopCh)
 	go s.sendPushes(stopCh)
+	go s.sweepOnDemand(stopCh)
 }
 
 // Push metrics are updated periodically (10s default)
@@ -236,6 +301,11 @@ func (s *DiscoveryServer) Push(req *model.PushRequest) {
 		return
 	}
 
+	// Drop the cached config made stale by this push, before the new push context is used.
+	if cache, ok := s.ConfigGenerator.(*core.CachedConfigGenerator); ok {
+		cache.Invalidate(push, req.ConfigsUpdated)
+	}
+
 	s.updateMutex.Lock()
 	s.Env.PushContext = push
 	s.updateMutex.Unlock()
@@ -283,11 +353,12 @@ func (s *DiscoveryServer) ConfigUpdate(req *model.PushRequest) {
 // It ensures that at minimum minQuiet time has elapsed since the last event before processing it.
 // It also ensures that at most maxDelay is elapsed between receiving an event and processing it.
 func (s *DiscoveryServer) handleUpdates(stopCh <-chan struct{}) {
-	debounce(s.pushChannel, stopCh, s.Push)
+	debounce(s.pushChannel, stopCh, s.Push, s.adaptiveDebounce)
 }
 
 // The debounce helper function is implemented to enable mocking
-func debounce(ch chan *model.PushRequest, stopCh <-chan struct{}, pushFn func(req *model.PushRequest)) {
+// If adaptive is not nil, it determines the quiet period instead of debounceAfter.
+func debounce(ch chan *model.PushRequest, stopCh <-chan struct{}, pushFn func(req *model.PushRequest), adaptive *adaptiveDebounce) {
 	var timeChan <-chan time.Time
 	var startDebounce time.Time
 	var lastConfigUpdateTime time.Time
@@ -299,23 +370,28 @@ func debounce(ch chan *model.PushRequest, stopCh <-chan struct{}, pushFn func(re
 	var req *model.PushRequest
 
 	free := true
-	freeCh := make(chan struct{}, 1)
+	// freeCh receives the duration of each push once it completes.
+	freeCh := make(chan time.Duration, 1)
 
 	push := func(req *model.PushRequest) {
+		pushStart := time.Now()
 		pushFn(req)
-		freeCh <- struct{}{}
+		freeCh <- time.Since(pushStart)
 	}
 
+	quietPeriod := debounceAfter
+
 	pushWorker := func() {
 		eventDelay := time.Since(startDebounce)
 		quietTime := time.Since(lastConfigUpdateTime)
 		// it has been too long or quiet enough
-		if eventDelay >= debounceMax || quietTime >= debounceAfter {
+		if eventDelay >= debounceMax || quietTime >= quietPeriod {
 			if req != nil {
 				pushCounter++
 				adsLog.Infof("Push debounce stable[%d] %d: %v since last change, %v since last push, full=%v",
 					pushCounter, debouncedEvents,
 					quietTime, eventDelay, req.Full)
+				debouncedPushes.With(typeTag.Value(adaptive.debounceReason())).Increment()
 
 				free = false
 				go push(req)
@@ -323,14 +399,17 @@ func debounce(ch chan *model.PushRequest, stopCh <-chan struct{}, pushFn func(re
 				debouncedEvents = 0
 			}
 		} else {
-			timeChan = time.After(debounceAfter - quietTime)
+			timeChan = time.After(quietPeriod - quietTime)
 		}
 	}
 
 	for {
 		select {
-		case <-freeCh:
+		case pushTime := <-freeCh:
 			free = true
+			if adaptive != nil {
+				adaptive.recordPush(pushTime)
+			}
 			pushWorker()
 		case r := <-ch:
 			// If reason is not set, record it as an unknown reason
@@ -344,8 +423,12 @@ func debounce(ch chan *model.PushRequest, stopCh <-chan struct{}, pushFn func(re
 			}
 
 			lastConfigUpdateTime = time.Now()
+			if adaptive != nil {
+				adaptive.recordEvent(lastConfigUpdateTime)
+				quietPeriod = adaptive.window(lastConfigUpdateTime)
+			}
 			if debouncedEvents == 0 {
-				timeChan = time.After(debounceAfter)
+				timeChan = time.After(quietPeriod)
 				startDebounce = lastConfigUpdateTime
 			}
 			debouncedEvents++
@@ -275,7 +275,7 @@ func TestDebounce(t *testing.T) {
 
 			wg.Add(1)
 			go func() {
-				debounce(updateCh, stopCh, fakePush)
+				debounce(updateCh, stopCh, fakePush, nil)
 				wg.Done()
 			}()
 
@@ -308,3 +308,82 @@ func TestDebounce(t *testing.T) {
 		})
 	}
 }
+
+func TestAdaptiveDebounceWindow(t *testing.T) {
+	base := 100 * time.Millisecond
+	now := time.Now()
+
+	t.Run("default", func(t *testing.T) {
+		a := newAdaptiveDebounce(base, 10*time.Millisecond, time.Second)
+		if got := a.window(now); got != base {
+			t.Fatalf("expected %v, got %v", base, got)
+		}
+		if a.status().Reason != debounceReasonDefault {
+			t.Fatalf("unexpected reason %v", a.status().Reason)
+		}
+	})
+
+	t.Run("calm", func(t *testing.T) {
+		a := newAdaptiveDebounce(base, 10*time.Millisecond, time.Second)
+		a.recordEvent(now)
+		a.recordEvent(now.Add(time.Minute))
+		if got := a.window(now.Add(time.Minute)); got != 10*time.Millisecond {
+			t.Fatalf("expected min window, got %v", got)
+		}
+		if a.status().Reason != debounceReasonCalm {
+			t.Fatalf("unexpected reason %v", a.status().Reason)
+		}
+	})
+
+	t.Run("churn", func(t *testing.T) {
+		a := newAdaptiveDebounce(base, 10*time.Millisecond, time.Second)
+		for i := 0; i < 20; i++ {
+			a.recordEvent(now.Add(time.Duration(i) * 10 * time.Millisecond))
+		}
+		if got := a.window(now.Add(190 * time.Millisecond)); got <= base {
+			t.Fatalf("expected window above %v, got %v", base, got)
+		}
+		if a.status().Reason != debounceReasonChurn {
+			t.Fatalf("unexpected reason %v", a.status().Reason)
+		}
+	})
+
+	t.Run("push latency", func(t *testing.T) {
+		a := newAdaptiveDebounce(base, 10*time.Millisecond, time.Second)
+		for i := 0; i < 20; i++ {
+			a.recordPush(500 * time.Millisecond)
+		}
+		if got := a.window(now); got < 400*time.Millisecond || got > 500*time.Millisecond {
+			t.Fatalf("expected window near push time, got %v", got)
+		}
+		if a.status().Reason != debounceReasonPushLatency {
+			t.Fatalf("unexpected reason %v", a.status().Reason)
+		}
+	})
+
+	t.Run("bounded", func(t *testing.T) {
+		a := newAdaptiveDebounce(base, 10*time.Millisecond, time.Second)
+		a.recordPush(time.Minute)
+		if got := a.window(now); got != time.Second {
+			t.Fatalf("expected max window, got %v", got)
+		}
+	})
+
+	t.Run("churn decays", func(t *testing.T) {
+		a := newAdaptiveDebounce(base, 10*time.Millisecond, time.Second)
+		for i := 0; i < 20; i++ {
+			a.recordEvent(now.Add(time.Duration(i) * 10 * time.Millisecond))
+		}
+		// The burst is over: the window computed later, or for the next event, no longer widens.
+		if got := a.window(now.Add(10 * time.Second)); got != 10*time.Millisecond {
+			t.Fatalf("expected min window after the burst, got %v", got)
+		}
+		if a.status().EventRate >= 1 {
+			t.Fatalf("expected the event rate to decay, got %v", a.status().EventRate)
+		}
+		a.recordEvent(now.Add(10 * time.Second))
+		if got := a.window(now.Add(10 * time.Second)); got > base {
+			t.Fatalf("expected no churn for an event after the burst, got %v", got)
+		}
+	})
+}
@@ -34,7 +34,6 @@ import (
 	"istio.io/istio/pilot/pkg/util/sets"
 	"istio.io/istio/pkg/config/host"
 	"istio.io/istio/pkg/config/labels"
-	"istio.io/istio/pkg/config/protocol"
 )
 
 // EDS returns the list of endpoints (IP:port and in future labels) associated with a real
@@ -90,6 +89,8 @@ func buildEnvoyLbEndpoint(e *model.IstioEndpoint, push *model.PushContext) *endp
 	// Istio endpoint level tls transport socket configuration depends on this logic
 	// Do not remove
 	ep.Metadata = util.BuildLbEndpointMetadata(e.UID, e.Network, e.TLSMode, push)
+	// Gateways pin the stateful sessions to the endpoint with this address.
+	ep.Metadata = util.AddStatefulSessionEndpointMetadata(ep.Metadata, e.Address, e.EndpointPort)
 
 	return ep
 }
@@ -127,10 +128,13 @@ func (s *DiscoveryServer) UpdateServiceShards(push *model.PushContext) error {
 				continue
 			}
 			endpoints := make([]*model.IstioEndpoint, 0)
+			ports := map[int]struct{}{}
 			for _, port := range svc.Ports {
-				if port.Protocol == protocol.UDP {
+				// Instances are listed by port number, which UDP and TCP ports may share.
+				if _, f := ports[port.Port]; f {
 					continue
 				}
+				ports[port.Port] = struct{}{}
 
 				// This loses track of grouping (shards)
 				instances, err := registry.InstancesByPort(svc, port.Port, labels.Collection{})
@@ -341,7 +345,13 @@ func (s *DiscoveryServer) loadAssignmentsForClusterIsolated(proxy *model.Proxy,
 		return nil
 	}
 
-	svcPort, f := svc.Ports.GetByPort(port)
+	var svcPort *model.Port
+	var f bool
+	if model.IsUDPSubsetKey(clusterName) {
+		svcPort, f = svc.Ports.GetUDPByPort(port)
+	} else {
+		svcPort, f = svc.Ports.GetByPort(port)
+	}
 	if !f {
 		// Shouldn't happen here
 		adsLog.Debugf("can not find the service port %d for cluster %s", port, clusterName)
@@ -369,7 +379,7 @@ func (s *DiscoveryServer) loadAssignmentsForClusterIsolated(proxy *model.Proxy,
 func (s *DiscoveryServer) generateEndpoints(
 	clusterName string, proxy *model.Proxy, push *model.PushContext, edsUpdatedServices map[string]struct{},
 ) *xdsapi.ClusterLoadAssignment {
-	_, _, hostname, _ := model.ParseSubsetKey(clusterName)
+	_, subsetName, hostname, portNumber := model.ParseSubsetKey(clusterName)
 	if edsUpdatedServices != nil {
 		if _, ok := edsUpdatedServices[string(hostname)]; !ok {
 			// Cluster was not updated, skip recomputing. This happens when we get an incremental update for a
@@ -398,7 +408,8 @@ func (s *DiscoveryServer) generateEndpoints(
 	// If locality aware routing is enabled, prioritize endpoints or set their lb weight.
 	// Failover should only be enabled when there is an outlier detection, otherwise Envoy
 	// will never detect the hosts are unhealthy and redirect traffic.
-	enableFailover, lb := getOutlierDetectionAndLoadBalancerSettings(push, proxy, clusterName)
+	destinationRule, port := getDestinationRule(push, proxy, hostname, portNumber)
+	enableFailover, lb := getOutlierDetectionAndLoadBalancerSettings(destinationRule, port, subsetName)
 	lbSetting := loadbalancer.GetLocalityLbSetting(push.Mesh.GetLocalityLbSetting(), lb.GetLocalityLbSetting())
 	if lbSetting != nil {
 		// Make a shallow copy of the cla as we are mutating the endpoints with priorities/weights relative to the calling proxy
@@ -406,6 +417,16 @@ func (s *DiscoveryServer) generateEndpoints(
 		l = &clonedCLA
 		loadbalancer.ApplyLocalityLBSetting(proxy.Locality, l, lbSetting, enableFailover)
 	}
+	if factor := getOverprovisioningFactor(destinationRule); factor != nil {
+		// Make a shallow copy of the cla and of its policy, which may be shared with the cached cla
+		clonedCLA := *l
+		clonedCLA.Policy = &xdsapi.ClusterLoadAssignment_Policy{}
+		if l.Policy != nil {
+			*clonedCLA.Policy = *l.Policy
+		}
+		l = &clonedCLA
+		loadbalancer.ApplyOverprovisioningFactor(l, factor)
+	}
 	return l
 }
 
@@ -458,7 +479,7 @@ func (s *DiscoveryServer) pushEds(push *model.PushContext, con *XdsConnection, v
 
 // getDestinationRule gets the DestinationRule for a given hostname. As an optimization, this also gets the service port,
 // which is needed to access the traffic policy from the destination rule.
-func getDestinationRule(push *model.PushContext, proxy *model.Proxy, hostname host.Name, clusterPort int) (*networkingapi.DestinationRule, *model.Port) {
+func getDestinationRule(push *model.PushContext, proxy *model.Proxy, hostname host.Name, clusterPort int) (*model.Config, *model.Port) {
 	for _, service := range push.Services(proxy) {
 		if service.Hostname == hostname {
 			cfg := push.DestinationRule(proxy, service)
@@ -467,7 +488,7 @@ func getDestinationRule(push *model.PushContext, proxy *model.Proxy, hostname ho
 			}
 			for _, p := range service.Ports {
 				if p.Port == clusterPort {
-					return cfg.Spec.(*networkingapi.DestinationRule), p
+					return cfg, p
 				}
 			}
 		}
@@ -475,15 +496,23 @@ func getDestinationRule(push *model.PushContext, proxy *model.Proxy, hostname ho
 	return nil, nil
 }
 
-func getOutlierDetectionAndLoadBalancerSettings(push *model.PushContext, proxy *model.Proxy, clusterName string) (bool, *networkingapi.LoadBalancerSettings) {
-	_, subsetName, hostname, portNumber := model.ParseSubsetKey(clusterName)
+// getOverprovisioningFactor returns the overprovisioning factor set by the destination rule of the cluster, which
+// may be nil, if any.
+func getOverprovisioningFactor(cfg *model.Config) *wrappers.UInt32Value {
+	if cfg == nil {
+		return nil
+	}
+	return loadbalancer.GetOverprovisioningFactor(cfg.Annotations)
+}
+
+func getOutlierDetectionAndLoadBalancerSettings(cfg *model.Config, port *model.Port, subsetName string) (bool, *networkingapi.LoadBalancerSettings) {
 	var outlierDetectionEnabled = false
 	var lbSettings *networkingapi.LoadBalancerSettings
 
-	destinationRule, port := getDestinationRule(push, proxy, hostname, portNumber)
-	if destinationRule == nil || port == nil {
+	if cfg == nil || port == nil {
 		return false, nil
 	}
+	destinationRule := cfg.Spec.(*networkingapi.DestinationRule)
 
 	_, outlierDetection, loadBalancerSettings, _ := networking.SelectTrafficPolicyComponents(destinationRule.TrafficPolicy, port)
 	lbSettings = loadBalancerSettings
@@ -504,6 +533,27 @@ func getOutlierDetectionAndLoadBalancerSettings(push *model.PushContext, proxy *
 	return outlierDetectionEnabled, lbSettings
 }
 
+// EdsGenerator generates the endpoints of the watched clusters, for clients using a custom
+// generator. It uses the same endpoint shards as the default EDS code path.
+type EdsGenerator struct {
+	Server *DiscoveryServer
+}
+
+var _ model.XdsResourceGenerator = &EdsGenerator{}
+
+// Generate returns the ClusterLoadAssignments of the watched clusters.
+func (eds *EdsGenerator) Generate(proxy *model.Proxy, push *model.PushContext, w *model.WatchedResource) model.Resources {
+	resp := model.Resources{}
+	for _, clusterName := range w.ResourceNames {
+		l := eds.Server.generateEndpoints(clusterName, proxy, push, nil)
+		if l == nil {
+			continue
+		}
+		resp = append(resp, util.MessageToAny(l))
+	}
+	return resp
+}
+
 func endpointDiscoveryResponse(loadAssignments []*xdsapi.ClusterLoadAssignment, version, noncePrefix, typeURL string) *xdsapi.DiscoveryResponse {
 	out := &xdsapi.DiscoveryResponse{
 		TypeUrl: typeURL,
@@ -515,9 +565,7 @@ func endpointDiscoveryResponse(loadAssignments []*xdsapi.ClusterLoadAssignment,
 		Nonce:       nonce(noncePrefix),
 	}
 	for _, loadAssignment := range loadAssignments {
-		resource := util.MessageToAny(loadAssignment)
-		resource.TypeUrl = typeURL
-		out.Resources = append(out.Resources, resource)
+		out.Resources = append(out.Resources, resourceOfType(util.MessageToAny(loadAssignment), typeURL))
 	}
 
 	return out
@@ -90,6 +90,11 @@ func TestEds(t *testing.T) {
 	t.Run("UDSEndpoints", func(t *testing.T) {
 		testUdsEndpoints(server, adscConn, t)
 	})
+	for _, version := range xdsVersions {
+		t.Run("DirectRequest/"+version, func(t *testing.T) {
+			testDirectRequestEndpoints("127.0.0.1", version, t)
+		})
+	}
 	t.Run("PushIncremental", func(t *testing.T) {
 		edsUpdateInc(server, adscConn, t)
 	})
@@ -367,6 +372,42 @@ func testEndpoints(expected string, cluster string, adsc *adsc.ADSC, t *testing.
 	}
 }
 
+// Verify server sends the endpoint to a direct EDS request of the given xDS version, without adsc.
+func testDirectRequestEndpoints(expected string, version string, t *testing.T) {
+	t.Helper()
+	cluster := "outbound|8080||eds.test.svc.cluster.local"
+	edsstr, cancel, err := connectADSVersion(util.MockPilotGrpcAddr, version)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cancel()
+	if err := sendEDSReq([]string{cluster}, sidecarID(app3Ip, "app3"), edsstr); err != nil {
+		t.Fatal(err)
+	}
+	res, err := adsReceive(edsstr, 15*time.Second)
+	if err != nil {
+		t.Fatal("Recv failed", err)
+	}
+	cla, err := getLoadAssignment(res)
+	if err != nil {
+		t.Fatal("Invalid EDS response ", err)
+	}
+	if cla.ClusterName != cluster {
+		t.Fatalf("Expecting %s got %s", cluster, cla.ClusterName)
+	}
+	var found []string
+	for _, lbe := range cla.Endpoints {
+		for _, e := range lbe.LbEndpoints {
+			addr := e.GetEndpoint().Address.GetSocketAddress().Address
+			found = append(found, addr)
+			if expected == addr {
+				return
+			}
+		}
+	}
+	t.Errorf("Expecting %s got %v", expected, found)
+}
+
 func testLocalityPrioritizedEndpoints(adsc *adsc.ADSC, adsc2 *adsc.ADSC, t *testing.T) {
 	endpoints1 := adsc.GetEndpoints()
 	endpoints2 := adsc2.GetEndpoints()
@@ -47,6 +47,7 @@ func (s *DiscoveryServer) handleReqAck(con *XdsConnection, discReq *xdsapi.Disco
 	con.mu.RUnlock()
 
 	if discReq.ErrorDetail != nil {
+		// The NACK is recorded in the connection's NACK history by handleAckState.
 		errCode := codes.Code(discReq.ErrorDetail.Code)
 		adsLog.Warnf("ADS: ACK ERROR %s %s:%s", con.ConID, errCode.String(), discReq.ErrorDetail.GetMessage())
 		return w, true
@@ -99,7 +100,7 @@ func (s *DiscoveryServer) handleCustomGenerator(con *XdsConnection, req *xdsapi.
 		Nonce:       nonce(push.Version),
 	}
 
-	cl := con.node.XdsResourceGenerator.Generate(con.node, push, w)
+	cl := s.findGenerator(con.node, w.TypeUrl).Generate(con.node, push, w)
 	sz := 0
 	for _, rc := range cl {
 		resp.Resources = append(resp.Resources, rc)
@@ -128,7 +129,11 @@ func (s *DiscoveryServer) handleCustomGenerator(con *XdsConnection, req *xdsapi.
 func (s *DiscoveryServer) pushGeneratorV2(con *XdsConnection, push *model.PushContext, currentVersion string, w *model.WatchedResource) error {
 	// TODO: generators may send incremental changes if both sides agree on the protocol.
 	// This is specific to each generator type.
-	cl := con.node.XdsResourceGenerator.Generate(con.node, push, w)
+	gen := s.findGenerator(con.node, w.TypeUrl)
+	if gen == nil {
+		return nil
+	}
+	cl := gen.Generate(con.node, push, w)
 	if cl == nil {
 		return nil // No push needed.
 	}
@@ -160,6 +165,6 @@ func (s *DiscoveryServer) pushGeneratorV2(con *XdsConnection, push *model.PushCo
 	w.LastSize = sz // just resource size - doesn't include header and types
 	w.NonceSent = resp.Nonce
 
-	adsLog.Infof("XDS: PUSH for node:%s listeners:%d", con.node.ID, len(cl))
+	adsLog.Infof("XDS: PUSH for node:%s type:%s resources:%d", con.node.ID, w.TypeUrl, len(cl))
 	return nil
 }
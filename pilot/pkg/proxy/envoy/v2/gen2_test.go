@@ -0,0 +1,153 @@
+// Copyright 2020 Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package v2_test
+
+import (
+	"testing"
+	"time"
+
+	xdsapi "github.com/envoyproxy/go-control-plane/envoy/api/v2"
+	core "github.com/envoyproxy/go-control-plane/envoy/api/v2/core"
+	http_conn "github.com/envoyproxy/go-control-plane/envoy/config/filter/network/http_connection_manager/v2"
+	ads "github.com/envoyproxy/go-control-plane/envoy/service/discovery/v2"
+	"github.com/golang/protobuf/ptypes"
+	structpb "github.com/golang/protobuf/ptypes/struct"
+
+	v2 "istio.io/istio/pilot/pkg/proxy/envoy/v2"
+	"istio.io/istio/pkg/adsc"
+	"istio.io/istio/pkg/config/schema/collections"
+	"istio.io/istio/tests/util"
+)
+
+func grpcRequest(t *testing.T, client ads.AggregatedDiscoveryService_StreamAggregatedResourcesClient,
+	typeURL string, names ...string) *xdsapi.DiscoveryResponse {
+	t.Helper()
+	err := client.Send(&xdsapi.DiscoveryRequest{
+		Node: &core.Node{
+			Id: sidecarID(app3Ip, "grpc"),
+			Metadata: &structpb.Struct{Fields: map[string]*structpb.Value{
+				"ISTIO_VERSION": {Kind: &structpb.Value_StringValue{StringValue: "1.3"}},
+				"GENERATOR":     {Kind: &structpb.Value_StringValue{StringValue: v2.GrpcGenerator}},
+			}},
+		},
+		TypeUrl:       typeURL,
+		ResourceNames: names,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	res, err := adsReceive(client, 15*time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.TypeUrl != typeURL {
+		t.Fatalf("expected %s response, got %s", typeURL, res.TypeUrl)
+	}
+	return res
+}
+
+func TestGrpcGenerator(t *testing.T) {
+	_, tearDown := initLocalPilotTestEnv(t)
+	defer tearDown()
+
+	client, cancel, err := connectADS(util.MockPilotGrpcAddr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cancel()
+
+	target := "hello.default.svc.cluster.local:80"
+	cluster := "outbound|80||hello.default.svc.cluster.local"
+
+	lds := grpcRequest(t, client, v2.ListenerType, target)
+	if len(lds.Resources) != 1 {
+		t.Fatalf("expected a single listener, got %v", lds.Resources)
+	}
+	l := &xdsapi.Listener{}
+	if err := ptypes.UnmarshalAny(lds.Resources[0], l); err != nil {
+		t.Fatal(err)
+	}
+	hcm := &http_conn.HttpConnectionManager{}
+	if err := ptypes.UnmarshalAny(l.GetApiListener().GetApiListener(), hcm); err != nil {
+		t.Fatal(err)
+	}
+	if l.Name != target || hcm.GetRds().GetRouteConfigName() != target {
+		t.Fatalf("unexpected listener %v", l)
+	}
+
+	rds := grpcRequest(t, client, v2.RouteType, target)
+	if len(rds.Resources) != 1 {
+		t.Fatalf("expected a single route, got %v", rds.Resources)
+	}
+	r := &xdsapi.RouteConfiguration{}
+	if err := ptypes.UnmarshalAny(rds.Resources[0], r); err != nil {
+		t.Fatal(err)
+	}
+	if got := r.VirtualHosts[0].Routes[0].GetRoute().GetCluster(); got != cluster {
+		t.Fatalf("expected route to %s, got %s", cluster, got)
+	}
+
+	cds := grpcRequest(t, client, v2.ClusterType, cluster)
+	if len(cds.Resources) != 1 {
+		t.Fatalf("expected a single cluster, got %v", cds.Resources)
+	}
+
+	// Endpoints use the registered EDS generator.
+	eds := grpcRequest(t, client, v2.EndpointType, cluster)
+	if len(eds.Resources) != 1 {
+		t.Fatalf("expected a single load assignment, got %v", eds.Resources)
+	}
+	cla := &xdsapi.ClusterLoadAssignment{}
+	if err := ptypes.UnmarshalAny(eds.Resources[0], cla); err != nil {
+		t.Fatal(err)
+	}
+	if cla.ClusterName != cluster || len(cla.Endpoints) == 0 {
+		t.Fatalf("unexpected endpoints %v", cla)
+	}
+}
+
+func TestAPIGenerator(t *testing.T) {
+	_, tearDown := initLocalPilotTestEnv(t)
+	defer tearDown()
+
+	client, err := adsc.Dial(util.MockPilotGrpcAddr, "", &adsc.Config{
+		IP: app3Ip,
+		Meta: &structpb.Struct{Fields: map[string]*structpb.Value{
+			"ISTIO_VERSION": {Kind: &structpb.Value_StringValue{StringValue: "1.3"}},
+			"GENERATOR":     {Kind: &structpb.Value_StringValue{StringValue: v2.APIGenerator}},
+		}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+
+	vs := collections.IstioNetworkingV1Alpha3Virtualservices.Resource().GroupVersionKind()
+	client.WatchConfig(vs.String())
+	if _, err := client.Wait(10*time.Second, vs.String()); err != nil {
+		t.Fatal(err)
+	}
+	configs, err := client.Store.List(vs, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(configs) == 0 {
+		t.Fatal("expected virtual services")
+	}
+	for _, c := range configs {
+		if c.Name == "" || c.Namespace == "" || c.Spec == nil {
+			t.Errorf("incomplete config %v", c)
+		}
+	}
+}
@@ -27,10 +27,13 @@ import (
 	"istio.io/istio/pilot/pkg/model"
 
 	v2 "istio.io/istio/pilot/pkg/proxy/envoy/v2"
+	v3 "istio.io/istio/pilot/pkg/proxy/envoy/v3"
 
 	xdsapi "github.com/envoyproxy/go-control-plane/envoy/api/v2"
 	core "github.com/envoyproxy/go-control-plane/envoy/api/v2/core"
 	ads "github.com/envoyproxy/go-control-plane/envoy/service/discovery/v2"
+	discovery "github.com/envoyproxy/go-control-plane/envoy/service/discovery/v3"
+	"github.com/golang/protobuf/proto"
 	"google.golang.org/genproto/googleapis/rpc/status"
 	"google.golang.org/grpc"
 
@@ -80,6 +83,92 @@ func connectADS(url string) (ads.AggregatedDiscoveryService_StreamAggregatedReso
 	}, nil
 }
 
+// xdsVersions are the versions of the ADS service the tests run against.
+var xdsVersions = []string{"v2", "v3"}
+
+// connectADSVersion connects to the ADS service of the given version. The returned client uses the
+// v2 API in both cases, see v3Client.
+func connectADSVersion(url, version string) (ads.AggregatedDiscoveryService_StreamAggregatedResourcesClient, util.TearDownFunc, error) {
+	if version != "v3" {
+		return connectADS(url)
+	}
+	conn, err := grpc.Dial(url, grpc.WithInsecure(), grpc.WithBlock())
+	if err != nil {
+		return nil, nil, fmt.Errorf("GRPC dial failed: %s", err)
+	}
+	xds := discovery.NewAggregatedDiscoveryServiceClient(conn)
+	client, err := xds.StreamAggregatedResources(context.Background())
+	if err != nil {
+		return nil, nil, fmt.Errorf("stream resources failed: %s", err)
+	}
+
+	return &v3Client{client}, func() {
+		_ = client.CloseSend()
+		_ = conn.Close()
+	}, nil
+}
+
+var v3Types = map[string]string{
+	v2.ClusterType:  v3.ClusterType,
+	v2.ListenerType: v3.ListenerType,
+	v2.RouteType:    v3.RouteType,
+	v2.EndpointType: v3.EndpointType,
+}
+
+// v3Client runs the v2 test clients against the v3 ADS service. Requests for v2 types are sent as
+// requests for the v3 types. Responses must hold v3 resources, which are then presented as the
+// wire compatible v2 resources.
+type v3Client struct {
+	discovery.AggregatedDiscoveryService_StreamAggregatedResourcesClient
+}
+
+func (c *v3Client) Send(req *xdsapi.DiscoveryRequest) error {
+	out := &discovery.DiscoveryRequest{}
+	if err := convertMessage(req, out); err != nil {
+		return err
+	}
+	if t, f := v3Types[out.TypeUrl]; f {
+		out.TypeUrl = t
+	}
+	return c.AggregatedDiscoveryService_StreamAggregatedResourcesClient.Send(out)
+}
+
+func (c *v3Client) Recv() (*xdsapi.DiscoveryResponse, error) {
+	res, err := c.AggregatedDiscoveryService_StreamAggregatedResourcesClient.Recv()
+	if err != nil {
+		return nil, err
+	}
+	out := &xdsapi.DiscoveryResponse{}
+	if err := convertMessage(res, out); err != nil {
+		return nil, err
+	}
+	for v2Type, v3Type := range v3Types {
+		if res.TypeUrl != v3Type {
+			continue
+		}
+		out.TypeUrl = v2Type
+		for _, r := range out.Resources {
+			if r.TypeUrl != v3Type {
+				return nil, fmt.Errorf("expected %s resource, got %s", v3Type, r.TypeUrl)
+			}
+			var msg ptypes.DynamicAny
+			if err := ptypes.UnmarshalAny(r, &msg); err != nil {
+				return nil, err
+			}
+			r.TypeUrl = v2Type
+		}
+	}
+	return out, nil
+}
+
+func convertMessage(from, to proto.Message) error {
+	b, err := proto.Marshal(from)
+	if err != nil {
+		return err
+	}
+	return proto.Unmarshal(b, to)
+}
+
 func adsReceive(ads ads.AggregatedDiscoveryService_StreamAggregatedResourcesClient, to time.Duration) (*xdsapi.DiscoveryResponse, error) {
 	done := make(chan int, 1)
 	t := time.NewTimer(to)
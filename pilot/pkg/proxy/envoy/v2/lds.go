@@ -58,9 +58,7 @@ func ldsDiscoveryResponse(ls []*xdsapi.Listener, version, noncePrefix, typeURL s
 			totalXDSInternalErrors.Increment()
 			continue
 		}
-		lr := util.MessageToAny(ll)
-		lr.TypeUrl = typeURL
-		resp.Resources = append(resp.Resources, lr)
+		resp.Resources = append(resp.Resources, resourceOfType(util.MessageToAny(ll), typeURL))
 	}
 
 	return resp
@@ -310,61 +310,63 @@ func TestLDSWithIngressGateway(t *testing.T) {
 	}
 }
 
-// TestLDS is running LDSv2 tests.
+// TestLDS is running the LDS tests for each xDS version.
 func TestLDS(t *testing.T) {
 	_, tearDown := initLocalPilotTestEnv(t)
 	defer tearDown()
 
-	t.Run("sidecar", func(t *testing.T) {
-		ldsr, cancel, err := connectADS(util.MockPilotGrpcAddr)
-		if err != nil {
-			t.Fatal(err)
-		}
-		defer cancel()
-		err = sendLDSReq(sidecarID(app3Ip, "app3"), ldsr)
-		if err != nil {
-			t.Fatal(err)
-		}
+	for _, version := range xdsVersions {
+		t.Run(version+"/sidecar", func(t *testing.T) {
+			ldsr, cancel, err := connectADSVersion(util.MockPilotGrpcAddr, version)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer cancel()
+			err = sendLDSReq(sidecarID(app3Ip, "app3"), ldsr)
+			if err != nil {
+				t.Fatal(err)
+			}
 
-		res, err := ldsr.Recv()
-		if err != nil {
-			t.Fatal("Failed to receive LDS", err)
-			return
-		}
+			res, err := ldsr.Recv()
+			if err != nil {
+				t.Fatal("Failed to receive LDS", err)
+				return
+			}
 
-		strResponse, _ := gogoprotomarshal.ToJSONWithIndent(res, " ")
-		_ = ioutil.WriteFile(env.IstioOut+"/ldsv2_sidecar.json", []byte(strResponse), 0644)
+			strResponse, _ := gogoprotomarshal.ToJSONWithIndent(res, " ")
+			_ = ioutil.WriteFile(env.IstioOut+"/lds"+version+"_sidecar.json", []byte(strResponse), 0644)
 
-		if len(res.Resources) == 0 {
-			t.Fatal("No response")
-		}
-	})
+			if len(res.Resources) == 0 {
+				t.Fatal("No response")
+			}
+		})
 
-	// 'router' or 'gateway' type of listener
-	t.Run("gateway", func(t *testing.T) {
-		ldsr, cancel, err := connectADS(util.MockPilotGrpcAddr)
-		if err != nil {
-			t.Fatal(err)
-		}
-		defer cancel()
-		err = sendLDSReqWithLabels(gatewayID(gatewayIP), ldsr, map[string]string{"version": "v2", "app": "my-gateway-controller"})
-		if err != nil {
-			t.Fatal(err)
-		}
+		// 'router' or 'gateway' type of listener
+		t.Run(version+"/gateway", func(t *testing.T) {
+			ldsr, cancel, err := connectADSVersion(util.MockPilotGrpcAddr, version)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer cancel()
+			err = sendLDSReqWithLabels(gatewayID(gatewayIP), ldsr, map[string]string{"version": "v2", "app": "my-gateway-controller"})
+			if err != nil {
+				t.Fatal(err)
+			}
 
-		res, err := ldsr.Recv()
-		if err != nil {
-			t.Fatal("Failed to receive LDS", err)
-		}
+			res, err := ldsr.Recv()
+			if err != nil {
+				t.Fatal("Failed to receive LDS", err)
+			}
 
-		strResponse, _ := gogoprotomarshal.ToJSONWithIndent(res, " ")
+			strResponse, _ := gogoprotomarshal.ToJSONWithIndent(res, " ")
 
-		_ = ioutil.WriteFile(env.IstioOut+"/ldsv2_gateway.json", []byte(strResponse), 0644)
+			_ = ioutil.WriteFile(env.IstioOut+"/lds"+version+"_gateway.json", []byte(strResponse), 0644)
 
-		if len(res.Resources) == 0 {
-			t.Fatal("No response")
-		}
-	})
+			if len(res.Resources) == 0 {
+				t.Fatal("No response")
+			}
+		})
+	}
 
 	// TODO: compare with some golden once it's stable
 	// check that each mocked service and destination rule has a corresponding resource
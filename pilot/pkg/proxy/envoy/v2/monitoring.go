@@ -28,6 +28,8 @@ var (
 	nodeTag    = monitoring.MustCreateLabel("node")
 	typeTag    = monitoring.MustCreateLabel("type")
 
+	priorityTag = monitoring.MustCreateLabel("priority")
+
 	cdsReject = monitoring.NewGauge(
 		"pilot_xds_cds_reject",
 		"Pilot rejected CDS configs.",
@@ -129,6 +131,42 @@ var (
 		[]float64{.1, 1, 3, 5, 10, 20, 30},
 	)
 
+	deltaResources = monitoring.NewDistribution(
+		"pilot_xds_delta_resources",
+		"Number of resources included in incremental (delta) XDS responses.",
+		[]float64{1, 10, 100, 1000, 10000},
+	)
+
+	nackRollbacks = monitoring.NewSum(
+		"pilot_xds_nack_rollbacks",
+		"Total number of rejected resources replaced by their last accepted version, by type.",
+		monitoring.WithLabels(typeTag),
+	)
+
+	pushQueueDepth = monitoring.NewGauge(
+		"pilot_push_queue_depth",
+		"Number of proxies waiting in the push queue, by push priority.",
+		monitoring.WithLabels(priorityTag),
+	)
+
+	pushQueueWaitTime = monitoring.NewDistribution(
+		"pilot_push_queue_wait_time",
+		"Time in seconds a proxy waits in the push queue before being dequeued, by push priority.",
+		[]float64{.1, 1, 3, 5, 10, 20, 30},
+		monitoring.WithLabels(priorityTag),
+	)
+
+	debounceWindow = monitoring.NewGauge(
+		"pilot_debounce_window",
+		"Debounce quiet period in seconds chosen by adaptive debouncing.",
+	)
+
+	debouncedPushes = monitoring.NewSum(
+		"pilot_debounce_pushes",
+		"Total number of debounced pushes, labeled by the reason for the debounce quiet period in use.",
+		monitoring.WithLabels(typeTag),
+	)
+
 	pushTriggers = monitoring.NewSum(
 		"pilot_push_triggers",
 		"Total number of times a push was triggered, labeled by reason for the push.",
@@ -206,5 +244,11 @@ func init() {
 		totalXDSInternalErrors,
 		inboundUpdates,
 		pushTriggers,
+		deltaResources,
+		nackRollbacks,
+		pushQueueDepth,
+		pushQueueWaitTime,
+		debounceWindow,
+		debouncedPushes,
 	)
 }
@@ -0,0 +1,355 @@
+// Copyright 2020 Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package v2
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	xdsapi "github.com/envoyproxy/go-control-plane/envoy/api/v2"
+	"github.com/golang/protobuf/ptypes/any"
+	"google.golang.org/grpc/codes"
+
+	"istio.io/istio/pilot/pkg/features"
+	"istio.io/istio/pilot/pkg/model"
+	v3 "istio.io/istio/pilot/pkg/proxy/envoy/v3"
+)
+
+// maxNackHistory is the number of NACKs kept for each connection.
+const maxNackHistory = 20
+
+// enableNackRollback is a package variable so tests can enable it.
+var enableNackRollback = features.EnableNackRollback
+
+// NackRecord describes a response rejected by a proxy.
+type NackRecord struct {
+	Time    time.Time `json:"time"`
+	TypeURL string    `json:"type_url"`
+	// Version and Nonce identify the rejected response.
+	Version string `json:"version"`
+	Nonce   string `json:"nonce"`
+	// ErrorCode and ErrorMessage are the error detail reported by the proxy.
+	ErrorCode    string `json:"error_code"`
+	ErrorMessage string `json:"error_message"`
+	// ResourceNames are the resources of the response that changed since the last accepted response,
+	// narrowed down to the ones named in the error message if any. Resource versions are only tracked
+	// when rollback is enabled: otherwise all the resources of the response are considered changed.
+	ResourceNames []string `json:"resource_names,omitempty"`
+	// Configs are the configs updated by the push that generated the response. Empty for responses
+	// to a request, and for full pushes not triggered by specific configs.
+	Configs []string `json:"configs,omitempty"`
+}
+
+// NackStatus is the NACK history of a proxy connected to this Pilot instance.
+type NackStatus struct {
+	ProxyID string       `json:"proxy"`
+	Nacks   []NackRecord `json:"nacks"`
+	// RolledBack lists, by type, the resources currently sent at their last accepted version.
+	RolledBack map[string][]string `json:"rolled_back,omitempty"`
+}
+
+// nackState tracks the responses of a single type sent on a connection, so NACKs can be attributed
+// to the resources that caused them.
+type nackState struct {
+	// sentNonce, sentVersion and sentConfigs describe the last response sent.
+	sentNonce   string
+	sentVersion string
+	sentConfigs []string
+	// sent and acked map resource names to the content version in the last response sent, and in the
+	// responses accepted by the proxy. Versions are hashes of the resources, only computed when rollback
+	// is enabled; otherwise they are empty.
+	sent  map[string]string
+	acked map[string]string
+
+	// The following are only populated when rollback is enabled.
+
+	// sentResources and ackedResources hold the resources matching sent and acked.
+	sentResources  map[string]*any.Any
+	ackedResources map[string]*any.Any
+	// rejected maps the resources rejected by the proxy to the rejected version. The last accepted
+	// version is sent instead, until the resource is generated with different content.
+	rejected map[string]string
+
+	// lastNackNonce is the nonce of the last rejected response.
+	lastNackNonce string
+}
+
+func newNackState() *nackState {
+	return &nackState{
+		sent:           map[string]string{},
+		acked:          map[string]string{},
+		sentResources:  map[string]*any.Any{},
+		ackedResources: map[string]*any.Any{},
+		rejected:       map[string]string{},
+	}
+}
+
+// isWildcardType returns true for types where every response holds the complete set of resources.
+func isWildcardType(typeURL string) bool {
+	switch typeURL {
+	case ClusterType, v3.ClusterType, ListenerType, v3.ListenerType:
+		return true
+	}
+	return false
+}
+
+// rollback replaces the rejected resources that are generated again with the same content by their
+// last accepted version. Resources that were never accepted are left out. Rejected resources
+// generated with a new content are sent as is, as the new version may fix the error.
+func (n *nackState) rollback(typeURL string, resources []*any.Any) []*any.Any {
+	if len(n.rejected) == 0 {
+		return resources
+	}
+	out := make([]*any.Any, 0, len(resources))
+	generated := make(map[string]struct{}, len(resources))
+	for _, r := range resources {
+		name := resourceName(r)
+		generated[name] = struct{}{}
+		rejectedVersion, f := n.rejected[name]
+		if !f {
+			out = append(out, r)
+			continue
+		}
+		if resourceVersion(r) != rejectedVersion {
+			delete(n.rejected, name)
+			out = append(out, r)
+			continue
+		}
+		nackRollbacks.With(typeTag.Value(typeURL)).Increment()
+		if acked := n.ackedResources[name]; acked != nil {
+			out = append(out, acked)
+		}
+	}
+	if isWildcardType(typeURL) {
+		for name := range n.rejected {
+			if _, f := generated[name]; !f {
+				delete(n.rejected, name)
+			}
+		}
+	}
+	return out
+}
+
+// recordSent records the response about to be sent, after rolling back rejected resources.
+func (n *nackState) recordSent(res *xdsapi.DiscoveryResponse, configs map[model.ConfigKey]struct{}) {
+	if enableNackRollback {
+		res.Resources = n.rollback(res.TypeUrl, res.Resources)
+	}
+	n.sentNonce = res.Nonce
+	n.sentVersion = res.VersionInfo
+	n.sentConfigs = configNames(configs)
+	n.sent = make(map[string]string, len(res.Resources))
+	n.sentResources = map[string]*any.Any{}
+	for _, r := range res.Resources {
+		name := resourceName(r)
+		if !enableNackRollback {
+			// Hashing every resource on the push path is only worth it for rollback.
+			n.sent[name] = ""
+			continue
+		}
+		n.sent[name] = resourceVersion(r)
+		n.sentResources[name] = r
+	}
+}
+
+// ack records the last sent response as accepted.
+func (n *nackState) ack(typeURL string) {
+	if isWildcardType(typeURL) {
+		n.acked = n.sent
+		n.ackedResources = n.sentResources
+		return
+	}
+	// Other types may be pushed incrementally, the response only holds the updated resources.
+	for name, version := range n.sent {
+		n.acked[name] = version
+	}
+	for name, r := range n.sentResources {
+		n.ackedResources[name] = r
+	}
+}
+
+// nack records the last sent response as rejected, and returns the suspected resources.
+func (n *nackState) nack(errorMessage string) []string {
+	n.lastNackNonce = n.sentNonce
+	var changed, named []string
+	for name, version := range n.sent {
+		if enableNackRollback && n.acked[name] == version {
+			continue
+		}
+		changed = append(changed, name)
+		if name != "" && strings.Contains(errorMessage, name) {
+			named = append(named, name)
+		}
+	}
+	suspects := changed
+	if len(named) > 0 {
+		suspects = named
+	}
+	sort.Strings(suspects)
+	if enableNackRollback {
+		for _, name := range suspects {
+			n.rejected[name] = n.sent[name]
+		}
+	}
+	return suspects
+}
+
+// rolledBack returns the resources currently sent at their last accepted version.
+func (n *nackState) rolledBack() []string {
+	out := make([]string, 0, len(n.rejected))
+	for name := range n.rejected {
+		out = append(out, name)
+	}
+	sort.Strings(out)
+	return out
+}
+
+func configNames(configs map[model.ConfigKey]struct{}) []string {
+	if len(configs) == 0 {
+		return nil
+	}
+	out := make([]string, 0, len(configs))
+	for key := range configs {
+		out = append(out, fmt.Sprintf("%s/%s/%s", key.Kind.Kind, key.Namespace, key.Name))
+	}
+	sort.Strings(out)
+	return out
+}
+
+// nackState returns the state for the type, creating it if needed. Must be called with mu held.
+func (conn *XdsConnection) nackState(typeURL string) *nackState {
+	n := conn.nackStates[typeURL]
+	if n == nil {
+		n = newNackState()
+		conn.nackStates[typeURL] = n
+	}
+	return n
+}
+
+// lastNack returns the nonce of the last rejected response of any of the types.
+func (conn *XdsConnection) lastNack(typeURLs ...string) string {
+	for _, t := range typeURLs {
+		if n := conn.nackStates[t]; n != nil && n.lastNackNonce != "" {
+			return n.lastNackNonce
+		}
+	}
+	return ""
+}
+
+// handleAckState updates the NACK tracking state for the request, recording it in the connection's
+// NACK history if it rejects the last response. It returns true if rejected resources are now
+// rolled back, and the type should be pushed again.
+func (s *DiscoveryServer) handleAckState(con *XdsConnection, discReq *xdsapi.DiscoveryRequest) bool {
+	if discReq.ResponseNonce == "" {
+		return false
+	}
+	con.mu.Lock()
+	defer con.mu.Unlock()
+	n := con.nackStates[discReq.TypeUrl]
+	if n == nil || n.sentNonce != discReq.ResponseNonce {
+		// Initial request, or a response to an expired nonce.
+		return false
+	}
+	if discReq.ErrorDetail == nil {
+		n.ack(discReq.TypeUrl)
+		return false
+	}
+
+	rolledBack := len(n.rejected)
+	record := NackRecord{
+		Time:          time.Now(),
+		TypeURL:       discReq.TypeUrl,
+		Version:       n.sentVersion,
+		Nonce:         n.sentNonce,
+		ErrorCode:     codes.Code(discReq.ErrorDetail.Code).String(),
+		ErrorMessage:  discReq.ErrorDetail.GetMessage(),
+		ResourceNames: n.nack(discReq.ErrorDetail.GetMessage()),
+		Configs:       n.sentConfigs,
+	}
+	con.nackHistory = append(con.nackHistory, record)
+	if len(con.nackHistory) > maxNackHistory {
+		con.nackHistory = con.nackHistory[len(con.nackHistory)-maxNackHistory:]
+	}
+	adsLog.Warnf("ADS: NACK %s %s version:%s resources:%v configs:%v", con.ConID, discReq.TypeUrl,
+		record.Version, record.ResourceNames, record.Configs)
+	return len(n.rejected) > rolledBack
+}
+
+// pushRolledBack pushes the type again after rejected resources were rolled back, so the proxy gets
+// the other changes of the rejected response.
+func (s *DiscoveryServer) pushRolledBack(con *XdsConnection, typeURL string) error {
+	push := s.globalPushContext()
+	if s.findGenerator(con.node, typeURL) != nil {
+		if w := con.node.Active[typeURL]; w != nil {
+			return s.pushGeneratorV2(con, push, versionInfo(), w)
+		}
+		return nil
+	}
+	switch typeURL {
+	case ClusterType, v3.ClusterType:
+		return s.pushCds(con, push, versionInfo())
+	case ListenerType, v3.ListenerType:
+		return s.pushLds(con, push, versionInfo())
+	case RouteType, v3.RouteType:
+		return s.pushRoute(con, push, versionInfo())
+	case EndpointType, v3.EndpointType:
+		return s.pushEds(push, con, versionInfo(), nil)
+	}
+	return nil
+}
+
+// nackz dumps the NACK history of the proxies connected to this Pilot instance. The proxyID query
+// parameter restricts the output to a single proxy.
+func (s *DiscoveryServer) nackz(w http.ResponseWriter, req *http.Request) {
+	proxyID := req.URL.Query().Get("proxyID")
+	nackz := make([]NackStatus, 0)
+	s.adsClientsMutex.RLock()
+	for _, con := range s.adsClients {
+		con.mu.RLock()
+		if con.node != nil && (proxyID == "" || strings.Contains(con.node.ID, proxyID)) {
+			status := NackStatus{
+				ProxyID: con.node.ID,
+				Nacks:   append([]NackRecord{}, con.nackHistory...),
+			}
+			for typeURL, n := range con.nackStates {
+				if len(n.rejected) == 0 {
+					continue
+				}
+				if status.RolledBack == nil {
+					status.RolledBack = map[string][]string{}
+				}
+				status.RolledBack[typeURL] = n.rolledBack()
+			}
+			nackz = append(nackz, status)
+		}
+		con.mu.RUnlock()
+	}
+	s.adsClientsMutex.RUnlock()
+	sort.Slice(nackz, func(i, j int) bool {
+		return nackz[i].ProxyID < nackz[j].ProxyID
+	})
+	out, err := json.MarshalIndent(&nackz, "", "    ")
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		_, _ = fmt.Fprintf(w, "unable to marshal nackz information: %v", err)
+		return
+	}
+	w.Header().Add("Content-Type", "application/json")
+	_, _ = w.Write(out)
+}
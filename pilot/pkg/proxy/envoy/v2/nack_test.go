@@ -0,0 +1,161 @@
+// Copyright 2020 Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package v2
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	xdsapi "github.com/envoyproxy/go-control-plane/envoy/api/v2"
+	"github.com/golang/protobuf/ptypes"
+	"github.com/golang/protobuf/ptypes/any"
+	"google.golang.org/genproto/googleapis/rpc/status"
+
+	"istio.io/istio/pilot/pkg/model"
+	"istio.io/istio/pilot/pkg/networking/util"
+)
+
+func testCluster(name string, timeout time.Duration) *any.Any {
+	return util.MessageToAny(&xdsapi.Cluster{Name: name, ConnectTimeout: ptypes.DurationProto(timeout)})
+}
+
+func clusterNames(t *testing.T, resources []*any.Any) map[string]time.Duration {
+	t.Helper()
+	out := map[string]time.Duration{}
+	for _, r := range resources {
+		c := &xdsapi.Cluster{}
+		if err := ptypes.UnmarshalAny(r, c); err != nil {
+			t.Fatal(err)
+		}
+		d, _ := ptypes.Duration(c.ConnectTimeout)
+		out[c.Name] = d
+	}
+	return out
+}
+
+func TestNackHistoryAndRollback(t *testing.T) {
+	defer func(v bool) { enableNackRollback = v }(enableNackRollback)
+	enableNackRollback = true
+
+	s := &DiscoveryServer{}
+	con := newXdsConnection("", nil)
+	con.ConID = "test-1"
+
+	send := func(nonce string, configs map[model.ConfigKey]struct{}, resources ...*any.Any) *xdsapi.DiscoveryResponse {
+		res := &xdsapi.DiscoveryResponse{TypeUrl: ClusterType, VersionInfo: "v-" + nonce, Nonce: nonce, Resources: resources}
+		con.pushConfigs = configs
+		con.nackState(ClusterType).recordSent(res, con.pushConfigs)
+		con.pushConfigs = nil
+		return res
+	}
+	ack := func(nonce string) bool {
+		return s.handleAckState(con, &xdsapi.DiscoveryRequest{TypeUrl: ClusterType, ResponseNonce: nonce})
+	}
+	nack := func(nonce, msg string) bool {
+		return s.handleAckState(con, &xdsapi.DiscoveryRequest{
+			TypeUrl:       ClusterType,
+			ResponseNonce: nonce,
+			ErrorDetail:   &status.Status{Code: 3, Message: msg},
+		})
+	}
+
+	send("1", nil, testCluster("cluster-a", time.Second), testCluster("cluster-b", time.Second))
+	if ack("1") {
+		t.Fatal("ACK should not trigger a push")
+	}
+
+	// A push changing both clusters is rejected because of b.
+	dr := map[model.ConfigKey]struct{}{{Kind: model.DestinationRuleKind, Name: "b", Namespace: "default"}: {}}
+	send("2", dr, testCluster("cluster-a", 2*time.Second), testCluster("cluster-b", -time.Second), testCluster("cluster-c", time.Second))
+	if !nack("2", "cluster-b: invalid connect timeout") {
+		t.Fatal("expected rollback push")
+	}
+	want := NackRecord{
+		TypeURL:       ClusterType,
+		Version:       "v-2",
+		Nonce:         "2",
+		ErrorCode:     "InvalidArgument",
+		ErrorMessage:  "cluster-b: invalid connect timeout",
+		ResourceNames: []string{"cluster-b"},
+		Configs:       []string{"DestinationRule/default/b"},
+	}
+	if len(con.nackHistory) != 1 {
+		t.Fatalf("expected a single NACK, got %v", con.nackHistory)
+	}
+	got := con.nackHistory[0]
+	got.Time = time.Time{}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("got NACK %+v, want %+v", got, want)
+	}
+	if con.lastNack(ClusterType) != "2" {
+		t.Fatalf("unexpected last NACK nonce %q", con.lastNack(ClusterType))
+	}
+
+	// The next response has the other changes, and the last accepted version of b.
+	res := send("3", nil, testCluster("cluster-a", 2*time.Second), testCluster("cluster-b", -time.Second), testCluster("cluster-c", time.Second))
+	expected := map[string]time.Duration{"cluster-a": 2 * time.Second, "cluster-b": time.Second, "cluster-c": time.Second}
+	if got := clusterNames(t, res.Resources); !reflect.DeepEqual(got, expected) {
+		t.Fatalf("got clusters %v, want %v", got, expected)
+	}
+	ack("3")
+
+	// A new version of b is sent again.
+	res = send("4", nil, testCluster("cluster-a", 2*time.Second), testCluster("cluster-b", 3*time.Second), testCluster("cluster-c", time.Second))
+	expected = map[string]time.Duration{"cluster-a": 2 * time.Second, "cluster-b": 3 * time.Second, "cluster-c": time.Second}
+	if got := clusterNames(t, res.Resources); !reflect.DeepEqual(got, expected) {
+		t.Fatalf("got clusters %v, want %v", got, expected)
+	}
+	if rolledBack := con.nackState(ClusterType).rolledBack(); len(rolledBack) != 0 {
+		t.Fatalf("unexpected rolled back resources %v", rolledBack)
+	}
+
+	// Responses to expired nonces are ignored.
+	if nack("3", "stale") || len(con.nackHistory) != 1 {
+		t.Fatalf("expired NACK should be ignored, got %v", con.nackHistory)
+	}
+}
+
+func TestNackWithoutRollback(t *testing.T) {
+	defer func(v bool) { enableNackRollback = v }(enableNackRollback)
+	enableNackRollback = false
+
+	s := &DiscoveryServer{}
+	con := newXdsConnection("", nil)
+	n := con.nackState(ClusterType)
+	n.recordSent(&xdsapi.DiscoveryResponse{TypeUrl: ClusterType, Nonce: "1", Resources: []*any.Any{testCluster("cluster-a", time.Second)}}, nil)
+	s.handleAckState(con, &xdsapi.DiscoveryRequest{TypeUrl: ClusterType, ResponseNonce: "1"})
+
+	n.recordSent(&xdsapi.DiscoveryResponse{TypeUrl: ClusterType, Nonce: "2", Resources: []*any.Any{
+		testCluster("cluster-a", time.Second), testCluster("cluster-b", time.Second)}}, nil)
+	if s.handleAckState(con, &xdsapi.DiscoveryRequest{
+		TypeUrl:       ClusterType,
+		ResponseNonce: "2",
+		ErrorDetail:   &status.Status{Message: "unknown error"},
+	}) {
+		t.Fatal("no push expected without rollback")
+	}
+	// Without rollback the resource versions are not tracked, so all the resources of the response are
+	// suspected, even the unchanged cluster-a.
+	if got := con.nackHistory[0].ResourceNames; !reflect.DeepEqual(got, []string{"cluster-a", "cluster-b"}) {
+		t.Fatalf("got suspected resources %v", got)
+	}
+
+	res := &xdsapi.DiscoveryResponse{TypeUrl: ClusterType, Nonce: "3", Resources: []*any.Any{testCluster("cluster-a", -time.Second)}}
+	n.recordSent(res, nil)
+	if got := clusterNames(t, res.Resources); got["cluster-a"] != -time.Second {
+		t.Fatalf("resources should not be rolled back, got %v", got)
+	}
+}
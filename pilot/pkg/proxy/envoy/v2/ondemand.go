@@ -0,0 +1,388 @@
+// Copyright 2020 Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package v2
+
+import (
+	"sort"
+	"strings"
+	"time"
+
+	xdsapi "github.com/envoyproxy/go-control-plane/envoy/api/v2"
+	core "github.com/envoyproxy/go-control-plane/envoy/api/v2/core"
+	route "github.com/envoyproxy/go-control-plane/envoy/api/v2/route"
+	"google.golang.org/grpc/codes"
+
+	"istio.io/istio/pilot/pkg/features"
+	"istio.io/istio/pilot/pkg/model"
+	"istio.io/istio/pilot/pkg/networking/util"
+	v3 "istio.io/istio/pilot/pkg/proxy/envoy/v3"
+	"istio.io/istio/pkg/config/host"
+)
+
+// Sidecars with the ON_DEMAND_CLUSTERS metadata load their HTTP destinations on demand:
+//
+// - outbound route configurations are sent without virtual hosts, and reference VHDS instead.
+// - the first request to a host without virtual host makes Envoy's on_demand filter request the
+//   "<route configuration>/<host>" virtual host. It is tracked in the VirtualHostType WatchedResource
+//   of the proxy, and the clusters used by its routes are added to CDS. Endpoints are then requested
+//   by Envoy as usual.
+// - outbound clusters of HTTP service ports are only sent if used by a requested virtual host.
+//   Clusters of other ports, which can't be requested on demand, are always sent.
+//
+// Pilot doesn't see the traffic, so the virtual hosts listed by each request and ACK of the sidecar are
+// refreshed, and a virtual host is removed once no request or ACK listed it for longer than the idle
+// timeout. If still in use, the sidecar requests it again on the next request.
+
+var (
+	// onDemandIdleTimeout is a package variable so tests can change it.
+	onDemandIdleTimeout = features.OnDemandClusterIdleTimeout
+
+	// onDemandSweepInterval is the interval at which connections are checked for expired virtual hosts.
+	onDemandSweepInterval = time.Minute
+)
+
+// isOnDemand returns true if the proxy loads its HTTP destinations on demand.
+func isOnDemand(proxy *model.Proxy) bool {
+	return proxy != nil && proxy.Type == model.SidecarProxy && bool(proxy.Metadata.OnDemandClusters)
+}
+
+// isOnDemandType returns true for the types requested on demand. Resources of these types are only
+// sent while tracked by Pilot, unlike other named watches.
+func isOnDemandType(typeURL string) bool {
+	return typeURL == VirtualHostType || typeURL == v3.VirtualHostType
+}
+
+func (s *DiscoveryServer) handleVhds(con *XdsConnection, discReq *xdsapi.DiscoveryRequest) error {
+	if discReq.ErrorDetail != nil {
+		errCode := codes.Code(discReq.ErrorDetail.Code)
+		adsLog.Warnf("ADS:VHDS: ACK ERROR %s %s:%s", con.ConID, errCode.String(), discReq.ErrorDetail.GetMessage())
+		return nil
+	}
+	if !isOnDemand(con.node) {
+		adsLog.Warnf("ADS:VHDS: %s requested virtual hosts without ON_DEMAND_CLUSTERS", con.ConID)
+		return nil
+	}
+	w := con.node.Active[VirtualHostType]
+	// The first request is always answered, Envoy waits for it to initialize the route configurations.
+	changed := w == nil
+	if w == nil {
+		w = &model.WatchedResource{TypeUrl: discReq.TypeUrl, LastRequested: map[string]time.Time{}}
+		con.node.Active[VirtualHostType] = w
+	}
+
+	if refreshOnDemand(w, discReq.ResourceNames, time.Now()) {
+		changed = true
+	}
+	if !changed {
+		// The listed virtual hosts were refreshed, which delays the next expiry.
+		s.updateOnDemand(con, w)
+		if discReq.ResponseNonce != "" {
+			w.NonceAcked = discReq.ResponseNonce
+		}
+		adsLog.Debugf("ADS:VHDS: ACK %s %s %s", con.ConID, discReq.VersionInfo, discReq.ResponseNonce)
+		return nil
+	}
+	s.updateOnDemand(con, w)
+	adsLog.Debugf("ADS:VHDS: REQ %s virtual hosts:%v", con.ConID, w.ResourceNames)
+
+	push := s.globalPushContext()
+	version := versionInfo()
+	// Clusters are pushed first, so the virtual hosts never reference a missing cluster.
+	if con.CDSWatch {
+		if err := s.pushCds(con, push, version); err != nil {
+			return err
+		}
+	}
+	return s.pushVhds(con, push, version)
+}
+
+// refreshOnDemand stamps the names listed by a request or ACK with its time, and removes the names it no
+// longer lists. It returns true if names were added or removed.
+func refreshOnDemand(w *model.WatchedResource, names []string, now time.Time) bool {
+	changed := false
+	requested := make(map[string]struct{}, len(names))
+	for _, name := range names {
+		requested[name] = struct{}{}
+		if _, f := w.LastRequested[name]; !f {
+			changed = true
+		}
+		w.LastRequested[name] = now
+	}
+	for name := range w.LastRequested {
+		if _, f := requested[name]; !f {
+			delete(w.LastRequested, name)
+			changed = true
+		}
+	}
+	return changed
+}
+
+// updateOnDemand updates the watched names after LastRequested changed, and the time of the next
+// expiry checked by sweepOnDemand.
+func (s *DiscoveryServer) updateOnDemand(con *XdsConnection, w *model.WatchedResource) {
+	w.ResourceNames = make([]string, 0, len(w.LastRequested))
+	var next time.Time
+	for name, t := range w.LastRequested {
+		w.ResourceNames = append(w.ResourceNames, name)
+		if next.IsZero() || t.Before(next) {
+			next = t
+		}
+	}
+	sort.Strings(w.ResourceNames)
+	if !next.IsZero() {
+		next = next.Add(onDemandIdleTimeout)
+	}
+	con.mu.Lock()
+	con.onDemandExpiry = next
+	con.mu.Unlock()
+}
+
+// expireOnDemand removes the virtual hosts not listed by a request or ACK within the idle timeout. It is called
+// before full pushes, so the pushed clusters and virtual hosts no longer include them.
+func (s *DiscoveryServer) expireOnDemand(con *XdsConnection) {
+	w := con.node.Active[VirtualHostType]
+	if w == nil {
+		return
+	}
+	deadline := time.Now().Add(-onDemandIdleTimeout)
+	expired := false
+	for name, t := range w.LastRequested {
+		if t.Before(deadline) {
+			delete(w.LastRequested, name)
+			expired = true
+		}
+	}
+	if expired {
+		s.updateOnDemand(con, w)
+		adsLog.Debugf("ADS:VHDS: expired virtual hosts for %s, remaining:%v", con.ConID, w.ResourceNames)
+	}
+}
+
+// sweepOnDemand periodically triggers a push to the connections with expired virtual hosts.
+func (s *DiscoveryServer) sweepOnDemand(stopCh <-chan struct{}) {
+	ticker := time.NewTicker(onDemandSweepInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			now := time.Now()
+			var expired []*XdsConnection
+			s.adsClientsMutex.RLock()
+			for _, con := range s.adsClients {
+				con.mu.RLock()
+				if !con.onDemandExpiry.IsZero() && now.After(con.onDemandExpiry) {
+					expired = append(expired, con)
+				}
+				con.mu.RUnlock()
+			}
+			s.adsClientsMutex.RUnlock()
+			for _, con := range expired {
+				s.pushQueue.Enqueue(con, &model.PushRequest{
+					Full:   true,
+					Push:   s.globalPushContext(),
+					Start:  now,
+					Reason: []model.TriggerReason{model.ProxyUpdate},
+				})
+			}
+		case <-stopCh:
+			return
+		}
+	}
+}
+
+// onDemandVirtualHosts returns the virtual hosts requested by the proxy, and the clusters their
+// routes use. Each virtual host is a copy of the generated virtual host matching the requested host,
+// named after the request and restricted to the requested domain.
+func (s *DiscoveryServer) onDemandVirtualHosts(con *XdsConnection, push *model.PushContext) ([]*route.VirtualHost, map[string]struct{}) {
+	clusters := map[string]struct{}{}
+	w := con.node.Active[VirtualHostType]
+	if w == nil || len(w.ResourceNames) == 0 {
+		return nil, clusters
+	}
+
+	routeNames := []string{}
+	seen := map[string]struct{}{}
+	for _, name := range w.ResourceNames {
+		routeName, _, ok := splitVirtualHostName(name)
+		if _, f := seen[routeName]; ok && !f {
+			seen[routeName] = struct{}{}
+			routeNames = append(routeNames, routeName)
+		}
+	}
+	routes := map[string]*xdsapi.RouteConfiguration{}
+	for _, rc := range s.ConfigGenerator.BuildHTTPRoutes(con.node, push, routeNames) {
+		routes[rc.Name] = rc
+	}
+
+	vhosts := make([]*route.VirtualHost, 0, len(w.ResourceNames))
+	for _, name := range w.ResourceNames {
+		routeName, domain, ok := splitVirtualHostName(name)
+		if !ok || routes[routeName] == nil {
+			continue
+		}
+		vh := matchVirtualHost(routes[routeName].VirtualHosts, domain)
+		if vh == nil {
+			adsLog.Debugf("ADS:VHDS: no virtual host for %s requested by %s", name, con.ConID)
+			continue
+		}
+		// Generated routes may be cached and shared, only the copy is modified.
+		out := *vh
+		out.Name = name
+		out.Domains = []string{domain}
+		vhosts = append(vhosts, &out)
+		addRouteClusters(vh, clusters)
+	}
+	return vhosts, clusters
+}
+
+// splitVirtualHostName splits a virtual host requested on demand, "<route configuration>/<host>".
+func splitVirtualHostName(name string) (string, string, bool) {
+	parts := strings.SplitN(name, "/", 2)
+	if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+		return "", "", false
+	}
+	return parts[0], parts[1], true
+}
+
+// matchVirtualHost returns the virtual host Envoy would select for the domain: an exact match first,
+// then the longest suffix wildcard, the longest prefix wildcard and finally the "*" virtual host.
+func matchVirtualHost(vhosts []*route.VirtualHost, domain string) *route.VirtualHost {
+	domain = strings.ToLower(domain)
+	var suffixMatch, prefixMatch, catchAll *route.VirtualHost
+	suffixLen, prefixLen := 0, 0
+	for _, vh := range vhosts {
+		for _, d := range vh.Domains {
+			d = strings.ToLower(d)
+			switch {
+			case d == domain:
+				return vh
+			case d == "*":
+				catchAll = vh
+			case strings.HasPrefix(d, "*") && strings.HasSuffix(domain, d[1:]) && len(d) > suffixLen:
+				suffixMatch, suffixLen = vh, len(d)
+			case strings.HasSuffix(d, "*") && strings.HasPrefix(domain, d[:len(d)-1]) && len(d) > prefixLen:
+				prefixMatch, prefixLen = vh, len(d)
+			}
+		}
+	}
+	if suffixMatch != nil {
+		return suffixMatch
+	}
+	if prefixMatch != nil {
+		return prefixMatch
+	}
+	return catchAll
+}
+
+// addRouteClusters adds the clusters used by the routes of the virtual host to the set.
+func addRouteClusters(vh *route.VirtualHost, clusters map[string]struct{}) {
+	for _, r := range vh.Routes {
+		action := r.GetRoute()
+		if action == nil {
+			continue
+		}
+		if c := action.GetCluster(); c != "" {
+			clusters[c] = struct{}{}
+		}
+		for _, wc := range action.GetWeightedClusters().GetClusters() {
+			clusters[wc.Name] = struct{}{}
+		}
+		// nolint: staticcheck
+		if m := action.GetRequestMirrorPolicy(); m != nil {
+			clusters[m.Cluster] = struct{}{}
+		}
+		for _, m := range action.GetRequestMirrorPolicies() {
+			clusters[m.Cluster] = struct{}{}
+		}
+	}
+}
+
+// filterOnDemandClusters removes the outbound clusters of HTTP service ports not used by a requested
+// virtual host.
+func (s *DiscoveryServer) filterOnDemandClusters(con *XdsConnection, push *model.PushContext, clusters []*xdsapi.Cluster) []*xdsapi.Cluster {
+	httpPorts := map[host.Name]map[int]struct{}{}
+	for _, svc := range push.Services(con.node) {
+		for _, port := range svc.Ports {
+			if !port.Protocol.IsHTTP() {
+				continue
+			}
+			if httpPorts[svc.Hostname] == nil {
+				httpPorts[svc.Hostname] = map[int]struct{}{}
+			}
+			httpPorts[svc.Hostname][port.Port] = struct{}{}
+		}
+	}
+	_, used := s.onDemandVirtualHosts(con, push)
+
+	out := make([]*xdsapi.Cluster, 0, len(clusters))
+	for _, c := range clusters {
+		if _, f := used[c.Name]; !f {
+			direction, _, hostname, port := model.ParseSubsetKey(c.Name)
+			if _, onDemand := httpPorts[hostname][port]; direction == model.TrafficDirectionOutbound && onDemand {
+				continue
+			}
+		}
+		out = append(out, c)
+	}
+	return out
+}
+
+// onDemandRouteConfigs replaces the virtual hosts of the outbound route configurations by VHDS.
+func onDemandRouteConfigs(routes []*xdsapi.RouteConfiguration) []*xdsapi.RouteConfiguration {
+	out := make([]*xdsapi.RouteConfiguration, 0, len(routes))
+	for _, rc := range routes {
+		if strings.HasPrefix(rc.Name, string(model.TrafficDirectionInbound)) {
+			out = append(out, rc)
+			continue
+		}
+		odr := *rc
+		odr.VirtualHosts = nil
+		odr.Vhds = &xdsapi.Vhds{
+			ConfigSource: &core.ConfigSource{
+				ConfigSourceSpecifier: &core.ConfigSource_Ads{
+					Ads: &core.AggregatedConfigSource{},
+				},
+			},
+		}
+		out = append(out, &odr)
+	}
+	return out
+}
+
+func (s *DiscoveryServer) pushVhds(con *XdsConnection, push *model.PushContext, version string) error {
+	w := con.node.Active[VirtualHostType]
+	if w == nil {
+		return nil
+	}
+	vhosts, _ := s.onDemandVirtualHosts(con, push)
+	resp := &xdsapi.DiscoveryResponse{
+		TypeUrl:     con.RequestedTypes.VHDS,
+		VersionInfo: version,
+		Nonce:       nonce(push.Version),
+	}
+	for _, vh := range vhosts {
+		resp.Resources = append(resp.Resources, resourceOfType(util.MessageToAny(vh), resp.TypeUrl))
+	}
+	if err := con.send(resp); err != nil {
+		adsLog.Warnf("VHDS: Send failure for node:%v: %v", con.node.ID, err)
+		return err
+	}
+	w.NonceSent = resp.Nonce
+	w.VersionSent = version
+	w.LastSent = time.Now()
+
+	adsLog.Infof("VHDS: PUSH for node:%s virtual hosts:%d", con.node.ID, len(vhosts))
+	return nil
+}
@@ -0,0 +1,116 @@
+// Copyright 2020 Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package v2
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	route "github.com/envoyproxy/go-control-plane/envoy/api/v2/route"
+
+	"istio.io/istio/pilot/pkg/model"
+)
+
+func TestMatchVirtualHost(t *testing.T) {
+	vhosts := []*route.VirtualHost{
+		{Name: "exact", Domains: []string{"foo.example.com", "foo.example.com:80"}},
+		{Name: "suffix", Domains: []string{"*.example.com"}},
+		{Name: "longer-suffix", Domains: []string{"*.bar.example.com"}},
+		{Name: "prefix", Domains: []string{"foo.*"}},
+		{Name: "catch-all", Domains: []string{"*"}},
+	}
+	cases := []struct {
+		domain string
+		want   string
+	}{
+		{"foo.example.com", "exact"},
+		{"FOO.example.com:80", "exact"},
+		{"baz.example.com", "suffix"},
+		{"baz.bar.example.com", "longer-suffix"},
+		{"foo.other.com", "prefix"},
+		{"other.com", "catch-all"},
+	}
+	for _, tt := range cases {
+		t.Run(tt.domain, func(t *testing.T) {
+			got := matchVirtualHost(vhosts, tt.domain)
+			if got == nil || got.Name != tt.want {
+				t.Fatalf("matchVirtualHost(%s) = %v, want %s", tt.domain, got, tt.want)
+			}
+		})
+	}
+	if got := matchVirtualHost(vhosts[:1], "other.com"); got != nil {
+		t.Fatalf("expected no match, got %v", got)
+	}
+}
+
+func TestSplitVirtualHostName(t *testing.T) {
+	if r, h, ok := splitVirtualHostName("80/foo.example.com"); !ok || r != "80" || h != "foo.example.com" {
+		t.Fatalf("unexpected split %q %q %v", r, h, ok)
+	}
+	for _, name := range []string{"80", "/foo", "80/", ""} {
+		if _, _, ok := splitVirtualHostName(name); ok {
+			t.Errorf("expected %q to be invalid", name)
+		}
+	}
+}
+
+func TestExpireOnDemand(t *testing.T) {
+	now := time.Now()
+	con := &XdsConnection{node: &model.Proxy{Active: map[string]*model.WatchedResource{
+		VirtualHostType: {
+			TypeUrl: VirtualHostType,
+			LastRequested: map[string]time.Time{
+				"80/old.example.com": now.Add(-2 * onDemandIdleTimeout),
+				"80/new.example.com": now,
+			},
+		},
+	}}}
+	s := &DiscoveryServer{}
+	s.expireOnDemand(con)
+
+	w := con.node.Active[VirtualHostType]
+	if !reflect.DeepEqual(w.ResourceNames, []string{"80/new.example.com"}) {
+		t.Fatalf("unexpected virtual hosts after expiry: %v", w.ResourceNames)
+	}
+	if want := now.Add(onDemandIdleTimeout); !con.onDemandExpiry.Equal(want) {
+		t.Fatalf("expected next expiry %v, got %v", want, con.onDemandExpiry)
+	}
+}
+
+func TestRefreshOnDemand(t *testing.T) {
+	now := time.Now()
+	w := &model.WatchedResource{
+		TypeUrl: VirtualHostType,
+		LastRequested: map[string]time.Time{
+			"80/busy.example.com":    now.Add(-2 * onDemandIdleTimeout),
+			"80/removed.example.com": now,
+		},
+	}
+	if !refreshOnDemand(w, []string{"80/busy.example.com", "80/new.example.com"}, now) {
+		t.Fatalf("expected the added and removed names to be a change")
+	}
+	if refreshOnDemand(w, []string{"80/busy.example.com", "80/new.example.com"}, now) {
+		t.Fatalf("expected an ACK of the same names not to be a change")
+	}
+
+	// A name listed by every request and ACK is refreshed, so it is not expired while in use.
+	con := &XdsConnection{node: &model.Proxy{Active: map[string]*model.WatchedResource{VirtualHostType: w}}}
+	s := &DiscoveryServer{}
+	s.expireOnDemand(con)
+	if want := map[string]time.Time{"80/busy.example.com": now, "80/new.example.com": now}; !reflect.DeepEqual(w.LastRequested, want) {
+		t.Fatalf("unexpected virtual hosts after refresh: %v", w.LastRequested)
+	}
+}
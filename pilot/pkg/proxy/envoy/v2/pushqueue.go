@@ -15,35 +15,148 @@
 package v2
 
 import (
+	"sort"
+	"strings"
 	"sync"
+	"time"
 
+	"istio.io/istio/pilot/pkg/features"
 	"istio.io/istio/pilot/pkg/model"
+	"istio.io/istio/pkg/config/labels"
 )
 
+// pushPriority orders proxies waiting in the PushQueue. Lower values are pushed first.
+type pushPriority int
+
+const (
+	// Incremental (EDS only) pushes to gateways and prioritized workloads.
+	pushPriorityHighEds pushPriority = iota
+	// Full pushes to gateways and prioritized workloads.
+	pushPriorityHighFull
+	// Incremental (EDS only) pushes to other sidecars. These are cheap and usually reflect endpoints
+	// going away, so they are sent ahead of full pushes.
+	pushPriorityNormalEds
+	// Full pushes to other sidecars.
+	pushPriorityNormalFull
+
+	numPushPriorities
+)
+
+func (p pushPriority) String() string {
+	switch p {
+	case pushPriorityHighEds:
+		return "high_eds"
+	case pushPriorityHighFull:
+		return "high_full"
+	case pushPriorityNormalEds:
+		return "normal_eds"
+	default:
+		return "normal_full"
+	}
+}
+
+// pushPrioritizer assigns priorities to queued pushes.
+type pushPrioritizer struct {
+	// namespaces whose proxies are pushed with high priority.
+	namespaces map[string]struct{}
+
+	// labels selecting workloads pushed with high priority. Nil if not configured.
+	labels labels.Instance
+
+	// aging is the time after which a waiting proxy is raised one priority level. Zero disables aging.
+	aging time.Duration
+}
+
+func newPushPrioritizer(namespaces, workloadLabels string, aging time.Duration) *pushPrioritizer {
+	pp := &pushPrioritizer{
+		namespaces: map[string]struct{}{},
+		aging:      aging,
+	}
+	for _, ns := range strings.Split(namespaces, ",") {
+		if ns = strings.TrimSpace(ns); ns != "" {
+			pp.namespaces[ns] = struct{}{}
+		}
+	}
+	if workloadLabels != "" {
+		pp.labels = labels.Parse(workloadLabels)
+	}
+	return pp
+}
+
+// isHighPriority returns true for gateways and proxies selected by the configured namespaces or labels.
+func (pp *pushPrioritizer) isHighPriority(con *XdsConnection) bool {
+	node := con.node
+	if node == nil {
+		return false
+	}
+	if node.Type == model.Router {
+		return true
+	}
+	if _, f := pp.namespaces[node.ConfigNamespace]; f {
+		return true
+	}
+	return pp.labels != nil && node.Metadata != nil && pp.labels.SubsetOf(node.Metadata.Labels)
+}
+
+func (pp *pushPrioritizer) priority(con *XdsConnection, req *model.PushRequest) pushPriority {
+	prio := pushPriorityNormalEds
+	if pp.isHighPriority(con) {
+		prio = pushPriorityHighEds
+	}
+	if req.Full {
+		prio++
+	}
+	return prio
+}
+
+// effectivePriority returns the priority of a queued push, raised by one level for each aging
+// interval the proxy has been waiting.
+func (pp *pushPrioritizer) effectivePriority(e *queuedPush, now time.Time) int {
+	if pp.aging <= 0 {
+		return int(e.priority)
+	}
+	return int(e.priority) - int(now.Sub(e.enqueued)/pp.aging)
+}
+
+// queuedPush is a pending push for a proxy in the PushQueue.
+type queuedPush struct {
+	request  *model.PushRequest
+	priority pushPriority
+	// enqueued is the time the proxy was added to the queue, used for aging and wait time metrics.
+	enqueued time.Time
+}
+
+// PushQueue holds the proxies waiting for a push. Each proxy is queued at most once, with its
+// pending requests merged. Proxies are dequeued by priority (see pushPriority), in FIFO order within
+// a priority. Waiting proxies age into higher priorities, so that none is starved.
 type PushQueue struct {
 	mu   *sync.RWMutex
 	cond *sync.Cond
 
 	// eventsMap stores all connections in the queue. If the same connection is enqueued again, the
 	// PushEvents will be merged.
-	eventsMap map[*XdsConnection]*model.PushRequest
+	eventsMap map[*XdsConnection]*queuedPush
 
-	// connections maintains ordering of the queue
-	connections []*XdsConnection
+	// connections maintains ordering of the queue, for each priority
+	connections [numPushPriorities][]*XdsConnection
 
 	// inProgress stores all connections that have been Dequeue(), but not MarkDone().
 	// The value stored will be initially be nil, but may be populated if the connection is Enqueue().
 	// If model.PushRequest is not nil, it will be Enqueued again once MarkDone has been called.
 	inProgress map[*XdsConnection]*model.PushRequest
+
+	prioritizer *pushPrioritizer
 }
 
 func NewPushQueue() *PushQueue {
 	mu := &sync.RWMutex{}
 	return &PushQueue{
 		mu:         mu,
-		eventsMap:  make(map[*XdsConnection]*model.PushRequest),
+		eventsMap:  make(map[*XdsConnection]*queuedPush),
 		inProgress: make(map[*XdsConnection]*model.PushRequest),
 		cond:       sync.NewCond(mu),
+		prioritizer: newPushPrioritizer(features.PushPriorityNamespaces, features.PushPriorityLabels,
+			features.PushPriorityAging),
 	}
 }
 
@@ -60,36 +173,93 @@ func (p *PushQueue) Enqueue(proxy *XdsConnection, pushInfo *model.PushRequest) {
 	}
 
 	if event, f := p.eventsMap[proxy]; f {
-		p.eventsMap[proxy] = event.Merge(pushInfo)
+		event.request = event.request.Merge(pushInfo)
+		// The proxy keeps the time it has already waited. It is moved up if the merged request is more
+		// urgent, but never moved down.
+		if prio := p.prioritizer.priority(proxy, event.request); prio < event.priority {
+			p.remove(proxy, event.priority)
+			event.priority = prio
+			p.insert(proxy, event)
+		}
 		return
 	}
 
-	p.eventsMap[proxy] = pushInfo
-	p.connections = append(p.connections, proxy)
+	event := &queuedPush{
+		request:  pushInfo,
+		priority: p.prioritizer.priority(proxy, pushInfo),
+		enqueued: time.Now(),
+	}
+	p.eventsMap[proxy] = event
+	p.connections[event.priority] = append(p.connections[event.priority], proxy)
+	pushQueueDepth.With(priorityTag.Value(event.priority.String())).Record(float64(len(p.connections[event.priority])))
 	// Signal waiters on Dequeue that a new item is available
 	p.cond.Signal()
 }
 
+// insert adds the proxy to the queue of its priority, keeping the queue ordered by enqueue time.
+func (p *PushQueue) insert(proxy *XdsConnection, event *queuedPush) {
+	queue := p.connections[event.priority]
+	i := sort.Search(len(queue), func(i int) bool {
+		return p.eventsMap[queue[i]].enqueued.After(event.enqueued)
+	})
+	queue = append(queue, nil)
+	copy(queue[i+1:], queue[i:])
+	queue[i] = proxy
+	p.connections[event.priority] = queue
+	pushQueueDepth.With(priorityTag.Value(event.priority.String())).Record(float64(len(queue)))
+}
+
+// remove deletes the proxy from the queue of the given priority.
+func (p *PushQueue) remove(proxy *XdsConnection, prio pushPriority) {
+	queue := p.connections[prio]
+	for i, con := range queue {
+		if con == proxy {
+			p.connections[prio] = append(queue[:i], queue[i+1:]...)
+			break
+		}
+	}
+	pushQueueDepth.With(priorityTag.Value(prio.String())).Record(float64(len(p.connections[prio])))
+}
+
 // Remove a proxy from the queue. If there are no proxies ready to be removed, this will block
 func (p *PushQueue) Dequeue() (*XdsConnection, *model.PushRequest) {
 	p.mu.Lock()
 	defer p.mu.Unlock()
 
 	// Block until there is one to remove. Enqueue will signal when one is added.
-	for len(p.connections) == 0 {
+	for len(p.eventsMap) == 0 {
 		p.cond.Wait()
 	}
 
-	head := p.connections[0]
-	p.connections = p.connections[1:]
+	// The head of each priority queue is its longest waiting proxy. Pick the one with the best
+	// effective priority, the longest waiting one on ties.
+	now := time.Now()
+	prio := pushPriority(-1)
+	var best *queuedPush
+	bestEffective := 0
+	for i := range p.connections {
+		if len(p.connections[i]) == 0 {
+			continue
+		}
+		event := p.eventsMap[p.connections[i][0]]
+		effective := p.prioritizer.effectivePriority(event, now)
+		if best == nil || effective < bestEffective || (effective == bestEffective && event.enqueued.Before(best.enqueued)) {
+			prio, best, bestEffective = pushPriority(i), event, effective
+		}
+	}
 
-	info := p.eventsMap[head]
+	head := p.connections[prio][0]
+	p.connections[prio] = p.connections[prio][1:]
 	delete(p.eventsMap, head)
 
+	priorityValue := priorityTag.Value(prio.String())
+	pushQueueDepth.With(priorityValue).Record(float64(len(p.connections[prio])))
+	pushQueueWaitTime.With(priorityValue).Record(now.Sub(best.enqueued).Seconds())
+
 	// Mark the connection as in progress
 	p.inProgress[head] = nil
 
-	return head, info
+	return head, best.request
 }
 
 func (p *PushQueue) MarkDone(con *XdsConnection) {
@@ -110,5 +280,5 @@ func (p *PushQueue) MarkDone(con *XdsConnection) {
 func (p *PushQueue) Pending() int {
 	p.mu.Lock()
 	defer p.mu.Unlock()
-	return len(p.connections)
+	return len(p.eventsMap)
 }
@@ -260,3 +260,75 @@ func TestProxyQueue(t *testing.T) {
 		}
 	})
 }
+
+func TestProxyQueuePriority(t *testing.T) {
+	sidecar := func(name, ns string) *XdsConnection {
+		return &XdsConnection{ConID: name, node: &model.Proxy{Type: model.SidecarProxy, ConfigNamespace: ns,
+			Metadata: &model.NodeMetadata{Labels: map[string]string{"app": name}}}}
+	}
+	gateway := &XdsConnection{ConID: "gateway", node: &model.Proxy{Type: model.Router, Metadata: &model.NodeMetadata{}}}
+
+	t.Run("gateways before sidecars", func(t *testing.T) {
+		p := NewPushQueue()
+		p.prioritizer = newPushPrioritizer("", "", 0)
+		a := sidecar("a", "default")
+		p.Enqueue(a, &model.PushRequest{Full: true})
+		p.Enqueue(gateway, &model.PushRequest{Full: true})
+
+		ExpectDequeue(t, p, gateway)
+		ExpectDequeue(t, p, a)
+		ExpectTimeout(t, p)
+	})
+
+	t.Run("eds before full", func(t *testing.T) {
+		p := NewPushQueue()
+		p.prioritizer = newPushPrioritizer("", "", 0)
+		a, b := sidecar("a", "default"), sidecar("b", "default")
+		p.Enqueue(a, &model.PushRequest{Full: true})
+		p.Enqueue(b, &model.PushRequest{})
+
+		ExpectDequeue(t, p, b)
+		ExpectDequeue(t, p, a)
+	})
+
+	t.Run("configured namespaces and labels", func(t *testing.T) {
+		p := NewPushQueue()
+		p.prioritizer = newPushPrioritizer("critical", "app=c", 0)
+		a, b, c := sidecar("a", "default"), sidecar("b", "critical"), sidecar("c", "default")
+		p.Enqueue(a, &model.PushRequest{})
+		p.Enqueue(b, &model.PushRequest{Full: true})
+		p.Enqueue(c, &model.PushRequest{Full: true})
+
+		ExpectDequeue(t, p, b)
+		ExpectDequeue(t, p, c)
+		ExpectDequeue(t, p, a)
+	})
+
+	t.Run("merged request keeps its priority", func(t *testing.T) {
+		p := NewPushQueue()
+		p.prioritizer = newPushPrioritizer("", "", 0)
+		a, b := sidecar("a", "default"), sidecar("b", "default")
+		p.Enqueue(a, &model.PushRequest{})
+		p.Enqueue(b, &model.PushRequest{Full: true})
+		// Merging an EDS push into a full one keeps the EDS priority.
+		p.Enqueue(a, &model.PushRequest{Full: true})
+
+		con, info := p.Dequeue()
+		if con != a || !info.Full {
+			t.Fatalf("expected full push for a, got %v %v", con.ConID, info.Full)
+		}
+		ExpectDequeue(t, p, b)
+	})
+
+	t.Run("aging prevents starvation", func(t *testing.T) {
+		p := NewPushQueue()
+		p.prioritizer = newPushPrioritizer("", "", 10*time.Millisecond)
+		a := sidecar("a", "default")
+		p.Enqueue(a, &model.PushRequest{Full: true})
+		time.Sleep(50 * time.Millisecond)
+		p.Enqueue(gateway, &model.PushRequest{})
+
+		ExpectDequeue(t, p, a)
+		ExpectDequeue(t, p, gateway)
+	})
+}
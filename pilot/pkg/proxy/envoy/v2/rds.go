@@ -28,6 +28,9 @@ import (
 func (s *DiscoveryServer) pushRoute(con *XdsConnection, push *model.PushContext, version string) error {
 	pushStart := time.Now()
 	rawRoutes := s.ConfigGenerator.BuildHTTPRoutes(con.node, push, con.Routes)
+	if isOnDemand(con.node) {
+		rawRoutes = onDemandRouteConfigs(rawRoutes)
+	}
 	if s.DebugConfigs {
 		for _, r := range rawRoutes {
 			con.RouteConfigs[r.Name] = r
@@ -59,9 +62,7 @@ func routeDiscoveryResponse(rs []*xdsapi.RouteConfiguration, version, noncePrefi
 		Nonce:       nonce(noncePrefix),
 	}
 	for _, rc := range rs {
-		rr := util.MessageToAny(rc)
-		rr.TypeUrl = typeURL
-		resp.Resources = append(resp.Resources, rr)
+		resp.Resources = append(resp.Resources, resourceOfType(util.MessageToAny(rc), typeURL))
 	}
 
 	return resp
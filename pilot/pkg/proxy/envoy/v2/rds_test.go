@@ -23,7 +23,7 @@ import (
 	"istio.io/istio/tests/util"
 )
 
-// TestRDS is running RDSv2 tests.
+// TestRDS is running RDS tests, against the v2 and v3 ADS services.
 func TestRDS(t *testing.T) {
 	_, tearDown := initLocalPilotTestEnv(t)
 	defer tearDown()
@@ -52,30 +52,32 @@ func TestRDS(t *testing.T) {
 		},
 	}
 
-	for idx, tt := range tests {
-		t.Run(tt.name, func(t *testing.T) {
-			rdsr, cancel, err := connectADS(util.MockPilotGrpcAddr)
-			if err != nil {
-				t.Fatal(err)
-			}
-			defer cancel()
+	for _, version := range xdsVersions {
+		for idx, tt := range tests {
+			t.Run(version+"/"+tt.name, func(t *testing.T) {
+				rdsr, cancel, err := connectADSVersion(util.MockPilotGrpcAddr, version)
+				if err != nil {
+					t.Fatal(err)
+				}
+				defer cancel()
 
-			err = sendRDSReq(tt.node, tt.routes, "", rdsr)
-			if err != nil {
-				t.Fatal(err)
-			}
+				err = sendRDSReq(tt.node, tt.routes, "", rdsr)
+				if err != nil {
+					t.Fatal(err)
+				}
 
-			res, err := rdsr.Recv()
-			if err != nil {
-				t.Fatal("Failed to receive RDS", err)
-			}
+				res, err := rdsr.Recv()
+				if err != nil {
+					t.Fatal("Failed to receive RDS", err)
+				}
 
-			strResponse, _ := gogoprotomarshal.ToJSONWithIndent(res, " ")
-			_ = ioutil.WriteFile(env.IstioOut+fmt.Sprintf("/rdsv2/%s_%d.json", tt.name, idx), []byte(strResponse), 0644)
-			if len(res.Resources) == 0 {
-				t.Fatal("No response")
-			}
-		})
+				strResponse, _ := gogoprotomarshal.ToJSONWithIndent(res, " ")
+				_ = ioutil.WriteFile(env.IstioOut+fmt.Sprintf("/rds%s/%s_%d.json", version, tt.name, idx), []byte(strResponse), 0644)
+				if len(res.Resources) == 0 {
+					t.Fatal("No response")
+				}
+			})
+		}
 	}
 
 	// TODO: compare with some golden once it's stable
@@ -0,0 +1,423 @@
+// Copyright 2020 Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package v2
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+
+	xdsapi "github.com/envoyproxy/go-control-plane/envoy/api/v2"
+	core "github.com/envoyproxy/go-control-plane/envoy/api/v2/core"
+	"google.golang.org/grpc"
+
+	"istio.io/istio/pilot/pkg/config/kube/crd"
+	"istio.io/istio/pilot/pkg/config/memory"
+	"istio.io/istio/pilot/pkg/model"
+	"istio.io/istio/pkg/config/host"
+	"istio.io/istio/pkg/config/mesh"
+	"istio.io/istio/pkg/config/schema/collection"
+	"istio.io/istio/pkg/config/schema/collections"
+	"istio.io/istio/pkg/config/schema/resource"
+	"istio.io/istio/pkg/util/gogoprotomarshal"
+)
+
+// PushSnapshot holds everything a push is computed from: the mesh configuration, the Istio configs,
+// the services and endpoints, and the connected proxies. It is exported by /debug/push_snapshot,
+// and loaded by `pilot-discovery replay` to regenerate the configuration of a proxy offline.
+type PushSnapshot struct {
+	// PushVersion is the version of the PushContext at the time of the snapshot.
+	PushVersion  string          `json:"pushVersion"`
+	DomainSuffix string          `json:"domainSuffix,omitempty"`
+	Mesh         json.RawMessage `json:"mesh"`
+	MeshNetworks json.RawMessage `json:"meshNetworks,omitempty"`
+	// MeshExtensions are the settings of the mesh configuration that Mesh does not define.
+	MeshExtensions *mesh.MeshExtensions `json:"meshExtensions,omitempty"`
+
+	Configs   []crd.IstioKind      `json:"configs"`
+	Services  []*model.Service     `json:"services"`
+	Endpoints []*SnapshotEndpoints `json:"endpoints"`
+	Proxies   []*SnapshotProxy     `json:"proxies"`
+}
+
+// SnapshotEndpoints holds the endpoints of a service, from one registry shard.
+type SnapshotEndpoints struct {
+	Hostname  string                 `json:"hostname"`
+	Namespace string                 `json:"namespace"`
+	ClusterID string                 `json:"clusterID"`
+	Endpoints []*model.IstioEndpoint `json:"endpoints"`
+}
+
+// SnapshotProxy holds the state of a connected proxy, as computed by Pilot from its node metadata
+// and the registries, and the routes and clusters it watches.
+type SnapshotProxy struct {
+	ClusterID        string                   `json:"clusterID,omitempty"`
+	Type             model.NodeType           `json:"type"`
+	IPAddresses      []string                 `json:"ipAddresses"`
+	ID               string                   `json:"id"`
+	DNSDomain        string                   `json:"dnsDomain"`
+	ConfigNamespace  string                   `json:"configNamespace"`
+	Locality         *core.Locality           `json:"locality,omitempty"`
+	Metadata         *model.NodeMetadata      `json:"metadata"`
+	RawMetadata      map[string]interface{}   `json:"rawMetadata,omitempty"`
+	ServiceInstances []*model.ServiceInstance `json:"serviceInstances,omitempty"`
+	Routes           []string                 `json:"routes,omitempty"`
+	Clusters         []string                 `json:"clusters,omitempty"`
+}
+
+// NodeID returns the proxy ID in the form sent by the proxy, used to select it when replaying.
+func (p *SnapshotProxy) NodeID() string {
+	ip := ""
+	if len(p.IPAddresses) > 0 {
+		ip = p.IPAddresses[0]
+	}
+	return fmt.Sprintf("%s~%s~%s~%s", p.Type, ip, p.ID, p.DNSDomain)
+}
+
+// pushSnapshotz exports the push snapshot, see PushSnapshot.
+func (s *DiscoveryServer) pushSnapshotz(w http.ResponseWriter, req *http.Request) {
+	snap, err := s.Snapshot(req.URL.Query().Get("proxyID"))
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		_, _ = fmt.Fprintf(w, "unable to create push snapshot: %v", err)
+		return
+	}
+	out, err := json.MarshalIndent(snap, "", "  ")
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		_, _ = fmt.Fprintf(w, "unable to marshal push snapshot: %v", err)
+		return
+	}
+	w.Header().Add("Content-Type", "application/json")
+	_, _ = w.Write(out)
+}
+
+// Snapshot captures the current push state. If proxyID is not empty, only the connected proxies
+// with this ID are included.
+func (s *DiscoveryServer) Snapshot(proxyID string) (*PushSnapshot, error) {
+	push := s.globalPushContext()
+	snap := &PushSnapshot{
+		PushVersion:    push.Version,
+		DomainSuffix:   s.Env.DomainSuffix,
+		MeshExtensions: push.MeshExtensions,
+	}
+
+	meshJSON, err := gogoprotomarshal.ToJSON(push.Mesh)
+	if err != nil {
+		return nil, err
+	}
+	snap.Mesh = json.RawMessage(meshJSON)
+	if networks := s.Env.Networks(); networks != nil {
+		networksJSON, err := gogoprotomarshal.ToJSON(networks)
+		if err != nil {
+			return nil, err
+		}
+		snap.MeshNetworks = json.RawMessage(networksJSON)
+	}
+
+	s.Env.IstioConfigStore.Schemas().ForEach(func(schema collection.Schema) bool {
+		var configs []model.Config
+		configs, err = s.Env.IstioConfigStore.List(schema.Resource().GroupVersionKind(), "")
+		if err != nil {
+			return true
+		}
+		for _, c := range configs {
+			var obj crd.IstioObject
+			obj, err = crd.ConvertConfig(schema, c)
+			if err != nil {
+				return true
+			}
+			snap.Configs = append(snap.Configs, *obj.(*crd.IstioKind))
+		}
+		return false
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	snap.Services = push.Services(nil)
+
+	s.mutex.RLock()
+	for hostname, byNamespace := range s.EndpointShardsByService {
+		for namespace, shards := range byNamespace {
+			shards.mutex.RLock()
+			for clusterID, endpoints := range shards.Shards {
+				snap.Endpoints = append(snap.Endpoints, &SnapshotEndpoints{
+					Hostname:  hostname,
+					Namespace: namespace,
+					ClusterID: clusterID,
+					Endpoints: snapshotEndpoints(endpoints),
+				})
+			}
+			shards.mutex.RUnlock()
+		}
+	}
+	s.mutex.RUnlock()
+	sort.Slice(snap.Endpoints, func(i, j int) bool {
+		a, b := snap.Endpoints[i], snap.Endpoints[j]
+		if a.Hostname != b.Hostname {
+			return a.Hostname < b.Hostname
+		}
+		if a.Namespace != b.Namespace {
+			return a.Namespace < b.Namespace
+		}
+		return a.ClusterID < b.ClusterID
+	})
+
+	s.adsClientsMutex.RLock()
+	for _, con := range s.adsClients {
+		con.mu.RLock()
+		if con.node != nil && (proxyID == "" || con.node.ID == proxyID) {
+			snap.Proxies = append(snap.Proxies, snapshotProxy(con))
+		}
+		con.mu.RUnlock()
+	}
+	s.adsClientsMutex.RUnlock()
+	sort.Slice(snap.Proxies, func(i, j int) bool {
+		return snap.Proxies[i].ID < snap.Proxies[j].ID
+	})
+
+	return snap, nil
+}
+
+// snapshotEndpoints copies the endpoints without the cached Envoy endpoint, which is rebuilt on replay.
+func snapshotEndpoints(endpoints []*model.IstioEndpoint) []*model.IstioEndpoint {
+	out := make([]*model.IstioEndpoint, 0, len(endpoints))
+	for _, e := range endpoints {
+		c := *e
+		c.EnvoyEndpoint = nil
+		out = append(out, &c)
+	}
+	return out
+}
+
+func snapshotProxy(con *XdsConnection) *SnapshotProxy {
+	node := con.node
+	p := &SnapshotProxy{
+		ClusterID:       node.ClusterID,
+		Type:            node.Type,
+		IPAddresses:     node.IPAddresses,
+		ID:              node.ID,
+		DNSDomain:       node.DNSDomain,
+		ConfigNamespace: node.ConfigNamespace,
+		Locality:        node.Locality,
+		Metadata:        node.Metadata,
+		RawMetadata:     node.Metadata.Raw,
+		Routes:          con.Routes,
+		Clusters:        con.Clusters,
+	}
+	for _, si := range node.ServiceInstances {
+		p.ServiceInstances = append(p.ServiceInstances, &model.ServiceInstance{
+			Service:     si.Service,
+			ServicePort: si.ServicePort,
+			Endpoint:    snapshotEndpoints([]*model.IstioEndpoint{si.Endpoint})[0],
+		})
+	}
+	return p
+}
+
+// NewReplayServer creates a discovery server computing the configuration from a snapshot instead
+// of the registries. It is not started, Replay generates the configuration of a proxy.
+func NewReplayServer(snap *PushSnapshot, plugins []string) (*DiscoveryServer, error) {
+	meshConfig, err := mesh.ApplyMeshConfigDefaults(string(snap.Mesh))
+	if err != nil {
+		return nil, fmt.Errorf("failed to load mesh config: %v", err)
+	}
+	networks := mesh.EmptyMeshNetworks()
+	if len(snap.MeshNetworks) > 0 {
+		n, err := mesh.ParseMeshNetworks(string(snap.MeshNetworks))
+		if err != nil {
+			return nil, fmt.Errorf("failed to load mesh networks: %v", err)
+		}
+		networks = *n
+	}
+
+	store := memory.Make(collections.Pilot)
+	for i := range snap.Configs {
+		obj := &snap.Configs[i]
+		gvk := obj.GroupVersionKind()
+		schema, f := collections.Pilot.FindByGroupVersionKind(resource.FromKubernetesGVK(&gvk))
+		if !f {
+			adsLog.Warnf("replay: skipping config %s/%s of unknown kind %v", obj.Namespace, obj.Name, obj.Kind)
+			continue
+		}
+		cfg, err := crd.ConvertObject(schema, obj, snap.DomainSuffix)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load config %s/%s: %v", obj.Namespace, obj.Name, err)
+		}
+		if _, err := store.Create(*cfg); err != nil {
+			return nil, fmt.Errorf("failed to load config %s/%s: %v", obj.Namespace, obj.Name, err)
+		}
+	}
+
+	registry := &replayRegistry{
+		MemServiceDiscovery: NewMemServiceDiscovery(map[host.Name]*model.Service{}, 0),
+		services:            snap.Services,
+	}
+	for _, svc := range snap.Services {
+		// AddService marks the service as coming from the mock registry, keep the original registry.
+		serviceRegistry := svc.Attributes.ServiceRegistry
+		registry.AddService(svc.Hostname, svc)
+		svc.Attributes.ServiceRegistry = serviceRegistry
+	}
+	for _, eps := range snap.Endpoints {
+		svc := snap.service(eps.Hostname, eps.Namespace)
+		if svc == nil {
+			continue
+		}
+		for _, e := range eps.Endpoints {
+			port, f := svc.Ports.Get(e.ServicePortName)
+			if !f {
+				continue
+			}
+			registry.AddInstance(svc.Hostname, &model.ServiceInstance{ServicePort: port, Endpoint: e})
+		}
+	}
+
+	env := &model.Environment{
+		ServiceDiscovery: registry,
+		IstioConfigStore: model.MakeIstioStore(store),
+		Watcher:          mesh.NewFixedWatcherWithExtensions(meshConfig, snap.MeshExtensions),
+		NetworksWatcher:  mesh.NewFixedNetworksWatcher(&networks),
+		PushContext:      model.NewPushContext(),
+		DomainSuffix:     snap.DomainSuffix,
+	}
+	if err := env.PushContext.InitContext(env, nil, nil); err != nil {
+		return nil, fmt.Errorf("failed to initialize push context: %v", err)
+	}
+	env.PushContext.Version = snap.PushVersion
+
+	s := NewDiscoveryServer(env, plugins)
+	registry.EDSUpdater = s
+	for _, eps := range snap.Endpoints {
+		s.edsUpdate(eps.ClusterID, eps.Hostname, eps.Namespace, eps.Endpoints)
+	}
+	return s, nil
+}
+
+// replayRegistry lists the services of a snapshot in their order, including the services of a
+// ServiceEntry sharing a hostname, so that the push context orders them as the exported one.
+type replayRegistry struct {
+	*MemServiceDiscovery
+	services []*model.Service
+}
+
+// Services implements discovery interface
+func (r *replayRegistry) Services() ([]*model.Service, error) {
+	// The push context sorts the returned slice.
+	return append([]*model.Service(nil), r.services...), nil
+}
+
+// service returns the service of the snapshot with the hostname, in the namespace.
+func (snap *PushSnapshot) service(hostname, namespace string) *model.Service {
+	for _, svc := range snap.Services {
+		if string(svc.Hostname) == hostname && svc.Attributes.Namespace == namespace {
+			return svc
+		}
+	}
+	return nil
+}
+
+// Proxy returns the proxy of the snapshot with the node ID or ID, or nil if not found.
+func (snap *PushSnapshot) Proxy(id string) *SnapshotProxy {
+	for _, p := range snap.Proxies {
+		if p.ID == id || p.NodeID() == id {
+			return p
+		}
+	}
+	return nil
+}
+
+// Replay generates the responses pushed to the proxy of the snapshot, for the requested types. The
+// responses are generated by the same code as a push to a connected proxy.
+func (s *DiscoveryServer) Replay(snap *PushSnapshot, p *SnapshotProxy, typeURLs []string) ([]*xdsapi.DiscoveryResponse, error) {
+	proxy := &model.Proxy{
+		ClusterID:       p.ClusterID,
+		Type:            p.Type,
+		IPAddresses:     p.IPAddresses,
+		ID:              p.ID,
+		DNSDomain:       p.DNSDomain,
+		ConfigNamespace: p.ConfigNamespace,
+		Locality:        p.Locality,
+		Metadata:        p.Metadata,
+		Active:          map[string]*model.WatchedResource{},
+	}
+	if proxy.Metadata == nil {
+		proxy.Metadata = &model.NodeMetadata{}
+	}
+	proxy.Metadata.Raw = p.RawMetadata
+	proxy.IstioVersion = model.ParseIstioVersion(proxy.Metadata.IstioVersion)
+	// Service instances are taken from the snapshot, the registry only keeps one instance per address.
+	for _, si := range p.ServiceInstances {
+		if si.Service != nil {
+			if svc := snap.service(string(si.Service.Hostname), si.Service.Attributes.Namespace); svc != nil {
+				si.Service = svc
+			}
+		}
+		proxy.ServiceInstances = append(proxy.ServiceInstances, si)
+	}
+	push := s.globalPushContext()
+	proxy.SetSidecarScope(push)
+	proxy.SetGatewaysForProxy(push)
+	proxy.DiscoverIPVersions()
+
+	stream := &replayStream{}
+	con := newXdsConnection("replay", stream)
+	con.ConID = connectionID(proxy.ID)
+	con.node = proxy
+	con.Routes = p.Routes
+	con.Clusters = p.Clusters
+	con.RequestedTypes.CDS = ClusterType
+	con.RequestedTypes.EDS = EndpointType
+	con.RequestedTypes.LDS = ListenerType
+	con.RequestedTypes.RDS = RouteType
+
+	version := push.Version
+	for _, typeURL := range typeURLs {
+		var err error
+		switch typeURL {
+		case ClusterType:
+			err = s.pushCds(con, push, version)
+		case ListenerType:
+			err = s.pushLds(con, push, version)
+		case RouteType:
+			err = s.pushRoute(con, push, version)
+		case EndpointType:
+			err = s.pushEds(push, con, version, nil)
+		default:
+			err = fmt.Errorf("unsupported type %s", typeURL)
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+	return stream.responses, nil
+}
+
+// replayStream records the responses generated by Replay.
+type replayStream struct {
+	grpc.ServerStream
+	responses []*xdsapi.DiscoveryResponse
+}
+
+func (r *replayStream) Send(res *xdsapi.DiscoveryResponse) error {
+	r.responses = append(r.responses, res)
+	return nil
+}
+
+func (r *replayStream) Recv() (*xdsapi.DiscoveryRequest, error) {
+	return nil, fmt.Errorf("replay stream does not receive requests")
+}
@@ -0,0 +1,241 @@
+// Copyright 2020 Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package v3
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"reflect"
+	"regexp"
+	"strings"
+	"sync"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/golang/protobuf/ptypes/any"
+
+	"istio.io/istio/pilot/pkg/networking/util"
+
+	// Register the v3 messages resources and typed configs are converted to.
+	_ "github.com/envoyproxy/go-control-plane/envoy/config/cluster/v3"
+	_ "github.com/envoyproxy/go-control-plane/envoy/config/endpoint/v3"
+	_ "github.com/envoyproxy/go-control-plane/envoy/config/listener/v3"
+	_ "github.com/envoyproxy/go-control-plane/envoy/config/route/v3"
+	_ "github.com/envoyproxy/go-control-plane/envoy/config/trace/v3"
+	_ "github.com/envoyproxy/go-control-plane/envoy/extensions/access_loggers/file/v3"
+	_ "github.com/envoyproxy/go-control-plane/envoy/extensions/access_loggers/grpc/v3"
+	_ "github.com/envoyproxy/go-control-plane/envoy/extensions/filters/http/cors/v3"
+	_ "github.com/envoyproxy/go-control-plane/envoy/extensions/filters/http/ext_authz/v3"
+	_ "github.com/envoyproxy/go-control-plane/envoy/extensions/filters/http/fault/v3"
+	_ "github.com/envoyproxy/go-control-plane/envoy/extensions/filters/http/grpc_stats/v3"
+	_ "github.com/envoyproxy/go-control-plane/envoy/extensions/filters/http/grpc_web/v3"
+	_ "github.com/envoyproxy/go-control-plane/envoy/extensions/filters/http/health_check/v3"
+	_ "github.com/envoyproxy/go-control-plane/envoy/extensions/filters/http/jwt_authn/v3"
+	_ "github.com/envoyproxy/go-control-plane/envoy/extensions/filters/http/on_demand/v3"
+	_ "github.com/envoyproxy/go-control-plane/envoy/extensions/filters/http/ratelimit/v3"
+	_ "github.com/envoyproxy/go-control-plane/envoy/extensions/filters/http/rbac/v3"
+	_ "github.com/envoyproxy/go-control-plane/envoy/extensions/filters/http/router/v3"
+	_ "github.com/envoyproxy/go-control-plane/envoy/extensions/filters/listener/http_inspector/v3"
+	_ "github.com/envoyproxy/go-control-plane/envoy/extensions/filters/listener/original_dst/v3"
+	_ "github.com/envoyproxy/go-control-plane/envoy/extensions/filters/listener/tls_inspector/v3"
+	_ "github.com/envoyproxy/go-control-plane/envoy/extensions/filters/network/http_connection_manager/v3"
+	_ "github.com/envoyproxy/go-control-plane/envoy/extensions/filters/network/kafka_broker/v3"
+	_ "github.com/envoyproxy/go-control-plane/envoy/extensions/filters/network/local_ratelimit/v3"
+	_ "github.com/envoyproxy/go-control-plane/envoy/extensions/filters/network/mongo_proxy/v3"
+	_ "github.com/envoyproxy/go-control-plane/envoy/extensions/filters/network/mysql_proxy/v3"
+	_ "github.com/envoyproxy/go-control-plane/envoy/extensions/filters/network/ratelimit/v3"
+	_ "github.com/envoyproxy/go-control-plane/envoy/extensions/filters/network/rbac/v3"
+	_ "github.com/envoyproxy/go-control-plane/envoy/extensions/filters/network/redis_proxy/v3"
+	_ "github.com/envoyproxy/go-control-plane/envoy/extensions/filters/network/tcp_proxy/v3"
+	_ "github.com/envoyproxy/go-control-plane/envoy/extensions/filters/network/thrift_proxy/filters/ratelimit/v3"
+	_ "github.com/envoyproxy/go-control-plane/envoy/extensions/filters/network/thrift_proxy/v3"
+	_ "github.com/envoyproxy/go-control-plane/envoy/extensions/filters/network/zookeeper_proxy/v3"
+	_ "github.com/envoyproxy/go-control-plane/envoy/extensions/transport_sockets/tls/v3"
+)
+
+const typePrefix = "type.googleapis.com/"
+
+// v2Types maps the v2 messages that do not follow the filter naming scheme to their v3 version.
+var v2Types = map[string]string{
+	"envoy.api.v2.Cluster":                              "envoy.config.cluster.v3.Cluster",
+	"envoy.api.v2.Listener":                             "envoy.config.listener.v3.Listener",
+	"envoy.api.v2.RouteConfiguration":                   "envoy.config.route.v3.RouteConfiguration",
+	"envoy.api.v2.ClusterLoadAssignment":                "envoy.config.endpoint.v3.ClusterLoadAssignment",
+	"envoy.api.v2.route.VirtualHost":                    "envoy.config.route.v3.VirtualHost",
+	"envoy.api.v2.auth.UpstreamTlsContext":              "envoy.extensions.transport_sockets.tls.v3.UpstreamTlsContext",
+	"envoy.api.v2.auth.DownstreamTlsContext":            "envoy.extensions.transport_sockets.tls.v3.DownstreamTlsContext",
+	"envoy.config.accesslog.v2.FileAccessLog":           "envoy.extensions.access_loggers.file.v3.FileAccessLog",
+	"envoy.config.accesslog.v2.HttpGrpcAccessLogConfig": "envoy.extensions.access_loggers.grpc.v3.HttpGrpcAccessLogConfig",
+	"envoy.config.accesslog.v2.TcpGrpcAccessLogConfig":  "envoy.extensions.access_loggers.grpc.v3.TcpGrpcAccessLogConfig",
+}
+
+// renamedFilters maps the v2 filter packages renamed in v3.
+var renamedFilters = map[string]string{
+	"rate_limit":       "ratelimit",
+	"local_rate_limit": "local_ratelimit",
+}
+
+var (
+	// v2FilterType matches the v2 filter configs, such as
+	// envoy.config.filter.network.tcp_proxy.v2.TcpProxy. Thrift filters are network filters in v3, and
+	// UDP filters have no v3 version yet.
+	v2FilterType = regexp.MustCompile(`^envoy\.config\.filter\.(network|http|listener|thrift)\.(\w+)\.v\d+(alpha\d*)?\.(\w+)$`)
+	// v2TraceType matches the v2 tracing provider configs.
+	v2TraceType = regexp.MustCompile(`^envoy\.config\.trace\.v2(alpha)?\.(\w+)$`)
+
+	anyType = reflect.TypeOf(&any.Any{})
+)
+
+// upgradedType returns the name of the v3 message replacing a v2 message, or an empty string if
+// the message is not a v2 message, or the v3 message is not known.
+func upgradedType(name string) string {
+	v3Name, f := v2Types[name]
+	if !f {
+		if m := v2FilterType.FindStringSubmatch(name); m != nil {
+			filter := m[2]
+			if renamed, f := renamedFilters[filter]; f {
+				filter = renamed
+			}
+			if m[1] == "thrift" {
+				v3Name = fmt.Sprintf("envoy.extensions.filters.network.thrift_proxy.filters.%s.v3.%s", filter, m[4])
+			} else {
+				v3Name = fmt.Sprintf("envoy.extensions.filters.%s.%s.v3.%s", m[1], filter, m[4])
+			}
+		} else if m := v2TraceType.FindStringSubmatch(name); m != nil {
+			v3Name = "envoy.config.trace.v3." + m[2]
+		}
+	}
+	if v3Name == "" || proto.MessageType(v3Name) == nil {
+		return ""
+	}
+	return v3Name
+}
+
+// maxCachedConversions bounds the size of the conversion cache, which is reset when it grows past
+// this size.
+const maxCachedConversions = 20000
+
+// conversions caches the converted resources by the hash of the v2 resource, as the same resources
+// are converted for every v3 connection on every push.
+var conversions = struct {
+	sync.RWMutex
+	entries map[[sha256.Size]byte]*any.Any
+}{entries: map[[sha256.Size]byte]*any.Any{}}
+
+// ConvertResource converts a resource generated with the v2 API to the equivalent v3 message.
+// The v2 and v3 messages are wire compatible, deprecated v2 fields are kept as hidden fields in v3.
+// Typed configs embedded in the resource, such as filter configs and transport sockets, are converted
+// as well. Resources and typed configs without a known v3 version are returned unchanged.
+//
+// The resource passed in is not modified, as it may be shared by several connections. The returned
+// resource may be shared as well, and must not be modified.
+func ConvertResource(r *any.Any) (*any.Any, error) {
+	h := sha256.New()
+	_, _ = h.Write([]byte(r.TypeUrl))
+	_, _ = h.Write([]byte{0})
+	_, _ = h.Write(r.Value)
+	var key [sha256.Size]byte
+	copy(key[:], h.Sum(nil))
+
+	conversions.RLock()
+	converted, f := conversions.entries[key]
+	conversions.RUnlock()
+	if f {
+		return converted, nil
+	}
+
+	converted, err := convertResource(r)
+	if err != nil {
+		return nil, err
+	}
+	conversions.Lock()
+	if len(conversions.entries) >= maxCachedConversions {
+		conversions.entries = map[[sha256.Size]byte]*any.Any{}
+	}
+	conversions.entries[key] = converted
+	conversions.Unlock()
+	return converted, nil
+}
+
+func convertResource(r *any.Any) (*any.Any, error) {
+	v3Name := upgradedType(strings.TrimPrefix(r.TypeUrl, typePrefix))
+	if v3Name == "" {
+		return r, nil
+	}
+	msg := reflect.New(proto.MessageType(v3Name).Elem()).Interface().(proto.Message)
+	if err := proto.Unmarshal(r.Value, msg); err != nil {
+		return nil, fmt.Errorf("failed to convert %s to %s: %v", r.TypeUrl, v3Name, err)
+	}
+	if err := convertTypedConfigs(reflect.ValueOf(msg)); err != nil {
+		return nil, err
+	}
+	// Marshal deterministically, like the v2 resources, so the content versions are stable.
+	out, err := util.MessageToAnyWithError(msg)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal %s: %v", v3Name, err)
+	}
+	return out, nil
+}
+
+// convertTypedConfigs converts in place the Any fields found in the message. The message must have
+// been freshly unmarshaled, so the Any fields are not shared.
+func convertTypedConfigs(v reflect.Value) error {
+	switch v.Kind() {
+	case reflect.Ptr:
+		if v.IsNil() {
+			return nil
+		}
+		if v.Type() == anyType {
+			a := v.Interface().(*any.Any)
+			converted, err := convertResource(a)
+			if err != nil {
+				return err
+			}
+			*a = *converted
+			return nil
+		}
+		return convertTypedConfigs(v.Elem())
+	case reflect.Interface:
+		if v.IsNil() {
+			return nil
+		}
+		return convertTypedConfigs(v.Elem())
+	case reflect.Struct:
+		for i := 0; i < v.NumField(); i++ {
+			if strings.HasPrefix(v.Type().Field(i).Name, "XXX_") {
+				continue
+			}
+			if err := convertTypedConfigs(v.Field(i)); err != nil {
+				return err
+			}
+		}
+	case reflect.Slice:
+		if v.Type().Elem().Kind() == reflect.Uint8 {
+			return nil
+		}
+		for i := 0; i < v.Len(); i++ {
+			if err := convertTypedConfigs(v.Index(i)); err != nil {
+				return err
+			}
+		}
+	case reflect.Map:
+		iter := v.MapRange()
+		for iter.Next() {
+			if err := convertTypedConfigs(iter.Value()); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
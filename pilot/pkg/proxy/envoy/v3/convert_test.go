@@ -0,0 +1,145 @@
+// Copyright 2020 Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package v3
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+
+	xdsapi "github.com/envoyproxy/go-control-plane/envoy/api/v2"
+	listener "github.com/envoyproxy/go-control-plane/envoy/api/v2/listener"
+	extauthz "github.com/envoyproxy/go-control-plane/envoy/config/filter/http/ext_authz/v2"
+	ratelimit "github.com/envoyproxy/go-control-plane/envoy/config/filter/http/rate_limit/v2"
+	hcm "github.com/envoyproxy/go-control-plane/envoy/config/filter/network/http_connection_manager/v2"
+	kafka "github.com/envoyproxy/go-control-plane/envoy/config/filter/network/kafka_broker/v2alpha1"
+	localratelimit "github.com/envoyproxy/go-control-plane/envoy/config/filter/network/local_rate_limit/v2alpha"
+	thrift "github.com/envoyproxy/go-control-plane/envoy/config/filter/network/thrift_proxy/v2alpha1"
+	zookeeper "github.com/envoyproxy/go-control-plane/envoy/config/filter/network/zookeeper_proxy/v1alpha1"
+	thriftratelimit "github.com/envoyproxy/go-control-plane/envoy/config/filter/thrift/rate_limit/v2alpha1"
+	listenerv3 "github.com/envoyproxy/go-control-plane/envoy/config/listener/v3"
+	hcmv3 "github.com/envoyproxy/go-control-plane/envoy/extensions/filters/network/http_connection_manager/v3"
+	thriftv3 "github.com/envoyproxy/go-control-plane/envoy/extensions/filters/network/thrift_proxy/v3"
+	"github.com/golang/protobuf/ptypes"
+
+	"istio.io/istio/pilot/pkg/networking/util"
+)
+
+func TestUpgradedType(t *testing.T) {
+	cases := map[string]string{
+		"envoy.api.v2.Cluster":                                          "envoy.config.cluster.v3.Cluster",
+		"envoy.config.filter.http.ext_authz.v2.ExtAuthz":                "envoy.extensions.filters.http.ext_authz.v3.ExtAuthz",
+		"envoy.config.filter.http.on_demand.v2.OnDemand":                "envoy.extensions.filters.http.on_demand.v3.OnDemand",
+		"envoy.config.filter.http.rate_limit.v2.RateLimit":              "envoy.extensions.filters.http.ratelimit.v3.RateLimit",
+		"envoy.config.filter.network.kafka_broker.v2alpha1.KafkaBroker": "envoy.extensions.filters.network.kafka_broker.v3.KafkaBroker",
+		"envoy.config.filter.network.local_rate_limit.v2alpha.LocalRateLimit": "" +
+			"envoy.extensions.filters.network.local_ratelimit.v3.LocalRateLimit",
+		"envoy.config.filter.network.rate_limit.v2.RateLimit":                 "envoy.extensions.filters.network.ratelimit.v3.RateLimit",
+		"envoy.config.filter.network.zookeeper_proxy.v1alpha1.ZooKeeperProxy": "envoy.extensions.filters.network.zookeeper_proxy.v3.ZooKeeperProxy",
+		"envoy.config.filter.thrift.rate_limit.v2alpha1.RateLimit": "" +
+			"envoy.extensions.filters.network.thrift_proxy.filters.ratelimit.v3.RateLimit",
+		// The UDP filters have no v3 version in this go-control-plane.
+		"envoy.config.filter.udp.udp_proxy.v2alpha.UdpProxyConfig":   "",
+		"istio.envoy.config.filter.http.authn.v2alpha1.FilterConfig": "",
+	}
+	for v2Name, want := range cases {
+		if got := upgradedType(v2Name); got != want {
+			t.Errorf("upgradedType(%s): got %q, want %q", v2Name, got, want)
+		}
+	}
+}
+
+func TestConvertResource(t *testing.T) {
+	httpManager := &hcm.HttpConnectionManager{
+		StatPrefix: "http",
+		HttpFilters: []*hcm.HttpFilter{
+			{Name: "ext_authz", ConfigType: &hcm.HttpFilter_TypedConfig{TypedConfig: util.MessageToAny(&extauthz.ExtAuthz{})}},
+			{Name: "rate_limit", ConfigType: &hcm.HttpFilter_TypedConfig{TypedConfig: util.MessageToAny(&ratelimit.RateLimit{Domain: "d"})}},
+		},
+	}
+	thriftProxy := &thrift.ThriftProxy{
+		StatPrefix: "thrift",
+		ThriftFilters: []*thrift.ThriftFilter{{
+			Name:       "rate_limit",
+			ConfigType: &thrift.ThriftFilter_TypedConfig{TypedConfig: util.MessageToAny(&thriftratelimit.RateLimit{Domain: "d"})},
+		}},
+	}
+	l := &xdsapi.Listener{
+		Name: "listener",
+		FilterChains: []*listener.FilterChain{{
+			Filters: []*listener.Filter{
+				{Name: "hcm", ConfigType: &listener.Filter_TypedConfig{TypedConfig: util.MessageToAny(httpManager)}},
+				{Name: "thrift", ConfigType: &listener.Filter_TypedConfig{TypedConfig: util.MessageToAny(thriftProxy)}},
+				{Name: "kafka", ConfigType: &listener.Filter_TypedConfig{TypedConfig: util.MessageToAny(&kafka.KafkaBroker{StatPrefix: "k"})}},
+				{Name: "zk", ConfigType: &listener.Filter_TypedConfig{TypedConfig: util.MessageToAny(&zookeeper.ZooKeeperProxy{StatPrefix: "z"})}},
+				{Name: "local", ConfigType: &listener.Filter_TypedConfig{TypedConfig: util.MessageToAny(&localratelimit.LocalRateLimit{StatPrefix: "l"})}},
+			},
+		}},
+	}
+	r := util.MessageToAny(l)
+
+	converted, err := ConvertResource(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if converted.TypeUrl != ListenerType {
+		t.Fatalf("unexpected type %s", converted.TypeUrl)
+	}
+	v3Listener := &listenerv3.Listener{}
+	if err := ptypes.UnmarshalAny(converted, v3Listener); err != nil {
+		t.Fatal(err)
+	}
+	got := []string{}
+	for _, f := range v3Listener.FilterChains[0].Filters {
+		got = append(got, f.GetTypedConfig().TypeUrl)
+	}
+	v3Manager := &hcmv3.HttpConnectionManager{}
+	if err := ptypes.UnmarshalAny(v3Listener.FilterChains[0].Filters[0].GetTypedConfig(), v3Manager); err != nil {
+		t.Fatal(err)
+	}
+	for _, f := range v3Manager.HttpFilters {
+		got = append(got, f.GetTypedConfig().TypeUrl)
+	}
+	v3Thrift := &thriftv3.ThriftProxy{}
+	if err := ptypes.UnmarshalAny(v3Listener.FilterChains[0].Filters[1].GetTypedConfig(), v3Thrift); err != nil {
+		t.Fatal(err)
+	}
+	got = append(got, v3Thrift.ThriftFilters[0].GetTypedConfig().TypeUrl)
+	want := []string{
+		typePrefix + "envoy.extensions.filters.network.http_connection_manager.v3.HttpConnectionManager",
+		typePrefix + "envoy.extensions.filters.network.thrift_proxy.v3.ThriftProxy",
+		typePrefix + "envoy.extensions.filters.network.kafka_broker.v3.KafkaBroker",
+		typePrefix + "envoy.extensions.filters.network.zookeeper_proxy.v3.ZooKeeperProxy",
+		typePrefix + "envoy.extensions.filters.network.local_ratelimit.v3.LocalRateLimit",
+		typePrefix + "envoy.extensions.filters.http.ext_authz.v3.ExtAuthz",
+		typePrefix + "envoy.extensions.filters.http.ratelimit.v3.RateLimit",
+		typePrefix + "envoy.extensions.filters.network.thrift_proxy.filters.ratelimit.v3.RateLimit",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("unexpected typed configs:\n got: %v\nwant: %v", got, want)
+	}
+
+	// The conversion is deterministic, and cached.
+	again, err := convertResource(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(again.Value, converted.Value) {
+		t.Fatal("expected the conversion to be deterministic")
+	}
+	if cached, _ := ConvertResource(r); cached != converted {
+		t.Fatal("expected the conversion to be cached")
+	}
+}
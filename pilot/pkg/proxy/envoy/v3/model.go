@@ -21,4 +21,7 @@ const (
 	ClusterType  = resource.ClusterType
 	ListenerType = resource.ListenerType
 	RouteType    = resource.RouteType
+
+	// VirtualHostType is used for on demand virtual host discovery (VHDS).
+	VirtualHostType = "type.googleapis.com/envoy.config.route.v3.VirtualHost"
 )
@@ -35,4 +35,7 @@ type PolicyApplier interface {
 	// AuthNFilter returns the (authn) HTTP filter to enforce the underlying authentication policy.
 	// It may return nil, if no authentication is needed.
 	AuthNFilter(proxyType model.NodeType, port uint32) *http_conn.HttpFilter
+
+	// GetMutualTLSModeForPort returns the effective mutual TLS mode of the given endpoint (aka workload) port.
+	GetMutualTLSModeForPort(endpointPort uint32) model.MutualTLSMode
 }
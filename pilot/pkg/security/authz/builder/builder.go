@@ -38,31 +38,83 @@ var (
 // Builder builds Istio authorization policy to Envoy RBAC filter.
 type Builder struct {
 	trustDomainBundle  trustdomain.Bundle
+	customPolicies     []model.AuthorizationPolicyConfig
+	extAuthz           *extAuthzProvider
 	denyPolicies       []model.AuthorizationPolicyConfig
 	allowPolicies      []model.AuthorizationPolicyConfig
+	auditPolicies      []model.AuthorizationPolicyConfig
 	isIstioVersionGE15 bool
 }
 
-// New returns a new builder for the given workload with the authorization policy.
+// New returns a new builder for the given workload with the authorization policy. The CUSTOM policies use
+// the external authorizers of extAuthzProviders, declared in the mesh config.
 // Returns nil if none of the authorization policies are enabled for the workload.
 func New(trustDomainBundle trustdomain.Bundle, workload labels.Collection, namespace string,
-	policies *model.AuthorizationPolicies, isIstioVersionGE15 bool) *Builder {
-	denyPolicies, allowPolicies := policies.ListAuthorizationPolicies(namespace, workload)
-	if len(denyPolicies) == 0 && len(allowPolicies) == 0 {
+	policies *model.AuthorizationPolicies, isIstioVersionGE15 bool, extAuthzProviders map[string]string) *Builder {
+	result := policies.ListAuthorizationPolicies(namespace, workload)
+	if len(result.Custom) == 0 && len(result.Deny) == 0 && len(result.Allow) == 0 && len(result.Audit) == 0 {
 		return nil
 	}
-	return &Builder{
+	b := &Builder{
 		trustDomainBundle:  trustDomainBundle,
-		denyPolicies:       denyPolicies,
-		allowPolicies:      allowPolicies,
+		denyPolicies:       result.Deny,
+		allowPolicies:      result.Allow,
+		auditPolicies:      result.Audit,
 		isIstioVersionGE15: isIstioVersionGE15,
 	}
+	if len(result.Custom) > 0 {
+		provider, err := extAuthzProviderOf(result.Custom, parseExtAuthzProviders(extAuthzProviders))
+		if err != nil {
+			// Fail closed: the requests that cannot be checked by the external authorizer are denied.
+			authzLog.Errorf("denying the requests matching the CUSTOM policies: %v", err)
+			b.denyPolicies = append(append([]model.AuthorizationPolicyConfig{}, result.Custom...), result.Deny...)
+		} else {
+			b.customPolicies = result.Custom
+			b.extAuthz = provider
+		}
+	}
+	if len(b.customPolicies) > 0 && len(b.auditPolicies) > 0 {
+		// The RBAC HTTP filters record their shadow results in the same dynamic metadata and stats, so the
+		// AUDIT results could not be told apart from the CUSTOM ones.
+		authzLog.Errorf("ignoring the AUDIT policies of a workload with CUSTOM policies, which are not supported together")
+		b.auditPolicies = nil
+	}
+	if len(b.auditPolicies) > 0 {
+		// The shadow results of the dry-run policies would be overwritten by the AUDIT filter, which comes last.
+		b.denyPolicies = withoutDryRun(b.denyPolicies)
+		b.allowPolicies = withoutDryRun(b.allowPolicies)
+	}
+	return b
 }
 
-// BuilderHTTP returns the RBAC HTTP filters built from the authorization policy.
+// withoutDryRun returns the policies that are not in dry-run mode.
+func withoutDryRun(policies []model.AuthorizationPolicyConfig) []model.AuthorizationPolicyConfig {
+	var out []model.AuthorizationPolicyConfig
+	for _, policy := range policies {
+		if policy.DryRun {
+			authzLog.Errorf("ignoring the dry-run policy %s/%s of a workload with AUDIT policies, which are not supported together",
+				policy.Namespace, policy.Name)
+			continue
+		}
+		out = append(out, policy)
+	}
+	return out
+}
+
+// BuilderHTTP returns the RBAC HTTP filters built from the authorization policy, in order: the CUSTOM
+// policies, their ext_authz filter and the check of the ext_authz result, the DENY policies, the ALLOW
+// policies and the AUDIT policies.
 func (b Builder) BuildHTTP() []*httppb.HttpFilter {
 	var filters []*httppb.HttpFilter
 
+	if customConfig := buildShadow(b.customPolicies, b.trustDomainBundle,
+		false /* forTCP */, b.isIstioVersionGE15); customConfig != nil {
+		customConfig.Rules = buildExtAuthzAllowedHeaderRules()
+		filters = append(filters, createHTTPFilter(customConfig), createExtAuthzHTTPFilter(b.extAuthz))
+		if checkConfig := buildExtAuthzCheck(b.customPolicies, b.trustDomainBundle, b.isIstioVersionGE15); checkConfig != nil {
+			filters = append(filters, createHTTPFilter(checkConfig))
+		}
+	}
 	if denyConfig := build(b.denyPolicies, b.trustDomainBundle,
 		false /* forTCP */, true /* forDeny */, b.isIstioVersionGE15); denyConfig != nil {
 		filters = append(filters, createHTTPFilter(denyConfig))
@@ -71,15 +123,21 @@ func (b Builder) BuildHTTP() []*httppb.HttpFilter {
 		false /* forTCP */, false /* forDeny */, b.isIstioVersionGE15); allowConfig != nil {
 		filters = append(filters, createHTTPFilter(allowConfig))
 	}
+	if auditConfig := buildShadow(b.auditPolicies, b.trustDomainBundle,
+		false /* forTCP */, b.isIstioVersionGE15); auditConfig != nil {
+		filters = append(filters, createHTTPFilter(auditConfig))
+	}
 
 	return filters
 }
 
-// BuildTCP returns the RBAC TCP filters built from the authorization policy.
+// BuildTCP returns the RBAC TCP filters built from the authorization policy. The connections matching the
+// CUSTOM policies are denied.
 func (b Builder) BuildTCP() []*tcppb.Filter {
 	var filters []*tcppb.Filter
 
-	if denyConfig := build(b.denyPolicies, b.trustDomainBundle,
+	denyPolicies := append(append([]model.AuthorizationPolicyConfig{}, b.customPolicies...), b.denyPolicies...)
+	if denyConfig := build(denyPolicies, b.trustDomainBundle,
 		true /* forTCP */, true /* forDeny */, b.isIstioVersionGE15); denyConfig != nil {
 		filters = append(filters, createTCPFilter(denyConfig))
 	}
@@ -87,6 +145,10 @@ func (b Builder) BuildTCP() []*tcppb.Filter {
 		true /* forTCP */, false /* forDeny */, b.isIstioVersionGE15); allowConfig != nil {
 		filters = append(filters, createTCPFilter(allowConfig))
 	}
+	if auditConfig := buildShadow(b.auditPolicies, b.trustDomainBundle,
+		true /* forTCP */, b.isIstioVersionGE15); auditConfig != nil {
+		filters = append(filters, createTCPFilter(auditConfig))
+	}
 
 	return filters
 }
@@ -96,6 +158,41 @@ func build(policies []model.AuthorizationPolicyConfig, tdBundle trustdomain.Bund
 		return nil
 	}
 
+	var enforced []model.AuthorizationPolicyConfig
+	dryRun := false
+	for _, policy := range policies {
+		if policy.DryRun {
+			dryRun = true
+		} else {
+			enforced = append(enforced, policy)
+		}
+	}
+	config := &rbachttppb.RBAC{
+		Rules: buildRules(enforced, tdBundle, forTCP, forDeny, isIstioVersionGE15),
+	}
+	if dryRun {
+		// The shadow rules also include the enforced policies, so that the shadow result of the filter is the
+		// result it would have with the dry-run policies enforced.
+		config.ShadowRules = buildRules(policies, tdBundle, forTCP, forDeny, isIstioVersionGE15)
+	}
+	return config
+}
+
+// buildShadow returns an RBAC config that enforces nothing, but records the policy matched by the request as
+// the shadow_effective_policy_id dynamic metadata of the filter.
+func buildShadow(policies []model.AuthorizationPolicyConfig, tdBundle trustdomain.Bundle, forTCP, isIstioVersionGE15 bool) *rbachttppb.RBAC {
+	rules := buildRules(policies, tdBundle, forTCP, false /* forDeny */, isIstioVersionGE15)
+	if rules == nil || len(rules.Policies) == 0 {
+		return nil
+	}
+	return &rbachttppb.RBAC{ShadowRules: rules}
+}
+
+func buildRules(policies []model.AuthorizationPolicyConfig, tdBundle trustdomain.Bundle, forTCP, forDeny, isIstioVersionGE15 bool) *rbacpb.RBAC {
+	if len(policies) == 0 {
+		return nil
+	}
+
 	rules := &rbacpb.RBAC{
 		Action:   rbacpb.RBAC_ALLOW,
 		Policies: map[string]*rbacpb.Policy{},
@@ -128,7 +225,7 @@ func build(policies []model.AuthorizationPolicyConfig, tdBundle trustdomain.Bund
 		}
 	}
 
-	return &rbachttppb.RBAC{Rules: rules}
+	return rules
 }
 
 // nolint: interfacer
@@ -147,8 +244,9 @@ func createTCPFilter(config *rbachttppb.RBAC) *tcppb.Filter {
 		return nil
 	}
 	rbacConfig := &rbactcppb.RBAC{
-		Rules:      config.Rules,
-		StatPrefix: authzmodel.RBACTCPFilterStatPrefix,
+		Rules:       config.Rules,
+		ShadowRules: config.ShadowRules,
+		StatPrefix:  authzmodel.RBACTCPFilterStatPrefix,
 	}
 	return &tcppb.Filter{
 		Name:       authzmodel.RBACTCPFilterName,
@@ -42,6 +42,11 @@ var (
 			"version": "v1",
 		},
 	}
+
+	extAuthzProviders = map[string]string{
+		"opa":        "grpc://opa.istio-system.svc.cluster.local:9191",
+		"http-authz": "http://authz.istio-system.svc.cluster.local:8000/check",
+	}
 )
 
 func TestGenerator_GenerateHTTP(t *testing.T) {
@@ -70,6 +75,44 @@ func TestGenerator_GenerateHTTP(t *testing.T) {
 				"action-both-deny-out.yaml",
 				"action-both-allow-out.yaml"},
 		},
+		{
+			name:  "action-audit",
+			input: "action-audit-in.yaml",
+			want: []string{
+				"action-audit-allow-out.yaml",
+				"action-audit-out.yaml"},
+		},
+		{
+			name:  "action-custom",
+			input: "action-custom-in.yaml",
+			want: []string{
+				"action-custom-rbac-out.yaml",
+				"action-custom-ext-authz-out.yaml",
+				"action-custom-check-out.yaml",
+				"action-custom-deny-out.yaml"},
+		},
+		{
+			// The AUDIT policies are ignored, as their shadow results would be mixed up with the CUSTOM ones.
+			name:  "action-custom-audit",
+			input: "action-custom-audit-in.yaml",
+			want: []string{
+				"action-custom-rbac-out.yaml",
+				"action-custom-ext-authz-out.yaml",
+				"action-custom-check-out.yaml"},
+		},
+		{
+			name:  "action-custom-http-provider",
+			input: "action-custom-http-provider-in.yaml",
+			want: []string{
+				"action-custom-http-provider-rbac-out.yaml",
+				"action-custom-http-provider-ext-authz-out.yaml",
+				"action-custom-check-out.yaml"},
+		},
+		{
+			name:  "action-custom-unknown-provider",
+			input: "action-custom-unknown-provider-in.yaml",
+			want:  []string{"action-custom-unknown-provider-out.yaml"},
+		},
 		{
 			name:  "all-fields",
 			input: "all-fields-in.yaml",
@@ -85,6 +128,21 @@ func TestGenerator_GenerateHTTP(t *testing.T) {
 			input: "deny-all-in.yaml",
 			want:  []string{"deny-all-out.yaml"},
 		},
+		{
+			name:  "dry-run",
+			input: "dry-run-in.yaml",
+			want: []string{
+				"dry-run-deny-out.yaml",
+				"dry-run-allow-out.yaml"},
+		},
+		{
+			// The dry-run policies are ignored, as their shadow results would be overwritten by the AUDIT filter.
+			name:  "dry-run-audit",
+			input: "dry-run-audit-in.yaml",
+			want: []string{
+				"dry-run-audit-allow-out.yaml",
+				"dry-run-audit-out.yaml"},
+		},
 		{
 			name:  "multiple-policies",
 			input: "multiple-policies-in.yaml",
@@ -123,7 +181,7 @@ func TestGenerator_GenerateHTTP(t *testing.T) {
 
 	for _, tc := range testCases {
 		t.Run(tc.name, func(t *testing.T) {
-			g := New(tc.tdBundle, httpbin, "foo", yamlPolicy(t, basePath+tc.input), !tc.isVersion14)
+			g := New(tc.tdBundle, httpbin, "foo", yamlPolicy(t, basePath+tc.input), !tc.isVersion14, extAuthzProviders)
 			if g == nil {
 				t.Fatalf("failed to create generator")
 			}
@@ -150,11 +208,30 @@ func TestGenerator_GenerateTCP(t *testing.T) {
 			input: "action-deny-HTTP-for-TCP-filter-in.yaml",
 			want:  []string{"action-deny-HTTP-for-TCP-filter-out.yaml"},
 		},
+		{
+			name:  "action-audit",
+			input: "action-audit-in.yaml",
+			want: []string{
+				"action-audit-TCP-allow-out.yaml",
+				"action-audit-TCP-out.yaml"},
+		},
+		{
+			name:  "action-custom",
+			input: "action-custom-in.yaml",
+			want:  []string{"action-custom-TCP-out.yaml"},
+		},
+		{
+			name:  "dry-run",
+			input: "dry-run-in.yaml",
+			want: []string{
+				"dry-run-TCP-deny-out.yaml",
+				"dry-run-TCP-allow-out.yaml"},
+		},
 	}
 
 	for _, tc := range testCases {
 		t.Run(tc.name, func(t *testing.T) {
-			g := New(tc.tdBundle, httpbin, "foo", yamlPolicy(t, basePath+tc.input), true)
+			g := New(tc.tdBundle, httpbin, "foo", yamlPolicy(t, basePath+tc.input), true, extAuthzProviders)
 			if g == nil {
 				t.Fatalf("failed to create generator")
 			}
@@ -0,0 +1,227 @@
+// Copyright 2020 Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package builder
+
+import (
+	"fmt"
+	"net"
+	"net/url"
+	"strconv"
+	"strings"
+
+	core "github.com/envoyproxy/go-control-plane/envoy/api/v2/core"
+	extauthzhttppb "github.com/envoyproxy/go-control-plane/envoy/config/filter/http/ext_authz/v2"
+	rbachttppb "github.com/envoyproxy/go-control-plane/envoy/config/filter/http/rbac/v2"
+	httppb "github.com/envoyproxy/go-control-plane/envoy/config/filter/network/http_connection_manager/v2"
+	rbacpb "github.com/envoyproxy/go-control-plane/envoy/config/rbac/v2"
+	matcherpb "github.com/envoyproxy/go-control-plane/envoy/type/matcher"
+	"github.com/envoyproxy/go-control-plane/pkg/wellknown"
+	"github.com/golang/protobuf/ptypes"
+
+	"istio.io/istio/pilot/pkg/features"
+	"istio.io/istio/pilot/pkg/model"
+	"istio.io/istio/pilot/pkg/networking/util"
+	"istio.io/istio/pilot/pkg/security/authz/matcher"
+	authzmodel "istio.io/istio/pilot/pkg/security/authz/model"
+	"istio.io/istio/pilot/pkg/security/trustdomain"
+	"istio.io/istio/pkg/config/host"
+)
+
+// The CUSTOM authorization policies delegate the decision on the requests they match to an external
+// authorizer. They are built into an RBAC filter with shadow rules, which records the CUSTOM policy matched by
+// the request, if any, as the shadow_effective_policy_id dynamic metadata, followed by an ext_authz filter
+// calling the external authorizer with this metadata. Envoy cannot skip the ext_authz filter per request, so it
+// is called for all the HTTP requests of the workload: the external authorizer should allow the requests whose
+// shadow_engine_result is "denied", which match no CUSTOM policy.
+//
+// The ext_authz filter allows the requests when the external authorizer fails, so that an outage of the
+// authorizer does not deny the requests matching no CUSTOM policy. The requests matching a CUSTOM policy are
+// then denied by an RBAC filter after the ext_authz filter, unless the external authorizer allowed them with
+// the ExtAuthzAllowedHeader header. The RBAC filter of the shadow rules denies the requests of the clients
+// setting this header.
+//
+// TCP connections matching a CUSTOM policy are denied, as the network ext_authz filter cannot receive the
+// matched policy.
+//
+// The contract of the external authorizers is documented for users in samples/extauthz/README.md.
+
+// ExtAuthzAllowedHeader is the header the external authorizer adds to the requests matching a CUSTOM policy
+// that it allows.
+const ExtAuthzAllowedHeader = "x-istio-ext-authz-allowed"
+
+// extAuthzAllowedHeaderPolicy is the name of the policy denying the requests setting ExtAuthzAllowedHeader.
+const extAuthzAllowedHeaderPolicy = "ext-authz-allowed-header"
+
+// extAuthzProvider is an external authorizer declared in the extAuthzProviders extension of the mesh config.
+type extAuthzProvider struct {
+	name string
+	// grpc is true for an authorizer implementing the Envoy gRPC authorization API, false for an HTTP
+	// authorizer.
+	grpc       bool
+	cluster    string
+	uri        string
+	pathPrefix string
+}
+
+// parseExtAuthzProvider parses the url of a declared external authorizer.
+func parseExtAuthzProvider(name, value string) (*extAuthzProvider, error) {
+	if strings.TrimSpace(name) == "" {
+		return nil, fmt.Errorf("expected a name for url %q", value)
+	}
+	u, err := url.Parse(strings.TrimSpace(value))
+	if err != nil {
+		return nil, fmt.Errorf("invalid url %q: %v", value, err)
+	}
+	provider := &extAuthzProvider{name: strings.TrimSpace(name)}
+	switch u.Scheme {
+	case "grpc":
+		provider.grpc = true
+		if u.Path != "" && u.Path != "/" {
+			return nil, fmt.Errorf("unexpected path in gRPC url %q", value)
+		}
+	case "http":
+		provider.pathPrefix = strings.TrimSuffix(u.Path, "/")
+	default:
+		return nil, fmt.Errorf("unsupported scheme in url %q, expected grpc or http", value)
+	}
+	hostname, p, err := net.SplitHostPort(u.Host)
+	if err != nil {
+		return nil, fmt.Errorf("invalid authority in url %q: %v", value, err)
+	}
+	port, err := strconv.Atoi(p)
+	if err != nil || port <= 0 || port > 65535 {
+		return nil, fmt.Errorf("invalid port in url %q", value)
+	}
+	provider.cluster = model.BuildSubsetKey(model.TrafficDirectionOutbound, "", host.Name(hostname), port)
+	provider.uri = "http://" + u.Host
+	return provider, nil
+}
+
+// parseExtAuthzProviders returns the declared external authorizers, by name. Invalid entries are ignored.
+func parseExtAuthzProviders(providers map[string]string) map[string]*extAuthzProvider {
+	out := map[string]*extAuthzProvider{}
+	for name, value := range providers {
+		provider, err := parseExtAuthzProvider(name, value)
+		if err != nil {
+			authzLog.Errorf("ignoring invalid external authorizer %s: %v", name, err)
+			continue
+		}
+		out[provider.name] = provider
+	}
+	return out
+}
+
+// extAuthzProviderOf returns the external authorizer of the CUSTOM policies of a workload, which must all use
+// the same one of the declared external authorizers.
+func extAuthzProviderOf(policies []model.AuthorizationPolicyConfig, providers map[string]*extAuthzProvider) (*extAuthzProvider, error) {
+	name := ""
+	for _, policy := range policies {
+		if policy.Provider == "" {
+			return nil, fmt.Errorf("policy %s/%s has no %s annotation",
+				policy.Namespace, policy.Name, model.AuthorizationProviderAnnotation)
+		}
+		if name != "" && name != policy.Provider {
+			return nil, fmt.Errorf("policies use different external authorizers %s and %s, only one is supported per workload",
+				name, policy.Provider)
+		}
+		name = policy.Provider
+	}
+	provider, f := providers[name]
+	if !f {
+		return nil, fmt.Errorf("external authorizer %s is not declared in the extAuthzProviders of the mesh config", name)
+	}
+	return provider, nil
+}
+
+func createExtAuthzHTTPFilter(provider *extAuthzProvider) *httppb.HttpFilter {
+	timeout := ptypes.DurationProto(features.ExtAuthzTimeout)
+	config := &extauthzhttppb.ExtAuthz{
+		// The requests matching a CUSTOM policy are denied by the filter built by buildExtAuthzCheck instead.
+		FailureModeAllow:          true,
+		MetadataContextNamespaces: []string{authzmodel.RBACHTTPFilterName},
+	}
+	if provider.grpc {
+		config.Services = &extauthzhttppb.ExtAuthz_GrpcService{
+			GrpcService: &core.GrpcService{
+				TargetSpecifier: &core.GrpcService_EnvoyGrpc_{
+					EnvoyGrpc: &core.GrpcService_EnvoyGrpc{ClusterName: provider.cluster},
+				},
+				Timeout: timeout,
+			},
+		}
+	} else {
+		config.Services = &extauthzhttppb.ExtAuthz_HttpService{
+			HttpService: &extauthzhttppb.HttpService{
+				ServerUri: &core.HttpUri{
+					Uri:              provider.uri,
+					HttpUpstreamType: &core.HttpUri_Cluster{Cluster: provider.cluster},
+					Timeout:          timeout,
+				},
+				PathPrefix: provider.pathPrefix,
+				AuthorizationResponse: &extauthzhttppb.AuthorizationResponse{
+					AllowedUpstreamHeaders: &matcherpb.ListStringMatcher{
+						Patterns: []*matcherpb.StringMatcher{{
+							MatchPattern: &matcherpb.StringMatcher_Exact{Exact: ExtAuthzAllowedHeader},
+						}},
+					},
+				},
+			},
+		}
+	}
+	return &httppb.HttpFilter{
+		Name:       wellknown.HTTPExternalAuthorization,
+		ConfigType: &httppb.HttpFilter_TypedConfig{TypedConfig: util.MessageToAny(config)},
+	}
+}
+
+// extAuthzAllowedHeaderPrincipal matches the requests with the ExtAuthzAllowedHeader header.
+func extAuthzAllowedHeaderPrincipal() *rbacpb.Principal {
+	return &rbacpb.Principal{
+		Identifier: &rbacpb.Principal_Header{Header: matcher.HeaderMatcher(ExtAuthzAllowedHeader, "*")},
+	}
+}
+
+// buildExtAuthzAllowedHeaderRules returns the rules denying the requests whose clients set the
+// ExtAuthzAllowedHeader header, which is only set by the external authorizer.
+func buildExtAuthzAllowedHeaderRules() *rbacpb.RBAC {
+	return &rbacpb.RBAC{
+		Action: rbacpb.RBAC_DENY,
+		Policies: map[string]*rbacpb.Policy{
+			extAuthzAllowedHeaderPolicy: {
+				Permissions: []*rbacpb.Permission{{Rule: &rbacpb.Permission_Any{Any: true}}},
+				Principals:  []*rbacpb.Principal{extAuthzAllowedHeaderPrincipal()},
+			},
+		},
+	}
+}
+
+// buildExtAuthzCheck returns the RBAC config denying the requests matching the CUSTOM policies that the
+// external authorizer did not allow, because it failed.
+func buildExtAuthzCheck(policies []model.AuthorizationPolicyConfig, tdBundle trustdomain.Bundle, isIstioVersionGE15 bool) *rbachttppb.RBAC {
+	rules := buildRules(policies, tdBundle, false /* forTCP */, true /* forDeny */, isIstioVersionGE15)
+	if rules == nil || len(rules.Policies) == 0 {
+		return nil
+	}
+	notAllowed := &rbacpb.Principal{Identifier: &rbacpb.Principal_NotId{NotId: extAuthzAllowedHeaderPrincipal()}}
+	for _, policy := range rules.Policies {
+		policy.Principals = []*rbacpb.Principal{{
+			Identifier: &rbacpb.Principal_AndIds{AndIds: &rbacpb.Principal_Set{Ids: []*rbacpb.Principal{
+				{Identifier: &rbacpb.Principal_OrIds{OrIds: &rbacpb.Principal_Set{Ids: policy.Principals}}},
+				notAllowed,
+			}}},
+		}}
+	}
+	return &rbachttppb.RBAC{Rules: rules}
+}
@@ -0,0 +1,154 @@
+// Copyright 2020 Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package builder
+
+import (
+	"reflect"
+	"testing"
+
+	extauthzhttppb "github.com/envoyproxy/go-control-plane/envoy/config/filter/http/ext_authz/v2"
+	rbachttppb "github.com/envoyproxy/go-control-plane/envoy/config/filter/http/rbac/v2"
+	rbacpb "github.com/envoyproxy/go-control-plane/envoy/config/rbac/v2"
+	"github.com/golang/protobuf/ptypes"
+
+	"istio.io/istio/pilot/pkg/model"
+	"istio.io/istio/pilot/pkg/security/trustdomain"
+)
+
+func TestParseExtAuthzProvider(t *testing.T) {
+	cases := []struct {
+		name string
+		in   string
+		want *extAuthzProvider
+	}{
+		{
+			name: "opa",
+			in:   "grpc://opa.istio-system.svc.cluster.local:9191",
+			want: &extAuthzProvider{
+				name:    "opa",
+				grpc:    true,
+				cluster: "outbound|9191||opa.istio-system.svc.cluster.local",
+				uri:     "http://opa.istio-system.svc.cluster.local:9191",
+			},
+		},
+		{
+			name: " authz ",
+			in:   " http://authz.foo.svc.cluster.local:8000/check/",
+			want: &extAuthzProvider{
+				name:       "authz",
+				cluster:    "outbound|8000||authz.foo.svc.cluster.local",
+				uri:        "http://authz.foo.svc.cluster.local:8000",
+				pathPrefix: "/check",
+			},
+		},
+		{name: "", in: "grpc://opa.istio-system.svc.cluster.local:9191"},
+		{name: "opa", in: "grpc://opa.istio-system.svc.cluster.local"},
+		{name: "opa", in: "grpc://opa.istio-system.svc.cluster.local:9191/check"},
+		{name: "opa", in: "https://opa.istio-system.svc.cluster.local:443"},
+		{name: "opa", in: "http://opa.istio-system.svc.cluster.local:0"},
+	}
+	for _, tc := range cases {
+		t.Run(tc.in, func(t *testing.T) {
+			got, err := parseExtAuthzProvider(tc.name, tc.in)
+			if tc.want == nil {
+				if err == nil {
+					t.Errorf("expected an error, got %+v", got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, tc.want) {
+				t.Errorf("expected %+v, got %+v", tc.want, got)
+			}
+		})
+	}
+}
+
+func TestExtAuthzProviderOf(t *testing.T) {
+	providers := parseExtAuthzProviders(map[string]string{
+		"opa":     "grpc://opa.istio-system.svc.cluster.local:9191",
+		"invalid": "invalid",
+	})
+	if len(providers) != 1 {
+		t.Fatalf("expected the opa provider only, got %v", providers)
+	}
+
+	custom := func(name, provider string) model.AuthorizationPolicyConfig {
+		return model.AuthorizationPolicyConfig{
+			Name:      name,
+			Namespace: "foo",
+			Action:    model.AuthorizationActionCustom,
+			Provider:  provider,
+		}
+	}
+	if got, err := extAuthzProviderOf([]model.AuthorizationPolicyConfig{custom("a", "opa"), custom("b", "opa")}, providers); err != nil ||
+		got.name != "opa" {
+		t.Errorf("expected the opa provider, got %v, %v", got, err)
+	}
+	for name, policies := range map[string][]model.AuthorizationPolicyConfig{
+		"no provider":         {custom("a", "")},
+		"unknown provider":    {custom("a", "unknown")},
+		"different providers": {custom("a", "opa"), custom("b", "other")},
+	} {
+		if _, err := extAuthzProviderOf(policies, providers); err == nil {
+			t.Errorf("%s: expected an error", name)
+		}
+	}
+}
+
+func TestExtAuthzFailureMode(t *testing.T) {
+	filters := New(trustdomain.Bundle{}, httpbin, "foo", yamlPolicy(t, basePath+"action-custom-in.yaml"), true, extAuthzProviders).BuildHTTP()
+	if len(filters) < 3 {
+		t.Fatalf("expected the CUSTOM filters, got %v", filters)
+	}
+
+	extAuthz := &extauthzhttppb.ExtAuthz{}
+	if err := ptypes.UnmarshalAny(filters[1].GetTypedConfig(), extAuthz); err != nil {
+		t.Fatal(err)
+	}
+	if !extAuthz.FailureModeAllow {
+		t.Error("expected the requests to be allowed by the ext_authz filter when the external authorizer fails")
+	}
+
+	// When the external authorizer fails, the requests matching a CUSTOM policy are denied by the next filter,
+	// as they miss the header set by the external authorizer.
+	check := &rbachttppb.RBAC{}
+	if err := ptypes.UnmarshalAny(filters[2].GetTypedConfig(), check); err != nil {
+		t.Fatal(err)
+	}
+	if check.GetRules().GetAction() != rbacpb.RBAC_DENY {
+		t.Fatalf("expected a DENY filter, got %v", check)
+	}
+	policy, f := check.GetRules().GetPolicies()["ns[foo]-policy[httpbin-custom]-rule[0]"]
+	if !f {
+		t.Fatalf("expected the CUSTOM policy to be denied, got %v", check)
+	}
+	ids := policy.GetPrincipals()[0].GetAndIds().GetIds()
+	if len(ids) != 2 || ids[1].GetNotId().GetHeader().GetName() != ExtAuthzAllowedHeader {
+		t.Errorf("expected the requests allowed by the external authorizer to be excluded, got %v", policy.GetPrincipals())
+	}
+
+	// The clients cannot set the header of the external authorizer.
+	custom := &rbachttppb.RBAC{}
+	if err := ptypes.UnmarshalAny(filters[0].GetTypedConfig(), custom); err != nil {
+		t.Fatal(err)
+	}
+	if custom.GetRules().GetAction() != rbacpb.RBAC_DENY ||
+		custom.GetRules().GetPolicies()[extAuthzAllowedHeaderPolicy].GetPrincipals()[0].GetHeader().GetName() != ExtAuthzAllowedHeader {
+		t.Errorf("expected the requests with the header %s to be denied, got %v", ExtAuthzAllowedHeader, custom.GetRules())
+	}
+}
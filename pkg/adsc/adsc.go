@@ -22,21 +22,30 @@ import (
 	"fmt"
 	"io/ioutil"
 	"net"
+	"strings"
 	"sync"
 	"time"
 
+	"istio.io/istio/pilot/pkg/config/memory"
+	"istio.io/istio/pilot/pkg/model"
 	"istio.io/istio/pilot/pkg/networking/util"
+	"istio.io/istio/pkg/config/schema/collection"
+	"istio.io/istio/pkg/config/schema/collections"
+	"istio.io/istio/pkg/config/schema/resource"
 
 	xdsapi "github.com/envoyproxy/go-control-plane/envoy/api/v2"
 	core "github.com/envoyproxy/go-control-plane/envoy/api/v2/core"
 	ads "github.com/envoyproxy/go-control-plane/envoy/service/discovery/v2"
 	"github.com/envoyproxy/go-control-plane/pkg/conversion"
+	gogoproto "github.com/gogo/protobuf/proto"
+	"github.com/gogo/protobuf/types"
 	"github.com/golang/protobuf/jsonpb"
 	"github.com/golang/protobuf/proto"
 	pstruct "github.com/golang/protobuf/ptypes/struct"
 	"google.golang.org/grpc"
 	"google.golang.org/grpc/credentials"
 
+	mcp "istio.io/api/mcp/v1alpha1"
 	istiolog "istio.io/pkg/log"
 )
 
@@ -57,6 +66,10 @@ type Config struct {
 	// IP is currently the primary key used to locate inbound configs. It is sent by client,
 	// must match a known endpoint IP. Tests can use a ServiceEntry to register fake IPs.
 	IP string
+
+	// Store holds the Istio configs received after calling WatchConfig. Defaults to an in memory
+	// store for all the known collections.
+	Store model.ConfigStore
 }
 
 // ADSC implements a basic client for ADS, for use in stress tests and tools
@@ -101,6 +114,9 @@ type ADSC struct {
 	// If nil, the defaults will be used.
 	Metadata *pstruct.Struct
 
+	// Store holds the Istio configs received from pilot.
+	Store model.ConfigStore
+
 	// Updates includes the type of the last update received from the server.
 	Updates     chan string
 	VersionInfo map[string]string
@@ -121,6 +137,9 @@ const (
 	listenerType = typePrefix + "Listener"
 	// RouteType is sent after listeners.
 	routeType = typePrefix + "RouteConfiguration"
+
+	// mcpResourceType is the type of the Istio configs, enveloped in MCP Resources.
+	mcpResourceType = "type.googleapis.com/istio.mcp.v1alpha1.Resource"
 )
 
 var (
@@ -148,6 +167,10 @@ func Dial(url string, certDir string, opts *Config) (*ADSC, error) {
 		opts.Workload = "test-1"
 	}
 	adsc.Metadata = opts.Meta
+	adsc.Store = opts.Store
+	if adsc.Store == nil {
+		adsc.Store = memory.Make(collections.All)
+	}
 
 	adsc.nodeID = fmt.Sprintf("%s~%s~%s.%s~%s.svc.cluster.local", opts.NodeType, opts.IP,
 		opts.Workload, opts.Namespace, opts.Namespace)
@@ -261,6 +284,7 @@ func (a *ADSC) handleRecv() {
 		clusters := []*xdsapi.Cluster{}
 		routes := []*xdsapi.RouteConfiguration{}
 		eds := []*xdsapi.ClusterLoadAssignment{}
+		var configs []*mcp.Resource
 		for _, rsc := range msg.Resources { // Any
 			a.VersionInfo[rsc.TypeUrl] = msg.VersionInfo
 			valBytes := rsc.Value
@@ -280,6 +304,13 @@ func (a *ADSC) handleRecv() {
 				ll := &xdsapi.RouteConfiguration{}
 				_ = proto.Unmarshal(valBytes, ll)
 				routes = append(routes, ll)
+			} else if rsc.TypeUrl == mcpResourceType {
+				r := &mcp.Resource{}
+				if err := gogoproto.Unmarshal(valBytes, r); err != nil {
+					adscLog.Warnf("invalid config resource: %v", err)
+					continue
+				}
+				configs = append(configs, r)
 			}
 		}
 
@@ -300,6 +331,10 @@ func (a *ADSC) handleRecv() {
 		if len(routes) > 0 {
 			a.handleRDS(routes)
 		}
+		// Config responses may legitimately be empty, all configs of the type were removed.
+		if _, f := collections.All.FindByGroupVersionKind(parseGroupVersionKind(msg.TypeUrl)); f {
+			a.handleConfig(msg.TypeUrl, configs)
+		}
 	}
 
 }
@@ -315,6 +350,12 @@ func (a *ADSC) handleLDS(ll []*xdsapi.Listener) {
 	for _, l := range ll {
 		ldsSize += proto.Size(l)
 
+		if len(l.FilterChains) == 0 {
+			// UDP listeners only have listener filters.
+			adscLog.Debugf("LDS: %s has no filter chains", l.Name)
+			continue
+		}
+
 		// The last filter is the actual destination for inbound listener
 		filter := l.FilterChains[len(l.FilterChains)-1].Filters[0]
 
@@ -638,6 +679,99 @@ func (a *ADSC) EndpointsJSON() string {
 	return string(out)
 }
 
+// WatchConfig requests the Istio configs of the given types, identified by the GroupVersionKind of
+// their collection - for example "networking.istio.io/v1alpha3/VirtualService". The configs are
+// kept in Store. Pilot only serves configs to clients using the "api" generator, selected with the
+// GENERATOR node metadata.
+func (a *ADSC) WatchConfig(typeURLs ...string) {
+	for _, t := range typeURLs {
+		a.sendRsc(t, nil)
+	}
+}
+
+// handleConfig replaces the configs of the type in Store with the received ones.
+func (a *ADSC) handleConfig(typeURL string, resources []*mcp.Resource) {
+	gvk := parseGroupVersionKind(typeURL)
+	schema, _ := collections.All.FindByGroupVersionKind(gvk)
+
+	received := map[string]struct{}{}
+	for _, r := range resources {
+		c, err := toConfig(schema, r)
+		if err != nil {
+			adscLog.Warnf("invalid %s config %s: %v", typeURL, r.GetMetadata().GetName(), err)
+			continue
+		}
+		received[c.Namespace+"/"+c.Name] = struct{}{}
+		if a.Store.Get(gvk, c.Name, c.Namespace) == nil {
+			_, err = a.Store.Create(*c)
+		} else {
+			_, err = a.Store.Update(*c)
+		}
+		if err != nil {
+			adscLog.Warnf("failed to store %s config %s/%s: %v", typeURL, c.Namespace, c.Name, err)
+		}
+	}
+
+	existing, err := a.Store.List(gvk, "")
+	if err != nil {
+		adscLog.Warnf("failed to list %s configs: %v", typeURL, err)
+	}
+	for _, c := range existing {
+		if _, f := received[c.Namespace+"/"+c.Name]; !f {
+			_ = a.Store.Delete(gvk, c.Name, c.Namespace)
+		}
+	}
+
+	select {
+	case a.Updates <- typeURL:
+	default:
+	}
+}
+
+// toConfig converts an MCP Resource to a config of the collection.
+func toConfig(schema collection.Schema, r *mcp.Resource) (*model.Config, error) {
+	spec, err := schema.Resource().NewProtoInstance()
+	if err != nil {
+		return nil, err
+	}
+	if err := types.UnmarshalAny(r.Body, spec); err != nil {
+		return nil, err
+	}
+	gvk := schema.Resource().GroupVersionKind()
+	c := &model.Config{
+		ConfigMeta: model.ConfigMeta{
+			Type:            gvk.Kind,
+			Group:           gvk.Group,
+			Version:         gvk.Version,
+			Labels:          r.GetMetadata().GetLabels(),
+			Annotations:     r.GetMetadata().GetAnnotations(),
+			ResourceVersion: r.GetMetadata().GetVersion(),
+		},
+		Spec: spec,
+	}
+	name := r.GetMetadata().GetName()
+	if parts := strings.SplitN(name, "/", 2); len(parts) == 2 {
+		c.Namespace, c.Name = parts[0], parts[1]
+	} else {
+		c.Name = name
+	}
+	if r.GetMetadata().GetCreateTime() != nil {
+		if t, err := types.TimestampFromProto(r.GetMetadata().GetCreateTime()); err == nil {
+			c.CreationTimestamp = t
+		}
+	}
+	return c, nil
+}
+
+// parseGroupVersionKind parses a Group/Version/Kind type URL.
+func parseGroupVersionKind(typeURL string) resource.GroupVersionKind {
+	parts := strings.SplitN(typeURL, "/", 3)
+	if len(parts) != 3 {
+		return resource.GroupVersionKind{}
+	}
+	return resource.GroupVersionKind{Group: parts[0], Version: parts[1], Kind: parts[2]}
+}
+
 // Watch will start watching resources, starting with LDS. Based on the LDS response
 // it will start watching RDS and CDS.
 func (a *ADSC) Watch() {
@@ -0,0 +1,263 @@
+// Copyright 2020 Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package annotation registers the annotations of the Istio configs, which select the Envoy features
+// the networking APIs do not expose. The annotations of the Kubernetes resources are registered in
+// istio.io/api/annotation.
+package annotation
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Instance describes an annotation of Istio configs.
+type Instance struct {
+	// Name of the annotation.
+	Name string
+	// Kinds of the configs the annotation applies to, such as DestinationRule.
+	Kinds []string
+	// Validate checks the value of the annotation.
+	Validate func(value string) error
+}
+
+const (
+	// RedisReadPolicy on a DestinationRule selects the Redis proxy read policy for the service:
+	// MASTER (default), PREFER_MASTER, REPLICA, PREFER_REPLICA or ANY.
+	RedisReadPolicy = "networking.istio.io/redisReadPolicy"
+	// RedisClusterMode set to "true" on a DestinationRule discovers the service as a Redis Cluster:
+	// Envoy uses the service host as a seed and discovers the topology with the CLUSTER SLOTS command.
+	RedisClusterMode = "networking.istio.io/redisClusterMode"
+
+	// OverprovisioningFactor on a DestinationRule sets the overprovisioning factor of the service endpoints,
+	// as a percentage: the endpoints of a priority are considered fully available while the healthy ratio
+	// multiplied by the factor is above 100%. Envoy defaults to 140.
+	OverprovisioningFactor = "networking.istio.io/overprovisioningFactor"
+	// RetryBudgetPercent on a DestinationRule limits the concurrent retries to the destination to this
+	// percentage, from 0 to 100, of the active requests. On the DestinationRule of the root namespace for the
+	// "*" host, it sets the mesh-wide retry budget. "0" disables the retry budget.
+	RetryBudgetPercent = "networking.istio.io/retryBudgetPercent"
+	// HedgeOnPerTryTimeout on a VirtualService lists the HTTP routes, by name, that are hedged on per try
+	// timeouts. "*" hedges all the routes of the virtual service.
+	HedgeOnPerTryTimeout = "networking.istio.io/hedgeOnPerTryTimeout"
+	// StatefulSessionCookie on a VirtualService enables stateful sessions on its gateway routes. Its value is
+	// the name of the session cookie.
+	StatefulSessionCookie = "networking.istio.io/statefulSessionCookie"
+	// ConnectionRateLimit on a DestinationRule limits the rate of the TCP connections, not of the requests,
+	// opened by each client proxy to the service, in the <connections>/<interval> form, e.g. "100/1s".
+	ConnectionRateLimit = "networking.istio.io/connectionRateLimit"
+	// RateLimitDescriptorHeaders on a VirtualService lists the request headers sent to the rate limit service
+	// of the mesh as descriptors of its routes, e.g. "x-user,x-tenant".
+	RateLimitDescriptorHeaders = "networking.istio.io/rateLimitDescriptorHeaders"
+	// ThriftPorts on a VirtualService lists the ports of its hosts that carry Thrift, e.g. "9090,9091", so that
+	// validation rejects the HTTP routes applied to them with matches the Thrift proxy cannot express. Pilot
+	// still selects the protocol of a port from the service port name.
+	ThriftPorts = "networking.istio.io/thriftPorts"
+)
+
+const (
+	destinationRule = "DestinationRule"
+	virtualService  = "VirtualService"
+
+	// minConnectionRateLimitInterval is the smallest token bucket fill interval accepted by Envoy.
+	minConnectionRateLimitInterval = 50 * time.Millisecond
+)
+
+// tokenRegex matches the tokens of RFC 7230, which are the valid header and cookie names.
+var tokenRegex = regexp.MustCompile("^[!#$%&'*+.^_`|~0-9A-Za-z-]+$")
+
+var all = map[string]*Instance{}
+
+func init() {
+	register(&Instance{
+		Name:     RedisReadPolicy,
+		Kinds:    []string{destinationRule},
+		Validate: oneOf("MASTER", "PREFER_MASTER", "REPLICA", "PREFER_REPLICA", "ANY"),
+	})
+	register(&Instance{
+		Name:     RedisClusterMode,
+		Kinds:    []string{destinationRule},
+		Validate: validateBool,
+	})
+	register(&Instance{
+		Name:     OverprovisioningFactor,
+		Kinds:    []string{destinationRule},
+		Validate: validateOverprovisioningFactor,
+	})
+	register(&Instance{
+		Name:     RetryBudgetPercent,
+		Kinds:    []string{destinationRule},
+		Validate: validateRetryBudgetPercent,
+	})
+	register(&Instance{
+		Name:     HedgeOnPerTryTimeout,
+		Kinds:    []string{virtualService},
+		Validate: validateRouteNames,
+	})
+	register(&Instance{
+		Name:     StatefulSessionCookie,
+		Kinds:    []string{virtualService},
+		Validate: validateCookieName,
+	})
+	register(&Instance{
+		Name:  ConnectionRateLimit,
+		Kinds: []string{destinationRule},
+		Validate: func(value string) error {
+			_, _, err := ParseConnectionRateLimit(value)
+			return err
+		},
+	})
+	register(&Instance{
+		Name:     RateLimitDescriptorHeaders,
+		Kinds:    []string{virtualService},
+		Validate: validateHeaderNames,
+	})
+	register(&Instance{
+		Name:  ThriftPorts,
+		Kinds: []string{virtualService},
+		Validate: func(value string) error {
+			_, err := ParsePorts(value)
+			return err
+		},
+	})
+}
+
+func register(i *Instance) {
+	if _, f := all[i.Name]; f {
+		panic(fmt.Sprintf("annotation %s is already registered", i.Name))
+	}
+	all[i.Name] = i
+}
+
+// Lookup returns the registered annotation with the given name, or nil if not found.
+func Lookup(name string) *Instance {
+	return all[name]
+}
+
+// All returns the registered annotations, sorted by name.
+func All() []*Instance {
+	out := make([]*Instance, 0, len(all))
+	for _, i := range all {
+		out = append(out, i)
+	}
+	sort.Slice(out, func(i, j int) bool {
+		return out[i].Name < out[j].Name
+	})
+	return out
+}
+
+// AppliesTo checks if the annotation applies to the configs of the kind.
+func (i *Instance) AppliesTo(kind string) bool {
+	for _, k := range i.Kinds {
+		if k == kind {
+			return true
+		}
+	}
+	return false
+}
+
+// oneOf returns a function validating that the value is one of the values, ignoring case.
+func oneOf(values ...string) func(string) error {
+	return func(value string) error {
+		for _, v := range values {
+			if strings.EqualFold(v, value) {
+				return nil
+			}
+		}
+		return fmt.Errorf("%q is not one of %s", value, strings.Join(values, ", "))
+	}
+}
+
+func validateBool(value string) error {
+	_, err := strconv.ParseBool(value)
+	return err
+}
+
+// ParseConnectionRateLimit parses the value of the ConnectionRateLimit annotation.
+func ParseConnectionRateLimit(value string) (connections uint32, interval time.Duration, err error) {
+	parts := strings.Split(value, "/")
+	if len(parts) != 2 {
+		return 0, 0, fmt.Errorf("expected <connections>/<interval>, got %q", value)
+	}
+	tokens, err := strconv.ParseUint(strings.TrimSpace(parts[0]), 10, 32)
+	if err != nil || tokens == 0 {
+		return 0, 0, fmt.Errorf("invalid number of connections %q", parts[0])
+	}
+	interval, err = time.ParseDuration(strings.TrimSpace(parts[1]))
+	if err != nil {
+		return 0, 0, fmt.Errorf("invalid interval %q: %v", parts[1], err)
+	}
+	if interval < minConnectionRateLimitInterval {
+		return 0, 0, fmt.Errorf("interval %v is shorter than %v", interval, minConnectionRateLimitInterval)
+	}
+	return uint32(tokens), interval, nil
+}
+
+// ParsePorts parses a comma separated list of port numbers, such as the value of the ThriftPorts annotation.
+func ParsePorts(value string) ([]uint32, error) {
+	var ports []uint32
+	for _, p := range strings.Split(value, ",") {
+		port, err := strconv.ParseUint(strings.TrimSpace(p), 10, 16)
+		if err != nil || port == 0 {
+			return nil, fmt.Errorf("%q is not a valid port", p)
+		}
+		ports = append(ports, uint32(port))
+	}
+	return ports, nil
+}
+
+func validateOverprovisioningFactor(value string) error {
+	factor, err := strconv.ParseUint(value, 10, 32)
+	if err != nil || factor == 0 {
+		return fmt.Errorf("%q is not a positive integer", value)
+	}
+	return nil
+}
+
+func validateRetryBudgetPercent(value string) error {
+	percent, err := strconv.ParseFloat(value, 64)
+	if err != nil || percent < 0 || percent > 100 {
+		return fmt.Errorf("%q is not a percentage between 0 and 100", value)
+	}
+	return nil
+}
+
+func validateRouteNames(value string) error {
+	for _, name := range strings.Split(value, ",") {
+		if strings.TrimSpace(name) == "" {
+			return fmt.Errorf("%q has an empty route name", value)
+		}
+	}
+	return nil
+}
+
+func validateCookieName(value string) error {
+	if !tokenRegex.MatchString(value) {
+		return fmt.Errorf("%q is not a valid cookie name", value)
+	}
+	return nil
+}
+
+func validateHeaderNames(value string) error {
+	for _, name := range strings.Split(value, ",") {
+		if !tokenRegex.MatchString(strings.TrimSpace(name)) {
+			return fmt.Errorf("%q is not a valid header name", name)
+		}
+	}
+	return nil
+}
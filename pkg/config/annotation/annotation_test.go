@@ -0,0 +1,73 @@
+// Copyright 2020 Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package annotation
+
+import (
+	"testing"
+)
+
+func TestValidate(t *testing.T) {
+	cases := []struct {
+		name  string
+		value string
+		valid bool
+	}{
+		{RedisReadPolicy, "prefer_replica", true},
+		{RedisReadPolicy, "SLAVE", false},
+		{RedisClusterMode, "true", true},
+		{RedisClusterMode, "yes", false},
+		{OverprovisioningFactor, "200", true},
+		{OverprovisioningFactor, "0", false},
+		{RetryBudgetPercent, "20.5", true},
+		{RetryBudgetPercent, "120", false},
+		{HedgeOnPerTryTimeout, "get, list", true},
+		{HedgeOnPerTryTimeout, "get,", false},
+		{StatefulSessionCookie, "session", true},
+		{StatefulSessionCookie, "my session", false},
+		{ConnectionRateLimit, "100/1s", true},
+		{ConnectionRateLimit, "100/10ms", false},
+		{ConnectionRateLimit, "100", false},
+		{RateLimitDescriptorHeaders, "x-user, X-Tenant", true},
+		{RateLimitDescriptorHeaders, "x-user,", false},
+		{ThriftPorts, "9090, 9091", true},
+		{ThriftPorts, "9090,", false},
+		{ThriftPorts, "70000", false},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name+"="+tc.value, func(t *testing.T) {
+			a := Lookup(tc.name)
+			if a == nil {
+				t.Fatalf("annotation %s is not registered", tc.name)
+			}
+			if err := a.Validate(tc.value); (err == nil) != tc.valid {
+				t.Fatalf("got valid=%v but wanted valid=%v: %v", err == nil, tc.valid, err)
+			}
+		})
+	}
+}
+
+func TestAll(t *testing.T) {
+	all := All()
+	for i := 1; i < len(all); i++ {
+		if all[i-1].Name >= all[i].Name {
+			t.Fatalf("annotations are not sorted: %s before %s", all[i-1].Name, all[i].Name)
+		}
+	}
+	for _, a := range all {
+		if len(a.Kinds) == 0 || a.Validate == nil {
+			t.Errorf("annotation %s has no kinds or validation", a.Name)
+		}
+	}
+}
@@ -24,6 +24,7 @@ import (
 
 	"istio.io/api/networking/v1alpha3"
 
+	"github.com/ghodss/yaml"
 	"github.com/gogo/protobuf/types"
 	"github.com/hashicorp/go-multierror"
 
@@ -260,11 +261,51 @@ func ReadMeshNetworks(filename string) (*meshconfig.MeshNetworks, error) {
 
 // ReadMeshConfig gets mesh configuration from a config file
 func ReadMeshConfig(filename string) (*meshconfig.MeshConfig, error) {
-	yaml, err := ioutil.ReadFile(filename)
+	meshConfig, _, err := readMesh(filename)
+	return meshConfig, err
+}
+
+// MeshExtensions are the settings of the mesh config that MeshConfig does not define yet. They are read from
+// the same YAML, where MeshConfig ignores them, and are reloaded with it.
+type MeshExtensions struct {
+	// ExtAuthzProviders declares the external authorizers of the CUSTOM authorization policies, by name. The
+	// url of an authorizer is grpc://<host>:<port> or http://<host>:<port>[/<path prefix>], where the host is
+	// a service of the mesh.
+	ExtAuthzProviders map[string]string `json:"extAuthzProviders,omitempty"`
+}
+
+// GetExtAuthzProviders returns the declared external authorizers, nil for nil extensions.
+func (e *MeshExtensions) GetExtAuthzProviders() map[string]string {
+	if e == nil {
+		return nil
+	}
+	return e.ExtAuthzProviders
+}
+
+// ParseMeshExtensions returns the MeshExtensions of the input mesh config YAML.
+func ParseMeshExtensions(yml string) (*MeshExtensions, error) {
+	out := &MeshExtensions{}
+	if err := yaml.Unmarshal([]byte(yml), out); err != nil {
+		return nil, multierror.Prefix(err, "failed to parse the mesh config extensions.")
+	}
+	return out, nil
+}
+
+// readMesh gets the mesh configuration and its extensions from a config file.
+func readMesh(filename string) (*meshconfig.MeshConfig, *MeshExtensions, error) {
+	yml, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return nil, nil, multierror.Prefix(err, "cannot read mesh config file")
+	}
+	meshConfig, err := ApplyMeshConfigDefaults(string(yml))
+	if err != nil {
+		return nil, nil, err
+	}
+	extensions, err := ParseMeshExtensions(string(yml))
 	if err != nil {
-		return nil, multierror.Prefix(err, "cannot read mesh config file")
+		return nil, nil, err
 	}
-	return ApplyMeshConfigDefaults(string(yaml))
+	return meshConfig, extensions, nil
 }
 
 // ResolveHostsInNetworksConfig will go through the Gateways addresses for all
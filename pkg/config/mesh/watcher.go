@@ -36,42 +36,53 @@ type Holder interface {
 type Watcher interface {
 	Holder
 
-	// AddMeshHandler registers a callback handler for changes to the mesh config.
+	// MeshExtensions returns the extensions of the mesh config.
+	MeshExtensions() *MeshExtensions
+
+	// AddMeshHandler registers a callback handler for changes to the mesh config, including its extensions.
 	AddMeshHandler(func())
 }
 
 var _ Watcher = &watcher{}
 
 type watcher struct {
-	mutex    sync.Mutex
-	handlers []func()
-	mesh     *meshconfig.MeshConfig
+	mutex      sync.Mutex
+	handlers   []func()
+	mesh       *meshconfig.MeshConfig
+	extensions *MeshExtensions
 }
 
 // NewFixedWatcher creates a new Watcher that always returns the given mesh config. It will never
 // fire any events, since the config never changes.
 func NewFixedWatcher(mesh *meshconfig.MeshConfig) Watcher {
+	return NewFixedWatcherWithExtensions(mesh, &MeshExtensions{})
+}
+
+// NewFixedWatcherWithExtensions is like NewFixedWatcher, with the given mesh config extensions.
+func NewFixedWatcherWithExtensions(mesh *meshconfig.MeshConfig, extensions *MeshExtensions) Watcher {
 	return &watcher{
-		mesh: mesh,
+		mesh:       mesh,
+		extensions: extensions,
 	}
 }
 
 // NewWatcher creates a new Watcher for changes to the given mesh config file. Returns an error
 // if the given file does not exist or failed during parsing.
 func NewWatcher(fileWatcher filewatcher.FileWatcher, filename string) (Watcher, error) {
-	meshConfig, err := ReadMeshConfig(filename)
+	meshConfig, extensions, err := readMesh(filename)
 	if err != nil {
 		return nil, err
 	}
 
 	w := &watcher{
-		mesh: meshConfig,
+		mesh:       meshConfig,
+		extensions: extensions,
 	}
 
 	// Watch the config file for changes and reload if it got modified
 	addFileWatcher(fileWatcher, filename, func() {
 		// Reload the config file
-		meshConfig, err = ReadMeshConfig(filename)
+		meshConfig, extensions, err = readMesh(filename)
 		if err != nil {
 			log.Warnf("failed to read mesh configuration, using default: %v", err)
 			return
@@ -80,6 +91,11 @@ func NewWatcher(fileWatcher filewatcher.FileWatcher, filename string) (Watcher,
 		var handlers []func()
 
 		w.mutex.Lock()
+		if !reflect.DeepEqual(extensions, w.MeshExtensions()) {
+			log.Infof("mesh configuration extensions updated to: %s", spew.Sdump(extensions))
+			atomic.StorePointer((*unsafe.Pointer)(unsafe.Pointer(&w.extensions)), unsafe.Pointer(extensions))
+			handlers = append([]func(){}, w.handlers...)
+		}
 		if !reflect.DeepEqual(meshConfig, w.mesh) {
 			log.Infof("mesh configuration updated to: %s", spew.Sdump(meshConfig))
 			if !reflect.DeepEqual(meshConfig.ConfigSources, w.mesh.ConfigSources) {
@@ -106,7 +122,12 @@ func (w *watcher) Mesh() *meshconfig.MeshConfig {
 	return (*meshconfig.MeshConfig)(atomic.LoadPointer((*unsafe.Pointer)(unsafe.Pointer(&w.mesh))))
 }
 
-// AddMeshHandler registers a callback handler for changes to the mesh config.
+// MeshExtensions returns the latest mesh config extensions.
+func (w *watcher) MeshExtensions() *MeshExtensions {
+	return (*MeshExtensions)(atomic.LoadPointer((*unsafe.Pointer)(unsafe.Pointer(&w.extensions))))
+}
+
+// AddMeshHandler registers a callback handler for changes to the mesh config, including its extensions.
 func (w *watcher) AddMeshHandler(h func()) {
 	w.mutex.Lock()
 	defer w.mutex.Unlock()
@@ -72,6 +72,39 @@ func TestWatcherShouldNotifyHandlers(t *testing.T) {
 	}
 }
 
+func TestWatcherShouldNotifyHandlersOfExtensions(t *testing.T) {
+	g := NewGomegaWithT(t)
+
+	path := newTempFile(t)
+	defer removeSilent(path)
+
+	writeFile(t, path, "ingressClass: foo\n")
+
+	w := newWatcher(t, path)
+	g.Expect(w.MeshExtensions()).To(Equal(&mesh.MeshExtensions{}))
+
+	doneCh := make(chan struct{}, 1)
+
+	var newExtensions *mesh.MeshExtensions
+	w.AddMeshHandler(func() {
+		newExtensions = w.MeshExtensions()
+		close(doneCh)
+	})
+
+	// Only change the extensions, which MeshConfig ignores.
+	writeFile(t, path, "ingressClass: foo\nextAuthzProviders:\n  opa: grpc://opa.istio-system.svc.cluster.local:9191\n")
+
+	select {
+	case <-doneCh:
+		g.Expect(newExtensions).To(Equal(&mesh.MeshExtensions{
+			ExtAuthzProviders: map[string]string{"opa": "grpc://opa.istio-system.svc.cluster.local:9191"},
+		}))
+		g.Expect(w.Mesh().IngressClass).To(Equal("foo"))
+	case <-time.After(time.Second * 5):
+		t.Fatal("timed out waiting for update")
+	}
+}
+
 func newWatcher(t testing.TB, filename string) mesh.Watcher {
 	t.Helper()
 	w, err := mesh.NewWatcher(filewatcher.NewWatcher(), filename)
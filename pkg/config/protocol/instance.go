@@ -44,7 +44,7 @@ const (
 	// TLS traffic is assumed to contain SNI as part of the handshake.
 	TLS Instance = "TLS"
 	// UDP declares that the port uses UDP.
-	// Note that UDP protocol is not currently supported by the proxy.
+	// Note that UDP traffic is forwarded by the proxy without protocol specific features.
 	UDP Instance = "UDP"
 	// Mongo declares that the port carries MongoDB traffic.
 	Mongo Instance = "Mongo"
@@ -52,6 +52,12 @@ const (
 	Redis Instance = "Redis"
 	// MySQL declares that the port carries MySQL traffic.
 	MySQL Instance = "MySQL"
+	// Kafka declares that the port carries Kafka traffic.
+	Kafka Instance = "Kafka"
+	// Postgres declares that the port carries PostgreSQL traffic.
+	Postgres Instance = "Postgres"
+	// ZooKeeper declares that the port carries ZooKeeper traffic.
+	ZooKeeper Instance = "ZooKeeper"
 	// Unsupported - value to signify that the protocol is unsupported.
 	Unsupported Instance = "UnsupportedProtocol"
 )
@@ -85,6 +91,12 @@ func Parse(s string) Instance {
 		return Redis
 	case "mysql":
 		return MySQL
+	case "kafka":
+		return Kafka
+	case "postgres", "postgresql":
+		return Postgres
+	case "zookeeper":
+		return ZooKeeper
 	}
 
 	return Unsupported
@@ -123,7 +135,7 @@ func (i Instance) IsThrift() bool {
 // IsTCP is true for protocols that use TCP as transport protocol
 func (i Instance) IsTCP() bool {
 	switch i {
-	case TCP, HTTPS, TLS, Mongo, Redis, MySQL:
+	case TCP, HTTPS, TLS, Mongo, Redis, MySQL, Kafka, Postgres, ZooKeeper:
 		return true
 	default:
 		return false
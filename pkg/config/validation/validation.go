@@ -21,6 +21,7 @@ import (
 	"net/http"
 	"path"
 	"regexp"
+	"sort"
 	"strconv"
 	"strings"
 	"time"
@@ -41,6 +42,7 @@ import (
 	"istio.io/pkg/log"
 
 	"istio.io/istio/pilot/pkg/features"
+	"istio.io/istio/pkg/config/annotation"
 	"istio.io/istio/pkg/config/constants"
 	"istio.io/istio/pkg/config/gateway"
 	"istio.io/istio/pkg/config/host"
@@ -444,6 +446,88 @@ func validateTLSOptions(tls *networking.ServerTLSSettings) (errs error) {
 	return
 }
 
+// ValidateAnnotations checks the Istio annotations of a config of the given kind, and the parts of its spec
+// they select. Annotations are not part of the spec passed to the validation functions, so the callers with
+// the config metadata, such as the validation webhook, validate them separately.
+func ValidateAnnotations(kind string, annotations map[string]string, spec proto.Message) (errs error) {
+	names := make([]string, 0, len(annotations))
+	for name := range annotations {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		a := annotation.Lookup(name)
+		if a == nil {
+			continue
+		}
+		if !a.AppliesTo(kind) {
+			errs = appendErrors(errs, fmt.Errorf("annotation %s cannot be applied to a %s", name, kind))
+			continue
+		}
+		if err := a.Validate(annotations[name]); err != nil {
+			errs = appendErrors(errs, fmt.Errorf("invalid annotation %s: %v", name, err))
+		}
+	}
+
+	if vs, ok := spec.(*networking.VirtualService); ok && annotations[annotation.ThriftPorts] != "" {
+		if ports, err := annotation.ParsePorts(annotations[annotation.ThriftPorts]); err == nil {
+			errs = appendErrors(errs, validateThriftRoutes(vs, ports))
+		}
+	}
+	return
+}
+
+// validateThriftRoutes checks that the HTTP routes of a virtual service applied to its Thrift ports only use
+// matches the Thrift proxy can express. The other HTTP fields are ignored on Thrift ports, and reported by
+// the virtualservice.ProtocolRouteAnalyzer.
+func validateThriftRoutes(vs *networking.VirtualService, ports []uint32) (errs error) {
+	for i, http := range vs.Http {
+		for _, match := range http.Match {
+			if match == nil {
+				continue
+			}
+			for _, port := range ports {
+				if match.Port != 0 && match.Port != port {
+					continue
+				}
+				if err := ValidateThriftMatch(match); err != nil {
+					errs = appendErrors(errs, fmt.Errorf("http[%d] is applied to the Thrift port %d: %v", i, port, err))
+				}
+				break
+			}
+		}
+	}
+	return
+}
+
+// ValidateThriftMatch checks that an HTTP match can be translated to a Thrift route match. Thrift routes only
+// match the method name (exact uri), the service name (uri prefix) and headers.
+func ValidateThriftMatch(match *networking.HTTPMatchRequest) (errs error) {
+	switch m := match.Uri.GetMatchType().(type) {
+	case nil:
+	case *networking.StringMatch_Exact:
+		if m.Exact == "" {
+			errs = appendErrors(errs, errors.New("thrift method name match cannot be empty"))
+		}
+	case *networking.StringMatch_Prefix:
+		if m.Prefix == "" {
+			errs = appendErrors(errs, errors.New("thrift service name match cannot be empty"))
+		}
+	default:
+		errs = appendErrors(errs, errors.New("thrift uri match must be exact (method name) or prefix (service name)"))
+	}
+	if match.IgnoreUriCase {
+		errs = appendErrors(errs, errors.New("thrift match cannot ignore uri case"))
+	}
+	if match.Scheme != nil || match.Method != nil || match.Authority != nil {
+		errs = appendErrors(errs, errors.New("thrift match cannot match scheme, method or authority"))
+	}
+	if len(match.QueryParams) > 0 {
+		errs = appendErrors(errs, errors.New("thrift match cannot match query parameters"))
+	}
+	return
+}
+
 // ValidateDestinationRule checks proxy policies
 var ValidateDestinationRule = registerValidateFunc("ValidateDestinationRule",
 	func(_, _ string, msg proto.Message) (errs error) {
@@ -2823,6 +2907,8 @@ func validateLocalityLbSetting(lb *networking.LocalityLoadBalancerSetting) error
 		return err
 	}
 
+	// Several failover settings with the same origin region define failover tiers, in order.
+	failovers := make(map[string]struct{}, len(lb.GetFailover()))
 	for _, failover := range lb.GetFailover() {
 		if failover.From == failover.To {
 			return fmt.Errorf("locality lb failover settings must specify different regions")
@@ -2830,6 +2916,11 @@ func validateLocalityLbSetting(lb *networking.LocalityLoadBalancerSetting) error
 		if strings.Contains(failover.To, "*") {
 			return fmt.Errorf("locality lb failover region should not contain '*' wildcard")
 		}
+		key := failover.From + "/" + failover.To
+		if _, f := failovers[key]; f {
+			return fmt.Errorf("locality lb failover from region %s to region %s is duplicated", failover.From, failover.To)
+		}
+		failovers[key] = struct{}{}
 	}
 
 	return nil
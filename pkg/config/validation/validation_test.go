@@ -33,6 +33,7 @@ import (
 	security_beta "istio.io/api/security/v1beta1"
 	api "istio.io/api/type/v1beta1"
 
+	"istio.io/istio/pkg/config/annotation"
 	"istio.io/istio/pkg/config/constants"
 )
 
@@ -1312,7 +1313,7 @@ func TestValidateServerPort(t *testing.T) {
 			""},
 		{"invalid protocol",
 			&networking.Port{
-				Protocol: "kafka",
+				Protocol: "activemq",
 				Number:   1,
 				Name:     "Henry",
 			},
@@ -2473,6 +2474,81 @@ func TestValidateVirtualService(t *testing.T) {
 	}
 }
 
+func TestValidateAnnotations(t *testing.T) {
+	thriftPorts := map[string]string{annotation.ThriftPorts: "9090"}
+	thriftRoute := func(match *networking.HTTPMatchRequest) *networking.VirtualService {
+		return &networking.VirtualService{
+			Hosts: []string{"foo.bar"},
+			Http: []*networking.HTTPRoute{{
+				Match: []*networking.HTTPMatchRequest{match},
+				Route: []*networking.HTTPRouteDestination{{Destination: &networking.Destination{Host: "foo.bar"}}},
+			}},
+		}
+	}
+
+	cases := []struct {
+		name        string
+		kind        string
+		annotations map[string]string
+		spec        proto.Message
+		valid       bool
+	}{
+		{"no annotations", "DestinationRule", nil, nil, true},
+		{"unknown annotation", "DestinationRule", map[string]string{"networking.istio.io/unknown": "x"}, nil, true},
+		{"valid", "DestinationRule", map[string]string{annotation.RedisReadPolicy: "replica"}, nil, true},
+		{"invalid value", "DestinationRule", map[string]string{annotation.RedisClusterMode: "yes"}, nil, false},
+		{"wrong kind", "VirtualService", map[string]string{annotation.RedisClusterMode: "true"}, nil, false},
+		{"virtual service", "VirtualService", map[string]string{
+			annotation.HedgeOnPerTryTimeout:  "get",
+			annotation.StatefulSessionCookie: "session",
+		}, nil, true},
+		{"invalid connection rate limit", "DestinationRule", map[string]string{annotation.ConnectionRateLimit: "100"}, nil, false},
+		{"invalid overprovisioning factor", "DestinationRule", map[string]string{annotation.OverprovisioningFactor: "-1"}, nil, false},
+		{"invalid retry budget", "DestinationRule", map[string]string{annotation.RetryBudgetPercent: "x"}, nil, false},
+		{"thrift ports", "VirtualService", thriftPorts, thriftRoute(&networking.HTTPMatchRequest{
+			Uri: &networking.StringMatch{MatchType: &networking.StringMatch_Exact{Exact: "getUser"}},
+			Headers: map[string]*networking.StringMatch{
+				"x-canary": {MatchType: &networking.StringMatch_Exact{Exact: "true"}},
+			},
+		}), true},
+		{"thrift service name match", "VirtualService", thriftPorts, thriftRoute(&networking.HTTPMatchRequest{
+			Uri: &networking.StringMatch{MatchType: &networking.StringMatch_Prefix{Prefix: "UserService"}},
+		}), true},
+		{"thrift regex uri match", "VirtualService", thriftPorts, thriftRoute(&networking.HTTPMatchRequest{
+			Uri: &networking.StringMatch{MatchType: &networking.StringMatch_Regex{Regex: "get.*"}},
+		}), false},
+		{"thrift empty method name", "VirtualService", thriftPorts, thriftRoute(&networking.HTTPMatchRequest{
+			Uri: &networking.StringMatch{MatchType: &networking.StringMatch_Exact{}},
+		}), false},
+		{"thrift query params match", "VirtualService", thriftPorts, thriftRoute(&networking.HTTPMatchRequest{
+			QueryParams: map[string]*networking.StringMatch{
+				"q": {MatchType: &networking.StringMatch_Exact{Exact: "1"}},
+			},
+		}), false},
+		{"thrift method match", "VirtualService", thriftPorts, thriftRoute(&networking.HTTPMatchRequest{
+			Method: &networking.StringMatch{MatchType: &networking.StringMatch_Exact{Exact: "GET"}},
+		}), false},
+		{"thrift ignore uri case", "VirtualService", thriftPorts, thriftRoute(&networking.HTTPMatchRequest{
+			Uri:           &networking.StringMatch{MatchType: &networking.StringMatch_Exact{Exact: "getUser"}},
+			IgnoreUriCase: true,
+		}), false},
+		{"match of another port", "VirtualService", thriftPorts, thriftRoute(&networking.HTTPMatchRequest{
+			Uri:  &networking.StringMatch{MatchType: &networking.StringMatch_Regex{Regex: "/api/.*"}},
+			Port: 8080,
+		}), true},
+		{"no thrift ports", "VirtualService", nil, thriftRoute(&networking.HTTPMatchRequest{
+			Uri: &networking.StringMatch{MatchType: &networking.StringMatch_Regex{Regex: "get.*"}},
+		}), true},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			if err := ValidateAnnotations(tc.kind, tc.annotations, tc.spec); (err == nil) != tc.valid {
+				t.Fatalf("got valid=%v but wanted valid=%v: %v", err == nil, tc.valid, err)
+			}
+		})
+	}
+}
+
 func TestValidateDestinationRule(t *testing.T) {
 	cases := []struct {
 		name  string
@@ -5441,6 +5517,29 @@ func TestValidateLocalityLbSetting(t *testing.T) {
 			},
 			valid: false,
 		},
+
+		{
+			name: "valid failover tiers",
+			in: &networking.LocalityLoadBalancerSetting{
+				Failover: []*networking.LocalityLoadBalancerSetting_Failover{
+					{From: "region1", To: "region2"},
+					{From: "region1", To: "region3"},
+					{From: "region2", To: "region1"},
+				},
+			},
+			valid: true,
+		},
+
+		{
+			name: "invalid duplicated failover",
+			in: &networking.LocalityLoadBalancerSetting{
+				Failover: []*networking.LocalityLoadBalancerSetting_Failover{
+					{From: "region1", To: "region2"},
+					{From: "region1", To: "region2"},
+				},
+			},
+			valid: false,
+		},
 	}
 
 	for _, c := range cases {
@@ -0,0 +1,210 @@
+// Copyright 2020 Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package ratelimit is a reference implementation of the Envoy rate limit service (RLS), used to test the
+// global rate limiting configured by pilot without an external rate limit service.
+package ratelimit
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"strings"
+	"sync"
+	"time"
+
+	api_ratelimit "github.com/envoyproxy/go-control-plane/envoy/api/v2/ratelimit"
+	rls "github.com/envoyproxy/go-control-plane/envoy/service/ratelimit/v2"
+	"google.golang.org/grpc"
+
+	"istio.io/pkg/log"
+)
+
+const (
+	// DefaultPort for the rate limit service, the port pilot uses if the rateLimitUrl of the mesh config has none.
+	DefaultPort = 8081
+)
+
+var scope = log.RegisterScope("fakes", "Scope for all fakes", 0)
+
+// Entry is a (key, value) entry of a rate limit descriptor.
+type Entry struct {
+	Key   string
+	Value string
+}
+
+// Limit is the number of requests allowed per unit of time for a descriptor.
+type Limit struct {
+	RequestsPerUnit uint32
+	Unit            rls.RateLimitResponse_RateLimit_Unit
+}
+
+type counter struct {
+	window time.Time
+	hits   uint32
+}
+
+// Server is a rate limit service counting the hits of each descriptor in fixed windows of the unit of its
+// limit. Descriptors without a limit are never rate limited. It can be ran either in a cluster or locally.
+type Server struct {
+	port int
+
+	listener net.Listener
+	server   *grpc.Server
+
+	mu       sync.Mutex
+	limits   map[string]Limit
+	counters map[string]*counter
+	// now returns the current time, replaced in tests.
+	now func() time.Time
+}
+
+var _ rls.RateLimitServiceServer = &Server{}
+
+// NewServer returns a new instance of Server.
+func NewServer(port int) *Server {
+	return &Server{
+		port:     port,
+		limits:   map[string]Limit{},
+		counters: map[string]*counter{},
+		now:      time.Now,
+	}
+}
+
+// Port returns the port number of the server.
+func (s *Server) Port() int {
+	return s.port
+}
+
+// Start the gRPC service of the rate limit server.
+func (s *Server) Start() error {
+	listener, err := net.Listen("tcp", fmt.Sprintf(":%d", s.port))
+	if err != nil {
+		return err
+	}
+	s.port = listener.Addr().(*net.TCPAddr).Port
+
+	grpcServer := grpc.NewServer()
+	rls.RegisterRateLimitServiceServer(grpcServer, s)
+
+	go func() {
+		scope.Infof("Starting the rate limit service at port: %d", s.port)
+		_ = grpcServer.Serve(listener)
+	}()
+
+	s.listener = listener
+	s.server = grpcServer
+	return nil
+}
+
+// Close the server.
+func (s *Server) Close() {
+	if s.server != nil {
+		s.server.Stop()
+	}
+}
+
+// SetLimit sets the limit of the descriptor of the domain made of the given entries, in order.
+func (s *Server) SetLimit(domain string, limit Limit, entries ...Entry) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	key := descriptorKey(domain, entries)
+	s.limits[key] = limit
+	delete(s.counters, key)
+}
+
+// Reset removes the limits and the hits counted so far.
+func (s *Server) Reset() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.limits = map[string]Limit{}
+	s.counters = map[string]*counter{}
+}
+
+// ShouldRateLimit implements the Envoy rate limit service. The request is over limit if any of its
+// descriptors is.
+func (s *Server) ShouldRateLimit(_ context.Context, req *rls.RateLimitRequest) (*rls.RateLimitResponse, error) {
+	hits := req.HitsAddend
+	if hits == 0 {
+		hits = 1
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	resp := &rls.RateLimitResponse{OverallCode: rls.RateLimitResponse_OK}
+	now := s.now()
+	for _, descriptor := range req.Descriptors {
+		key := descriptorKey(req.Domain, toEntries(descriptor))
+
+		limit, f := s.limits[key]
+		if !f {
+			resp.Statuses = append(resp.Statuses, &rls.RateLimitResponse_DescriptorStatus{Code: rls.RateLimitResponse_OK})
+			continue
+		}
+
+		window := now.Truncate(unitDuration(limit.Unit))
+		c := s.counters[key]
+		if c == nil || !c.window.Equal(window) {
+			c = &counter{window: window}
+			s.counters[key] = c
+		}
+		c.hits += hits
+
+		status := &rls.RateLimitResponse_DescriptorStatus{
+			Code:         rls.RateLimitResponse_OK,
+			CurrentLimit: &rls.RateLimitResponse_RateLimit{RequestsPerUnit: limit.RequestsPerUnit, Unit: limit.Unit},
+		}
+		if c.hits > limit.RequestsPerUnit {
+			status.Code = rls.RateLimitResponse_OVER_LIMIT
+			resp.OverallCode = rls.RateLimitResponse_OVER_LIMIT
+		} else {
+			status.LimitRemaining = limit.RequestsPerUnit - c.hits
+		}
+		resp.Statuses = append(resp.Statuses, status)
+	}
+
+	scope.Debugf("rate limit request %v: %v", req, resp.OverallCode)
+	return resp, nil
+}
+
+func toEntries(descriptor *api_ratelimit.RateLimitDescriptor) []Entry {
+	entries := make([]Entry, 0, len(descriptor.Entries))
+	for _, e := range descriptor.Entries {
+		entries = append(entries, Entry{Key: e.Key, Value: e.Value})
+	}
+	return entries
+}
+
+func descriptorKey(domain string, entries []Entry) string {
+	parts := make([]string, 0, len(entries)+1)
+	parts = append(parts, domain)
+	for _, e := range entries {
+		parts = append(parts, e.Key+"="+e.Value)
+	}
+	return strings.Join(parts, ",")
+}
+
+func unitDuration(unit rls.RateLimitResponse_RateLimit_Unit) time.Duration {
+	switch unit {
+	case rls.RateLimitResponse_RateLimit_MINUTE:
+		return time.Minute
+	case rls.RateLimitResponse_RateLimit_HOUR:
+		return time.Hour
+	case rls.RateLimitResponse_RateLimit_DAY:
+		return 24 * time.Hour
+	default:
+		return time.Second
+	}
+}
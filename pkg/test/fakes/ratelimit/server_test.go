@@ -0,0 +1,102 @@
+// Copyright 2020 Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ratelimit
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	api_ratelimit "github.com/envoyproxy/go-control-plane/envoy/api/v2/ratelimit"
+	rls "github.com/envoyproxy/go-control-plane/envoy/service/ratelimit/v2"
+	"google.golang.org/grpc"
+)
+
+func request(entries ...Entry) *rls.RateLimitRequest {
+	descriptor := &api_ratelimit.RateLimitDescriptor{}
+	for _, e := range entries {
+		descriptor.Entries = append(descriptor.Entries, &api_ratelimit.RateLimitDescriptor_Entry{Key: e.Key, Value: e.Value})
+	}
+	return &rls.RateLimitRequest{Domain: "istio", Descriptors: []*api_ratelimit.RateLimitDescriptor{descriptor}}
+}
+
+func TestServer(t *testing.T) {
+	s := NewServer(0)
+	if err := s.Start(); err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+
+	conn, err := grpc.Dial(fmt.Sprintf("localhost:%d", s.Port()), grpc.WithInsecure())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	client := rls.NewRateLimitServiceClient(conn)
+
+	route := Entry{Key: "generic_key", Value: "default/reviews"}
+	principal := Entry{Key: "generic_key", Value: "cluster.local/ns/default/sa/productpage"}
+	s.SetLimit("istio", Limit{RequestsPerUnit: 2, Unit: rls.RateLimitResponse_RateLimit_MINUTE}, route, principal)
+
+	expected := []rls.RateLimitResponse_Code{rls.RateLimitResponse_OK, rls.RateLimitResponse_OK, rls.RateLimitResponse_OVER_LIMIT}
+	for i, code := range expected {
+		resp, err := client.ShouldRateLimit(context.Background(), request(route, principal))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if resp.OverallCode != code {
+			t.Errorf("request %d: expected %v, got %v", i, code, resp.OverallCode)
+		}
+	}
+
+	// Descriptors without a limit are not rate limited.
+	resp, err := client.ShouldRateLimit(context.Background(), request(route))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.OverallCode != rls.RateLimitResponse_OK {
+		t.Errorf("expected a descriptor without a limit to be allowed, got %v", resp.OverallCode)
+	}
+}
+
+func TestServerWindows(t *testing.T) {
+	s := NewServer(0)
+	now := time.Date(2020, 5, 1, 10, 0, 0, 0, time.UTC)
+	s.now = func() time.Time { return now }
+
+	route := Entry{Key: "generic_key", Value: "default/reviews"}
+	s.SetLimit("istio", Limit{RequestsPerUnit: 1, Unit: rls.RateLimitResponse_RateLimit_SECOND}, route)
+
+	check := func(expected rls.RateLimitResponse_Code) {
+		t.Helper()
+		resp, err := s.ShouldRateLimit(context.Background(), request(route))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if resp.OverallCode != expected {
+			t.Errorf("expected %v, got %v", expected, resp.OverallCode)
+		}
+	}
+
+	check(rls.RateLimitResponse_OK)
+	check(rls.RateLimitResponse_OVER_LIMIT)
+	now = now.Add(time.Second)
+	check(rls.RateLimitResponse_OK)
+
+	s.Reset()
+	check(rls.RateLimitResponse_OK)
+	check(rls.RateLimitResponse_OK)
+}
@@ -43,6 +43,7 @@ import (
 	"istio.io/istio/pkg/config/schema/collection"
 	"istio.io/istio/pkg/config/schema/collections"
 	"istio.io/istio/pkg/config/schema/resource"
+	"istio.io/istio/pkg/config/validation"
 )
 
 var scope = log.RegisterScope("validationServer", "validation webhook server", 0)
@@ -421,6 +422,11 @@ func (wh *Webhook) admitPilot(request *kubeApiAdmission.AdmissionRequest) *kubeA
 		reportValidationFailed(request, reasonInvalidConfig)
 		return toAdmissionResponse(fmt.Errorf("configuration is invalid: %v", err))
 	}
+	if err := validation.ValidateAnnotations(s.Resource().Kind(), out.Annotations, out.Spec); err != nil {
+		scope.Infof("configuration is invalid: %v", err)
+		reportValidationFailed(request, reasonInvalidConfig)
+		return toAdmissionResponse(fmt.Errorf("configuration is invalid: %v", err))
+	}
 
 	if reason, err := checkFields(request.Object.Raw, request.Kind.Kind, request.Namespace, obj.Name); err != nil {
 		reportValidationFailed(request, reason)
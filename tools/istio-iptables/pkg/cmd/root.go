@@ -92,6 +92,7 @@ func constructConfig() *config.Config {
 		InboundPortsInclude:     viper.GetString(constants.InboundPorts),
 		InboundPortsExclude:     viper.GetString(constants.LocalExcludePorts),
 		OutboundPortsExclude:    viper.GetString(constants.LocalOutboundPortsExclude),
+		OutboundUDPPortsInclude: viper.GetString(constants.OutboundUDPPortsInclude),
 		OutboundIPRangesInclude: viper.GetString(constants.ServiceCidr),
 		OutboundIPRangesExclude: viper.GetString(constants.ServiceExcludeCidr),
 		KubevirtInterfaces:      viper.GetString(constants.KubeVirtInterfaces),
@@ -232,6 +233,15 @@ func init() {
 	}
 	viper.SetDefault(constants.LocalOutboundPortsExclude, "")
 
+	rootCmd.Flags().String(constants.OutboundUDPPortsInclude, "",
+		"Comma separated list of outbound UDP ports for which traffic is to be redirected to the Envoy UDP listeners "+
+			"on the same port (optional). The ports shared by several UDP services have no listener and must not be "+
+			"included. An empty list will disable")
+	if err := viper.BindPFlag(constants.OutboundUDPPortsInclude, rootCmd.Flags().Lookup(constants.OutboundUDPPortsInclude)); err != nil {
+		handleError(err)
+	}
+	viper.SetDefault(constants.OutboundUDPPortsInclude, "")
+
 	rootCmd.Flags().StringP(constants.KubeVirtInterfaces, "k", "",
 		"Comma separated list of virtual interfaces whose inbound traffic (from VM) will be treated as outbound")
 	if err := viper.BindPFlag(constants.KubeVirtInterfaces, rootCmd.Flags().Lookup(constants.KubeVirtInterfaces)); err != nil {
@@ -428,6 +428,21 @@ func (iptConfigurator *IptablesConfigurator) run() {
 			"-j", "REDIRECT", "--to-ports", "15013")
 	}
 
+	// Redirect outbound UDP traffic of the included ports to the Envoy UDP listener bound to the same port
+	// on localhost. Rules are appended after the DNS capture, which takes precedence for port 53.
+	// TODO: add ip6 as well
+	for _, port := range split(iptConfigurator.cfg.OutboundUDPPortsInclude) {
+		for _, gid := range split(iptConfigurator.cfg.ProxyGID) {
+			if gid == "0" {
+				continue
+			}
+			iptConfigurator.iptables.AppendRuleV4(constants.OUTPUT, constants.NAT,
+				"-p", constants.UDP, "--dport", port, "-m", "owner", "--gid-owner", gid, "-j", constants.RETURN)
+		}
+		iptConfigurator.iptables.AppendRuleV4(constants.OUTPUT, constants.NAT,
+			"-p", constants.UDP, "--dport", port, "-j", constants.REDIRECT)
+	}
+
 	iptConfigurator.executeCommands()
 }
 
@@ -604,3 +604,25 @@ func TestHandleInboundIpv4RulesWithUidGid(t *testing.T) {
 		t.Errorf("Output mismatch.\nExpected: %#v\nActual: %#v", expected, actual)
 	}
 }
+
+func TestRulesWithOutboundUDPPorts(t *testing.T) {
+	cfg := constructTestConfig()
+	cfg.OutboundUDPPortsInclude = "53,8125"
+	cfg.ProxyGID = "1337,0"
+	dnsCapture := dnsVar.DefaultValue
+	dnsVar.DefaultValue = ""
+	defer func() { dnsVar.DefaultValue = dnsCapture }()
+
+	iptConfigurator := NewIptablesConfigurator(cfg, &dep.StdoutStubDependencies{})
+	iptConfigurator.run()
+	actual := FormatIptablesCommands(iptConfigurator.iptables.BuildV4())
+	expected := []string{
+		"iptables -t nat -A OUTPUT -p udp --dport 53 -m owner --gid-owner 1337 -j RETURN",
+		"iptables -t nat -A OUTPUT -p udp --dport 53 -j REDIRECT",
+		"iptables -t nat -A OUTPUT -p udp --dport 8125 -m owner --gid-owner 1337 -j RETURN",
+		"iptables -t nat -A OUTPUT -p udp --dport 8125 -j REDIRECT",
+	}
+	if len(actual) < len(expected) || !reflect.DeepEqual(actual[len(actual)-len(expected):], expected) {
+		t.Errorf("Output mismatch. Expected UDP rules: \n%#v ; Actual: \n%#v", expected, actual)
+	}
+}
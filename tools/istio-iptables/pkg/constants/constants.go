@@ -43,6 +43,7 @@ var BuiltInChainsMap = map[string]struct{}{
 // Constants used for generating iptables commands
 const (
 	TCP = "tcp"
+	UDP = "udp"
 
 	TPROXY   = "TPROXY"
 	RETURN   = "RETURN"
@@ -72,6 +73,7 @@ const (
 	ServiceCidr               = "istio-service-cidr"
 	ServiceExcludeCidr        = "istio-service-exclude-cidr"
 	LocalOutboundPortsExclude = "istio-local-outbound-ports-exclude"
+	OutboundUDPPortsInclude   = "istio-outbound-udp-ports-include"
 	EnvoyPort                 = "envoy-port"
 	InboundCapturePort        = "inbound-capture-port"
 	ProxyUID                  = "proxy-uid"